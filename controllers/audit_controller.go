@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetAuditLogsHandler lists audit entries filtered by entity, entity_id, user_id and start_date/end_date (YYYY-MM-DD)
+func GetAuditLogsHandler(c *fiber.Ctx) error {
+	filter := models.AuditFilter{
+		EntityType: c.Query("entity"),
+		Page:       c.QueryInt("page", 1),
+		Limit:      c.QueryInt("limit", 20),
+	}
+
+	if id := c.Query("entity_id"); id != "" {
+		entityID, err := uuid.Parse(id)
+		if err != nil {
+			return utils.BadRequestResponse(c, "invalid entity_id")
+		}
+		filter.EntityID = entityID
+	}
+	if id := c.Query("user_id"); id != "" {
+		actorID, err := uuid.Parse(id)
+		if err != nil {
+			return utils.BadRequestResponse(c, "invalid user_id")
+		}
+		filter.ActorID = actorID
+	}
+	if start := c.Query("start_date"); start != "" {
+		startDate, err := utils.ParseDate(start)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		filter.StartDate = startDate
+	}
+	if end := c.Query("end_date"); end != "" {
+		endDate, err := utils.ParseDate(end)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		filter.EndDate = endDate.AddDate(0, 0, 1) // include the whole end day
+	}
+
+	logs, err := models.GetAuditLogs(filter)
+	if err != nil {
+		return utils.NewErrorResponse(c, "failed to get audit logs", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Audit logs retrieved successfully", logs)
+}
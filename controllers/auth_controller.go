@@ -9,11 +9,24 @@ import (
 	"github.com/dancankarani/safa/services"
 	"github.com/dancankarani/safa/utils"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 type ResponseLogin struct {
-	Employee models.Employee `json:"employee"`
-	Token    string           `json:"token"`
+	Employee     models.Employee `json:"employee"`
+	Token        string          `json:"token"`
+	RefreshToken string          `json:"refresh_token"`
+}
+
+// loginLimiter tracks failed logins per account and per IP
+var loginLimiter = services.NewLoginLimiter(repositories.NewDBAttemptStore(db))
+
+//counts a failed login and writes it to the audit trail
+func loginFailed(email string, employeeID *uuid.UUID, ip, userAgent, reason string) {
+	if err := loginLimiter.RegisterFailure(email, ip); err != nil {
+		log.Println("failed to register login failure:", err.Error())
+	}
+	repositories.RecordLoginAttempt(email, employeeID, ip, userAgent, false, reason)
 }
 
 // Login handles the login request for employees
@@ -31,44 +44,194 @@ func LoginUser(c *fiber.Ctx) error {
 		return utils.NewErrorResponse(c, "Email and password are required", err_str, fiber.StatusBadRequest)
 	}
 
+	ip := c.IP()
+	userAgent := c.Get("User-Agent")
+
+	//reject locked accounts and IPs before checking the password
+	if err := loginLimiter.Check(employee.Email, ip); err != nil {
+		repositories.RecordLoginAttempt(employee.Email, nil, ip, userAgent, false, "locked")
+		err_str["error"] = []string{err.Error()}
+		return utils.NewErrorResponse(c, "account temporarily locked", err_str, fiber.StatusTooManyRequests)
+	}
+
 	//get the employee by email
 	existingEmployee, err := repositories.GetEmployeeByEmail(employee.Email)
 	if err != nil {
+		loginFailed(employee.Email, nil, ip, userAgent, "unknown email")
 		err_str["error"] = []string{"invalid credentials"}
 		return utils.NewErrorResponse(c, "invalid credentials", err_str, fiber.StatusNotFound)
 	}
 
 	err = services.CompareHashAndPassword(existingEmployee.Password, employee.Password)
 	if err != nil {
+		loginFailed(employee.Email, &existingEmployee.ID, ip, userAgent, "wrong password")
 		err_str["error"] = []string{"invalid credentials"}
 		return utils.NewErrorResponse(c, "invalid credentials", err_str, fiber.StatusUnauthorized)
 	}
 
-	// Generate JWT token
-	exp := time.Hour * 24
-	full_name := existingEmployee.FirstName + " " + existingEmployee.LastName
-	token, err := services.GenerateToken(services.Claims{
-		UserID:   &existingEmployee.ID,
-		FullName: full_name,
-		Role:     existingEmployee.Role,
-	}, exp)
+	if err := loginLimiter.RegisterSuccess(employee.Email); err != nil {
+		log.Println("failed to reset login attempts:", err.Error())
+	}
+	repositories.RecordLoginAttempt(employee.Email, &existingEmployee.ID, ip, userAgent, true, "")
+	if err := repositories.PurgeExpiredRevocations(); err != nil {
+		log.Println("failed to purge expired token revocations:", err.Error())
+	}
+
+	// Generate access and refresh tokens
+	tokens, _, err := repositories.IssueTokenPair(db, existingEmployee, ip)
 	if err != nil {
-		err_str["error"] = []string{"failed to generate token"}
+		err_str["error"] = []string{err.Error()}
 		return utils.NewErrorResponse(c, "failed to generate token", err_str, fiber.StatusInternalServerError)
 	}
 
-	//set the token
+	setAuthCookies(c, tokens)
+	return utils.SuccessResponse(c, "Login successful", ResponseLogin{
+		Employee:     existingEmployee,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	})
+}
+
+//sets the access and refresh token cookies
+func setAuthCookies(c *fiber.Ctx, tokens *repositories.TokenPair) {
 	c.Cookie(&fiber.Cookie{
 		Name:     "token",
-		Value:    token,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HTTPOnly: true, 
+		Value:    tokens.AccessToken,
+		Expires:  tokens.AccessExpiresAt,
+		HTTPOnly: true,
 		Secure:   true,
-    	SameSite: "None",
+		SameSite: "None",
 		Path:     "/",
 	})
-	return utils.SuccessResponse(c, "Login successful", ResponseLogin{
-		Employee: existingEmployee,
-		Token:    token,
+	c.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    tokens.RefreshToken,
+		Expires:  tokens.RefreshExpiresAt,
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: "None",
+		Path:     "/api/v1/auth",
 	})
 }
+
+//clears the access and refresh token cookies
+func clearAuthCookies(c *fiber.Ctx) {
+	for name, path := range map[string]string{"token": "/", "refresh_token": "/api/v1/auth"} {
+		c.Cookie(&fiber.Cookie{
+			Name:     name,
+			Value:    "",
+			Expires:  time.Now().Add(-time.Hour),
+			HTTPOnly: true,
+			Secure:   true,
+			SameSite: "None",
+			Path:     path,
+		})
+	}
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+//reads the refresh token from the body or the cookie
+func refreshTokenFromRequest(c *fiber.Ctx) string {
+	var req RefreshRequest
+	_ = c.BodyParser(&req)
+	if req.RefreshToken != "" {
+		return req.RefreshToken
+	}
+	return c.Cookies("refresh_token")
+}
+
+// RefreshToken exchanges a refresh token for a new access and refresh token
+func RefreshToken(c *fiber.Ctx) error {
+	refreshToken := refreshTokenFromRequest(c)
+	if refreshToken == "" {
+		return utils.NewErrorResponse(c, "refresh token is required", map[string][]string{"error": {"refresh token is required"}}, fiber.StatusBadRequest)
+	}
+
+	tokens, err := repositories.RotateRefreshToken(refreshToken, c.IP())
+	if err != nil {
+		clearAuthCookies(c)
+		return utils.NewErrorResponse(c, "unauthorized", map[string][]string{"error": {err.Error()}}, fiber.StatusUnauthorized)
+	}
+
+	setAuthCookies(c, tokens)
+	return utils.SuccessResponse(c, "Token refreshed successfully", tokens)
+}
+
+// LogoutUser revokes the current access token and the refresh token of this session
+func LogoutUser(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	tokenID, _ := c.Locals("token_id").(string)
+	expiresAt, _ := c.Locals("token_expires_at").(time.Time)
+	if userID == nil {
+		return utils.NewErrorResponse(c, "unauthorized", map[string][]string{"error": {"user details not found"}}, fiber.StatusUnauthorized)
+	}
+
+	if err := repositories.RevokeAccessToken(tokenID, *userID, expiresAt, "logout"); err != nil {
+		log.Println("failed to revoke access token:", err.Error())
+		return utils.NewErrorResponse(c, "failed to logout", map[string][]string{"error": {"failed to revoke token"}}, fiber.StatusInternalServerError)
+	}
+	if refreshToken := refreshTokenFromRequest(c); refreshToken != "" {
+		if err := repositories.RevokeRefreshToken(refreshToken); err != nil {
+			log.Println("failed to revoke refresh token:", err.Error())
+		}
+	}
+
+	clearAuthCookies(c)
+	return utils.SendMessage(c, "Logout successful")
+}
+
+// RevokeEmployeeSessionsHandler immediately kills every session of an employee
+func RevokeEmployeeSessionsHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid employee id")
+	}
+	employee, err := models.GetEmployeeByID(c, id)
+	if err != nil {
+		return utils.NotFoundResponse(c, "Employee not found")
+	}
+	if !canAccessStation(c, employee.StationID) {
+		return stationForbidden(c)
+	}
+	if actor, _ := c.Locals("role").(string); !services.CanAssignRole(actor, employee.Role) {
+		return roleForbidden(c)
+	}
+	if err := repositories.RevokeEmployeeSessions(db, id, "revoked by admin"); err != nil {
+		return utils.NewErrorResponse(c, "failed to revoke sessions", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SendMessage(c, "Employee sessions revoked successfully")
+}
+
+// UnlockEmployeeHandler clears the failed login lockout of an employee account
+func UnlockEmployeeHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid employee id")
+	}
+	employee, err := models.GetEmployeeByID(c, id)
+	if err != nil {
+		return utils.NotFoundResponse(c, "Employee not found")
+	}
+	if err := loginLimiter.Unlock(services.AccountKey(employee.Email)); err != nil {
+		return utils.NewErrorResponse(c, "failed to unlock account", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	if ip := c.Query("ip"); ip != "" {
+		if err := loginLimiter.Unlock(services.IPKey(ip)); err != nil {
+			return utils.NewErrorResponse(c, "failed to unlock ip", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+		}
+	}
+	return utils.SendMessage(c, "Account unlocked successfully")
+}
+
+// GetLoginAttemptsHandler lists login attempts of the last 30 days, optionally for one email
+func GetLoginAttemptsHandler(c *fiber.Ctx) error {
+	since := time.Now().AddDate(0, 0, -30)
+	attempts, err := repositories.GetLoginAttempts(c.Query("email"), since, c.QueryInt("limit", 100))
+	if err != nil {
+		return utils.NewErrorResponse(c, "failed to get login attempts", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Login attempts retrieved successfully", attempts)
+}
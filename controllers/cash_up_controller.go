@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"github.com/dancankarani/safa/middleware"
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// CreateCashUpHandler records what an attendant handed over at the end of a shift
+func CreateCashUpHandler(c *fiber.Ctx) error {
+	input := models.CashUpInput{}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	shift, err := models.GetShiftByID(c, input.ShiftID)
+	if err != nil {
+		return utils.NotFoundResponse(c, err.Error())
+	}
+	if !canAccessStation(c, shift.StationID) {
+		return stationForbidden(c)
+	}
+
+	cashUp, err := models.CreateCashUp(c, input)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to record cash-up", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Cash-up recorded successfully", cashUp)
+}
+
+func UpdateCashUpHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid cash-up id")
+	}
+	existing, err := models.GetCashUpByID(c, id)
+	if err != nil {
+		return utils.NotFoundResponse(c, err.Error())
+	}
+	if !canAccessStation(c, existing.StationID) {
+		return stationForbidden(c)
+	}
+	input := models.CashUpInput{}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+
+	cashUp, err := models.UpdateCashUp(c, id, input)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to update cash-up", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Cash-up updated successfully", cashUp)
+}
+
+// GetShiftReconciliationHandler compares meter sales with collections per attendant for the shift in :id
+func GetShiftReconciliationHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid shift id")
+	}
+	report, err := models.GetShiftReconciliation(c, id)
+	if err != nil {
+		return utils.NotFoundResponse(c, err.Error())
+	}
+	if !canAccessStation(c, report.Shift.StationID) {
+		return stationForbidden(c)
+	}
+	return utils.SuccessResponse(c, "Shift reconciliation retrieved successfully", report)
+}
+
+// GetEmployeeShortagesHandler sums cash-up shortages per employee between start_date and end_date (YYYY-MM-DD), optionally for station_id
+func GetEmployeeShortagesHandler(c *fiber.Ctx) error {
+	start, err := utils.ParseDate(c.Query("start_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "start_date: "+err.Error())
+	}
+	end, err := utils.ParseDate(c.Query("end_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "end_date: "+err.Error())
+	}
+
+	var stationID *uuid.UUID
+	if id := c.Query("station_id"); id != "" {
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return utils.BadRequestResponse(c, "invalid station_id")
+		}
+		stationID = &parsed
+	}
+	if own, scoped := middleware.StationScope(c); scoped {
+		stationID = &own
+	}
+
+	shortages, err := models.GetEmployeeShortages(c, stationID, start, end)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get employee shortages", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Employee shortages retrieved successfully", shortages)
+}
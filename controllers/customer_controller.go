@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func AddCustomerHandler(c *fiber.Ctx) error {
+	input := models.CustomerInput{}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	customer, err := models.AddCustomer(c, input)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to add customer", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Customer added successfully", customer)
+}
+
+func UpdateCustomerHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid customer id")
+	}
+	input := models.CustomerInput{}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	customer, err := models.UpdateCustomer(c, id, input)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to update customer", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Customer updated successfully", customer)
+}
+
+func GetCustomersHandler(c *fiber.Ctx) error {
+	customers, err := models.GetCustomers()
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get customers", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Customers retrieved successfully", customers)
+}
+
+func GetCustomerHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid customer id")
+	}
+	customer, err := models.GetCustomerByID(id)
+	if err != nil {
+		return utils.NotFoundResponse(c, err.Error())
+	}
+	return utils.SuccessResponse(c, "Customer retrieved successfully", customer)
+}
+
+func AddCustomerCreditHandler(c *fiber.Ctx) error {
+	input := models.CustomerCreditInput{}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	if !canAccessStation(c, input.StationID) {
+		return stationForbidden(c)
+	}
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	credit, err := models.AddCustomerCredit(c, input, userID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to add customer credit", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Customer credit added successfully", credit)
+}
+
+// GetCustomerCreditsHandler lists the credits of customer :id, only unpaid ones with ?unpaid=true
+func GetCustomerCreditsHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid customer id")
+	}
+	credits, err := models.GetCustomerCredits(id, c.QueryBool("unpaid"))
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get customer credits", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Customer credits retrieved successfully", credits)
+}
+
+// AddCustomerPaymentHandler records a payment, allocated to the credits listed in "allocations" and then oldest first
+func AddCustomerPaymentHandler(c *fiber.Ctx) error {
+	input := models.CustomerPaymentInput{}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	if input.StationID != nil && !canAccessStation(c, *input.StationID) {
+		return stationForbidden(c)
+	}
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	payment, err := models.AddCustomerCreditPayment(c, input, userID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to add customer payment", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Customer payment added successfully", payment)
+}
+
+func GetCustomerPaymentsHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid customer id")
+	}
+	payments, err := models.GetCustomerCreditPayments(id)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get customer payments", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Customer payments retrieved successfully", payments)
+}
+
+// GetCustomerStatementHandler returns the running-balance statement of customer :id between start_date and end_date (YYYY-MM-DD)
+func GetCustomerStatementHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid customer id")
+	}
+	from, err := utils.ParseDate(c.Query("start_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "start_date: "+err.Error())
+	}
+	to, err := utils.ParseDate(c.Query("end_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "end_date: "+err.Error())
+	}
+
+	statement, err := models.GetCustomerStatement(id, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get customer statement", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Customer statement retrieved successfully", statement)
+}
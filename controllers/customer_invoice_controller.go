@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/dancankarani/safa/middleware"
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type GenerateInvoicesRequest struct {
+	CustomerID *uuid.UUID `json:"customer_id"` // omit to bill every customer
+	StationID  *uuid.UUID `json:"station_id"`  // omit to bill credits from every station, managers bill their own
+	StartDate  string     `json:"start_date"`  // YYYY-MM-DD
+	EndDate    string     `json:"end_date"`    // YYYY-MM-DD, inclusive
+}
+
+// GenerateInvoicesHandler bills customers for the credits they took between start_date and end_date
+func GenerateInvoicesHandler(c *fiber.Ctx) error {
+	var req GenerateInvoicesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	from, err := utils.ParseDate(req.StartDate)
+	if err != nil {
+		return utils.BadRequestResponse(c, "start_date: "+err.Error())
+	}
+	to, err := utils.ParseDate(req.EndDate)
+	if err != nil {
+		return utils.BadRequestResponse(c, "end_date: "+err.Error())
+	}
+	if own, scoped := middleware.StationScope(c); scoped {
+		if req.StationID != nil && *req.StationID != own {
+			return stationForbidden(c)
+		}
+		req.StationID = &own
+	}
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+
+	invoices, err := models.GenerateCustomerInvoices(c, req.CustomerID, req.StationID, from, to.AddDate(0, 0, 1), userID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to generate invoices", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Invoices generated successfully", invoices)
+}
+
+// GetInvoicesHandler lists invoices, optionally by ?customer_id, ?status and ?overdue=true
+func GetInvoicesHandler(c *fiber.Ctx) error {
+	filter := models.CustomerInvoiceFilter{StationID: scopedStation(c), Status: c.Query("status"), Overdue: c.QueryBool("overdue")}
+	if id := c.Query("customer_id"); id != "" {
+		customerID, err := uuid.Parse(id)
+		if err != nil {
+			return utils.BadRequestResponse(c, "invalid customer_id")
+		}
+		filter.CustomerID = &customerID
+	}
+	invoices, err := models.GetCustomerInvoices(filter)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get invoices", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Invoices retrieved successfully", invoices)
+}
+
+func GetInvoiceHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid invoice id")
+	}
+	invoice, err := models.GetCustomerInvoiceByID(id)
+	if err != nil {
+		return utils.NotFoundResponse(c, err.Error())
+	}
+	return utils.SuccessResponse(c, "Invoice retrieved successfully", invoice)
+}
+
+func VoidInvoiceHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid invoice id")
+	}
+	existing, err := models.GetCustomerInvoiceByID(id)
+	if err != nil {
+		return utils.NotFoundResponse(c, err.Error())
+	}
+	// a manager may only void an invoice billing nothing but their own station's credits
+	for _, line := range existing.Lines {
+		if line.StationID == nil || !canAccessStation(c, *line.StationID) {
+			return stationForbidden(c)
+		}
+	}
+	invoice, err := models.VoidCustomerInvoice(c, id)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to void invoice", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Invoice voided successfully", invoice)
+}
+
+// GetAgedReceivablesHandler buckets what customers owe by age as of ?as_of (YYYY-MM-DD, default today),
+// per station and overall, optionally for ?station_id
+func GetAgedReceivablesHandler(c *fiber.Ctx) error {
+	stationID, err := stationFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station_id")
+	}
+	asOf := time.Now()
+	if date := c.Query("as_of"); date != "" {
+		if asOf, err = utils.ParseDate(date); err != nil {
+			return utils.BadRequestResponse(c, "as_of: "+err.Error())
+		}
+	}
+
+	report, err := models.GetAgedReceivables(asOf, stationID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get aged receivables", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Aged receivables retrieved successfully", report)
+}
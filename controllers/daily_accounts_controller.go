@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/dancankarani/safa/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetDailyAccountsHandler lists the daily accounts of ?date, a manager only sees their own station's
+func GetDailyAccountsHandler(c *fiber.Ctx) error {
+	return models.GetDailyAccounts(c, scopedStation(c))
+}
+
+// GetMonthlyDailyAccountsHandler sums the daily accounts of the ?yymm month, a manager only sees their own station's
+func GetMonthlyDailyAccountsHandler(c *fiber.Ctx) error {
+	return models.GetMonthlyDailyAccounts(c, scopedStation(c))
+}
+
+// GenerateDailyAccountsHandler generates the day for a station, body {"station_id", "business_day"}
+func GenerateDailyAccountsHandler(c *fiber.Ctx) error {
+	var input struct {
+		StationID   uuid.UUID `json:"station_id"`
+		BusinessDay time.Time `json:"business_day"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if input.StationID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "station_id is required"})
+	}
+	if input.BusinessDay.IsZero() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "business_day is required"})
+	}
+	if !canAccessStation(c, input.StationID) {
+		return stationForbidden(c)
+	}
+
+	report, err := models.GenerateDailyAccounts(c, input.StationID, input.BusinessDay)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(report)
+}
+
+// ApproveDailyAccountHandler approves and locks the daily account in :id
+func ApproveDailyAccountHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	existing, err := models.GetDailyAccountsReport(c, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !canAccessStation(c, existing.DailyAccounts.StationID) {
+		return stationForbidden(c)
+	}
+
+	report, err := models.ApproveDailyAccounts(c, id)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(report)
+}
+
+// GetDailyAccountVariancesHandler returns the daily account in :id with its variances
+func GetDailyAccountVariancesHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	report, err := models.GetDailyAccountsReport(c, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Daily account not found"})
+	}
+	if !canAccessStation(c, report.DailyAccounts.StationID) {
+		return stationForbidden(c)
+	}
+	return c.JSON(report)
+}
@@ -17,7 +17,7 @@ func CreateDippingHandler(c *fiber.Ctx)error {
 		return utils.NewErrorResponse(c,"failed to parse json data",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
 	dipping.ID = uuid.New()
-	createdDipping, err := models.CreateDipping(&dipping)
+	createdDipping, err := models.CreateDipping(c, &dipping)
 	if err != nil {
 		log.Println(err)
 		return utils.NewErrorResponse(c,"failed to create",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
@@ -27,7 +27,7 @@ func CreateDippingHandler(c *fiber.Ctx)error {
 
 //get all dippings
 func GetAllDippingsHandler(c *fiber.Ctx)error {
-	data, err := models.GetAllDippings(c)
+	data, err := models.GetAllDippings(c, scopedStation(c))
 	if err != nil {
 		return utils.NewErrorResponse(c,"failed to get dippings",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
@@ -62,7 +62,7 @@ func GetDippingByDippingDateHandler(c *fiber.Ctx)error {
 	if err != nil {
 		return utils.NewErrorResponse(c,"invalid date format",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
-	data, err := models.GetDippingByDippingDate(date)
+	data, err := models.GetDippingByDippingDate(scopedStation(c), date)
 	if err != nil {
 		return utils.NewErrorResponse(c,"failed to get dippings",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
@@ -72,7 +72,7 @@ func GetDippingByDippingDateHandler(c *fiber.Ctx)error {
 //get dipping by fuel product
 func GetDippingByFuelProductHandler(c *fiber.Ctx)error {
 	id, _ := uuid.Parse(c.Params("id"))
-	data, err := models.GetDippingByFuelProductID(id)
+	data, err := models.GetDippingByFuelProductID(scopedStation(c), id)
 	if err != nil {
 		return utils.NewErrorResponse(c,"failed to get dippings",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
@@ -92,6 +92,9 @@ func UpdateDippingHandler(c *fiber.Ctx)error {
 
 //compare dippings and sales
 func CompareDippingsAndSales(c *fiber.Ctx)error {
+	if stationID, err := uuid.Parse(c.Query("station_id")); err == nil && !canAccessStation(c, stationID) {
+		return stationForbidden(c)
+	}
 	data, err := models.ComparePumpReadingsWithDippings(c)
 	if err != nil {
 		return utils.NewErrorResponse(c,"failed to get dippings",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/dancankarani/safa/middleware"
 	"github.com/dancankarani/safa/models"
 	"github.com/dancankarani/safa/repositories"
 	"github.com/dancankarani/safa/services"
@@ -21,6 +22,14 @@ func CreateEmployee(c *fiber.Ctx) error {
 		err_str["error"] = []string{"failed to parse json data"}
 		return utils.NewErrorResponse(c, "failed to parse json data", err_str, fiber.StatusBadRequest)
 	}
+	// a manager hires into their own station only
+	if stationID, scoped := middleware.StationScope(c); scoped {
+		employee.StationID = stationID
+	}
+	// only admins may create admins and accountants
+	if actor, _ := c.Locals("role").(string); !services.CanAssignRole(actor, employee.Role) {
+		return roleForbidden(c)
+	}
 	//check if employee with this email alredy exist
 	exists, _:= repositories.EmployeeExists(employee.Email)
 	if exists {
@@ -36,6 +45,10 @@ func CreateEmployee(c *fiber.Ctx) error {
 	
 }
 
+func roleForbidden(c *fiber.Ctx) error {
+	return utils.NewErrorResponse(c, "forbidden", map[string][]string{"error": {"only an admin can manage admin and accountant accounts"}}, fiber.StatusForbidden)
+}
+
 // GetEmployeeByID retrieves an employee by their ID
 func GetEmployeeByID(c *fiber.Ctx) error {
 	id,_ := uuid.Parse(c.Params("id"))
@@ -43,12 +56,21 @@ func GetEmployeeByID(c *fiber.Ctx) error {
 	if err != nil {
 		return utils.NotFoundResponse(c, "Employee not found")
 	}
+	if stationID, scoped := middleware.StationScope(c); scoped && employee.StationID != stationID {
+		return utils.NotFoundResponse(c, "Employee not found")
+	}
 	return utils.SuccessResponse(c, "Employee retrieved successfully", employee)
 }
 
 // GetAllEmployees retrieves all employees
 func GetAllEmployees(c *fiber.Ctx) error {
-	employees, err := models.GetAllEmployees(c)
+	var employees *models.ResEmployees
+	var err error
+	if stationID, scoped := middleware.StationScope(c); scoped {
+		employees, err = models.GetEmployeesByStation(c, stationID)
+	} else {
+		employees, err = models.GetAllEmployees(c)
+	}
 	err_str := map[string][]string{}
 	if err != nil {
 		err_str["error"] = []string{err.Error()}
@@ -66,6 +88,18 @@ func UpdateEmployee(c *fiber.Ctx) error {
 		err_str["error"] = []string{"failed to parse json data"}
 		return utils.NewErrorResponse(c, "failed to update employee", err_str, fiber.StatusBadRequest)
 	}
+	existing, err := models.GetEmployeeByID(c, id)
+	if err != nil {
+		return utils.NotFoundResponse(c, "Employee not found")
+	}
+	if !canAccessStation(c, existing.StationID) {
+		return stationForbidden(c)
+	}
+	// a manager can neither touch an admin or accountant nor promote anyone to those roles
+	actor, _ := c.Locals("role").(string)
+	if !services.CanAssignRole(actor, existing.Role) || (employee.Role != "" && !services.CanAssignRole(actor, employee.Role)) {
+		return roleForbidden(c)
+	}
 	employee.ID = id // Ensure the ID is set for the update
 	updated, err := models.UpdateEmployee(c, id, &employee);
 	if err != nil {
@@ -79,10 +113,24 @@ func UpdateEmployee(c *fiber.Ctx) error {
 func DeleteEmployee(c *fiber.Ctx) error {
 	id, _ := uuid.Parse(c.Params("id"))
 	err_str := map[string][]string{}
+	existing, err := models.GetEmployeeByID(c, id)
+	if err != nil {
+		return utils.NotFoundResponse(c, "Employee not found")
+	}
+	if !canAccessStation(c, existing.StationID) {
+		return stationForbidden(c)
+	}
+	if actor, _ := c.Locals("role").(string); !services.CanAssignRole(actor, existing.Role) {
+		return roleForbidden(c)
+	}
 	if err := models.DeleteEmployee(c, id); err != nil {
 		err_str["error"] = []string{err.Error()}
 		return utils.NewErrorResponse(c, "failed to delete employee", err_str, fiber.StatusBadRequest)
 	}
+	// a removed employee must not keep a live session
+	if err := repositories.RevokeEmployeeSessions(db, id, "employee deleted"); err != nil {
+		log.Println("failed to revoke employee sessions:", err.Error())
+	}
 	return utils.SendMessage(c, "Employee deleted successfully")
 }
 
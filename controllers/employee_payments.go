@@ -49,7 +49,7 @@ func UpdateEmployeePayment(c *fiber.Ctx)error{
 	}
 	id, _ := uuid.Parse(c.Params("id"))
 	
-	employeePayment, err := models.UpdateEmployeePayment(&p, id)
+	employeePayment, err := models.UpdateEmployeePayment(c, &p, id)
 	if err != nil {
 		return utils.NewErrorResponse(c,"failed to update employee payment",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
@@ -58,7 +58,7 @@ func UpdateEmployeePayment(c *fiber.Ctx)error{
 
 func DeleteEmployeePayment(c *fiber.Ctx)error{
 	id, _ := uuid.Parse(c.Params("id"))
-	err := models.DeletePayment(id)
+	err := models.DeletePayment(c, id)
 	if err != nil {
 		return utils.NewErrorResponse(c,"failed to delete employee payment",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
@@ -49,7 +49,7 @@ func DeleteExpensesHandler(c *fiber.Ctx) error {
 
 //GET EXPENSES BY DATE
 func GetExpensesByDateHandler(c *fiber.Ctx) error {
-	expenses, err := models.GetExpensesByDate(c)
+	expenses, err := models.GetExpensesByDate(c, scopedStation(c))
 	if err != nil {
 		return utils.NewErrorResponse(c, "Failed to get expenses", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
@@ -58,7 +58,7 @@ func GetExpensesByDateHandler(c *fiber.Ctx) error {
 
 //get expenses
 func GetExpensesHandler(c *fiber.Ctx) error {
-	expenses, err := models.GetExpenses(c)
+	expenses, err := models.GetExpenses(c, scopedStation(c))
 	if err != nil {
 		return utils.NewErrorResponse(c, "Failed to get expenses", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
@@ -77,7 +77,7 @@ func GetExpensesByDurationHandler(c *fiber.Ctx) error {
 	if err != nil {
 		return utils.NewErrorResponse(c, "Invalid end date format", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
-	expenses, err := models.GetExpensesByDuration(c, startDate, endDate)
+	expenses, err := models.GetExpensesByDuration(c, scopedStation(c), startDate, endDate)
 	if err != nil {
 		return utils.NewErrorResponse(c, "Failed to get expenses", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
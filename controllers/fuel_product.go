@@ -58,4 +58,102 @@ func DeleteFuelProductHandler(c *fiber.Ctx) error {
 		return utils.NewErrorResponse(c, "failed to delete", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
 	return utils.SendMessage(c, "Fuel product deleted successfully")
-}
\ No newline at end of file
+}
+
+// GetFuelPriceHistoryHandler lists every price version of station :station_id, optionally for ?fuel_product_id
+func GetFuelPriceHistoryHandler(c *fiber.Ctx) error {
+	stationID, err := uuid.Parse(c.Params("station_id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station id")
+	}
+	var productID *uuid.UUID
+	if raw := c.Query("fuel_product_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return utils.BadRequestResponse(c, "invalid fuel_product_id")
+		}
+		productID = &id
+	}
+	history, err := models.GetFuelPriceHistory(stationID, productID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "failed to get fuel price history", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Fuel price history retrieved successfully", history)
+}
+
+// CreateStationFuelPriceHandler adds price versions, each taking effect now or at its scheduled time
+func CreateStationFuelPriceHandler(c *fiber.Ctx) error {
+	var inputs []models.FuelPriceInput
+	if err := c.BodyParser(&inputs); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	for _, input := range inputs {
+		if !canAccessStation(c, input.StationID) {
+			return stationForbidden(c)
+		}
+	}
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	prices, err := models.ScheduleFuelPrices(c, inputs, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(prices)
+}
+
+// GetStationFuelPricesHandler lists the prices in effect at station :station_id and any scheduled changes
+func GetStationFuelPricesHandler(c *fiber.Ctx) error {
+	stationID, err := uuid.Parse(c.Params("station_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid station ID"})
+	}
+	prices, err := models.GetCurrentFuelPrices(stationID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch prices"})
+	}
+	return c.JSON(prices)
+}
+
+// UpdateStationFuelPriceHandler changes the price of the station and product of version :id. Versions are
+// immutable, so this adds a new one.
+func UpdateStationFuelPriceHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	var input models.FuelPriceInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	current, err := models.GetFuelPriceByID(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Price not found"})
+	}
+	if !canAccessStation(c, current.StationID) {
+		return stationForbidden(c)
+	}
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	price, err := models.ReplaceFuelPrice(c, id, input, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(price)
+}
+
+// DeleteStationFuelPriceHandler withdraws scheduled price version :id before it takes effect
+func DeleteStationFuelPriceHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	current, err := models.GetFuelPriceByID(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Price not found"})
+	}
+	if !canAccessStation(c, current.StationID) {
+		return stationForbidden(c)
+	}
+	if _, err := models.CancelScheduledFuelPrice(c, id); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func GetFuelStockHandler(c *fiber.Ctx) error {
-	fuelStock,err := repositories.GetFuelStocksWithDetails()
+	fuelStock,err := repositories.GetFuelStocksWithDetails(scopedStation(c))
 	if err != nil{
 		return utils.NewErrorResponse(c, "failed to get fuel stock", map[string][]string{"errors": {err.Error()}}, fiber.StatusInternalServerError)
 	}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"github.com/dancankarani/safa/middleware"
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/services"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// stationFilter reads ?station_id and restricts station scoped users to their own station
+func stationFilter(c *fiber.Ctx) (*uuid.UUID, error) {
+	if own, scoped := middleware.StationScope(c); scoped {
+		return &own, nil
+	}
+	id := c.Query("station_id")
+	if id == "" {
+		return nil, nil
+	}
+	stationID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return &stationID, nil
+}
+
+// GetInventoryValuationHandler values stock on hand per tank, product and station, optionally ?station_id
+func GetInventoryValuationHandler(c *fiber.Ctx) error {
+	stationID, err := stationFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station_id")
+	}
+	valuation, err := models.GetInventoryValuation(stationID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to value inventory", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Inventory valuation retrieved successfully", valuation)
+}
+
+// GetCostOfSalesHandler returns cost of sales per tank between start_date and end_date (YYYY-MM-DD), optionally ?station_id
+func GetCostOfSalesHandler(c *fiber.Ctx) error {
+	stationID, err := stationFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station_id")
+	}
+	from, err := utils.ParseDate(c.Query("start_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "start_date: "+err.Error())
+	}
+	to, err := utils.ParseDate(c.Query("end_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "end_date: "+err.Error())
+	}
+
+	rows, err := models.GetCostOfSales(stationID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get cost of sales", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Cost of sales retrieved successfully", rows)
+}
+
+// SetStationCostingMethodHandler sets the costing method of station :id, body {"costing_method"}
+func SetStationCostingMethodHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station id")
+	}
+	var req struct {
+		CostingMethod string `json:"costing_method"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	station, err := models.SetStationCostingMethod(c, id, req.CostingMethod)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to set costing method", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Costing method updated successfully", station)
+}
+
+// GetFuelForecastHandler forecasts consumption and suggests the next order for every tank of station :id.
+// Optional ?window (days of history), ?horizon (days ahead) and ?lead_time_days.
+func GetFuelForecastHandler(c *fiber.Ctx) error {
+	stationID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station id")
+	}
+	params := services.ForecastParams{
+		Window:       c.QueryInt("window", services.DefaultForecastWindow),
+		Horizon:      c.QueryInt("horizon", services.DefaultForecastHorizon),
+		LeadTimeDays: c.QueryInt("lead_time_days", services.DefaultLeadTimeDays),
+	}
+
+	forecast, err := models.GetStationFuelForecast(stationID, params)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to forecast fuel consumption", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Fuel forecast retrieved successfully", forecast)
+}
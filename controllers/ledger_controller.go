@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/dancankarani/safa/repositories"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func GetLedgerAccountsHandler(c *fiber.Ctx) error {
+	accounts, err := repositories.GetLedgerAccounts()
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get accounts", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Accounts retrieved successfully", accounts)
+}
+
+// GetTrialBalanceHandler returns the trial balance at the end of ?as_of (YYYY-MM-DD, default today), optionally for ?station_id
+func GetTrialBalanceHandler(c *fiber.Ctx) error {
+	asOf := time.Now()
+	if date := c.Query("as_of"); date != "" {
+		parsed, err := utils.ParseDate(date)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		asOf = parsed.AddDate(0, 0, 1) // include the whole day
+	}
+
+	var stationID *uuid.UUID
+	if id := c.Query("station_id"); id != "" {
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return utils.BadRequestResponse(c, "invalid station_id")
+		}
+		stationID = &parsed
+	}
+
+	tb, err := repositories.GetTrialBalance(asOf, stationID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get trial balance", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Trial balance retrieved successfully", tb)
+}
+
+// GetAccountStatementHandler returns the movements of account :code between start_date and end_date (YYYY-MM-DD)
+func GetAccountStatementHandler(c *fiber.Ctx) error {
+	from, err := utils.ParseDate(c.Query("start_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "start_date: "+err.Error())
+	}
+	to, err := utils.ParseDate(c.Query("end_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "end_date: "+err.Error())
+	}
+
+	statement, err := repositories.GetAccountStatement(c.Params("code"), from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get account statement", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Account statement retrieved successfully", statement)
+}
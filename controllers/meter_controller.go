@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// pumpForMeters loads pump :id and checks the caller may see its station
+func pumpForMeters(c *fiber.Ctx) (*models.Pump, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, utils.BadRequestResponse(c, "invalid pump id")
+	}
+	var pump models.Pump
+	if err := db.First(&pump, "id = ?", id).Error; err != nil {
+		return nil, utils.NotFoundResponse(c, "pump not found")
+	}
+	if !canAccessStation(c, pump.StationID) {
+		return nil, stationForbidden(c)
+	}
+	return &pump, nil
+}
+
+// RecordMeterResetHandler records a totalizer reset or replacement on pump :id
+func RecordMeterResetHandler(c *fiber.Ctx) error {
+	pump, err := pumpForMeters(c)
+	if pump == nil {
+		return err
+	}
+	var input models.MeterResetInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.BadRequestResponse(c, "invalid request body")
+	}
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+
+	reset, err := models.RecordMeterReset(c, pump.ID, input, userID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to record meter reset", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Meter reset recorded successfully", reset)
+}
+
+func GetMeterResetsHandler(c *fiber.Ctx) error {
+	pump, err := pumpForMeters(c)
+	if pump == nil {
+		return err
+	}
+	resets, err := models.GetMeterResets(pump.ID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get meter resets", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Meter resets retrieved successfully", resets)
+}
+
+// GetMeterContinuityHandler reports gaps and overlaps in pump :id's readings between start_date and end_date (YYYY-MM-DD)
+func GetMeterContinuityHandler(c *fiber.Ctx) error {
+	pump, err := pumpForMeters(c)
+	if pump == nil {
+		return err
+	}
+	from, err := utils.ParseDate(c.Query("start_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "start_date: "+err.Error())
+	}
+	to, err := utils.ParseDate(c.Query("end_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "end_date: "+err.Error())
+	}
+
+	report, err := models.GetMeterContinuity(pump.ID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to check meter continuity", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Meter continuity retrieved successfully", report)
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"log"
+	"time"
+
+	"github.com/dancankarani/safa/repositories"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// ChangePasswordHandler lets a logged in employee change their own password
+func ChangePasswordHandler(c *fiber.Ctx) error {
+	var req ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
+	}
+	if req.OldPassword == "" || req.NewPassword == "" {
+		return utils.BadRequestResponse(c, "old_password and new_password are required")
+	}
+
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	if userID == nil {
+		return utils.NewErrorResponse(c, "unauthorized", map[string][]string{"error": {"user details not found"}}, fiber.StatusUnauthorized)
+	}
+
+	tokens, err := repositories.ChangePassword(*userID, req.OldPassword, req.NewPassword, c.IP())
+	if err != nil {
+		return utils.NewErrorResponse(c, "failed to change password", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+
+	// the token used for this request still carries the old state
+	tokenID, _ := c.Locals("token_id").(string)
+	expiresAt, _ := c.Locals("token_expires_at").(time.Time)
+	if err := repositories.RevokeAccessToken(tokenID, *userID, expiresAt, "password changed"); err != nil {
+		log.Println("failed to revoke access token:", err.Error())
+	}
+
+	setAuthCookies(c, tokens)
+	return utils.SuccessResponse(c, "Password changed successfully", tokens)
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ForgotPasswordHandler emails a reset token if the email belongs to an employee
+func ForgotPasswordHandler(c *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return utils.BadRequestResponse(c, "email is required")
+	}
+	if err := repositories.RequestPasswordReset(req.Email); err != nil {
+		return utils.NewErrorResponse(c, "failed to request password reset", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SendMessage(c, "If the email exists, a password reset link has been sent")
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ResetPasswordHandler sets a new password using the emailed reset token
+func ResetPasswordHandler(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
+	}
+	if req.Token == "" || req.NewPassword == "" {
+		return utils.BadRequestResponse(c, "token and new_password are required")
+	}
+	if err := repositories.ResetPassword(req.Token, req.NewPassword); err != nil {
+		return utils.NewErrorResponse(c, "failed to reset password", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SendMessage(c, "Password reset successfully, please login")
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type ClosePeriodRequest struct {
+	StationID  uuid.UUID `json:"station_id"`
+	PeriodType string    `json:"period_type"` // "day" or "month"
+	Date       string    `json:"date"`        // any day in the period, YYYY-MM-DD
+}
+
+// ClosePeriodHandler closes a business day or month of a station
+func ClosePeriodHandler(c *fiber.Ctx) error {
+	var req ClosePeriodRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	date, err := utils.ParseDate(req.Date)
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+	if !canAccessStation(c, req.StationID) {
+		return stationForbidden(c)
+	}
+
+	period, err := models.ClosePeriod(c, req.StationID, req.PeriodType, date)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to close period", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Period closed successfully", period)
+}
+
+// ReopenPeriodHandler reopens the closed period in :id, body {"reason"}
+func ReopenPeriodHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid period id")
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+
+	period, err := models.ReopenPeriod(c, id, req.Reason)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to reopen period", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Period reopened successfully", period)
+}
+
+// GetStationPeriodsHandler lists the closed and reopened periods of the station in :id
+func GetStationPeriodsHandler(c *fiber.Ctx) error {
+	stationID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station id")
+	}
+	periods, err := models.GetPeriodCloses(c, stationID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get periods", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Periods retrieved successfully", periods)
+}
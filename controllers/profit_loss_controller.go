@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetProfitAndLossHandler returns the P&L of station :id between start_date and end_date (YYYY-MM-DD, inclusive).
+// Cost of sales is valued with the station's costing method, ?format=csv downloads a CSV.
+func GetProfitAndLossHandler(c *fiber.Ctx) error {
+	stationID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station id")
+	}
+	from, err := utils.ParseDate(c.Query("start_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "start_date: "+err.Error())
+	}
+	to, err := utils.ParseDate(c.Query("end_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "end_date: "+err.Error())
+	}
+	if to.Before(from) {
+		return utils.BadRequestResponse(c, "end_date must not be before start_date")
+	}
+
+	pl, err := models.GetProfitAndLoss(c, stationID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to build profit and loss", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+
+	if c.Query("format") == "csv" {
+		data, err := profitAndLossCSV(pl)
+		if err != nil {
+			return utils.NewErrorResponse(c, "Failed to build CSV", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+		}
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="profit-loss-%s-%s.csv"`, c.Query("start_date"), c.Query("end_date")))
+		return c.Send(data)
+	}
+	return utils.SuccessResponse(c, "Profit and loss retrieved successfully", pl)
+}
+
+func profitAndLossCSV(pl *models.ProfitAndLoss) ([]byte, error) {
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	rows := [][]string{
+		{"Station", pl.StationName},
+		{"From", pl.From.Format("2006-01-02")},
+		{"To", pl.To.AddDate(0, 0, -1).Format("2006-01-02")},
+		{"Costing method", pl.CostingMethod},
+		{},
+		{"Product", "Liters", "Revenue", "Cost of sales", "Gross margin", "Margin %"},
+	}
+	for _, p := range pl.Products {
+		rows = append(rows, []string{p.FuelProduct, money(p.Liters), money(p.Revenue), money(p.CostOfSales), money(p.GrossMargin), money(p.MarginPercent)})
+	}
+	rows = append(rows,
+		[]string{"Total", "", money(pl.Revenue), money(pl.CostOfSales), money(pl.GrossMargin), ""},
+		[]string{},
+		[]string{"Operating expenses", "Amount"},
+	)
+	for _, e := range pl.OperatingExpenses {
+		rows = append(rows, []string{e.ExpenseType, money(e.Amount)})
+	}
+	rows = append(rows,
+		[]string{"Total expenses", money(pl.TotalExpenses)},
+		[]string{"Payroll", money(pl.Payroll)},
+		[]string{},
+		[]string{"Net profit", money(pl.NetProfit)},
+	)
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -28,7 +28,7 @@ func UpdatePumpReadingsHandler(c *fiber.Ctx) error {
 	if err := c.BodyParser(&pumpReadings); err != nil {
 		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
-	updatedPumpReadings, err := models.UpdatePumpReadings(c, id, pumpReadings)
+	updatedPumpReadings, err := repositories.UpdatePumpReadings(c, id, pumpReadings)
 	if err != nil {
 		return utils.NewErrorResponse(c, "Failed to update pump readings", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
@@ -37,7 +37,7 @@ func UpdatePumpReadingsHandler(c *fiber.Ctx) error {
 
 func DeletePumpReadingsHandler(c *fiber.Ctx) error {
 	id, _ := uuid.Parse(c.Params("id"))
-	err := models.DeletePumpReadings(c, id)
+	err := repositories.DeletePumpReadings(c, id)
 	if err != nil {
 		return utils.NewErrorResponse(c, "Failed to delete pump readings", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
@@ -73,7 +73,7 @@ func GetOrderedPumpReadingsHandler(c *fiber.Ctx) error {
 
 func GetAllSalesByDateHandler(c *fiber.Ctx) error {
 	
-	sales, err := models.GetTotalSalesByDate(c)
+	sales, err := models.GetTotalSalesByDate(c, scopedStation(c))
 	if err != nil {
 		return utils.NewErrorResponse(c, "Failed to get sales", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// supplierFilter reads the optional ?supplier_id query parameter
+func supplierFilter(c *fiber.Ctx) (*uuid.UUID, error) {
+	id := c.Query("supplier_id")
+	if id == "" {
+		return nil, nil
+	}
+	supplierID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return &supplierID, nil
+}
+
+// purchaseOrderForStation loads purchase order :id and checks the caller may see its station
+func purchaseOrderForStation(c *fiber.Ctx) (*models.PurchaseOrder, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, utils.BadRequestResponse(c, "invalid purchase order id")
+	}
+	order, err := models.GetPurchaseOrderByID(id)
+	if err != nil {
+		return nil, utils.NotFoundResponse(c, err.Error())
+	}
+	if !canAccessStation(c, order.StationID) {
+		return nil, stationForbidden(c)
+	}
+	return order, nil
+}
+
+func CreatePurchaseOrderHandler(c *fiber.Ctx) error {
+	input := models.PurchaseOrderInput{}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	if !canAccessStation(c, input.StationID) {
+		return stationForbidden(c)
+	}
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	order, err := models.CreatePurchaseOrder(c, input, userID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to create purchase order", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Purchase order created successfully", order)
+}
+
+// GetPurchaseOrdersHandler lists purchase orders, optionally by ?supplier_id, ?station_id and ?status
+func GetPurchaseOrdersHandler(c *fiber.Ctx) error {
+	stationID, err := stationFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station_id")
+	}
+	supplierID, err := supplierFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid supplier_id")
+	}
+	orders, err := models.GetPurchaseOrders(models.PurchaseOrderFilter{SupplierID: supplierID, StationID: stationID, Status: c.Query("status")})
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get purchase orders", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Purchase orders retrieved successfully", orders)
+}
+
+// GetOutstandingOrdersHandler groups orders awaiting delivery by supplier, optionally by ?supplier_id and ?station_id
+func GetOutstandingOrdersHandler(c *fiber.Ctx) error {
+	stationID, err := stationFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station_id")
+	}
+	supplierID, err := supplierFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid supplier_id")
+	}
+	orders, err := models.GetOutstandingOrders(supplierID, stationID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get outstanding orders", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Outstanding orders retrieved successfully", orders)
+}
+
+func GetPurchaseOrderHandler(c *fiber.Ctx) error {
+	order, err := purchaseOrderForStation(c)
+	if order == nil {
+		return err
+	}
+	return utils.SuccessResponse(c, "Purchase order retrieved successfully", order)
+}
+
+func UpdatePurchaseOrderHandler(c *fiber.Ctx) error {
+	order, err := purchaseOrderForStation(c)
+	if order == nil {
+		return err
+	}
+	input := models.PurchaseOrderInput{}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	order, err = models.UpdatePurchaseOrder(c, order.ID, input)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to update purchase order", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Purchase order updated successfully", order)
+}
+
+func CancelPurchaseOrderHandler(c *fiber.Ctx) error {
+	order, err := purchaseOrderForStation(c)
+	if order == nil {
+		return err
+	}
+	order, err = models.CancelPurchaseOrder(c, order.ID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to cancel purchase order", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Purchase order cancelled successfully", order)
+}
+
+func ClosePurchaseOrderHandler(c *fiber.Ctx) error {
+	order, err := purchaseOrderForStation(c)
+	if order == nil {
+		return err
+	}
+	order, err = models.ClosePurchaseOrder(c, order.ID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to close purchase order", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Purchase order closed successfully", order)
+}
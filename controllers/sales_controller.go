@@ -31,7 +31,7 @@ func UpdateSalesHandler(c *fiber.Ctx) error {
 }
 
 func GetSalesHandler(c *fiber.Ctx) error {
-	sales, err := models.GetSales(c)
+	sales, err := models.GetSales(c, scopedStation(c))
 	if err != nil {
 		log.Println(err)
 		return utils.NewErrorResponse(c, "Failed to get sales", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
@@ -51,7 +51,7 @@ func GetSalesByDateHandler(c *fiber.Ctx) error {
 		return utils.NewErrorResponse(c, "Invalid date format", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
 	
-	sales, err := models.GetSalesByDate(c, start_date, end_date)
+	sales, err := models.GetSalesByDate(c, scopedStation(c), start_date, end_date)
 	if err != nil {
 		log.Println(err)
 		return utils.NewErrorResponse(c, "Failed to get sales", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
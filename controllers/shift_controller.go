@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/dancankarani/safa/middleware"
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// canAccessStation reports whether the caller may work on data of the station
+func canAccessStation(c *fiber.Ctx, stationID uuid.UUID) bool {
+	own, scoped := middleware.StationScope(c)
+	return !scoped || own == stationID
+}
+
+// scopedStation returns the caller's own station when their role is limited to one, and nil otherwise.
+func scopedStation(c *fiber.Ctx) *uuid.UUID {
+	if own, scoped := middleware.StationScope(c); scoped {
+		return &own
+	}
+	return nil
+}
+
+func stationForbidden(c *fiber.Ctx) error {
+	return utils.NewErrorResponse(c, "forbidden", map[string][]string{"error": {"you do not have access to this station"}}, fiber.StatusForbidden)
+}
+
+// OpenShiftHandler opens a shift for a station
+func OpenShiftHandler(c *fiber.Ctx) error {
+	input := models.OpenShiftInput{}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	if !canAccessStation(c, input.StationID) {
+		return stationForbidden(c)
+	}
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	if userID == nil {
+		return utils.NewErrorResponse(c, "unauthorized", map[string][]string{"error": {"user details not found"}}, fiber.StatusUnauthorized)
+	}
+
+	shift, err := models.OpenShift(c, input, *userID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to open shift", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Shift opened successfully", shift)
+}
+
+// CloseShiftHandler closes a shift once every pump has its closing reading
+func CloseShiftHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid shift id")
+	}
+	shift, err := models.GetShiftByID(c, id)
+	if err != nil {
+		return utils.NotFoundResponse(c, err.Error())
+	}
+	if !canAccessStation(c, shift.StationID) {
+		return stationForbidden(c)
+	}
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	if userID == nil {
+		return utils.NewErrorResponse(c, "unauthorized", map[string][]string{"error": {"user details not found"}}, fiber.StatusUnauthorized)
+	}
+
+	closed, err := models.CloseShift(c, id, *userID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to close shift", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Shift closed successfully", closed)
+}
+
+func GetShiftHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid shift id")
+	}
+	shift, err := models.GetShiftByID(c, id)
+	if err != nil {
+		return utils.NotFoundResponse(c, err.Error())
+	}
+	if !canAccessStation(c, shift.StationID) {
+		return stationForbidden(c)
+	}
+	return utils.SuccessResponse(c, "Shift retrieved successfully", shift)
+}
+
+// GetOpenShiftHandler returns the open shift of the station in :id
+func GetOpenShiftHandler(c *fiber.Ctx) error {
+	stationID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station id")
+	}
+	shift, err := models.GetOpenShift(c, stationID)
+	if err != nil {
+		return utils.NotFoundResponse(c, err.Error())
+	}
+	return utils.SuccessResponse(c, "Open shift retrieved successfully", shift)
+}
+
+// GetStationShiftsHandler lists the shifts of the station in :id, ?page=&limit=
+func GetStationShiftsHandler(c *fiber.Ctx) error {
+	stationID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station id")
+	}
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "10"))
+	shifts, err := models.GetShiftsByStation(c, stationID, page, limit)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get shifts", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Shifts retrieved successfully", shifts)
+}
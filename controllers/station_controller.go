@@ -3,6 +3,7 @@ package controllers
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/dancankarani/safa/middleware"
 	"github.com/dancankarani/safa/models"
 	"github.com/dancankarani/safa/utils"
 )
@@ -21,6 +22,13 @@ func NewStationHandler(c *fiber.Ctx) error{
 }
 
 func ReadAllStationsController(c *fiber.Ctx) error{
+	if stationID, scoped := middleware.StationScope(c); scoped {
+		station, err := models.GetStationByID(c, stationID)
+		if err != nil {
+			return utils.NewErrorResponse(c,"failed to get all stations",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+		}
+		return utils.SuccessResponse(c,"Stations retrieved successfully",[]models.Station{*station})
+	}
 	stations, err := models.GetAllStations(c)
 	if err != nil {
 		return utils.NewErrorResponse(c,"failed to get all stations",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
@@ -39,7 +47,7 @@ func ReadStationByIDController(c *fiber.Ctx) error{
 
 func GetAllSalesInStationHandler(c *fiber.Ctx)error{
 	
-	sales, err := models.GetSummationOfSalesAndLiters(c)
+	sales, err := models.GetSummationOfSalesAndLiters(c, scopedStation(c))
 	if err != nil{
 		return utils.NewErrorResponse(c,"failed to get sales",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
@@ -48,7 +56,7 @@ func GetAllSalesInStationHandler(c *fiber.Ctx)error{
 
 func GetStationExpensesHandler(c *fiber.Ctx)error{
 	
-	expenses, err := models.GetMonthlySummationOfExpenses(c)
+	expenses, err := models.GetMonthlySummationOfExpenses(c, scopedStation(c))
 	if err != nil{
 		return utils.NewErrorResponse(c,"failed to get expenses",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
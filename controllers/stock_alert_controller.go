@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetStockAlertsHandler is the polling endpoint for stock alerts, filtered by ?station_id, ?status
+// and ?since (RFC3339, returns only alerts raised after it)
+func GetStockAlertsHandler(c *fiber.Ctx) error {
+	stationID, err := stationFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station_id")
+	}
+	filter := models.StockAlertFilter{StationID: stationID, Status: c.Query("status")}
+	if since := c.Query("since"); since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return utils.BadRequestResponse(c, "since must be an RFC3339 timestamp")
+		}
+	}
+
+	alerts, err := models.GetStockAlerts(filter)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get stock alerts", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Stock alerts retrieved successfully", alerts)
+}
+
+func AcknowledgeStockAlertHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid alert id")
+	}
+	alert, err := models.GetStockAlertByID(id)
+	if err != nil {
+		return utils.NotFoundResponse(c, err.Error())
+	}
+	if !canAccessStation(c, alert.StationID) {
+		return stationForbidden(c)
+	}
+	alert, err = models.AcknowledgeStockAlert(c, id)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to acknowledge stock alert", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Stock alert acknowledged successfully", alert)
+}
@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"time"
+
 	"github.com/dancankarani/safa/database"
 	"github.com/dancankarani/safa/models"
 	"github.com/dancankarani/safa/repositories"
@@ -80,13 +82,60 @@ func GetSupplierBalanceHandler(c *fiber.Ctx)error{
 
 //get all balances handler
 func GetAllSupplierBalancesHandler(c *fiber.Ctx)error{
-	data, err := repositories.GetSupplierDebts( db)
+	data, err := repositories.GetSupplierDebts(db, nil, scopedStation(c))
 	if err != nil {
 		return utils.NewErrorResponse(c, "Failed to get supplier balances", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
 	return utils.SuccessResponse(c, "Supplier balances retrieved successfully", data)
 }
 
+// GetSupplierStatementHandler returns the statement of account of supplier :id between start_date and end_date (YYYY-MM-DD)
+func GetSupplierStatementHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid supplier id")
+	}
+	from, err := utils.ParseDate(c.Query("start_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "start_date: "+err.Error())
+	}
+	to, err := utils.ParseDate(c.Query("end_date"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "end_date: "+err.Error())
+	}
+
+	statement, err := models.GetSupplierStatement(id, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get supplier statement", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Supplier statement retrieved successfully", statement)
+}
+
+// GetAgedPayablesHandler buckets unpaid supplies by delivery date as of ?as_of (YYYY-MM-DD, default today),
+// optionally for ?supplier_id and ?station_id
+func GetAgedPayablesHandler(c *fiber.Ctx) error {
+	stationID, err := stationFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station_id")
+	}
+	supplierID, err := supplierFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid supplier_id")
+	}
+	asOf := time.Now()
+	if date := c.Query("as_of"); date != "" {
+		if asOf, err = utils.ParseDate(date); err != nil {
+			return utils.BadRequestResponse(c, "as_of: "+err.Error())
+		}
+	}
+
+	report, err := models.GetAgedPayables(asOf, supplierID, stationID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get aged payables", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Aged payables retrieved successfully", report)
+}
+
 //add supplier payments
 func AddSupplierPayments(c *fiber.Ctx)error{
 	payment, error := repositories.AddSupplierPayments(c)
@@ -94,4 +143,54 @@ func AddSupplierPayments(c *fiber.Ctx)error{
 		return utils.NewErrorResponse(c, "Failed to add supplier payment", map[string][]string{"error": {error.Error()}}, fiber.StatusBadRequest)
 	}
 	return utils.SuccessResponse(c, "Supplier payment added successfully", payment)
-}
\ No newline at end of file
+}
+// GetSupplierPaymentsHandler lists supplier payments, optionally for ?supplier_id
+func GetSupplierPaymentsHandler(c *fiber.Ctx) error {
+	supplierID, err := supplierFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid supplier_id")
+	}
+	payments, err := repositories.GetSupplierPayments(supplierID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get supplier payments", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Supplier payments retrieved successfully", payments)
+}
+
+// ReverseSupplierPaymentHandler reverses payment :id recorded by mistake, body {"reason"}
+func ReverseSupplierPaymentHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid payment id")
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	payment, err := repositories.ReverseSupplierPayment(c, id, req.Reason, userID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to reverse supplier payment", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Supplier payment reversed successfully", payment)
+}
+
+// RecordSupplierNoteHandler records a credit or debit note against supplier :id, optionally for litres returned
+func RecordSupplierNoteHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid supplier id")
+	}
+	input := models.SupplierNoteInput{}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	note, err := repositories.RecordSupplierNote(c, id, input, userID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to record supplier note", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Supplier note recorded successfully", note)
+}
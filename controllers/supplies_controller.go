@@ -44,7 +44,7 @@ func DeleteSupplyHandler(c *fiber.Ctx)error{
 
 //get paginated supplies
 func GetSuppliesHandler(c *fiber.Ctx)error{
-	data, err := repositories.GetAllSupplies(c)
+	data, err := repositories.GetAllSupplies(c, scopedStation(c))
 	if err != nil{
 		return utils.NewErrorResponse(c,"failed to get supplies",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
@@ -60,10 +60,71 @@ func GetSupplyByIDHandler(c *fiber.Ctx)error{
 	return utils.SuccessResponse(c,"Supply retrieved successfully", data)
 }
 
+// GetSupplierDebtsHandler lists supplier debt entries, optionally for ?supplier_id
 func GetSupplierDebtsHandler(c *fiber.Ctx)error{
-	data, err := repositories.GetSupplierDebts(db)
+	supplierID, err := supplierFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid supplier_id")
+	}
+	data, err := repositories.GetSupplierDebts(db, supplierID, scopedStation(c))
 	if err != nil{
 		return utils.NewErrorResponse(c,"failed to get supplier debts",map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
 	}
 	return utils.SuccessResponse(c,"Supply debts retrieved successfully", data)
-}
\ No newline at end of file
+}
+// VerifyDeliveryHandler records the before and after dips of supply :id's offload and reconciles it
+func VerifyDeliveryHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid supply id")
+	}
+	supply, err := repositories.GetSupplyByID(c, id)
+	if err != nil {
+		return utils.NotFoundResponse(c, "supply not found")
+	}
+	if !canAccessStation(c, supply.StationID) {
+		return stationForbidden(c)
+	}
+	input := repositories.DeliveryVerificationInput{}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	verification, err := repositories.VerifyDelivery(c, id, input, userID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to verify delivery", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Delivery verified successfully", verification)
+}
+
+func GetDeliveryVerificationHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid supply id")
+	}
+	verification, err := repositories.GetDeliveryVerification(id)
+	if err != nil {
+		return utils.NotFoundResponse(c, err.Error())
+	}
+	if !canAccessStation(c, verification.StationID) {
+		return stationForbidden(c)
+	}
+	return utils.SuccessResponse(c, "Delivery verification retrieved successfully", verification)
+}
+
+// GetDeliveryVerificationsHandler lists verified deliveries by ?station_id and ?supplier_id, ?short=true for short deliveries only
+func GetDeliveryVerificationsHandler(c *fiber.Ctx) error {
+	stationID, err := stationFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid station_id")
+	}
+	supplierID, err := supplierFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid supplier_id")
+	}
+	verifications, err := repositories.GetDeliveryVerifications(stationID, supplierID, c.QueryBool("short"))
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get delivery verifications", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Delivery verifications retrieved successfully", verifications)
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/services"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// UploadTankCalibrationHandler replaces the strapping chart of tank :id from a CSV of height_cm,liters,
+// sent either as the multipart field "file" or as the raw request body
+func UploadTankCalibrationHandler(c *fiber.Ctx) error {
+	tankID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid tank id")
+	}
+
+	var csvData io.Reader = bytes.NewReader(c.Body())
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return utils.BadRequestResponse(c, "failed to read uploaded file")
+		}
+		defer f.Close()
+		csvData = f
+	}
+
+	points, err := services.ParseCalibrationCSV(csvData)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Invalid calibration chart", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	rows, err := models.SaveTankCalibration(c, tankID, points)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to save calibration chart", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Calibration chart saved successfully", rows)
+}
+
+func GetTankCalibrationHandler(c *fiber.Ctx) error {
+	tankID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid tank id")
+	}
+	points, err := models.GetTankCalibration(db, tankID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get calibration chart", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+	return utils.SuccessResponse(c, "Calibration chart retrieved successfully", points)
+}
+
+// ConvertDipHandler converts ?height_cm to litres, or ?liters to a dip height, for tank :id
+func ConvertDipHandler(c *fiber.Ctx) error {
+	tankID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid tank id")
+	}
+	points, err := models.GetTankCalibration(db, tankID)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to get calibration chart", map[string][]string{"error": {err.Error()}}, fiber.StatusInternalServerError)
+	}
+
+	result := services.CalibrationPoint{}
+	if c.Query("height_cm") != "" {
+		result.HeightCm = c.QueryFloat("height_cm")
+		result.Liters, err = services.VolumeAtHeight(points, result.HeightCm)
+	} else {
+		result.Liters = c.QueryFloat("liters")
+		result.HeightCm, err = services.HeightAtVolume(points, result.Liters)
+	}
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+	return utils.SuccessResponse(c, "Dip converted successfully", result)
+}
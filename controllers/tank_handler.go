@@ -84,3 +84,27 @@ func DeleteTankHandler(c *fiber.Ctx)error{
 	}
 	return utils.SendMessage(c,"Tank deleted successfully")
 }
+
+// SetTankThresholdsHandler sets the reorder and high levels (litres) that raise stock alerts for tank :id
+func SetTankThresholdsHandler(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "invalid tank id")
+	}
+	input := models.TankThresholds{}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.NewErrorResponse(c, "Failed to parse JSON data", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	tank, err := models.GetTankByID(c, id)
+	if err != nil {
+		return utils.NotFoundResponse(c, err.Error())
+	}
+	if !canAccessStation(c, tank.StationID) {
+		return stationForbidden(c)
+	}
+	tank, err = models.SetTankThresholds(c, id, input)
+	if err != nil {
+		return utils.NewErrorResponse(c, "Failed to update tank thresholds", map[string][]string{"error": {err.Error()}}, fiber.StatusBadRequest)
+	}
+	return utils.SuccessResponse(c, "Tank thresholds updated successfully", tank)
+}
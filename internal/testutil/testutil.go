@@ -0,0 +1,56 @@
+// Package testutil holds the fixtures shared by the database backed tests of the models and repositories packages
+package testutil
+
+import (
+	"testing"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// OpenDB opens a fresh, empty in-memory database that is closed when the test ends.
+// Callers point their package at it and migrate it.
+func OpenDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	conn, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	// one connection so every query sees the same in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return conn
+}
+
+// Ctx is a request context acting as userID
+func Ctx(t *testing.T, userID uuid.UUID) *fiber.Ctx {
+	t.Helper()
+	app := fiber.New()
+	c := app.AcquireCtx(&fasthttp.RequestCtx{})
+	t.Cleanup(func() { app.ReleaseCtx(c) })
+	c.Locals("user_id", &userID)
+	return c
+}
+
+// AccountBalance is the net debit of a ledger account and its sub accounts
+func AccountBalance(t *testing.T, conn *gorm.DB, code string) float64 {
+	t.Helper()
+	var net float64
+	if err := conn.Table("journal_lines").
+		Select("COALESCE(SUM(journal_lines.debit - journal_lines.credit), 0)").
+		Joins("JOIN ledger_accounts ON ledger_accounts.id = journal_lines.account_id").
+		Where("ledger_accounts.code = ? OR ledger_accounts.parent_code = ?", code, code).
+		Scan(&net).Error; err != nil {
+		t.Fatalf("balance of %s: %v", code, err)
+	}
+	return ledger.Round2(net)
+}
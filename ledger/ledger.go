@@ -0,0 +1,306 @@
+// Package ledger is the double-entry general ledger every money movement posts to.
+// It only depends on gorm so both models and repositories can post inside their own transactions.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// account types
+const (
+	Asset     = "asset"
+	Liability = "liability"
+	Equity    = "equity"
+	Revenue   = "revenue"
+	Expense   = "expense"
+)
+
+// chart of accounts
+const (
+	CashAccount        = "1000"
+	MpesaAccount       = "1010"
+	BankAccount        = "1020"
+	ReceivablesAccount = "1100" // control account, one sub account per customer
+	InventoryAccount   = "1200"
+	PayablesAccount    = "2000" // control account, one sub account per supplier
+	EquityAccount      = "3000"
+	FuelSalesAccount   = "4000"
+	CostOfSalesAccount = "5000"
+	ExpensesAccount    = "6000"
+	SalariesAccount    = "6100"
+)
+
+// source types of journal entries
+const (
+	SourceSupply               = "supply"
+	SourceSupplierPayment      = "supplier_payment"
+	SourcePumpReading          = "pump_reading"
+	SourceExpense              = "expense"
+	SourceEmployeePayment      = "employee_payment"
+	SourceDeliveryVerification = "delivery_verification"
+	SourceCustomerCredit       = "customer_credit"
+	SourceCustomerPayment      = "customer_payment"
+	SourceSupplierNote         = "supplier_note"
+)
+
+type Account struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	Code       string     `json:"code" gorm:"size:50;not null;uniqueIndex"`
+	Name       string     `json:"name" gorm:"size:150;not null"`
+	Type       string     `json:"type" gorm:"size:20;not null"`
+	ParentCode string     `json:"parent_code" gorm:"size:50;index"`
+	SupplierID *uuid.UUID `json:"supplier_id,omitempty" gorm:"type:varchar(36);index"`
+	CustomerID *uuid.UUID `json:"customer_id,omitempty" gorm:"type:varchar(36);index"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (Account) TableName() string { return "ledger_accounts" }
+
+type JournalEntry struct {
+	ID          uuid.UUID     `json:"id" gorm:"type:varchar(36);primaryKey"`
+	Date        time.Time     `json:"date" gorm:"not null;index"`
+	Description string        `json:"description" gorm:"size:255"`
+	SourceType  string        `json:"source_type" gorm:"size:30;index:idx_journal_source"`
+	SourceID    *uuid.UUID    `json:"source_id" gorm:"type:varchar(36);index:idx_journal_source"`
+	StationID   *uuid.UUID    `json:"station_id" gorm:"type:varchar(36);index"`
+	CreatedBy   *uuid.UUID    `json:"created_by" gorm:"type:varchar(36)"`
+	ReversalOf  *uuid.UUID    `json:"reversal_of,omitempty" gorm:"type:varchar(36);index"` // entry this one cancels
+	ReversedBy  *uuid.UUID    `json:"reversed_by,omitempty" gorm:"type:varchar(36)"`       // entry that cancelled this one
+	CreatedAt   time.Time     `json:"created_at" gorm:"autoCreateTime"`
+	Lines       []JournalLine `json:"lines" gorm:"foreignKey:EntryID;references:ID"`
+}
+
+func (JournalEntry) TableName() string { return "journal_entries" }
+
+type JournalLine struct {
+	ID        uuid.UUID `json:"id" gorm:"type:varchar(36);primaryKey"`
+	EntryID   uuid.UUID `json:"entry_id" gorm:"type:varchar(36);not null;index"`
+	AccountID uuid.UUID `json:"account_id" gorm:"type:varchar(36);not null;index"`
+	Debit     float64   `json:"debit" gorm:"type:decimal(14,2);not null;default:0"`
+	Credit    float64   `json:"credit" gorm:"type:decimal(14,2);not null;default:0"`
+	Memo      string    `json:"memo" gorm:"size:255"`
+	Account   *Account  `json:"account,omitempty" gorm:"foreignKey:AccountID;references:ID"`
+}
+
+func (JournalLine) TableName() string { return "journal_lines" }
+
+var standardAccounts = []Account{
+	{Code: CashAccount, Name: "Cash on Hand", Type: Asset},
+	{Code: MpesaAccount, Name: "M-Pesa", Type: Asset},
+	{Code: BankAccount, Name: "Bank", Type: Asset},
+	{Code: ReceivablesAccount, Name: "Accounts Receivable", Type: Asset},
+	{Code: InventoryAccount, Name: "Fuel Inventory", Type: Asset},
+	{Code: PayablesAccount, Name: "Accounts Payable", Type: Liability},
+	{Code: EquityAccount, Name: "Owner's Equity", Type: Equity},
+	{Code: FuelSalesAccount, Name: "Fuel Sales", Type: Revenue},
+	{Code: CostOfSalesAccount, Name: "Cost of Fuel Sold", Type: Expense},
+	{Code: ExpensesAccount, Name: "Operating Expenses", Type: Expense},
+	{Code: SalariesAccount, Name: "Salaries and Wages", Type: Expense},
+}
+
+// Migrate creates the ledger tables and seeds the chart of accounts
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&Account{}, &JournalEntry{}, &JournalLine{}); err != nil {
+		return err
+	}
+	for _, a := range standardAccounts {
+		if _, err := ensureAccount(db, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ensureAccount(tx *gorm.DB, a Account) (*Account, error) {
+	var existing Account
+	err := tx.Where("code = ?", a.Code).First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	a.ID = uuid.New()
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&a).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("code = ?", a.Code).First(&existing).Error; err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// AccountByCode returns a chart account, creating standard ones on first use
+func AccountByCode(tx *gorm.DB, code string) (*Account, error) {
+	for _, a := range standardAccounts {
+		if a.Code == code {
+			return ensureAccount(tx, a)
+		}
+	}
+	var account Account
+	if err := tx.Where("code = ?", code).First(&account).Error; err != nil {
+		return nil, fmt.Errorf("account %s not found", code)
+	}
+	return &account, nil
+}
+
+// SupplierAccount returns the payables sub account of a supplier
+func SupplierAccount(tx *gorm.DB, supplierID uuid.UUID, name string) (*Account, error) {
+	return ensureAccount(tx, Account{
+		Code:       PayablesAccount + "-" + supplierID.String(),
+		Name:       "Payable - " + name,
+		Type:       Liability,
+		ParentCode: PayablesAccount,
+		SupplierID: &supplierID,
+	})
+}
+
+// CustomerAccount returns the receivables sub account of a customer
+func CustomerAccount(tx *gorm.DB, customerID uuid.UUID, name string) (*Account, error) {
+	return ensureAccount(tx, Account{
+		Code:       ReceivablesAccount + "-" + customerID.String(),
+		Name:       "Receivable - " + name,
+		Type:       Asset,
+		ParentCode: ReceivablesAccount,
+		CustomerID: &customerID,
+	})
+}
+
+// TenderAccount maps a payment method to the cash, M-Pesa or bank account
+func TenderAccount(method string) string {
+	switch method {
+	case "mpesa", "m-pesa", "M-Pesa", "MPESA":
+		return MpesaAccount
+	case "bank", "transfer", "cheque", "eft", "rtgs":
+		return BankAccount
+	}
+	return CashAccount
+}
+
+// Debit and Credit build journal lines
+func Debit(account *Account, amount float64, memo string) JournalLine {
+	return JournalLine{AccountID: account.ID, Debit: amount, Memo: memo}
+}
+
+func Credit(account *Account, amount float64, memo string) JournalLine {
+	return JournalLine{AccountID: account.ID, Credit: amount, Memo: memo}
+}
+
+// Validate checks that every line is one sided and positive and that debits equal credits
+func Validate(lines []JournalLine) error {
+	if len(lines) < 2 {
+		return errors.New("a journal entry needs at least two lines")
+	}
+	var debits, credits float64
+	for _, l := range lines {
+		if l.Debit < 0 || l.Credit < 0 {
+			return errors.New("journal line amounts cannot be negative")
+		}
+		if (l.Debit == 0) == (l.Credit == 0) {
+			return errors.New("a journal line must have either a debit or a credit")
+		}
+		debits += l.Debit
+		credits += l.Credit
+	}
+	if math.Abs(debits-credits) > 0.005 {
+		return fmt.Errorf("journal entry is not balanced: debits %.2f, credits %.2f", debits, credits)
+	}
+	return nil
+}
+
+// Post validates and saves a journal entry with its lines.
+// Zero amount lines are dropped so callers can post optional legs unconditionally.
+func Post(tx *gorm.DB, entry *JournalEntry) error {
+	lines := entry.Lines[:0]
+	for _, l := range entry.Lines {
+		if l.Debit != 0 || l.Credit != 0 {
+			lines = append(lines, l)
+		}
+	}
+	entry.Lines = lines
+	if len(entry.Lines) == 0 {
+		return nil // nothing to post
+	}
+	if err := Validate(entry.Lines); err != nil {
+		return err
+	}
+
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	if entry.Date.IsZero() {
+		entry.Date = time.Now()
+	}
+	for i := range entry.Lines {
+		entry.Lines[i].ID = uuid.New()
+		entry.Lines[i].EntryID = entry.ID
+	}
+	if err := tx.Omit("Lines.Account").Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to post journal entry: %w", err)
+	}
+	return nil
+}
+
+// ReversalLines swaps the debits and credits of lines
+func ReversalLines(lines []JournalLine) []JournalLine {
+	reversed := make([]JournalLine, 0, len(lines))
+	for _, l := range lines {
+		reversed = append(reversed, JournalLine{AccountID: l.AccountID, Debit: l.Credit, Credit: l.Debit, Memo: l.Memo})
+	}
+	return reversed
+}
+
+// Reverse cancels every live entry posted for a source with an opposite entry dated date.
+// Entries are never edited or deleted, so a corrected document is reversed and posted again.
+func Reverse(tx *gorm.DB, sourceType string, sourceID uuid.UUID, date time.Time, createdBy *uuid.UUID) error {
+	return ReverseWithReason(tx, sourceType, sourceID, date, createdBy, "")
+}
+
+// ReverseWithReason is Reverse recording why the entries were cancelled on the reversing entries
+func ReverseWithReason(tx *gorm.DB, sourceType string, sourceID uuid.UUID, date time.Time, createdBy *uuid.UUID, reason string) error {
+	var entries []JournalEntry
+	if err := tx.Preload("Lines").
+		Where("source_type = ? AND source_id = ? AND reversal_of IS NULL AND reversed_by IS NULL", sourceType, sourceID).
+		Find(&entries).Error; err != nil {
+		return err
+	}
+	for _, original := range entries {
+		description := "Reversal: " + original.Description
+		if reason != "" {
+			description += " - " + reason
+		}
+		if len(description) > 255 {
+			description = description[:255]
+		}
+		reversal := &JournalEntry{
+			Date:        date,
+			Description: description,
+			SourceType:  original.SourceType,
+			SourceID:    original.SourceID,
+			StationID:   original.StationID,
+			CreatedBy:   createdBy,
+			ReversalOf:  &original.ID,
+			Lines:       ReversalLines(original.Lines),
+		}
+		if err := Post(tx, reversal); err != nil {
+			return err
+		}
+		if err := tx.Model(&JournalEntry{}).Where("id = ?", original.ID).Update("reversed_by", reversal.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Round2 rounds an amount to cents, the precision every posting is kept at
+func Round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
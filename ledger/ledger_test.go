@@ -0,0 +1,53 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestValidate(t *testing.T) {
+	cash := &Account{ID: uuid.New()}
+	sales := &Account{ID: uuid.New()}
+
+	tests := []struct {
+		name    string
+		lines   []JournalLine
+		wantErr bool
+	}{
+		{"balanced", []JournalLine{Debit(cash, 100, ""), Credit(sales, 100, "")}, false},
+		{"split credit", []JournalLine{Debit(cash, 100, ""), Credit(sales, 60, ""), Credit(sales, 40, "")}, false},
+		{"unbalanced", []JournalLine{Debit(cash, 100, ""), Credit(sales, 90, "")}, true},
+		{"single line", []JournalLine{Debit(cash, 100, "")}, true},
+		{"negative", []JournalLine{Debit(cash, -100, ""), Credit(sales, -100, "")}, true},
+		{"both sides", []JournalLine{{AccountID: cash.ID, Debit: 10, Credit: 10}, Credit(sales, 0.01, "")}, true},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.lines); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSignedBalance(t *testing.T) {
+	if got := signedBalance(Asset, 150, 50); got != 100 {
+		t.Errorf("asset balance = %v, want 100", got)
+	}
+	if got := signedBalance(Liability, 50, 150); got != 100 {
+		t.Errorf("liability balance = %v, want 100", got)
+	}
+}
+
+func TestReversalLines(t *testing.T) {
+	inventory := &Account{ID: uuid.New()}
+	payable := &Account{ID: uuid.New()}
+	lines := []JournalLine{Debit(inventory, 250, ""), Credit(payable, 250, "supplier")}
+
+	reversed := ReversalLines(lines)
+	if reversed[0].Credit != 250 || reversed[0].Debit != 0 || reversed[1].Debit != 250 || reversed[1].Memo != "supplier" {
+		t.Fatalf("unexpected reversal %+v", reversed)
+	}
+	if err := Validate(reversed); err != nil {
+		t.Fatalf("reversal should balance: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package ledger
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DebitNormal reports whether the account type increases with debits
+func DebitNormal(accountType string) bool {
+	return accountType == Asset || accountType == Expense
+}
+
+// signedBalance turns debit and credit totals into a balance on the account's normal side
+func signedBalance(accountType string, debit, credit float64) float64 {
+	if DebitNormal(accountType) {
+		return debit - credit
+	}
+	return credit - debit
+}
+
+type TrialBalanceRow struct {
+	AccountID uuid.UUID `json:"account_id"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Debit     float64   `json:"debit"`  // debit balance
+	Credit    float64   `json:"credit"` // credit balance
+}
+
+type TrialBalance struct {
+	AsOf        time.Time         `json:"as_of"`
+	Rows        []TrialBalanceRow `json:"rows"`
+	TotalDebit  float64           `json:"total_debit"`
+	TotalCredit float64           `json:"total_credit"`
+	Balanced    bool              `json:"balanced"`
+}
+
+// GetTrialBalance lists every account with a balance at asOf, optionally only entries of one station
+func GetTrialBalance(db *gorm.DB, asOf time.Time, stationID *uuid.UUID) (*TrialBalance, error) {
+	type row struct {
+		AccountID uuid.UUID
+		Code      string
+		Name      string
+		Type      string
+		Debit     float64
+		Credit    float64
+	}
+	query := db.Table("journal_lines").
+		Select(`ledger_accounts.id AS account_id, ledger_accounts.code, ledger_accounts.name, ledger_accounts.type,
+			COALESCE(SUM(journal_lines.debit), 0) AS debit, COALESCE(SUM(journal_lines.credit), 0) AS credit`).
+		Joins("JOIN journal_entries ON journal_entries.id = journal_lines.entry_id").
+		Joins("JOIN ledger_accounts ON ledger_accounts.id = journal_lines.account_id").
+		Where("journal_entries.date < ?", asOf)
+	if stationID != nil {
+		query = query.Where("journal_entries.station_id = ?", *stationID)
+	}
+	var rows []row
+	if err := query.
+		Group("ledger_accounts.id, ledger_accounts.code, ledger_accounts.name, ledger_accounts.type").
+		Order("ledger_accounts.code").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	tb := TrialBalance{AsOf: asOf}
+	for _, r := range rows {
+		net := r.Debit - r.Credit
+		tbRow := TrialBalanceRow{AccountID: r.AccountID, Code: r.Code, Name: r.Name, Type: r.Type}
+		if net >= 0 {
+			tbRow.Debit = Round2(net)
+		} else {
+			tbRow.Credit = Round2(-net)
+		}
+		if tbRow.Debit == 0 && tbRow.Credit == 0 {
+			continue
+		}
+		tb.TotalDebit += tbRow.Debit
+		tb.TotalCredit += tbRow.Credit
+		tb.Rows = append(tb.Rows, tbRow)
+	}
+	tb.TotalDebit = Round2(tb.TotalDebit)
+	tb.TotalCredit = Round2(tb.TotalCredit)
+	tb.Balanced = tb.TotalDebit == tb.TotalCredit
+	return &tb, nil
+}
+
+type StatementLine struct {
+	EntryID     uuid.UUID  `json:"entry_id"`
+	Date        time.Time  `json:"date"`
+	Description string     `json:"description"`
+	SourceType  string     `json:"source_type"`
+	SourceID    *uuid.UUID `json:"source_id"`
+	Debit       float64    `json:"debit"`
+	Credit      float64    `json:"credit"`
+	Balance     float64    `json:"balance"`
+}
+
+type AccountStatement struct {
+	Account        Account         `json:"account"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	OpeningBalance float64         `json:"opening_balance"`
+	Lines          []StatementLine `json:"lines"`
+	ClosingBalance float64         `json:"closing_balance"`
+}
+
+// GetAccountStatement lists the movements of an account in [from, to) with a running balance.
+// Balances are on the account's normal side, so a payable shows what is owed as positive.
+func GetAccountStatement(db *gorm.DB, code string, from, to time.Time) (*AccountStatement, error) {
+	var account Account
+	if err := db.Where("code = ?", code).First(&account).Error; err != nil {
+		return nil, errors.New("account not found")
+	}
+
+	var opening struct {
+		Debit  float64
+		Credit float64
+	}
+	if err := db.Table("journal_lines").
+		Select("COALESCE(SUM(journal_lines.debit), 0) AS debit, COALESCE(SUM(journal_lines.credit), 0) AS credit").
+		Joins("JOIN journal_entries ON journal_entries.id = journal_lines.entry_id").
+		Where("journal_lines.account_id = ? AND journal_entries.date < ?", account.ID, from).
+		Scan(&opening).Error; err != nil {
+		return nil, err
+	}
+
+	var lines []StatementLine
+	if err := db.Table("journal_lines").
+		Select(`journal_entries.id AS entry_id, journal_entries.date, journal_entries.description,
+			journal_entries.source_type, journal_entries.source_id, journal_lines.debit, journal_lines.credit`).
+		Joins("JOIN journal_entries ON journal_entries.id = journal_lines.entry_id").
+		Where("journal_lines.account_id = ? AND journal_entries.date >= ? AND journal_entries.date < ?", account.ID, from, to).
+		Order("journal_entries.date, journal_entries.created_at").
+		Scan(&lines).Error; err != nil {
+		return nil, err
+	}
+
+	statement := AccountStatement{
+		Account:        account,
+		From:           from,
+		To:             to,
+		OpeningBalance: Round2(signedBalance(account.Type, opening.Debit, opening.Credit)),
+	}
+	balance := statement.OpeningBalance
+	for i := range lines {
+		balance = Round2(balance + signedBalance(account.Type, lines[i].Debit, lines[i].Credit))
+		lines[i].Balance = balance
+	}
+	statement.Lines = lines
+	statement.ClosingBalance = balance
+	return &statement, nil
+}
+
+// GetAccounts lists the chart of accounts ordered by code
+func GetAccounts(db *gorm.DB) ([]Account, error) {
+	var accounts []Account
+	if err := db.Order("code").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
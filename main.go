@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/dancankarani/safa/database"
 	"github.com/dancankarani/safa/endpoints"
 	"github.com/dancankarani/safa/models"
@@ -12,5 +14,6 @@ func main (){
 	//go services.SendEmail("karanidancan120@gmail.com","dsa","dsad")
 	// Initialize your application here
 	models.MigrateDb()
+	go models.RunStockAlertDispatcher(time.Minute)
 	endpoints.RegisterEndpoint()
 }
\ No newline at end of file
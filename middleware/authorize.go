@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"log"
+
+	"github.com/dancankarani/safa/services"
+	"github.com/dancankarani/safa/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// RequirePermission only lets the request through when the logged in role holds the permission.
+// Must be registered after JWTMiddleware.
+func RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		if !services.HasPermission(role, permission) {
+			log.Printf("role %q denied %s", role, permission)
+			return utils.NewErrorResponse(c, "forbidden", map[string][]string{"error": {"you do not have permission to perform this action"}}, fiber.StatusForbidden)
+		}
+		return c.Next()
+	}
+}
+
+// AuthorizeResource checks "<resource>:read" for GET requests and "<resource>:write" for everything else
+func AuthorizeResource(resource string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return RequirePermission(resource + ":" + services.ActionForMethod(c.Method()))(c)
+	}
+}
+
+// StationScope returns the station the logged in user is restricted to.
+// The second value is false when the user may see every station.
+func StationScope(c *fiber.Ctx) (uuid.UUID, bool) {
+	role, _ := c.Locals("role").(string)
+	if !services.IsStationScoped(role) {
+		return uuid.Nil, false
+	}
+	stationID, _ := c.Locals("station_id").(uuid.UUID)
+	return stationID, true
+}
+
+// RequireStationAccess rejects requests whose station route param is outside the user's station
+func RequireStationAccess(param string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		stationID, scoped := StationScope(c)
+		if !scoped {
+			return c.Next()
+		}
+		requested, err := uuid.Parse(c.Params(param))
+		if err != nil || requested != stationID {
+			return utils.NewErrorResponse(c, "forbidden", map[string][]string{"error": {"you can only access your own station"}}, fiber.StatusForbidden)
+		}
+		return c.Next()
+	}
+}
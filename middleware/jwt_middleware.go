@@ -3,11 +3,20 @@ package middleware
 import (
 	"log"
 	"strings"
+	"time"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/dancankarani/safa/repositories"
 	"github.com/dancankarani/safa/utils"
 	"github.com/dancankarani/safa/services"
 )
 
+// routes reachable while a password change is pending
+var passwordChangeAllowed = map[string]bool{
+    "/api/v1/auth/change-password": true,
+    "/api/v1/auth/logout":          true,
+}
+
 func JWTMiddleware(c *fiber.Ctx) error {
     // Check for token in cookies first
     tokenString := c.Cookies("token")
@@ -32,11 +41,31 @@ func JWTMiddleware(c *fiber.Ctx) error {
         log.Println(err.Error())
         return utils.NewErrorResponse(c, "unauthorized",map[string][]string{"errors":{err.Error()}},fiber.StatusInternalServerError)
     }
+    // Reject tokens revoked on logout or when the employee's sessions were killed
+    userID := uuid.Nil
+    if claims.UserID != nil {
+        userID = *claims.UserID
+    }
+    revoked, err := repositories.IsTokenRevoked(claims.Id, userID, time.Unix(claims.IssuedAt, 0))
+    if err != nil {
+        log.Println(err.Error())
+        return utils.NewErrorResponse(c, "unauthorized",map[string][]string{"errors":{"failed to verify token"}},fiber.StatusInternalServerError)
+    }
+    if revoked {
+        return utils.NewErrorResponse(c, "unauthorized",map[string][]string{"error":{"token has been revoked"}}, fiber.StatusUnauthorized)
+    }
+    // Accounts created with a generated password may only change it or log out
+    if claims.MustChangePassword && !passwordChangeAllowed[c.Path()] {
+        return utils.NewErrorResponse(c, "password change required",map[string][]string{"error":{"you must change your password before continuing"}}, fiber.StatusForbidden)
+    }
     //get ip address and store in context
     ip := c.IP()
     c.Locals("ip_address", ip)
     // Store the userID in context
     c.Locals("user_id", claims.UserID)
     c.Locals("role",claims.Role)
+    c.Locals("station_id", claims.StationID)
+    c.Locals("token_id", claims.Id)
+    c.Locals("token_expires_at", time.Unix(claims.ExpiresAt, 0))
     return c.Next()
 }
\ No newline at end of file
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// audited entity types
+const (
+	AuditEntitySales                = "sales"
+	AuditEntitySupply               = "supply"
+	AuditEntitySupplierPayment      = "supplier_payment"
+	AuditEntityDipping              = "dipping"
+	AuditEntityPumpReading          = "pump_reading"
+	AuditEntityExpense              = "expense"
+	AuditEntityDailyAccount         = "daily_account"
+	AuditEntityEmployeePayment      = "employee_payment"
+	AuditEntityCashUp               = "cash_up"
+	AuditEntityPeriodClose          = "period_close"
+	AuditEntityPurchaseOrder        = "purchase_order"
+	AuditEntityDeliveryVerification = "delivery_verification"
+	AuditEntityMeterReset           = "meter_reset"
+	AuditEntityCustomer             = "customer"
+	AuditEntityCustomerCredit       = "customer_credit"
+	AuditEntityCustomerPayment      = "customer_payment"
+	AuditEntityCustomerInvoice      = "customer_invoice"
+	AuditEntitySupplierNote         = "supplier_note"
+	AuditEntityFuelPrice            = "fuel_price"
+)
+
+// RecordAudit writes an audit entry using tx so it commits or rolls back with the change.
+// before is nil on create and after is nil on delete.
+func RecordAudit(c *fiber.Ctx, tx *gorm.DB, entityType string, entityID uuid.UUID, action string, before, after interface{}) error {
+	entry := AuditLog{
+		ID:         uuid.New(),
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     action,
+		Before:     auditJSON(before),
+		After:      auditJSON(after),
+	}
+	if c != nil {
+		if userID, ok := c.Locals("user_id").(*uuid.UUID); ok {
+			entry.ActorID = userID
+		}
+		entry.IPAddress, _ = c.Locals("ip_address").(string)
+		if entry.IPAddress == "" {
+			entry.IPAddress = c.IP()
+		}
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		log.Println("failed to write audit log:", err.Error())
+		return errors.New("failed to write audit log")
+	}
+	return nil
+}
+
+func auditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+type AuditFilter struct {
+	EntityType string
+	EntityID   uuid.UUID
+	ActorID    uuid.UUID
+	StartDate  time.Time
+	EndDate    time.Time
+	Page       int
+	Limit      int
+}
+
+type ResAuditLogs struct {
+	Logs  []AuditLog `json:"logs"`
+	Total int64      `json:"total"`
+}
+
+// GetAuditLogs returns audit entries filtered by entity, user and date range, newest first
+func GetAuditLogs(filter AuditFilter) (*ResAuditLogs, error) {
+	query := db.Model(&AuditLog{})
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != uuid.Nil {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.ActorID != uuid.Nil {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if !filter.StartDate.IsZero() {
+		query = query.Where("created_at >= ?", filter.StartDate)
+	}
+	if !filter.EndDate.IsZero() {
+		query = query.Where("created_at < ?", filter.EndDate)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, errors.New("failed to count audit logs")
+	}
+
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 {
+		filter.Limit = 20
+	}
+	var logs []AuditLog
+	if err := query.Order("created_at DESC").
+		Limit(filter.Limit).
+		Offset((filter.Page - 1) * filter.Limit).
+		Find(&logs).Error; err != nil {
+		return nil, errors.New("failed to get audit logs")
+	}
+	return &ResAuditLogs{Logs: logs, Total: total}, nil
+}
@@ -0,0 +1,334 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type CashUpInput struct {
+	ShiftID    uuid.UUID `json:"shift_id"`
+	EmployeeID uuid.UUID `json:"employee_id"`
+	Cash       float64   `json:"cash"`
+	Mpesa      float64   `json:"mpesa"`
+	Bank       float64   `json:"bank"`
+	Notes      string    `json:"notes"`
+}
+
+// Reconcile totals the tenders and compares them with the expected amount
+func (cu *CashUp) Reconcile(expected float64) {
+	cu.TotalCollected = ledger.Round2(cu.Cash + cu.Mpesa + cu.Bank)
+	cu.ExpectedAmount = ledger.Round2(expected)
+	cu.Variance = ledger.Round2(cu.TotalCollected - cu.ExpectedAmount)
+	cu.Shortage, cu.Excess = 0, 0
+	if cu.Variance < 0 {
+		cu.Shortage = -cu.Variance
+	} else {
+		cu.Excess = cu.Variance
+	}
+}
+
+// expectedShiftSales sums the sales of the readings an employee recorded on a shift, less the litres sold on
+// account against those readings, which the attendant never collected
+func expectedShiftSales(tx *gorm.DB, shiftID, employeeID uuid.UUID) (float64, error) {
+	var expected float64
+	err := tx.Model(&PumpReadings{}).
+		Where("shift_id = ? AND recorded_by = ?", shiftID, employeeID).
+		Select("COALESCE(SUM(total_sales_amount), 0)").
+		Scan(&expected).Error
+	if err != nil {
+		return 0, err
+	}
+	credited, err := shiftCreditSales(tx, shiftID)
+	if err != nil {
+		return 0, err
+	}
+	return expected - credited[employeeID], nil
+}
+
+// shiftCreditSales sums per attendant the customer credits linked to readings of a shift
+func shiftCreditSales(tx *gorm.DB, shiftID uuid.UUID) (map[uuid.UUID]float64, error) {
+	type creditRow struct {
+		RecordedBy uuid.UUID
+		Total      float64
+	}
+	var rows []creditRow
+	if err := tx.Table("customer_credits").
+		Select("pump_readings.recorded_by, SUM(customer_credits.amount) AS total").
+		Joins("JOIN pump_readings ON pump_readings.id = customer_credits.pump_reading_id").
+		Where("pump_readings.shift_id = ? AND pump_readings.deleted_at IS NULL AND customer_credits.deleted_at IS NULL", shiftID).
+		Group("pump_readings.recorded_by").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	credited := map[uuid.UUID]float64{}
+	for _, row := range rows {
+		credited[row.RecordedBy] = row.Total
+	}
+	return credited, nil
+}
+
+// RefreshShiftCashUps reconciles the cash-ups already taken on a shift again, so a reading or credit changed
+// after the cash-up moves the expected amount, variance and shortage with it
+func RefreshShiftCashUps(tx *gorm.DB, shiftID *uuid.UUID) error {
+	if shiftID == nil {
+		return nil
+	}
+	var cashUps []CashUp
+	if err := tx.Where("shift_id = ?", *shiftID).Find(&cashUps).Error; err != nil {
+		return err
+	}
+	for i := range cashUps {
+		expected, err := expectedShiftSales(tx, *shiftID, cashUps[i].EmployeeID)
+		if err != nil {
+			return err
+		}
+		cashUps[i].Reconcile(expected)
+		if err := tx.Model(&cashUps[i]).
+			Select("total_collected", "expected_amount", "variance", "shortage", "excess").
+			Updates(&cashUps[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateCashUp records the collections of one attendant on a shift
+func CreateCashUp(c *fiber.Ctx, input CashUpInput) (*CashUp, error) {
+	if input.ShiftID == uuid.Nil || input.EmployeeID == uuid.Nil {
+		return nil, errors.New("shift_id and employee_id are required")
+	}
+	if input.Cash < 0 || input.Mpesa < 0 || input.Bank < 0 {
+		return nil, errors.New("tender amounts cannot be negative")
+	}
+
+	var cashUp CashUp
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var shift Shift
+		if err := tx.First(&shift, "id = ?", input.ShiftID).Error; err != nil {
+			return errors.New("shift not found")
+		}
+		// the shift's takings are only final once it is closed
+		if shift.Status == ShiftOpen {
+			return errors.New("close the shift before cashing up")
+		}
+		var count int64
+		if err := tx.Model(&CashUp{}).Where("shift_id = ? AND employee_id = ?", input.ShiftID, input.EmployeeID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("employee already has a cash-up for this shift")
+		}
+
+		expected, err := expectedShiftSales(tx, shift.ID, input.EmployeeID)
+		if err != nil {
+			return err
+		}
+
+		cashUp = CashUp{
+			ID:          uuid.New(),
+			ShiftID:     shift.ID,
+			EmployeeID:  input.EmployeeID,
+			StationID:   shift.StationID,
+			BusinessDay: shift.BusinessDay,
+			Cash:        input.Cash,
+			Mpesa:       input.Mpesa,
+			Bank:        input.Bank,
+			Notes:       input.Notes,
+		}
+		if userID, ok := c.Locals("user_id").(*uuid.UUID); ok {
+			cashUp.RecordedBy = userID
+		}
+		cashUp.Reconcile(expected)
+
+		if err := tx.Create(&cashUp).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityCashUp, cashUp.ID, AuditCreate, nil, cashUp)
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return &cashUp, nil
+}
+
+func GetCashUpByID(c *fiber.Ctx, id uuid.UUID) (*CashUp, error) {
+	var cashUp CashUp
+	if err := db.Preload("Employee").First(&cashUp, "id = ?", id).Error; err != nil {
+		return nil, errors.New("cash-up not found")
+	}
+	return &cashUp, nil
+}
+
+// UpdateCashUp corrects the tenders of a cash-up and recomputes the variance
+func UpdateCashUp(c *fiber.Ctx, id uuid.UUID, input CashUpInput) (*CashUp, error) {
+	if input.Cash < 0 || input.Mpesa < 0 || input.Bank < 0 {
+		return nil, errors.New("tender amounts cannot be negative")
+	}
+
+	var cashUp CashUp
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&cashUp, "id = ?", id).Error; err != nil {
+			return errors.New("cash-up not found")
+		}
+		before := cashUp
+
+		expected, err := expectedShiftSales(tx, cashUp.ShiftID, cashUp.EmployeeID)
+		if err != nil {
+			return err
+		}
+		cashUp.Cash, cashUp.Mpesa, cashUp.Bank = input.Cash, input.Mpesa, input.Bank
+		if input.Notes != "" {
+			cashUp.Notes = input.Notes
+		}
+		cashUp.Reconcile(expected)
+
+		if err := tx.Save(&cashUp).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityCashUp, cashUp.ID, AuditUpdate, before, cashUp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cashUp, nil
+}
+
+// ShiftAttendantReconciliation is one attendant's line in the shift report
+type ShiftAttendantReconciliation struct {
+	EmployeeID     uuid.UUID  `json:"employee_id"`
+	EmployeeName   string     `json:"employee_name"`
+	ExpectedAmount float64    `json:"expected_amount"`
+	Cash           float64    `json:"cash"`
+	Mpesa          float64    `json:"mpesa"`
+	Bank           float64    `json:"bank"`
+	TotalCollected float64    `json:"total_collected"`
+	Variance       float64    `json:"variance"`
+	CashUpID       *uuid.UUID `json:"cash_up_id"`
+}
+
+type ShiftReconciliation struct {
+	Shift          Shift                          `json:"shift"`
+	Attendants     []ShiftAttendantReconciliation `json:"attendants"`
+	ExpectedAmount float64                        `json:"expected_amount"`
+	TotalCollected float64                        `json:"total_collected"`
+	Variance       float64                        `json:"variance"`
+}
+
+// GetShiftReconciliation compares meter sales per attendant with what they handed over.
+// Attendants with readings but no cash-up show up with nothing collected.
+func GetShiftReconciliation(c *fiber.Ctx, shiftID uuid.UUID) (*ShiftReconciliation, error) {
+	var shift Shift
+	if err := db.First(&shift, "id = ?", shiftID).Error; err != nil {
+		return nil, errors.New("shift not found")
+	}
+
+	type expectedRow struct {
+		RecordedBy uuid.UUID
+		Total      float64
+	}
+	var expectedRows []expectedRow
+	if err := db.Model(&PumpReadings{}).
+		Select("recorded_by, SUM(total_sales_amount) AS total").
+		Where("shift_id = ?", shiftID).
+		Group("recorded_by").
+		Scan(&expectedRows).Error; err != nil {
+		return nil, errors.New("failed to sum shift readings")
+	}
+	credited, err := shiftCreditSales(db, shiftID)
+	if err != nil {
+		return nil, errors.New("failed to sum shift credit sales")
+	}
+
+	var cashUps []CashUp
+	if err := db.Where("shift_id = ?", shiftID).Find(&cashUps).Error; err != nil {
+		return nil, errors.New("failed to get cash-ups")
+	}
+
+	lines := map[uuid.UUID]*ShiftAttendantReconciliation{}
+	var order []uuid.UUID
+	line := func(employeeID uuid.UUID) *ShiftAttendantReconciliation {
+		if l, ok := lines[employeeID]; ok {
+			return l
+		}
+		l := &ShiftAttendantReconciliation{EmployeeID: employeeID}
+		lines[employeeID] = l
+		order = append(order, employeeID)
+		return l
+	}
+	for _, row := range expectedRows {
+		line(row.RecordedBy).ExpectedAmount = ledger.Round2(row.Total - credited[row.RecordedBy])
+	}
+	for i := range cashUps {
+		l := line(cashUps[i].EmployeeID)
+		l.Cash, l.Mpesa, l.Bank = cashUps[i].Cash, cashUps[i].Mpesa, cashUps[i].Bank
+		l.TotalCollected = cashUps[i].TotalCollected
+		l.CashUpID = &cashUps[i].ID
+	}
+
+	var employees []Employee
+	if len(order) > 0 {
+		db.Where("id IN ?", order).Find(&employees)
+	}
+	names := map[uuid.UUID]string{}
+	for _, e := range employees {
+		names[e.ID] = e.FirstName + " " + e.LastName
+	}
+
+	report := ShiftReconciliation{Shift: shift}
+	for _, id := range order {
+		l := lines[id]
+		l.EmployeeName = names[id]
+		l.Variance = ledger.Round2(l.TotalCollected - l.ExpectedAmount)
+		report.ExpectedAmount += l.ExpectedAmount
+		report.TotalCollected += l.TotalCollected
+		report.Attendants = append(report.Attendants, *l)
+	}
+	report.ExpectedAmount = ledger.Round2(report.ExpectedAmount)
+	report.TotalCollected = ledger.Round2(report.TotalCollected)
+	report.Variance = ledger.Round2(report.TotalCollected - report.ExpectedAmount)
+	return &report, nil
+}
+
+// EmployeeShortage is the cumulative cash-up result of one employee over a period
+type EmployeeShortage struct {
+	EmployeeID    uuid.UUID `json:"employee_id"`
+	EmployeeName  string    `json:"employee_name"`
+	StationID     uuid.UUID `json:"station_id"`
+	Shifts        int64     `json:"shifts"`
+	TotalShortage float64   `json:"total_shortage"`
+	TotalExcess   float64   `json:"total_excess"`
+	NetVariance   float64   `json:"net_variance"`
+}
+
+// GetEmployeeShortages sums shortages per employee between two business days,
+// optionally for one station. TotalShortage is what payroll deducts.
+func GetEmployeeShortages(c *fiber.Ctx, stationID *uuid.UUID, start, end time.Time) ([]EmployeeShortage, error) {
+	query := db.Table("cash_ups").
+		Select(`cash_ups.employee_id, employees.first_name || ' ' || employees.last_name AS employee_name,
+			cash_ups.station_id, COUNT(*) AS shifts,
+			SUM(cash_ups.shortage) AS total_shortage, SUM(cash_ups.excess) AS total_excess,
+			SUM(cash_ups.variance) AS net_variance`).
+		Joins("LEFT JOIN employees ON employees.id = cash_ups.employee_id").
+		Where("cash_ups.deleted_at IS NULL").
+		Where("cash_ups.business_day BETWEEN ? AND ?", start, end)
+	if stationID != nil {
+		query = query.Where("cash_ups.station_id = ?", *stationID)
+	}
+
+	var shortages []EmployeeShortage
+	if err := query.
+		Group("cash_ups.employee_id, employees.first_name, employees.last_name, cash_ups.station_id").
+		Order("total_shortage DESC").
+		Scan(&shortages).Error; err != nil {
+		log.Println(err.Error())
+		return nil, errors.New("failed to get employee shortages")
+	}
+	return shortages, nil
+}
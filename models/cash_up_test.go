@@ -0,0 +1,85 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dancankarani/safa/internal/testutil"
+	"github.com/google/uuid"
+)
+
+func TestExpectedShiftSalesExcludesCreditSales(t *testing.T) {
+	conn := setupTestDB(t)
+	shiftID, attendant, other := uuid.New(), uuid.New(), uuid.New()
+	readings := []PumpReadings{
+		{ID: uuid.New(), PumpID: uuid.New(), ShiftID: &shiftID, Shift: "day", RecordedBy: attendant, OpeningMeter: 0, ClosingMeter: 100, UnitPrice: 200},
+		{ID: uuid.New(), PumpID: uuid.New(), ShiftID: &shiftID, Shift: "day", RecordedBy: other, OpeningMeter: 0, ClosingMeter: 50, UnitPrice: 200},
+	}
+	if err := conn.Create(&readings).Error; err != nil {
+		t.Fatal(err)
+	}
+	credit := CustomerCredit{ID: uuid.New(), CustomerID: uuid.New(), PumpReadingID: &readings[0].ID, Liters: 30, UnitPrice: 200, Amount: 6000}
+	if err := conn.Create(&credit).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := expectedShiftSales(conn, shiftID, attendant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected != 14000 {
+		t.Errorf("attendant expected = %v, want 14000", expected)
+	}
+	if expected, _ := expectedShiftSales(conn, shiftID, other); expected != 10000 {
+		t.Errorf("other attendant expected = %v, want 10000", expected)
+	}
+}
+
+func TestCreateCashUpRequiresClosedShift(t *testing.T) {
+	conn := setupTestDB(t)
+	shift := Shift{ID: uuid.New(), StationID: uuid.New(), Name: "day", Status: ShiftOpen, StartTime: time.Now(), OpenedBy: uuid.New()}
+	if err := conn.Create(&shift).Error; err != nil {
+		t.Fatal(err)
+	}
+	input := CashUpInput{ShiftID: shift.ID, EmployeeID: uuid.New(), Cash: 100}
+	if _, err := CreateCashUp(testutil.Ctx(t, uuid.New()), input); err == nil {
+		t.Fatal("cash-up accepted on an open shift")
+	}
+
+	conn.Model(&shift).Update("status", ShiftClosed)
+	if _, err := CreateCashUp(testutil.Ctx(t, uuid.New()), input); err != nil {
+		t.Fatalf("cash-up on a closed shift: %v", err)
+	}
+}
+
+func TestRefreshShiftCashUps(t *testing.T) {
+	conn := setupTestDB(t)
+	shift := Shift{ID: uuid.New(), StationID: uuid.New(), Name: "day", Status: ShiftClosed, StartTime: time.Now(), OpenedBy: uuid.New()}
+	if err := conn.Create(&shift).Error; err != nil {
+		t.Fatal(err)
+	}
+	attendant := uuid.New()
+	reading := PumpReadings{ID: uuid.New(), PumpID: uuid.New(), ShiftID: &shift.ID, Shift: "day", RecordedBy: attendant, OpeningMeter: 0, ClosingMeter: 100, UnitPrice: 200}
+	if err := conn.Create(&reading).Error; err != nil {
+		t.Fatal(err)
+	}
+	cashUp, err := CreateCashUp(testutil.Ctx(t, uuid.New()), CashUpInput{ShiftID: shift.ID, EmployeeID: attendant, Cash: 18000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cashUp.Shortage != 2000 {
+		t.Fatalf("shortage = %v, want 2000", cashUp.Shortage)
+	}
+
+	// the reading is corrected down to what was collected
+	conn.Model(&reading).Updates(map[string]interface{}{"closing_meter": 90, "total_sales_amount": 18000})
+	if err := RefreshShiftCashUps(conn, &shift.ID); err != nil {
+		t.Fatal(err)
+	}
+	var refreshed CashUp
+	conn.First(&refreshed, "id = ?", cashUp.ID)
+	if refreshed.ExpectedAmount != 18000 || refreshed.Variance != 0 || refreshed.Shortage != 0 {
+		t.Errorf("refreshed cash-up = expected %v variance %v shortage %v, want 18000 0 0",
+			refreshed.ExpectedAmount, refreshed.Variance, refreshed.Shortage)
+	}
+}
@@ -1,116 +1,632 @@
 package models
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/dancankarani/safa/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
 
-// add customer
 func (c *Customer) TableName() string {
 	return "customers"
 }
-func AddCustomer(c *fiber.Ctx) error {
-	var customer Customer
-	// Parse the request body into the customer struct
-	if err := c.BodyParser(&customer); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
-	}
-	if err := db.Create(&customer).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+
+func (c *CustomerCredit) TableName() string {
+	return "customer_credits"
+}
+
+func (c *CustomerCreditPayment) TableName() string {
+	return "customer_credit_payments"
+}
+
+type CustomerInput struct {
+	Name             string   `json:"name"`
+	PhoneNumber      string   `json:"phone_number"`
+	Email            string   `json:"email"`
+	CreditLimit      *float64 `json:"credit_limit"`
+	PaymentTermsDays *int     `json:"payment_terms_days"`
+	IsActive         *bool    `json:"is_active"`
+}
+
+// CustomerWithBalance is a customer with what they owe and how much of their limit is left
+type CustomerWithBalance struct {
+	Customer
+	Balance         float64 `json:"balance"`
+	AvailableCredit float64 `json:"available_credit"` // 0 when the customer has no limit
+}
+
+// CustomerBalanceSQL sums what a customer owes: credits taken less payments made
+const CustomerBalanceSQL = `COALESCE((SELECT SUM(amount) FROM customer_credits WHERE customer_id = customers.id AND deleted_at IS NULL), 0)
+	- COALESCE((SELECT SUM(amount) FROM customer_credit_payments WHERE customer_id = customers.id AND deleted_at IS NULL), 0)`
+
+// CustomerBalance returns what a customer currently owes
+func CustomerBalance(tx *gorm.DB, customerID uuid.UUID) (float64, error) {
+	var balance float64
+	err := tx.Model(&Customer{}).Select(CustomerBalanceSQL+" AS balance").
+		Where("id = ?", customerID).Scan(&balance).Error
+	return ledger.Round2(balance), err
+}
+
+func withBalance(customer Customer, balance float64) CustomerWithBalance {
+	result := CustomerWithBalance{Customer: customer, Balance: ledger.Round2(balance)}
+	if customer.CreditLimit > 0 {
+		result.AvailableCredit = ledger.Round2(math.Max(customer.CreditLimit-balance, 0))
 	}
-	return c.Status(fiber.StatusCreated).JSON(customer)
+	return result
 }
 
-// GetCustomers retrieves all customers from the database
-func GetCustomers(c *fiber.Ctx) error {
-	var customers []Customer
-	if err := db.Find(&customers).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+// DefaultPaymentTermsDays is how long a new customer has to pay an invoice unless told otherwise
+const DefaultPaymentTermsDays = 30
+
+func AddCustomer(c *fiber.Ctx, input CustomerInput) (*Customer, error) {
+	if strings.TrimSpace(input.Name) == "" || strings.TrimSpace(input.PhoneNumber) == "" {
+		return nil, errors.New("name and phone_number are required")
+	}
+	customer := Customer{
+		ID:          uuid.New(),
+		Name:        strings.TrimSpace(input.Name),
+		PhoneNumber: strings.TrimSpace(input.PhoneNumber),
+		Email:       input.Email,
+		IsActive:    true,
+		// set here rather than as a column default, which would turn explicit cash-on-delivery terms of 0 into 30
+		PaymentTermsDays: DefaultPaymentTermsDays,
 	}
-	return c.JSON(customers)
+	if input.CreditLimit != nil {
+		if *input.CreditLimit < 0 {
+			return nil, errors.New("credit_limit cannot be negative")
+		}
+		customer.CreditLimit = *input.CreditLimit
+	}
+	if input.PaymentTermsDays != nil {
+		if *input.PaymentTermsDays < 0 {
+			return nil, errors.New("payment_terms_days cannot be negative")
+		}
+		customer.PaymentTermsDays = *input.PaymentTermsDays
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&customer).Error; err != nil {
+			log.Println("failed to add customer:", err.Error())
+			return errors.New("failed to add customer")
+		}
+		return RecordAudit(c, tx, AuditEntityCustomer, customer.ID, AuditCreate, nil, customer)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &customer, nil
 }
-// GetCustomer retrieves a customer by ID
-func GetCustomer(c *fiber.Ctx) error {
-	id := c.Params("id")
+
+// UpdateCustomer changes a customer's details, credit limit or active flag. Lowering the limit below what
+// the customer already owes only blocks further credit.
+func UpdateCustomer(c *fiber.Ctx, id uuid.UUID, input CustomerInput) (*Customer, error) {
 	var customer Customer
-	if err := db.First(&customer, id).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Customer not found"})
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&customer, "id = ?", id).Error; err != nil {
+			return errors.New("customer not found")
+		}
+		before := customer
+
+		if name := strings.TrimSpace(input.Name); name != "" {
+			customer.Name = name
+		}
+		if phone := strings.TrimSpace(input.PhoneNumber); phone != "" {
+			customer.PhoneNumber = phone
+		}
+		if input.Email != "" {
+			customer.Email = input.Email
+		}
+		if input.CreditLimit != nil {
+			if *input.CreditLimit < 0 {
+				return errors.New("credit_limit cannot be negative")
+			}
+			customer.CreditLimit = *input.CreditLimit
+		}
+		if input.PaymentTermsDays != nil {
+			if *input.PaymentTermsDays < 0 {
+				return errors.New("payment_terms_days cannot be negative")
+			}
+			customer.PaymentTermsDays = *input.PaymentTermsDays
+		}
+		if input.IsActive != nil {
+			customer.IsActive = *input.IsActive
+		}
+
+		if err := tx.Select("name", "phone_number", "email", "credit_limit", "payment_terms_days", "is_active").Save(&customer).Error; err != nil {
+			log.Println("failed to update customer:", err.Error())
+			return errors.New("failed to update customer")
+		}
+		return RecordAudit(c, tx, AuditEntityCustomer, customer.ID, AuditUpdate, before, customer)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return c.JSON(customer)
+	return &customer, nil
 }
-// UpdateCustomer updates a customer by ID
-func UpdateCustomer(c *fiber.Ctx) error {
-	id := c.Params("id")
+
+func GetCustomers() ([]CustomerWithBalance, error) {
+	var rows []struct {
+		Customer
+		Balance float64
+	}
+	if err := db.Model(&Customer{}).Select("customers.*, " + CustomerBalanceSQL + " AS balance").
+		Order("name").Scan(&rows).Error; err != nil {
+		return nil, errors.New("failed to get customers")
+	}
+	customers := make([]CustomerWithBalance, len(rows))
+	for i, row := range rows {
+		customers[i] = withBalance(row.Customer, row.Balance)
+	}
+	return customers, nil
+}
+
+func GetCustomerByID(id uuid.UUID) (*CustomerWithBalance, error) {
 	var customer Customer
-	if err := db.First(&customer, id).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Customer not found"})
+	if err := db.First(&customer, "id = ?", id).Error; err != nil {
+		return nil, errors.New("customer not found")
+	}
+	balance, err := CustomerBalance(db, id)
+	if err != nil {
+		return nil, errors.New("failed to get customer balance")
+	}
+	result := withBalance(customer, balance)
+	return &result, nil
+}
+
+type CustomerCreditInput struct {
+	CustomerID          uuid.UUID  `json:"customer_id"`
+	StationID           uuid.UUID  `json:"station_id"`
+	PumpReadingID       *uuid.UUID `json:"pump_reading_id"`
+	FuelProductID       *uuid.UUID `json:"fuel_product_id"`
+	VehicleRegistration string     `json:"vehicle_registration"`
+	Reference           string     `json:"reference"`
+	Liters              float64    `json:"liters"`
+	UnitPrice           float64    `json:"unit_price"`
+	Amount              float64    `json:"amount"` // only used when no litres are given
+	Date                time.Time  `json:"date"`
+}
+
+// linkReading fills the product and price of a credit from the pump reading the fuel was dispensed in, and
+// checks the reading has enough litres not already sold on credit
+func (input *CustomerCreditInput) linkReading(tx *gorm.DB) error {
+	var reading PumpReadings
+	if err := tx.Preload("Pump.Tanks").First(&reading, "id = ?", *input.PumpReadingID).Error; err != nil {
+		return errors.New("pump reading not found")
 	}
-	// Parse the request body into the customer struct
-	if err := c.BodyParser(&customer); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	if reading.Pump.StationID != input.StationID {
+		return errors.New("pump reading does not belong to the station")
 	}
-	if err := db.Save(&customer).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if input.FuelProductID == nil && len(reading.Pump.Tanks) > 0 {
+		input.FuelProductID = &reading.Pump.Tanks[0].FuelProductID
 	}
-	return c.JSON(customer)
+	if input.UnitPrice == 0 {
+		input.UnitPrice = reading.UnitPrice
+	}
+	if input.Date.IsZero() {
+		input.Date = reading.BusinessDay
+	}
+
+	credited, err := ReadingCreditedLiters(tx, reading.ID)
+	if err != nil {
+		return err
+	}
+	if input.Liters > 0 && credited+input.Liters > reading.LitersDispensed+services.MeterTolerance {
+		return fmt.Errorf("only %.2f of the reading's %.2f litres are left to sell on credit", math.Max(reading.LitersDispensed-credited, 0), reading.LitersDispensed)
+	}
+	return nil
 }
 
-//record customerCredits
-func (c *CustomerCredit) TableName() string {
-	return "customer_credits"
+// ReadingCreditedLiters sums the litres of a pump reading already sold on credit
+func ReadingCreditedLiters(tx *gorm.DB, readingID uuid.UUID) (float64, error) {
+	var credited float64
+	err := tx.Model(&CustomerCredit{}).Select("COALESCE(SUM(liters), 0)").
+		Where("pump_reading_id = ?", readingID).Scan(&credited).Error
+	return credited, err
 }
-// AddCustomerCredit adds a credit record for a customer
-func AddCustomerCredit(c *fiber.Ctx) error {
+
+// UnlinkReadingCredits detaches the credits of a pump reading that is being removed. The customer still owes
+// them, but without the reading's cash takings behind them each is booked again as a sale of its own.
+func UnlinkReadingCredits(c *fiber.Ctx, tx *gorm.DB, readingID uuid.UUID, by *uuid.UUID) error {
+	var credits []CustomerCredit
+	if err := tx.Where("pump_reading_id = ?", readingID).Find(&credits).Error; err != nil {
+		return err
+	}
+	for _, credit := range credits {
+		before := credit
+		credit.PumpReadingID = nil
+		if err := tx.Model(&CustomerCredit{}).Where("id = ?", credit.ID).Update("pump_reading_id", nil).Error; err != nil {
+			return err
+		}
+		if err := ledger.Reverse(tx, ledger.SourceCustomerCredit, credit.ID, credit.Date, by); err != nil {
+			return err
+		}
+		var customer Customer
+		if err := tx.Select("id", "name").First(&customer, "id = ?", credit.CustomerID).Error; err != nil {
+			return errors.New("customer not found")
+		}
+		if err := PostCustomerCreditJournal(tx, credit, customer); err != nil {
+			return err
+		}
+		if err := RecordAudit(c, tx, AuditEntityCustomerCredit, credit.ID, AuditUpdate, before, credit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddCustomerCredit records fuel sold to a customer on account. It is refused when it would take the
+// customer past their credit limit.
+func AddCustomerCredit(c *fiber.Ctx, input CustomerCreditInput, recordedBy *uuid.UUID) (*CustomerCredit, error) {
+	if input.CustomerID == uuid.Nil || input.StationID == uuid.Nil {
+		return nil, errors.New("customer_id and station_id are required")
+	}
+	if input.Liters < 0 || input.UnitPrice < 0 || input.Amount < 0 {
+		return nil, errors.New("liters, unit_price and amount cannot be negative")
+	}
+
 	var credit CustomerCredit
-	// Parse the request body into the credit struct
-	if err := c.BodyParser(&credit); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// lock the customer so concurrent credits cannot both pass the limit check
+		var customer Customer
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&customer, "id = ?", input.CustomerID).Error; err != nil {
+			return errors.New("customer not found")
+		}
+		if !customer.IsActive {
+			return errors.New("customer account is inactive")
+		}
+		if input.PumpReadingID != nil {
+			if err := input.linkReading(tx); err != nil {
+				return err
+			}
+		}
+		if input.Date.IsZero() {
+			input.Date = time.Now()
+		}
+		if input.Liters > 0 {
+			if input.UnitPrice == 0 && input.FuelProductID != nil {
+				if price, err := EffectiveFuelPrice(tx, input.StationID, *input.FuelProductID, input.Date); err == nil {
+					input.UnitPrice = price.UnitPrice
+				}
+			}
+			if input.UnitPrice == 0 {
+				return errors.New("unit_price is required with liters")
+			}
+			input.Amount = ledger.Round2(input.Liters * input.UnitPrice)
+		}
+		if input.Amount <= 0 {
+			return errors.New("amount must be greater than zero")
+		}
+		if err := EnsurePeriodOpen(tx, input.StationID, input.Date); err != nil {
+			return err
+		}
+
+		balance, err := CustomerBalance(tx, customer.ID)
+		if err != nil {
+			return err
+		}
+		if customer.CreditLimit > 0 && balance+input.Amount > customer.CreditLimit+0.005 {
+			return fmt.Errorf("credit of %.2f would take %s past their limit of %.2f, %.2f is available",
+				input.Amount, customer.Name, customer.CreditLimit, math.Max(customer.CreditLimit-balance, 0))
+		}
+
+		credit = CustomerCredit{
+			ID:                  uuid.New(),
+			CustomerID:          customer.ID,
+			StationID:           &input.StationID,
+			PumpReadingID:       input.PumpReadingID,
+			FuelProductID:       input.FuelProductID,
+			VehicleRegistration: strings.ToUpper(strings.TrimSpace(input.VehicleRegistration)),
+			Reference:           input.Reference,
+			Liters:              input.Liters,
+			UnitPrice:           input.UnitPrice,
+			Date:                input.Date,
+			Amount:              input.Amount,
+			RecordedBy:          recordedBy,
+		}
+		if err := tx.Create(&credit).Error; err != nil {
+			log.Println("failed to add customer credit:", err.Error())
+			return errors.New("failed to add customer credit")
+		}
+		if err := PostCustomerCreditJournal(tx, credit, customer); err != nil {
+			return err
+		}
+		// litres credited from a reading come off its attendant's expected cash
+		if credit.PumpReadingID != nil {
+			var reading PumpReadings
+			if err := tx.Select("id", "shift_id").First(&reading, "id = ?", *credit.PumpReadingID).Error; err != nil {
+				return err
+			}
+			if err := RefreshShiftCashUps(tx, reading.ShiftID); err != nil {
+				return err
+			}
+		}
+		return RecordAudit(c, tx, AuditEntityCustomerCredit, credit.ID, AuditCreate, nil, credit)
+	})
+	if err != nil {
+		return nil, err
 	}
-	if err := db.Create(&credit).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	return &credit, nil
+}
+
+// GetCustomerCredits lists a customer's credits, newest first, optionally only those not yet paid
+func GetCustomerCredits(customerID uuid.UUID, unpaidOnly bool) ([]CustomerCredit, error) {
+	credits := []CustomerCredit{}
+	query := db.Preload("FuelProduct").Where("customer_id = ?", customerID)
+	if unpaidOnly {
+		query = query.Where("is_paid = ?", false)
 	}
-	return c.Status(fiber.StatusCreated).JSON(credit)
+	if err := query.Order("date DESC").Find(&credits).Error; err != nil {
+		return nil, errors.New("failed to get customer credits")
+	}
+	return credits, nil
+}
+
+type CustomerPaymentInput struct {
+	CustomerID  uuid.UUID             `json:"customer_id"`
+	StationID   *uuid.UUID            `json:"station_id"`
+	Amount      float64               `json:"amount"`
+	Method      string                `json:"method"`
+	Reference   string                `json:"reference"`
+	PaymentDate time.Time             `json:"payment_date"`
+	Allocations []services.Allocation `json:"allocations"` // credits to settle, anything left over goes to the oldest
+	// invoices to settle, each spread over the invoice's oldest unpaid credits
+	InvoiceAllocations []services.Allocation `json:"invoice_allocations"`
 }
-// GetCustomerCredits retrieves all credit records for a customer
-func GetCustomerCredits(c *fiber.Ctx) error {
+
+// allocateCustomerPayment settles the invoices and credits named in the payment first and the oldest unpaid
+// credits with whatever is left, then brings the paid amounts of the invoices touched up to date
+func allocateCustomerPayment(tx *gorm.DB, payment CustomerCreditPayment, requested, invoices []services.Allocation) ([]CustomerPaymentAllocation, error) {
 	var credits []CustomerCredit
-	customerID := c.Params("id")
-	if err := db.Where("customer_id = ?", customerID).Find(&credits).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("customer_id = ? AND is_paid = ?", payment.CustomerID, false).
+		Order("date").Find(&credits).Error; err != nil {
+		return nil, err
+	}
+	byID := map[string]*CustomerCredit{}
+	for i := range credits {
+		byID[credits[i].ID.String()] = &credits[i]
 	}
-	return c.JSON(credits)
-}
 
-//add customer credit payments
-func (c *CustomerCreditPayment) TableName() string {
-	return "customer_credit_payments"
+	// an invoice allocation becomes allocations to the invoice's credits, oldest first
+	for _, a := range invoices {
+		var items []services.OpenItem
+		for _, credit := range credits {
+			if credit.InvoiceID != nil && credit.InvoiceID.String() == a.ID {
+				items = append(items, services.OpenItem{ID: credit.ID.String(), Date: credit.Date, Outstanding: ledger.Round2(credit.Amount - credit.AmountPaid)})
+			}
+		}
+		if len(items) == 0 {
+			return nil, fmt.Errorf("invoice %s has nothing outstanding for this customer", a.ID)
+		}
+		spread, left := services.AllocateOldestFirst(a.Amount, items)
+		if left > 0.005 {
+			return nil, fmt.Errorf("allocation to invoice %s exceeds its outstanding amount", a.ID)
+		}
+		requested = append(spread, requested...)
+	}
+
+	applied := map[string]float64{}
+	remaining := ledger.Round2(payment.Amount)
+	for _, a := range requested {
+		credit, ok := byID[a.ID]
+		if !ok {
+			return nil, fmt.Errorf("credit %s is not an unpaid credit of this customer", a.ID)
+		}
+		if a.Amount <= 0 {
+			return nil, errors.New("allocation amounts must be greater than zero")
+		}
+		if a.Amount > remaining+0.005 {
+			return nil, errors.New("allocations exceed the payment amount")
+		}
+		if applied[a.ID]+a.Amount > credit.Amount-credit.AmountPaid+0.005 {
+			return nil, fmt.Errorf("allocation to credit %s exceeds its outstanding %.2f", a.ID, credit.Amount-credit.AmountPaid)
+		}
+		applied[a.ID] = ledger.Round2(applied[a.ID] + a.Amount)
+		remaining = ledger.Round2(remaining - a.Amount)
+	}
+
+	items := make([]services.OpenItem, len(credits))
+	for i, credit := range credits {
+		items[i] = services.OpenItem{ID: credit.ID.String(), Date: credit.Date, Outstanding: ledger.Round2(credit.Amount - credit.AmountPaid - applied[credit.ID.String()])}
+	}
+	auto, _ := services.AllocateOldestFirst(remaining, items)
+	for _, a := range auto {
+		applied[a.ID] = ledger.Round2(applied[a.ID] + a.Amount)
+	}
+
+	allocations := []CustomerPaymentAllocation{}
+	touched := map[uuid.UUID]bool{}
+	for _, credit := range credits {
+		amount := applied[credit.ID.String()]
+		if amount <= 0 {
+			continue
+		}
+		credit.AmountPaid = ledger.Round2(credit.AmountPaid + amount)
+		credit.IsPaid = credit.AmountPaid >= credit.Amount-0.005
+		if err := tx.Model(&CustomerCredit{}).Where("id = ?", credit.ID).
+			Updates(map[string]interface{}{"amount_paid": credit.AmountPaid, "is_paid": credit.IsPaid}).Error; err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, CustomerPaymentAllocation{ID: uuid.New(), PaymentID: payment.ID, CreditID: credit.ID, Amount: amount})
+		if credit.InvoiceID != nil {
+			touched[*credit.InvoiceID] = true
+		}
+	}
+	if len(allocations) > 0 {
+		if err := tx.Create(&allocations).Error; err != nil {
+			return nil, err
+		}
+	}
+	for invoiceID := range touched {
+		if err := SyncCustomerInvoice(tx, invoiceID); err != nil {
+			return nil, err
+		}
+	}
+	return allocations, nil
 }
 
-// AddCustomerCreditPayment adds a payment record for a customer credit
-func AddCustomerCreditPayment(c *fiber.Ctx) error {
-	var payment CustomerCreditPayment
-	// Parse the request body into the payment struct
-	if err := c.BodyParser(&payment); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+// AddCustomerCreditPayment records a customer paying towards their account and allocates it to their credits.
+// A payment cannot exceed what the customer owes.
+func AddCustomerCreditPayment(c *fiber.Ctx, input CustomerPaymentInput, recordedBy *uuid.UUID) (*CustomerCreditPayment, error) {
+	if input.CustomerID == uuid.Nil {
+		return nil, errors.New("customer_id is required")
+	}
+	if input.Amount <= 0 {
+		return nil, errors.New("amount must be greater than zero")
+	}
+	if input.PaymentDate.IsZero() {
+		input.PaymentDate = time.Now()
+	}
+
+	payment := CustomerCreditPayment{
+		ID:          uuid.New(),
+		CustomerID:  input.CustomerID,
+		StationID:   input.StationID,
+		Amount:      ledger.Round2(input.Amount),
+		Method:      input.Method,
+		Reference:   input.Reference,
+		PaymentDate: input.PaymentDate,
+		RecordedBy:  recordedBy,
 	}
-	if err := db.Create(&payment).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var customer Customer
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&customer, "id = ?", input.CustomerID).Error; err != nil {
+			return errors.New("customer not found")
+		}
+		if input.StationID != nil {
+			if err := EnsurePeriodOpen(tx, *input.StationID, input.PaymentDate); err != nil {
+				return err
+			}
+		}
+		balance, err := CustomerBalance(tx, customer.ID)
+		if err != nil {
+			return err
+		}
+		if payment.Amount > balance+0.005 {
+			return fmt.Errorf("payment of %.2f exceeds the %.2f %s owes", payment.Amount, balance, customer.Name)
+		}
+
+		if err := tx.Omit("Allocations").Create(&payment).Error; err != nil {
+			log.Println("failed to add customer payment:", err.Error())
+			return errors.New("failed to add customer payment")
+		}
+		if payment.Allocations, err = allocateCustomerPayment(tx, payment, input.Allocations, input.InvoiceAllocations); err != nil {
+			return err
+		}
+		if err := PostCustomerPaymentJournal(tx, payment, customer); err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityCustomerPayment, payment.ID, AuditCreate, nil, payment)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return c.Status(fiber.StatusCreated).JSON(payment)
+	return &payment, nil
 }
 
-// GetCustomerCreditPayments retrieves all payment records for a customer credit
-func GetCustomerCreditPayments(c *fiber.Ctx) error {
-	var payments []CustomerCreditPayment
-	creditID := c.Params("id")
-	if err := db.Where("customer_credit_id = ?", creditID).Find(&payments).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+func GetCustomerCreditPayments(customerID uuid.UUID) ([]CustomerCreditPayment, error) {
+	payments := []CustomerCreditPayment{}
+	if err := db.Preload("Allocations").Where("customer_id = ?", customerID).
+		Order("payment_date DESC").Find(&payments).Error; err != nil {
+		return nil, errors.New("failed to get customer payments")
 	}
-	return c.JSON(payments)
+	return payments, nil
+}
+
+// CustomerStatementLine is a credit (debit, raises the balance) or payment (credit, lowers it) on a statement
+type CustomerStatementLine struct {
+	Date        time.Time  `json:"date"`
+	Type        string     `json:"type"` // credit or payment
+	ID          uuid.UUID  `json:"id"`
+	StationID   *uuid.UUID `json:"station_id"`
+	Reference   string     `json:"reference"`
+	Description string     `json:"description"`
+	Debit       float64    `json:"debit"`
+	Credit      float64    `json:"credit"`
+	Balance     float64    `json:"balance"`
 }
-// GetCustomerCreditPayment retrieves a payment record by ID
-func GetCustomerCreditPayment(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var payment CustomerCreditPayment
-	if err := db.First(&payment, id).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Payment not found"})
+
+type CustomerStatement struct {
+	Customer       Customer                `json:"customer"`
+	From           time.Time               `json:"from"`
+	To             time.Time               `json:"to"`
+	OpeningBalance float64                 `json:"opening_balance"`
+	Lines          []CustomerStatementLine `json:"lines"`
+	TotalCredits   float64                 `json:"total_credits"`
+	TotalPayments  float64                 `json:"total_payments"`
+	ClosingBalance float64                 `json:"closing_balance"`
+}
+
+// GetCustomerStatement lists a customer's credits and payments in [from, to) with a running balance
+func GetCustomerStatement(customerID uuid.UUID, from, to time.Time) (*CustomerStatement, error) {
+	var customer Customer
+	if err := db.First(&customer, "id = ?", customerID).Error; err != nil {
+		return nil, errors.New("customer not found")
+	}
+
+	var openingCredits, openingPayments float64
+	if err := db.Model(&CustomerCredit{}).Select("COALESCE(SUM(amount), 0)").
+		Where("customer_id = ? AND date < ?", customerID, from).Scan(&openingCredits).Error; err != nil {
+		return nil, errors.New("failed to get opening balance")
 	}
-	return c.JSON(payment)
-}
\ No newline at end of file
+	if err := db.Model(&CustomerCreditPayment{}).Select("COALESCE(SUM(amount), 0)").
+		Where("customer_id = ? AND payment_date < ?", customerID, from).Scan(&openingPayments).Error; err != nil {
+		return nil, errors.New("failed to get opening balance")
+	}
+
+	var credits []CustomerCredit
+	if err := db.Preload("FuelProduct").Where("customer_id = ? AND date >= ? AND date < ?", customerID, from, to).
+		Find(&credits).Error; err != nil {
+		return nil, errors.New("failed to get customer credits")
+	}
+	var payments []CustomerCreditPayment
+	if err := db.Where("customer_id = ? AND payment_date >= ? AND payment_date < ?", customerID, from, to).
+		Find(&payments).Error; err != nil {
+		return nil, errors.New("failed to get customer payments")
+	}
+
+	lines := make([]CustomerStatementLine, 0, len(credits)+len(payments))
+	for _, credit := range credits {
+		description := "Fuel on credit"
+		if credit.FuelProduct != nil {
+			description = fmt.Sprintf("%s %.2f L", credit.FuelProduct.Name, credit.Liters)
+		}
+		if credit.VehicleRegistration != "" {
+			description += " " + credit.VehicleRegistration
+		}
+		lines = append(lines, CustomerStatementLine{Date: credit.Date, Type: "credit", ID: credit.ID, StationID: credit.StationID,
+			Reference: credit.Reference, Description: description, Debit: credit.Amount})
+	}
+	for _, payment := range payments {
+		lines = append(lines, CustomerStatementLine{Date: payment.PaymentDate, Type: "payment", ID: payment.ID, StationID: payment.StationID,
+			Reference: payment.Reference, Description: "Payment " + payment.Method, Credit: payment.Amount})
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Date.Before(lines[j].Date) })
+
+	statement := CustomerStatement{
+		Customer:       customer,
+		From:           from,
+		To:             to,
+		OpeningBalance: ledger.Round2(openingCredits - openingPayments),
+	}
+	balance := statement.OpeningBalance
+	for i := range lines {
+		balance = ledger.Round2(balance + lines[i].Debit - lines[i].Credit)
+		lines[i].Balance = balance
+		statement.TotalCredits = ledger.Round2(statement.TotalCredits + lines[i].Debit)
+		statement.TotalPayments = ledger.Round2(statement.TotalPayments + lines[i].Credit)
+	}
+	statement.Lines = lines
+	statement.ClosingBalance = balance
+	return &statement, nil
+}
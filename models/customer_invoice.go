@@ -0,0 +1,353 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/dancankarani/safa/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// customer invoice statuses
+const (
+	InvoiceIssued        = "issued"
+	InvoicePartiallyPaid = "partially_paid"
+	InvoicePaid          = "paid"
+	InvoiceVoid          = "void"
+)
+
+// customerInvoiceSequence names the DocumentSequence invoice numbers are drawn from
+const customerInvoiceSequence = "customer_invoice"
+
+// nextDocumentNumber hands out the next number of the named sequence. The row stays locked until tx ends,
+// so concurrent callers are numbered one after the other and a rolled back transaction leaves no gap.
+func nextDocumentNumber(tx *gorm.DB, name string) (int64, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&DocumentSequence{Name: name}).Error; err != nil {
+		return 0, err
+	}
+	var sequence DocumentSequence
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sequence, "name = ?", name).Error; err != nil {
+		return 0, err
+	}
+	sequence.LastNumber++
+	if err := tx.Model(&sequence).Update("last_number", sequence.LastNumber).Error; err != nil {
+		return 0, err
+	}
+	return sequence.LastNumber, nil
+}
+
+func invoiceStatus(total, paid float64) string {
+	switch {
+	case paid >= total-0.005:
+		return InvoicePaid
+	case paid > 0:
+		return InvoicePartiallyPaid
+	}
+	return InvoiceIssued
+}
+
+// generateInvoice bills a customer for their uninvoiced credits dated in [from, to), only those taken at
+// stationID when given. It returns nil when there is nothing to bill.
+func generateInvoice(c *fiber.Ctx, tx *gorm.DB, customer Customer, stationID *uuid.UUID, from, to time.Time, createdBy *uuid.UUID) (*CustomerInvoice, error) {
+	var credits []CustomerCredit
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("FuelProduct").
+		Where("customer_id = ? AND invoice_id IS NULL AND date >= ? AND date < ?", customer.ID, from, to)
+	if stationID != nil {
+		query = query.Where("station_id = ?", *stationID)
+	}
+	if err := query.Order("date").Find(&credits).Error; err != nil {
+		return nil, err
+	}
+	if len(credits) == 0 {
+		return nil, nil
+	}
+
+	number, err := nextDocumentNumber(tx, customerInvoiceSequence)
+	if err != nil {
+		log.Println("failed to number invoice:", err.Error())
+		return nil, errors.New("failed to number invoice")
+	}
+	id := uuid.New()
+	invoiceDate := truncateDay(time.Now().In(businessLocation()))
+	invoice := CustomerInvoice{
+		ID:          id,
+		InvoiceNo:   fmt.Sprintf("INV-%06d", number),
+		CustomerID:  customer.ID,
+		PeriodStart: from,
+		PeriodEnd:   to.AddDate(0, 0, -1),
+		InvoiceDate: invoiceDate,
+		DueDate:     invoiceDate.AddDate(0, 0, customer.PaymentTermsDays),
+		CreatedBy:   createdBy,
+	}
+	creditIDs := make([]uuid.UUID, len(credits))
+	for i, credit := range credits {
+		description := "Fuel on credit"
+		if credit.FuelProduct != nil {
+			description = credit.FuelProduct.Name
+		}
+		invoice.Lines = append(invoice.Lines, CustomerInvoiceLine{
+			ID:                  uuid.New(),
+			InvoiceID:           id,
+			CreditID:            credit.ID,
+			StationID:           credit.StationID,
+			Date:                credit.Date,
+			Description:         description,
+			VehicleRegistration: credit.VehicleRegistration,
+			Reference:           credit.Reference,
+			Liters:              credit.Liters,
+			UnitPrice:           credit.UnitPrice,
+			Amount:              credit.Amount,
+		})
+		invoice.TotalAmount = ledger.Round2(invoice.TotalAmount + credit.Amount)
+		invoice.AmountPaid = ledger.Round2(invoice.AmountPaid + credit.AmountPaid)
+		creditIDs[i] = credit.ID
+	}
+	invoice.Status = invoiceStatus(invoice.TotalAmount, invoice.AmountPaid)
+
+	if err := tx.Create(&invoice).Error; err != nil {
+		log.Println("failed to create invoice:", err.Error())
+		return nil, errors.New("failed to create invoice")
+	}
+	if err := tx.Model(&CustomerCredit{}).Where("id IN ?", creditIDs).Update("invoice_id", id).Error; err != nil {
+		return nil, err
+	}
+	if err := RecordAudit(c, tx, AuditEntityCustomerInvoice, invoice.ID, AuditCreate, nil, invoice); err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// GenerateCustomerInvoices bills every customer, or only customerID when given, for the credits they took in
+// [from, to) that are not on an invoice yet. With stationID only the credits taken at that station are billed.
+func GenerateCustomerInvoices(c *fiber.Ctx, customerID, stationID *uuid.UUID, from, to time.Time, createdBy *uuid.UUID) ([]CustomerInvoice, error) {
+	if !to.After(from) {
+		return nil, errors.New("end of the period must be after its start")
+	}
+	invoices := []CustomerInvoice{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		uninvoiced := tx.Model(&CustomerCredit{}).Select("customer_id").
+			Where("invoice_id IS NULL AND date >= ? AND date < ?", from, to)
+		if stationID != nil {
+			uninvoiced = uninvoiced.Where("station_id = ?", *stationID)
+		}
+		query := tx.Where("id IN (?)", uninvoiced)
+		if customerID != nil {
+			query = query.Where("id = ?", *customerID)
+		}
+		var customers []Customer
+		if err := query.Clauses(clause.Locking{Strength: "UPDATE"}).Order("name").Find(&customers).Error; err != nil {
+			return err
+		}
+		for _, customer := range customers {
+			invoice, err := generateInvoice(c, tx, customer, stationID, from, to, createdBy)
+			if err != nil {
+				return err
+			}
+			if invoice != nil {
+				invoices = append(invoices, *invoice)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if customerID != nil && len(invoices) == 0 {
+		return nil, errors.New("the customer has no uninvoiced credits in the period")
+	}
+	return invoices, nil
+}
+
+// SyncCustomerInvoice recomputes what has been paid on an invoice from its credits
+func SyncCustomerInvoice(tx *gorm.DB, id uuid.UUID) error {
+	var invoice CustomerInvoice
+	if err := tx.First(&invoice, "id = ?", id).Error; err != nil {
+		return err
+	}
+	if invoice.Status == InvoiceVoid {
+		return nil
+	}
+	var paid float64
+	if err := tx.Model(&CustomerCredit{}).Select("COALESCE(SUM(amount_paid), 0)").
+		Where("invoice_id = ?", id).Scan(&paid).Error; err != nil {
+		return err
+	}
+	paid = ledger.Round2(paid)
+	return tx.Model(&invoice).Updates(map[string]interface{}{
+		"amount_paid": paid,
+		"status":      invoiceStatus(invoice.TotalAmount, paid),
+	}).Error
+}
+
+// VoidCustomerInvoice cancels an invoice nothing has been paid on and frees its credits to be billed again
+func VoidCustomerInvoice(c *fiber.Ctx, id uuid.UUID) (*CustomerInvoice, error) {
+	var invoice CustomerInvoice
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invoice, "id = ?", id).Error; err != nil {
+			return errors.New("invoice not found")
+		}
+		if invoice.Status == InvoiceVoid {
+			return errors.New("invoice is already void")
+		}
+		if invoice.AmountPaid > 0 {
+			return errors.New("invoices with payments allocated cannot be voided")
+		}
+		before := invoice
+
+		if err := tx.Model(&CustomerCredit{}).Where("invoice_id = ?", id).Update("invoice_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("invoice_id = ?", id).Delete(&CustomerInvoiceLine{}).Error; err != nil {
+			return err
+		}
+		invoice.Status = InvoiceVoid
+		if err := tx.Model(&invoice).Update("status", InvoiceVoid).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityCustomerInvoice, invoice.ID, AuditUpdate, before, invoice)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+type CustomerInvoiceFilter struct {
+	CustomerID *uuid.UUID
+	StationID  *uuid.UUID // only invoices billing nothing but this station's credits
+	Status     string
+	Overdue    bool
+}
+
+func GetCustomerInvoices(filter CustomerInvoiceFilter) ([]CustomerInvoice, error) {
+	invoices := []CustomerInvoice{}
+	query := db.Preload("Customer")
+	if filter.CustomerID != nil {
+		query = query.Where("customer_id = ?", *filter.CustomerID)
+	}
+	if filter.StationID != nil {
+		query = query.Where("id IN (SELECT invoice_id FROM customer_invoice_lines WHERE station_id = ?)", *filter.StationID).
+			Where("id NOT IN (SELECT invoice_id FROM customer_invoice_lines WHERE station_id IS NULL OR station_id <> ?)", *filter.StationID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Overdue {
+		query = query.Where("status IN ? AND due_date < ?", []string{InvoiceIssued, InvoicePartiallyPaid}, truncateDay(time.Now().In(businessLocation())))
+	}
+	if err := query.Order("invoice_date DESC, invoice_no DESC").Find(&invoices).Error; err != nil {
+		return nil, errors.New("failed to get invoices")
+	}
+	return invoices, nil
+}
+
+func GetCustomerInvoiceByID(id uuid.UUID) (*CustomerInvoice, error) {
+	var invoice CustomerInvoice
+	if err := db.Preload("Customer").Preload("Lines", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("date")
+	}).First(&invoice, "id = ?", id).Error; err != nil {
+		return nil, errors.New("invoice not found")
+	}
+	return &invoice, nil
+}
+
+// CustomerAging is what one customer owes, by age
+type CustomerAging struct {
+	CustomerID   uuid.UUID `json:"customer_id"`
+	CustomerName string    `json:"customer_name"`
+	services.AgingBuckets
+}
+
+// StationAging is what customers owe for fuel taken at one station
+type StationAging struct {
+	StationID   *uuid.UUID      `json:"station_id"`
+	StationName string          `json:"station_name"`
+	Customers   []CustomerAging `json:"customers"`
+	services.AgingBuckets
+}
+
+type AgedReceivables struct {
+	AsOf      time.Time             `json:"as_of"`
+	Stations  []StationAging        `json:"stations"`
+	Customers []CustomerAging       `json:"customers"` // across all stations
+	Total     services.AgingBuckets `json:"total"`
+}
+
+// GetAgedReceivables buckets the credits still unpaid at the end of asOf by their age, per station and
+// overall, optionally for one station only
+func GetAgedReceivables(asOf time.Time, stationID *uuid.UUID) (*AgedReceivables, error) {
+	end := asOf.AddDate(0, 0, 1)
+	var rows []struct {
+		CustomerID   uuid.UUID
+		CustomerName string
+		StationID    *uuid.UUID
+		StationName  string
+		Date         time.Time
+		Outstanding  float64
+	}
+	query := db.Table("customer_credits").
+		Select(`customer_credits.customer_id, customers.name AS customer_name, customer_credits.station_id,
+			COALESCE(stations.name, '') AS station_name, customer_credits.date,
+			customer_credits.amount - COALESCE((SELECT SUM(a.amount) FROM customer_payment_allocations a
+				JOIN customer_credit_payments p ON p.id = a.payment_id
+				WHERE a.credit_id = customer_credits.id AND p.payment_date < ? AND p.deleted_at IS NULL), 0) AS outstanding`, end).
+		Joins("JOIN customers ON customers.id = customer_credits.customer_id").
+		Joins("LEFT JOIN stations ON stations.id = customer_credits.station_id").
+		Where("customer_credits.deleted_at IS NULL AND customer_credits.date < ?", end)
+	if stationID != nil {
+		query = query.Where("customer_credits.station_id = ?", *stationID)
+	}
+	if err := query.Order("station_name, customer_name").Scan(&rows).Error; err != nil {
+		return nil, errors.New("failed to get receivables")
+	}
+
+	report := &AgedReceivables{AsOf: asOf, Stations: []StationAging{}, Customers: []CustomerAging{}}
+	stationIndex := map[string]int{}
+	customerIndex := map[uuid.UUID]int{}
+	stationCustomerIndex := map[string]int{}
+	for _, row := range rows {
+		if row.Outstanding <= 0.005 {
+			continue
+		}
+		age := services.AgeInDays(row.Date, asOf)
+
+		stationKey := ""
+		if row.StationID != nil {
+			stationKey = row.StationID.String()
+		}
+		si, ok := stationIndex[stationKey]
+		if !ok {
+			si = len(report.Stations)
+			stationIndex[stationKey] = si
+			report.Stations = append(report.Stations, StationAging{StationID: row.StationID, StationName: row.StationName, Customers: []CustomerAging{}})
+		}
+		station := &report.Stations[si]
+		station.Add(row.Outstanding, age)
+
+		key := stationKey + "/" + row.CustomerID.String()
+		sci, ok := stationCustomerIndex[key]
+		if !ok {
+			sci = len(station.Customers)
+			stationCustomerIndex[key] = sci
+			station.Customers = append(station.Customers, CustomerAging{CustomerID: row.CustomerID, CustomerName: row.CustomerName})
+		}
+		station.Customers[sci].Add(row.Outstanding, age)
+
+		ci, ok := customerIndex[row.CustomerID]
+		if !ok {
+			ci = len(report.Customers)
+			customerIndex[row.CustomerID] = ci
+			report.Customers = append(report.Customers, CustomerAging{CustomerID: row.CustomerID, CustomerName: row.CustomerName})
+		}
+		report.Customers[ci].Add(row.Outstanding, age)
+
+		report.Total.Add(row.Outstanding, age)
+	}
+	return report, nil
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dancankarani/safa/internal/testutil"
+	"github.com/dancankarani/safa/ledger"
+	"github.com/google/uuid"
+)
+
+func TestUnlinkReadingCreditsRebooksAsSales(t *testing.T) {
+	conn := setupTestDB(t)
+	customer := Customer{ID: uuid.New(), Name: "Transporter", IsActive: true}
+	if err := conn.Create(&customer).Error; err != nil {
+		t.Fatal(err)
+	}
+	readingID := uuid.New()
+	credit := CustomerCredit{ID: uuid.New(), CustomerID: customer.ID, PumpReadingID: &readingID, Liters: 10, UnitPrice: 180, Amount: 1800}
+	if err := conn.Create(&credit).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := PostCustomerCreditJournal(conn, credit, customer); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UnlinkReadingCredits(testutil.Ctx(t, uuid.New()), conn, readingID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if liters, _ := ReadingCreditedLiters(conn, readingID); liters != 0 {
+		t.Errorf("reading still has %v credited litres", liters)
+	}
+	if got := testutil.AccountBalance(t, conn, ledger.CashAccount); got != 0 {
+		t.Errorf("cash = %v, want 0", got)
+	}
+	if got := testutil.AccountBalance(t, conn, ledger.FuelSalesAccount); got != -1800 {
+		t.Errorf("sales = %v, want -1800", got)
+	}
+	if got := testutil.AccountBalance(t, conn, ledger.ReceivablesAccount); got != 1800 {
+		t.Errorf("receivables = %v, want 1800", got)
+	}
+}
+
+func TestAddCustomerPaymentTerms(t *testing.T) {
+	cashOnDelivery, monthly := 0, 45
+	tests := []struct {
+		name  string
+		terms *int
+		want  int
+	}{
+		{"not given", nil, DefaultPaymentTermsDays},
+		{"cash on delivery", &cashOnDelivery, 0},
+		{"agreed terms", &monthly, 45},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := setupTestDB(t)
+			customer, err := AddCustomer(testutil.Ctx(t, uuid.New()), CustomerInput{Name: "Transporter", PhoneNumber: "0700000000", PaymentTermsDays: tt.terms})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stored Customer
+			conn.First(&stored, "id = ?", customer.ID)
+			if stored.PaymentTermsDays != tt.want {
+				t.Errorf("payment_terms_days = %v, want %v", stored.PaymentTermsDays, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomerInvoicesAreNumberedInSequence(t *testing.T) {
+	conn := setupTestDB(t)
+	day := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"Alpha Haulage", "Beta Transport"} {
+		customer := Customer{ID: uuid.New(), Name: name, IsActive: true}
+		if err := conn.Create(&customer).Error; err != nil {
+			t.Fatal(err)
+		}
+		credit := CustomerCredit{ID: uuid.New(), CustomerID: customer.ID, Date: day, Liters: 10, UnitPrice: 180, Amount: 1800}
+		if err := conn.Create(&credit).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	invoices, err := GenerateCustomerInvoices(testutil.Ctx(t, uuid.New()), nil, nil, day, day.AddDate(0, 0, 1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invoices) != 2 {
+		t.Fatalf("invoices = %d, want 2", len(invoices))
+	}
+	for i, want := range []string{"INV-000001", "INV-000002"} {
+		if invoices[i].InvoiceNo != want {
+			t.Errorf("invoice %d numbered %q, want %q", i, invoices[i].InvoiceNo, want)
+		}
+	}
+}
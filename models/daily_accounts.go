@@ -1,10 +1,14 @@
 package models
 
 import (
+	"errors"
+	"log"
 	"time"
 
+	"github.com/dancankarani/safa/ledger"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 func AddDailyAccounts(c *fiber.Ctx) error {
@@ -45,8 +49,25 @@ func AddDailyAccounts(c *fiber.Ctx) error {
 	}
 
 	dailyAccounts.ID = uuid.New()
+	dailyAccounts.Status = DailyAccountDraft
+	dailyAccounts.ApprovedBy, dailyAccounts.ApprovedAt, dailyAccounts.GeneratedAt = nil, nil, nil
 
-	if err := db.Create(&dailyAccounts).Error; err != nil {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var approved int64
+		if err := tx.Model(&DailyAccounts{}).
+			Where("station_id = ? AND business_day = ? AND status = ?", dailyAccounts.StationID, dailyAccounts.BusinessDay.Format("2006-01-02"), DailyAccountApproved).
+			Count(&approved).Error; err != nil {
+			return err
+		}
+		if approved > 0 {
+			return errors.New("daily accounts for this day are approved and locked")
+		}
+		if err := tx.Create(&dailyAccounts).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityDailyAccount, dailyAccounts.ID, AuditCreate, nil, dailyAccounts)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -54,8 +75,8 @@ func AddDailyAccounts(c *fiber.Ctx) error {
 }
 
 
-// GetDailyAccounts retrieves all daily accounts from the database
-func GetDailyAccounts(c *fiber.Ctx) error {
+// GetDailyAccounts retrieves all daily accounts from the database, only one station's when stationID is set
+func GetDailyAccounts(c *fiber.Ctx, stationID *uuid.UUID) error {
 	const DateFormat = "2006-01-02"
 	loc, err := time.LoadLocation("Africa/Nairobi") // Adjust to your business timezone
 	if err != nil {
@@ -84,7 +105,7 @@ func GetDailyAccounts(c *fiber.Ctx) error {
 	}
 
 	var dailyAccounts []DailyAccounts
-	if err := db.Preload("Station").Where("business_day >= ? AND business_day < ?", startOfDay, endOfDay).
+	if err := db.Preload("Station").Scopes(ForStation(stationID, "station_id = ?")).Where("business_day >= ? AND business_day < ?", startOfDay, endOfDay).
 		Find(&dailyAccounts).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to retrieve daily accounts",
@@ -94,7 +115,7 @@ func GetDailyAccounts(c *fiber.Ctx) error {
 	return c.JSON(dailyAccounts)
 }
 
-func GetMonthlyDailyAccounts(c *fiber.Ctx) error {
+func GetMonthlyDailyAccounts(c *fiber.Ctx, stationID *uuid.UUID) error {
 	const DateFormatYYYYMM = "2006-01"
 	loc, err := time.LoadLocation("Africa/Nairobi") // adjust timezone
 	if err != nil {
@@ -151,6 +172,7 @@ func GetMonthlyDailyAccounts(c *fiber.Ctx) error {
 				"COALESCE(SUM(mpesa),0) as total_mpesa, " +
 				"COALESCE(SUM(debt_paid),0) as total_debt_paid, " +
 				"COALESCE(SUM(debt_taken),0) as total_debt_taken").
+		Scopes(ForStation(stationID, "station_id = ?")).
 		Where("business_day >= ? AND business_day < ?", startDate, endDate).
 		Scan(&sums).Error
 
@@ -179,10 +201,20 @@ func UpdateDailyAccount(c *fiber.Ctx) error {
 	if err := db.First(&dailyAccounts, id).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Daily account not found"})
 	}
+	if dailyAccounts.Status == DailyAccountApproved {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "daily accounts for this day are approved and locked"})
+	}
+	before := dailyAccounts
 	// Parse the request body into the dailyAccounts struct
 	if err := c.BodyParser(&dailyAccounts); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
+	// computed figures and approval only change through generate and approve
+	dailyAccounts.ComputedSalesAmount, dailyAccounts.ComputedExpenses = before.ComputedSalesAmount, before.ComputedExpenses
+	dailyAccounts.ComputedDebtTaken, dailyAccounts.ComputedDebtPaid = before.ComputedDebtTaken, before.ComputedDebtPaid
+	dailyAccounts.ComputedMpesa, dailyAccounts.ComputedBank = before.ComputedMpesa, before.ComputedBank
+	dailyAccounts.GeneratedAt, dailyAccounts.Status = before.GeneratedAt, before.Status
+	dailyAccounts.ApprovedBy, dailyAccounts.ApprovedAt = before.ApprovedBy, before.ApprovedAt
 	// Validate required fields
 	if dailyAccounts.StationID == uuid.Nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "station_id is required"})
@@ -199,8 +231,193 @@ func UpdateDailyAccount(c *fiber.Ctx) error {
 	}
 	dailyAccounts.ID = uuid.MustParse(id)
 	// Update the dailyAccounts record in the database
-	if err := db.Save(&dailyAccounts).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&dailyAccounts).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityDailyAccount, dailyAccounts.ID, AuditUpdate, before, dailyAccounts)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.JSON(dailyAccounts)
 }
+
+const (
+	DailyAccountDraft    = "draft"
+	DailyAccountApproved = "approved"
+)
+
+// DailyAccountVariances is manual minus computed for every figure
+type DailyAccountVariances struct {
+	TotalSalesAmount float64 `json:"total_sales_amount"`
+	TotalExpenses    float64 `json:"total_expenses"`
+	DebtTaken        float64 `json:"debt_taken"`
+	DebtPaid         float64 `json:"debt_paid"`
+	Mpesa            float64 `json:"mpesa"`
+	Bank             float64 `json:"bank"`
+}
+
+type DailyAccountsReport struct {
+	DailyAccounts DailyAccounts         `json:"daily_accounts"`
+	Variances     DailyAccountVariances `json:"variances"`
+}
+
+func dailyAccountsReport(d DailyAccounts) DailyAccountsReport {
+	return DailyAccountsReport{
+		DailyAccounts: d,
+		Variances: DailyAccountVariances{
+			TotalSalesAmount: ledger.Round2(d.TotalSalesAmount - d.ComputedSalesAmount),
+			TotalExpenses:    ledger.Round2(d.TotalExpenses - d.ComputedExpenses),
+			DebtTaken:        ledger.Round2(d.DebtTaken - d.ComputedDebtTaken),
+			DebtPaid:         ledger.Round2(d.DebtPaid - d.ComputedDebtPaid),
+			Mpesa:            ledger.Round2(d.Mpesa - d.ComputedMpesa),
+			Bank:             ledger.Round2(d.Bank - d.ComputedBank),
+		},
+	}
+}
+
+// computeDailyFigures derives the day's figures of a station from the source tables.
+// day must be midnight in the business timezone.
+func computeDailyFigures(tx *gorm.DB, stationID uuid.UUID, day time.Time, d *DailyAccounts) error {
+	dayStr := day.Format("2006-01-02")
+	next := day.AddDate(0, 0, 1)
+
+	sum := func(query *gorm.DB, column string, dest *float64) error {
+		return query.Select("COALESCE(SUM(" + column + "), 0)").Scan(dest).Error
+	}
+
+	if err := sum(tx.Model(&PumpReadings{}).
+		Joins("JOIN pumps ON pumps.id = pump_readings.pump_id").
+		Where("pumps.station_id = ? AND pump_readings.business_day = ?", stationID, dayStr),
+		"pump_readings.total_sales_amount", &d.ComputedSalesAmount); err != nil {
+		return err
+	}
+	if err := sum(tx.Model(&Expenses{}).
+		Where("station_id = ? AND expense_date >= ? AND expense_date < ?", stationID, day, next),
+		"amount", &d.ComputedExpenses); err != nil {
+		return err
+	}
+	if err := sum(tx.Model(&CustomerCredit{}).
+		Where("station_id = ? AND date >= ? AND date < ?", stationID, day, next),
+		"amount", &d.ComputedDebtTaken); err != nil {
+		return err
+	}
+	if err := sum(tx.Model(&CustomerCreditPayment{}).
+		Where("station_id = ? AND payment_date >= ? AND payment_date < ?", stationID, day, next),
+		"amount", &d.ComputedDebtPaid); err != nil {
+		return err
+	}
+	if err := sum(tx.Model(&CashUp{}).
+		Where("station_id = ? AND business_day = ?", stationID, dayStr),
+		"mpesa", &d.ComputedMpesa); err != nil {
+		return err
+	}
+	return sum(tx.Model(&CashUp{}).
+		Where("station_id = ? AND business_day = ?", stationID, dayStr),
+		"bank", &d.ComputedBank)
+}
+
+// GenerateDailyAccounts computes the day's figures of a station from pump readings, expenses,
+// customer credits and cash-ups. Manually entered figures are kept so their variances show;
+// a day that had no manual entry takes the computed figures. Approved days cannot be regenerated.
+func GenerateDailyAccounts(c *fiber.Ctx, stationID uuid.UUID, businessDay time.Time) (*DailyAccountsReport, error) {
+	loc, err := time.LoadLocation("Africa/Nairobi")
+	if err != nil {
+		return nil, errors.New("failed to load location")
+	}
+	day := time.Date(businessDay.Year(), businessDay.Month(), businessDay.Day(), 0, 0, 0, 0, loc)
+	if day.After(time.Now().In(loc)) {
+		return nil, errors.New("business_day cannot be in the future")
+	}
+
+	var dailyAccounts DailyAccounts
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("station_id = ? AND business_day = ?", stationID, day.Format("2006-01-02")).First(&dailyAccounts).Error
+		exists := err == nil
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if exists && dailyAccounts.Status == DailyAccountApproved {
+			return errors.New("daily accounts for this day are approved and locked")
+		}
+		before := dailyAccounts
+
+		if err := computeDailyFigures(tx, stationID, day, &dailyAccounts); err != nil {
+			log.Println("failed to compute daily accounts:", err.Error())
+			return errors.New("failed to compute daily accounts")
+		}
+		now := time.Now()
+		dailyAccounts.GeneratedAt = &now
+
+		if exists {
+			if err := tx.Save(&dailyAccounts).Error; err != nil {
+				return err
+			}
+			return RecordAudit(c, tx, AuditEntityDailyAccount, dailyAccounts.ID, AuditUpdate, before, dailyAccounts)
+		}
+
+		dailyAccounts.ID = uuid.New()
+		dailyAccounts.StationID = stationID
+		dailyAccounts.BusinessDay = day
+		dailyAccounts.Status = DailyAccountDraft
+		dailyAccounts.TotalSalesAmount = dailyAccounts.ComputedSalesAmount
+		dailyAccounts.TotalExpenses = dailyAccounts.ComputedExpenses
+		dailyAccounts.DebtTaken = dailyAccounts.ComputedDebtTaken
+		dailyAccounts.DebtPaid = dailyAccounts.ComputedDebtPaid
+		dailyAccounts.Mpesa = dailyAccounts.ComputedMpesa
+		dailyAccounts.Bank = dailyAccounts.ComputedBank
+		if err := tx.Create(&dailyAccounts).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityDailyAccount, dailyAccounts.ID, AuditCreate, nil, dailyAccounts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	report := dailyAccountsReport(dailyAccounts)
+	return &report, nil
+}
+
+// ApproveDailyAccounts locks a day so it can no longer be edited or regenerated
+func ApproveDailyAccounts(c *fiber.Ctx, id uuid.UUID) (*DailyAccountsReport, error) {
+	var dailyAccounts DailyAccounts
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&dailyAccounts, "id = ?", id).Error; err != nil {
+			return errors.New("daily account not found")
+		}
+		if dailyAccounts.Status == DailyAccountApproved {
+			return errors.New("daily accounts are already approved")
+		}
+		if dailyAccounts.GeneratedAt == nil {
+			return errors.New("generate the day before approving it")
+		}
+		before := dailyAccounts
+
+		now := time.Now()
+		dailyAccounts.Status = DailyAccountApproved
+		dailyAccounts.ApprovedAt = &now
+		if userID, ok := c.Locals("user_id").(*uuid.UUID); ok {
+			dailyAccounts.ApprovedBy = userID
+		}
+		if err := tx.Save(&dailyAccounts).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityDailyAccount, dailyAccounts.ID, AuditUpdate, before, dailyAccounts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	report := dailyAccountsReport(dailyAccounts)
+	return &report, nil
+}
+
+// GetDailyAccountsReport returns the daily account id with its variances
+func GetDailyAccountsReport(c *fiber.Ctx, id uuid.UUID) (*DailyAccountsReport, error) {
+	var dailyAccounts DailyAccounts
+	if err := db.First(&dailyAccounts, "id = ?", id).Error; err != nil {
+		return nil, errors.New("daily account not found")
+	}
+	report := dailyAccountsReport(dailyAccounts)
+	return &report, nil
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/dancankarani/safa/internal/testutil"
+	"gorm.io/gorm"
+)
+
+// setupTestDB points the package at a fresh in-memory database with the full schema for the length of a test
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	conn := testutil.OpenDB(t)
+	previous := db
+	db = conn
+	t.Cleanup(func() { db = previous })
+	MigrateDb()
+	return conn
+}
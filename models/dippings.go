@@ -23,8 +23,20 @@ func (d *Dippings) BeforeCreate(tx *gorm.DB) (err error) {
 	return nil
 }
 
-func CreateDipping ( dippings *Dippings)(*Dippings, error) {
-	if err := db.Create(dippings).Error; err != nil {
+func CreateDipping (c *fiber.Ctx, dippings *Dippings)(*Dippings, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := EnsureTankPeriodOpen(tx, dippings.TankID, dippings.DippingDate); err != nil {
+			return err
+		}
+		if err := ApplyDipCalibration(tx, dippings); err != nil {
+			return err
+		}
+		if err := tx.Create(dippings).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityDipping, dippings.ID, AuditCreate, nil, dippings)
+	})
+	if err != nil {
 		return nil,err
 	}
 	return dippings, nil
@@ -46,17 +58,17 @@ func GetDippingByStationID(id uuid.UUID) ([]Dippings, error) {
 	return dippings, nil
 }
 //get dippings by fuel product
-func GetDippingByFuelProductID(id uuid.UUID) ([]Dippings, error) {
+func GetDippingByFuelProductID(stationID *uuid.UUID, id uuid.UUID) ([]Dippings, error) {
 	var dippings []Dippings
-	if err := db.Find(&dippings, "fuel_product_id = ?", id).Error; err != nil {
+	if err := db.Scopes(ForStation(stationID, "tank_id IN (SELECT id FROM tanks WHERE station_id = ?)")).Find(&dippings, "fuel_product_id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return dippings, nil
 }
 //get dippings by date
-func GetDippingByDippingDate(date time.Time) ([]Dippings, error) {
+func GetDippingByDippingDate(stationID *uuid.UUID, date time.Time) ([]Dippings, error) {
 	var dippings []Dippings
-	if err := db.Find(&dippings, "dipping_date = ?", date).Error; err != nil {
+	if err := db.Scopes(ForStation(stationID, "tank_id IN (SELECT id FROM tanks WHERE station_id = ?)")).Find(&dippings, "dipping_date = ?", date).Error; err != nil {
 		return nil, err
 	}
 	return dippings, nil
@@ -69,10 +81,15 @@ func DeleteDipping(c *fiber.Ctx, id uuid.UUID) error {
 	if err := db.First(&dippings, "id = ?", id).Error; err != nil {
 		return err
 	}
-	if err := db.Delete(&dippings).Error; err != nil {
-		return err
-	}
-	return nil
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := EnsureTankPeriodOpen(tx, dippings.TankID, dippings.DippingDate); err != nil {
+			return err
+		}
+		if err := tx.Delete(&dippings).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityDipping, dippings.ID, AuditDelete, dippings, nil)
+	})
 }
  
 // get all paginated dippings
@@ -85,7 +102,7 @@ type DippingResponse struct {
 
 // func GetUnitCostAtDate(stationID, fuelProductID uuid.UUID, date time.Time) (float64, error)
 
-func GetAllDippings(c *fiber.Ctx) ([]DippingResponse, error) {
+func GetAllDippings(c *fiber.Ctx, stationID *uuid.UUID) ([]DippingResponse, error) {
 	var dippings []Dippings
 
 	page := c.QueryInt("page", 1)
@@ -117,6 +134,7 @@ func GetAllDippings(c *fiber.Ctx) ([]DippingResponse, error) {
 		Preload("Tank").
 		Preload("Tank.FuelProduct").
 		Preload("Tank.Station").
+		Scopes(ForStation(stationID, "tank_id IN (SELECT id FROM tanks WHERE station_id = ?)")).
 		Where("dipping_date >= ? AND dipping_date < ?", startDate, endDate).
 		Limit(pageSize).
 		Offset(offset).
@@ -256,10 +274,7 @@ func ComparePumpReadingsWithDippings(c *fiber.Ctx) (*ResTankComparison, error) {
 }
 
 func GetUnitCostAtDate(stationID, fuelProductID uuid.UUID, date time.Time) (float64, error) {
-	var sfp StationFuelProduct
-	err := db.Where("station_id = ? AND fuel_product_id = ? AND effective_from <= ?", stationID, fuelProductID, date).
-		Order("effective_from DESC").
-		First(&sfp).Error
+	sfp, err := EffectiveFuelPrice(db, stationID, fuelProductID, date)
 	if err != nil {
 		return 0, err
 	}
@@ -326,6 +341,7 @@ func UpdateDippings(c *fiber.Ctx, dippingID uuid.UUID) (*Dippings, error) {
 	if err := db.First(&existing, "id = ?", dippingID).Error; err != nil {
 		return nil, errors.New("dipping not found")
 	}
+	before := existing
 
 	// Only update fields that are non-zero or non-default
 	if updateData.OpeningDip != 0 {
@@ -343,12 +359,48 @@ func UpdateDippings(c *fiber.Ctx, dippingID uuid.UUID) (*Dippings, error) {
 	if updateData.ClosingMeter != 0 {
 		existing.ClosingMeter = updateData.ClosingMeter
 	}
+	// a dip re-entered in litres drops the stale height so it is recomputed
+	if updateData.OpeningDip != 0 || updateData.OpeningDipCm != nil {
+		existing.OpeningDipCm = updateData.OpeningDipCm
+	}
+	if updateData.ClosingDip != 0 || updateData.ClosingDipCm != nil {
+		existing.ClosingDipCm = updateData.ClosingDipCm
+	}
+	if updateData.Temperature != nil {
+		existing.Temperature = updateData.Temperature
+	}
+	if updateData.WaterLevelCm != nil {
+		existing.WaterLevelCm = updateData.WaterLevelCm
+	}
 	// Add more fields as needed
 
 	// Recalculate LitersDispensed if relevant fields changed
 	existing.LitersDispensed = existing.OpeningDip + existing.AmountSupplied - existing.ClosingDip
 
-	if err := db.Save(&existing).Error; err != nil {
+	// calibration errors describe the dips sent and go back to the client, anything else is only logged
+	var invalidDip error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := EnsureTankPeriodOpen(tx, before.TankID, before.DippingDate); err != nil {
+			return err
+		}
+		if err := EnsureTankPeriodOpen(tx, existing.TankID, existing.DippingDate); err != nil {
+			return err
+		}
+		if err := ApplyDipCalibration(tx, &existing); err != nil {
+			invalidDip = err
+			return err
+		}
+		existing.LitersDispensed = existing.OpeningDip + existing.AmountSupplied - existing.ClosingDip
+		if err := tx.Save(&existing).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityDipping, existing.ID, AuditUpdate, before, existing)
+	})
+	if err != nil {
+		if errors.Is(err, ErrPeriodClosed) || invalidDip != nil {
+			return nil, err
+		}
+		log.Println(err.Error())
 		return nil, errors.New("failed to update dipping")
 	}
 
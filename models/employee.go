@@ -79,6 +79,11 @@ func CreateEmployee(c *fiber.Ctx, e *Employee)( *Employee, error) {
 		return nil, errors.New("invalid email")
 	}
 
+	e.SetRole(e.Role)
+	if !services.IsValidRole(e.Role) {
+		return nil, errors.New("invalid role")
+	}
+
 	password,_ := services.GenerateFormattedPassword()
 	hashed_password, err := services.HashPassword(password)
 	if err != nil {
@@ -86,6 +91,7 @@ func CreateEmployee(c *fiber.Ctx, e *Employee)( *Employee, error) {
 	}
 	
 	e.Password = hashed_password
+	e.MustChangePassword = true
 
 
 	if err := db.Create(e).Error; err != nil {
@@ -166,6 +172,24 @@ func GetAllEmployees(c *fiber.Ctx) (*ResEmployees, error) {
 }
 
 
+//get employees working in a station
+func GetEmployeesByStation(c *fiber.Ctx, stationID uuid.UUID) (*ResEmployees, error) {
+	var employees []Employee
+	if err := db.Preload("Station").
+		Preload("Payments").
+		Preload("SalaryAdvance").
+		Where("station_id = ?", stationID).
+		Find(&employees).Error; err != nil {
+		return nil, errors.New("failed to retrieve employees")
+	}
+
+	return &ResEmployees{
+		Employees: employees,
+		Count:     len(employees),
+	}, nil
+}
+
+
 func UpdateEmployee(c *fiber.Ctx, id uuid.UUID, updatedData *Employee) (*Employee, error) {
 	var employee Employee
 	if err := db.First(&employee, "id = ?", id).Error; err != nil {
@@ -185,6 +209,9 @@ func UpdateEmployee(c *fiber.Ctx, id uuid.UUID, updatedData *Employee) (*Employe
 		employee.Position = updatedData.Position
 	}
 	if updatedData.Role != "" {
+		if !services.IsValidRole(updatedData.Role) {
+			return nil, errors.New("invalid role")
+		}
 		employee.Role = updatedData.Role
 	}
 
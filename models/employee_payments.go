@@ -6,8 +6,10 @@ import (
 	"log"
 	"time"
 
+	"github.com/dancankarani/safa/ledger"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 
@@ -36,7 +38,20 @@ func AddEmployeePayment(c *fiber.Ctx,p *Payment) (*Payment, error) {
 	}
 
 	// Save payment
-	if err := db.Create(p).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(p).Error; err != nil {
+			return err
+		}
+		var employee Employee
+		if err := tx.Select("id", "station_id").First(&employee, "id = ?", p.EmployeeID).Error; err != nil {
+			return fmt.Errorf("employee not found")
+		}
+		if err := PostEmployeePaymentJournal(tx, *p, &employee.StationID); err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityEmployeePayment, p.ID, AuditCreate, nil, p)
+	})
+	if err != nil {
 		log.Printf("Error creating employee payment: %v", err)
 		return nil, fmt.Errorf("error creating employee payment: %v", err)
 	}
@@ -45,27 +60,65 @@ func AddEmployeePayment(c *fiber.Ctx,p *Payment) (*Payment, error) {
 }
 
 //update employee payment
-func UpdateEmployeePayment(employeePayment *Payment, id uuid.UUID) (*Payment, error) {
-	err := db.First(&employeePayment, "id = ?", id).Error
+func UpdateEmployeePayment(c *fiber.Ctx, employeePayment *Payment, id uuid.UUID) (*Payment, error) {
+	var payment Payment
+	err := db.First(&payment, "id = ?", id).Error
 	if err != nil {
 		log.Printf("Error finding employee payment: %v", err)
 		return nil, fmt.Errorf("error finding employee payment: %v", err)
 	}
-	err = db.Save(&employeePayment).Error
+	before := payment
+	if employeePayment.Amount != 0 {
+		payment.Amount = employeePayment.Amount
+	}
+	if employeePayment.Description != "" {
+		payment.Description = employeePayment.Description
+	}
+	if !employeePayment.PaymentDate.IsZero() {
+		payment.PaymentDate = employeePayment.PaymentDate
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&payment).Error; err != nil {
+			return err
+		}
+		// the original salary entry is reversed and the corrected payment posted again
+		userID, _ := c.Locals("user_id").(*uuid.UUID)
+		if err := ledger.Reverse(tx, ledger.SourceEmployeePayment, payment.ID, before.PaymentDate, userID); err != nil {
+			return err
+		}
+		var employee Employee
+		if err := tx.Select("id", "station_id").First(&employee, "id = ?", payment.EmployeeID).Error; err != nil {
+			return fmt.Errorf("employee not found")
+		}
+		if err := PostEmployeePaymentJournal(tx, payment, &employee.StationID); err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityEmployeePayment, payment.ID, AuditUpdate, before, payment)
+	})
 	if err != nil {
 		log.Printf("Error updating employee payment: %v", err)
 		return nil, fmt.Errorf("error updating employee payment: %v", err)
 	}
-	return employeePayment, nil
+	return &payment, nil
 }
 
 //delete the payment 
-func DeletePayment(id uuid.UUID) error {
+func DeletePayment(c *fiber.Ctx, id uuid.UUID) error {
 	var payment Payment
 	if err := db.First(&payment, "id = ?", id).Error; err != nil {
 		return errors.New("payment not found")
 	}
-	if err := db.Delete(&payment).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&payment).Error; err != nil {
+			return err
+		}
+		userID, _ := c.Locals("user_id").(*uuid.UUID)
+		if err := ledger.Reverse(tx, ledger.SourceEmployeePayment, payment.ID, payment.PaymentDate, userID); err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityEmployeePayment, payment.ID, AuditDelete, payment, nil)
+	})
+	if err != nil {
 		return errors.New("failed to delete payment")
 	}
 	return nil
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/dancankarani/safa/ledger"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -22,7 +23,22 @@ func (e *Expenses) BeforeUpdate(tx *gorm.DB) (err error) {
 
 func CreateExpenses(c *fiber.Ctx, e *Expenses) (*Expenses, error) {
 	db.AutoMigrate(&Expenses{})
-	if err := db.Create(e).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := EnsurePeriodOpen(tx, e.StationID, e.ExpenseDate); err != nil {
+			return err
+		}
+		if err := tx.Create(e).Error; err != nil {
+			return err
+		}
+		if err := PostExpenseJournal(tx, *e); err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityExpense, e.ID, AuditCreate, nil, e)
+	})
+	if err != nil {
+		if errors.Is(err, ErrPeriodClosed) {
+			return nil, err
+		}
 		return nil, errors.New("failed to create expenses")
 	}
 	return e, nil
@@ -33,6 +49,7 @@ func UpdateExpenses(c *fiber.Ctx, id uuid.UUID, updatedData *Expenses) (*Expense
 	if err := db.First(&expenses, "id = ?", id).Error; err != nil {
 		return nil, errors.New("expenses not found")
 	}
+	before := expenses
 	expenses.ExpenseType = updatedData.ExpenseType
 	if updatedData.Amount != 0 {
 		expenses.Amount = updatedData.Amount
@@ -42,16 +59,40 @@ func UpdateExpenses(c *fiber.Ctx, id uuid.UUID, updatedData *Expenses) (*Expense
 	}
 	expenses.ExpenseDate = updatedData.ExpenseDate
 
-	if err := db.Save(&expenses).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// both the old and the new date must be in open periods
+		if err := EnsurePeriodOpen(tx, before.StationID, before.ExpenseDate); err != nil {
+			return err
+		}
+		if err := EnsurePeriodOpen(tx, expenses.StationID, expenses.ExpenseDate); err != nil {
+			return err
+		}
+		if err := tx.Save(&expenses).Error; err != nil {
+			return err
+		}
+		// the ledger is never edited, the original entry is reversed and the corrected expense posted again
+		userID, _ := c.Locals("user_id").(*uuid.UUID)
+		if err := ledger.Reverse(tx, ledger.SourceExpense, expenses.ID, before.ExpenseDate, userID); err != nil {
+			return err
+		}
+		if err := PostExpenseJournal(tx, expenses); err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityExpense, expenses.ID, AuditUpdate, before, expenses)
+	})
+	if err != nil {
+		if errors.Is(err, ErrPeriodClosed) {
+			return nil, err
+		}
 		return nil, errors.New("failed to update expenses")
 	}
 	return &expenses, nil
 }
 
 //get expenses
-func GetExpenses(c *fiber.Ctx) ([]Expenses, error) {
+func GetExpenses(c *fiber.Ctx, stationID *uuid.UUID) ([]Expenses, error) {
 	var expenses []Expenses
-	if err := db.Find(&expenses).Error; err != nil {
+	if err := db.Scopes(ForStation(stationID, "station_id = ?")).Find(&expenses).Error; err != nil {
 		return nil, errors.New("failed to get expenses")
 	}
 	return expenses, nil
@@ -71,7 +112,7 @@ type ResExpenses struct {
 	Total    float64
 }
 
-func GetExpensesByDate(c *fiber.Ctx) (*ResExpenses, error) {
+func GetExpensesByDate(c *fiber.Ctx, stationID *uuid.UUID) (*ResExpenses, error) {
 	// Get date query or default to current day
 	dateParam := c.Query("date")
 	var targetDate time.Time
@@ -90,7 +131,7 @@ func GetExpensesByDate(c *fiber.Ctx) (*ResExpenses, error) {
 	endOfDay := startOfDay.Add(24 * time.Hour)
 
 	var expenses []Expenses
-	if err := db.Where("expense_date >= ? AND expense_date < ?", startOfDay, endOfDay).Find(&expenses).Error; err != nil {
+	if err := db.Scopes(ForStation(stationID, "station_id = ?")).Where("expense_date >= ? AND expense_date < ?", startOfDay, endOfDay).Find(&expenses).Error; err != nil {
 		return nil, errors.New("failed to get expenses")
 	}
 
@@ -112,14 +153,30 @@ func DeleteExpenses(c *fiber.Ctx, id uuid.UUID) error {
 	if err := db.First(&expenses, "id = ?", id).Error; err != nil {
 		return errors.New("expenses not found")
 	}
-	if err := db.Delete(&expenses).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := EnsurePeriodOpen(tx, expenses.StationID, expenses.ExpenseDate); err != nil {
+			return err
+		}
+		if err := tx.Delete(&expenses).Error; err != nil {
+			return err
+		}
+		userID, _ := c.Locals("user_id").(*uuid.UUID)
+		if err := ledger.Reverse(tx, ledger.SourceExpense, expenses.ID, expenses.ExpenseDate, userID); err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityExpense, expenses.ID, AuditDelete, expenses, nil)
+	})
+	if err != nil {
+		if errors.Is(err, ErrPeriodClosed) {
+			return err
+		}
 		return errors.New("failed to delete expenses")
 	}
 	return nil
 }
 
 //GET EXPENSES OF A PROVIDED DURATION 
-func GetExpensesByDuration(c *fiber.Ctx, startDate, endDate time.Time) ([]Expenses, error) {
+func GetExpensesByDuration(c *fiber.Ctx, stationID *uuid.UUID, startDate, endDate time.Time) ([]Expenses, error) {
 	var expenses []Expenses
 
 	// If both dates are zero (not provided), use current month's range
@@ -129,7 +186,7 @@ func GetExpensesByDuration(c *fiber.Ctx, startDate, endDate time.Time) ([]Expens
 		endDate = now
 	}
 
-	if err := db.Where("expense_date BETWEEN ? AND ?", startDate, endDate).Find(&expenses).Error; err != nil {
+	if err := db.Scopes(ForStation(stationID, "station_id = ?")).Where("expense_date BETWEEN ? AND ?", startDate, endDate).Find(&expenses).Error; err != nil {
 		return nil, errors.New("expenses not found")
 	}
 
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dancankarani/safa/internal/testutil"
+	"github.com/dancankarani/safa/ledger"
+	"github.com/google/uuid"
+)
+
+func TestExpenseEditAndDeleteFollowLedger(t *testing.T) {
+	conn := setupTestDB(t)
+	c := testutil.Ctx(t, uuid.New())
+	day := time.Now().Add(-time.Hour)
+
+	expense := &Expenses{StationID: uuid.New(), Amount: 500, ExpenseType: "repairs", ExpenseDate: day}
+	if _, err := CreateExpenses(c, expense); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := UpdateExpenses(c, expense.ID, &Expenses{ExpenseType: "repairs", Amount: 800, ExpenseDate: day}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got := testutil.AccountBalance(t, conn, ledger.ExpensesAccount); got != 800 {
+		t.Errorf("expenses after edit = %v, want 800", got)
+	}
+	if got := testutil.AccountBalance(t, conn, ledger.CashAccount); got != -800 {
+		t.Errorf("cash after edit = %v, want -800", got)
+	}
+
+	if err := DeleteExpenses(c, expense.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got := testutil.AccountBalance(t, conn, ledger.ExpensesAccount); got != 0 {
+		t.Errorf("expenses after delete = %v, want 0", got)
+	}
+	if got := testutil.AccountBalance(t, conn, ledger.CashAccount); got != 0 {
+		t.Errorf("cash after delete = %v, want 0", got)
+	}
+}
+
+func TestEmployeePaymentEditAndDeleteFollowLedger(t *testing.T) {
+	conn := setupTestDB(t)
+	employee := Employee{ID: uuid.New(), StationID: uuid.New(), FirstName: "Jane"}
+	if err := conn.Create(&employee).Error; err != nil {
+		t.Fatal(err)
+	}
+	c := testutil.Ctx(t, uuid.New())
+	c.Request().URI().SetQueryString("month=2025-06")
+
+	payment := &Payment{EmployeeID: employee.ID, Amount: 20000}
+	if _, err := AddEmployeePayment(c, payment); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := UpdateEmployeePayment(c, &Payment{Amount: 18000}, payment.ID); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got := testutil.AccountBalance(t, conn, ledger.SalariesAccount); got != 18000 {
+		t.Errorf("salaries after edit = %v, want 18000", got)
+	}
+	if got := testutil.AccountBalance(t, conn, ledger.CashAccount); got != -18000 {
+		t.Errorf("cash after edit = %v, want -18000", got)
+	}
+
+	if err := DeletePayment(c, payment.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got := testutil.AccountBalance(t, conn, ledger.SalariesAccount); got != 0 {
+		t.Errorf("salaries after delete = %v, want 0", got)
+	}
+	if got := testutil.AccountBalance(t, conn, ledger.CashAccount); got != 0 {
+		t.Errorf("cash after delete = %v, want 0", got)
+	}
+}
+
+func TestGetExpensesForStation(t *testing.T) {
+	conn := setupTestDB(t)
+	c := testutil.Ctx(t, uuid.New())
+	own, other := uuid.New(), uuid.New()
+	for _, stationID := range []uuid.UUID{own, other} {
+		if err := conn.Create(&Expenses{ID: uuid.New(), StationID: stationID, Amount: 100, ExpenseType: "repairs", ExpenseDate: time.Now()}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expenses, err := GetExpenses(c, &own)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expenses) != 1 || expenses[0].StationID != own {
+		t.Errorf("station expenses = %+v, want only station %s", expenses, own)
+	}
+	if all, _ := GetExpenses(c, nil); len(all) != 2 {
+		t.Errorf("unscoped expenses = %d, want 2", len(all))
+	}
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dancankarani/safa/services"
+	"github.com/google/uuid"
+)
+
+// TankForecast is the consumption forecast and order suggestion of one tank
+type TankForecast struct {
+	TankID          uuid.UUID          `json:"tank_id"`
+	TankName        string             `json:"tank_name"`
+	FuelProductID   uuid.UUID          `json:"fuel_product_id"`
+	FuelProductName string             `json:"fuel_product_name"`
+	Level           services.TankLevel `json:"level"`
+	Forecast        services.Forecast  `json:"forecast"`
+}
+
+// StationFuelForecast groups the tank forecasts of a station
+type StationFuelForecast struct {
+	StationID uuid.UUID               `json:"station_id"`
+	Today     time.Time               `json:"today"`
+	Params    services.ForecastParams `json:"params"`
+	Tanks     []TankForecast          `json:"tanks"`
+}
+
+// tankDailyUsage sums the litres dispensed per tank and business day from the pump readings of pumps linked to the tank
+func tankDailyUsage(stationID uuid.UUID, from, to time.Time) (map[uuid.UUID][]services.DailyUsage, error) {
+	var rows []struct {
+		TankID uuid.UUID
+		Day    time.Time
+		Liters float64
+	}
+	err := db.Table("pump_readings").
+		Select("tank_pumps.tank_id, pump_readings.business_day AS day, SUM(pump_readings.liters_dispensed) AS liters").
+		Joins("JOIN tank_pumps ON tank_pumps.pump_id = pump_readings.pump_id").
+		Joins("JOIN tanks ON tanks.id = tank_pumps.tank_id").
+		Where("tanks.station_id = ? AND pump_readings.deleted_at IS NULL", stationID).
+		Where("pump_readings.business_day >= ? AND pump_readings.business_day < ?", from, to).
+		Group("tank_pumps.tank_id, pump_readings.business_day").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	usage := map[uuid.UUID][]services.DailyUsage{}
+	for _, row := range rows {
+		usage[row.TankID] = append(usage[row.TankID], services.DailyUsage{Day: row.Day, Liters: row.Liters})
+	}
+	return usage, nil
+}
+
+// GetStationFuelForecast forecasts daily consumption, days of cover and the next order of every tank of a station
+func GetStationFuelForecast(stationID uuid.UUID, params services.ForecastParams) (*StationFuelForecast, error) {
+	if params.Window <= 0 {
+		params.Window = services.DefaultForecastWindow
+	}
+	if params.Horizon <= 0 {
+		params.Horizon = services.DefaultForecastHorizon
+	}
+	if params.Window > 365 || params.Horizon > 90 {
+		return nil, errors.New("window is limited to 365 days and horizon to 90 days")
+	}
+
+	now := time.Now().In(businessLocation())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var tanks []Tank
+	if err := db.Preload("FuelProduct").Where("station_id = ?", stationID).Order("name").Find(&tanks).Error; err != nil {
+		return nil, errors.New("failed to get tanks")
+	}
+
+	usage, err := tankDailyUsage(stationID, today.AddDate(0, 0, -params.Window), today)
+	if err != nil {
+		log.Println("failed to get tank usage:", err.Error())
+		return nil, errors.New("failed to get tank usage")
+	}
+
+	var stocks []FuelStock
+	if err := db.Where("station_id = ?", stationID).Find(&stocks).Error; err != nil {
+		return nil, errors.New("failed to get fuel stock")
+	}
+	volumes := map[uuid.UUID]float64{}
+	for _, stock := range stocks {
+		volumes[stock.TankID] = stock.CurrentVolume
+	}
+
+	result := &StationFuelForecast{StationID: stationID, Today: today, Params: params, Tanks: []TankForecast{}}
+	for _, tank := range tanks {
+		level := services.EvaluateTankLevel(tank.Capacity, tank.ReorderLevel, tank.HighLevel, volumes[tank.ID])
+		result.Tanks = append(result.Tanks, TankForecast{
+			TankID:          tank.ID,
+			TankName:        tank.Name,
+			FuelProductID:   tank.FuelProductID,
+			FuelProductName: tank.FuelProduct.Name,
+			Level:           level,
+			Forecast:        services.ForecastTank(usage[tank.ID], today, level, params),
+		})
+	}
+	return result, nil
+}
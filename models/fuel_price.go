@@ -0,0 +1,226 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// fuel price version statuses
+const (
+	PriceScheduled  = "scheduled"  // takes effect in the future
+	PriceActive     = "active"     // the price in effect now
+	PriceSuperseded = "superseded" // replaced by a later version
+	PriceCancelled  = "cancelled"  // withdrawn before it took effect
+)
+
+// backdatingGrace lets a price meant to apply "now" arrive a little late without counting as backdated
+const backdatingGrace = time.Minute
+
+type FuelPriceInput struct {
+	StationID     uuid.UUID `json:"station_id"`
+	FuelProductID uuid.UUID `json:"fuel_product_id"`
+	UnitPrice     float64   `json:"unit_price"`
+	EffectiveFrom time.Time `json:"effective_from"` // defaults to now, a later time schedules the change
+	Reason        string    `json:"reason"`
+}
+
+// ScheduleFuelPrice adds a new price version for a station's product. Versions are never edited: a price
+// change is a new version taking effect now or at a future time, so past readings keep the price they sold at.
+func ScheduleFuelPrice(c *fiber.Ctx, tx *gorm.DB, input FuelPriceInput, createdBy *uuid.UUID) (*StationFuelProduct, error) {
+	if input.StationID == uuid.Nil || input.FuelProductID == uuid.Nil {
+		return nil, errors.New("station_id and fuel_product_id are required")
+	}
+	if input.UnitPrice <= 0 {
+		return nil, errors.New("unit_price must be greater than zero")
+	}
+	now := time.Now()
+	if input.EffectiveFrom.IsZero() {
+		input.EffectiveFrom = now
+	}
+	if input.EffectiveFrom.Before(now.Add(-backdatingGrace)) {
+		return nil, errors.New("effective_from cannot be in the past, prices already charged cannot change")
+	}
+
+	var station Station
+	if err := tx.Select("id").First(&station, "id = ?", input.StationID).Error; err != nil {
+		return nil, errors.New("station not found")
+	}
+	var product FuelProduct
+	if err := tx.Select("id").First(&product, "id = ?", input.FuelProductID).Error; err != nil {
+		return nil, errors.New("fuel product not found")
+	}
+	var clashes int64
+	if err := tx.Model(&StationFuelProduct{}).
+		Where("station_id = ? AND fuel_product_id = ? AND effective_from = ? AND cancelled_at IS NULL", input.StationID, input.FuelProductID, input.EffectiveFrom).
+		Count(&clashes).Error; err != nil {
+		return nil, err
+	}
+	if clashes > 0 {
+		return nil, errors.New("a price already takes effect at that time, cancel it first")
+	}
+
+	price := StationFuelProduct{
+		ID:            uuid.New(),
+		StationID:     input.StationID,
+		FuelProductID: input.FuelProductID,
+		UnitPrice:     ledger.Round2(input.UnitPrice),
+		EffectiveFrom: input.EffectiveFrom,
+		Reason:        input.Reason,
+		CreatedBy:     createdBy,
+	}
+	if err := tx.Omit(clause.Associations).Create(&price).Error; err != nil {
+		log.Println("failed to create fuel price:", err.Error())
+		return nil, errors.New("failed to create fuel price")
+	}
+	if err := RecordAudit(c, tx, AuditEntityFuelPrice, price.ID, AuditCreate, nil, price); err != nil {
+		return nil, err
+	}
+	price.Status = PriceActive
+	if price.EffectiveFrom.After(now) {
+		price.Status = PriceScheduled
+	}
+	return &price, nil
+}
+
+// ScheduleFuelPrices adds several price versions at once, all or none
+func ScheduleFuelPrices(c *fiber.Ctx, inputs []FuelPriceInput, createdBy *uuid.UUID) ([]StationFuelProduct, error) {
+	prices := []StationFuelProduct{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, input := range inputs {
+			price, err := ScheduleFuelPrice(c, tx, input, createdBy)
+			if err != nil {
+				return err
+			}
+			prices = append(prices, *price)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+// ReplaceFuelPrice changes the price of the station and product of version id by adding a new version,
+// the existing one is left as it was
+func ReplaceFuelPrice(c *fiber.Ctx, id uuid.UUID, input FuelPriceInput, createdBy *uuid.UUID) (*StationFuelProduct, error) {
+	current, err := GetFuelPriceByID(id)
+	if err != nil {
+		return nil, err
+	}
+	input.StationID, input.FuelProductID = current.StationID, current.FuelProductID
+	var price *StationFuelProduct
+	err = db.Transaction(func(tx *gorm.DB) error {
+		price, err = ScheduleFuelPrice(c, tx, input, createdBy)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return price, nil
+}
+
+// GetFuelPriceByID returns one price version
+func GetFuelPriceByID(id uuid.UUID) (*StationFuelProduct, error) {
+	var price StationFuelProduct
+	if err := db.First(&price, "id = ?", id).Error; err != nil {
+		return nil, errors.New("price not found")
+	}
+	return &price, nil
+}
+
+// CancelScheduledFuelPrice withdraws a price change that has not taken effect yet
+func CancelScheduledFuelPrice(c *fiber.Ctx, id uuid.UUID) (*StationFuelProduct, error) {
+	var price StationFuelProduct
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&price, "id = ?", id).Error; err != nil {
+			return errors.New("price not found")
+		}
+		if price.CancelledAt != nil {
+			return errors.New("price change is already cancelled")
+		}
+		if !price.EffectiveFrom.After(time.Now()) {
+			return errors.New("price has already taken effect and cannot be cancelled, schedule a new price instead")
+		}
+		before := price
+		now := time.Now()
+		price.CancelledAt = &now
+		if err := tx.Model(&price).Update("cancelled_at", now).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityFuelPrice, price.ID, AuditUpdate, before, price)
+	})
+	if err != nil {
+		return nil, err
+	}
+	price.Status = PriceCancelled
+	return &price, nil
+}
+
+// EffectiveFuelPrice returns the price version of a station's product in effect at the given time
+func EffectiveFuelPrice(tx *gorm.DB, stationID, fuelProductID uuid.UUID, at time.Time) (*StationFuelProduct, error) {
+	var price StationFuelProduct
+	if err := tx.Where("station_id = ? AND fuel_product_id = ? AND effective_from <= ? AND cancelled_at IS NULL", stationID, fuelProductID, at).
+		Order("effective_from DESC").First(&price).Error; err != nil {
+		return nil, err
+	}
+	return &price, nil
+}
+
+// GetFuelPriceHistory lists every price version of a station, newest first per product, optionally for one
+// product, with when each took effect and stopped applying
+func GetFuelPriceHistory(stationID uuid.UUID, fuelProductID *uuid.UUID) ([]StationFuelProduct, error) {
+	prices := []StationFuelProduct{}
+	query := db.Preload("FuelProduct").Where("station_id = ?", stationID)
+	if fuelProductID != nil {
+		query = query.Where("fuel_product_id = ?", *fuelProductID)
+	}
+	if err := query.Order("fuel_product_id, effective_from DESC, created_at DESC").Find(&prices).Error; err != nil {
+		return nil, errors.New("failed to get fuel price history")
+	}
+
+	// walking newest first, each live version ends where the one after it begins
+	now := time.Now()
+	next := map[uuid.UUID]*time.Time{}
+	for i := range prices {
+		price := &prices[i]
+		if price.CancelledAt != nil {
+			price.Status = PriceCancelled
+			continue
+		}
+		price.EffectiveTo = next[price.FuelProductID]
+		switch {
+		case price.EffectiveFrom.After(now):
+			price.Status = PriceScheduled
+		case price.EffectiveTo == nil || price.EffectiveTo.After(now):
+			price.Status = PriceActive
+		default:
+			price.Status = PriceSuperseded
+		}
+		from := price.EffectiveFrom
+		next[price.FuelProductID] = &from
+	}
+	return prices, nil
+}
+
+// GetCurrentFuelPrices returns the prices in effect at a station and the changes scheduled after them
+func GetCurrentFuelPrices(stationID uuid.UUID) ([]StationFuelProduct, error) {
+	history, err := GetFuelPriceHistory(stationID, nil)
+	if err != nil {
+		return nil, err
+	}
+	prices := []StationFuelProduct{}
+	for _, price := range history {
+		if price.Status == PriceActive || price.Status == PriceScheduled {
+			prices = append(prices, price)
+		}
+	}
+	return prices, nil
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dancankarani/safa/internal/testutil"
+	"github.com/google/uuid"
+)
+
+func TestGetFuelPriceHistory(t *testing.T) {
+	conn := setupTestDB(t)
+	stationID, productID := uuid.New(), uuid.New()
+	now := time.Now()
+	cancelledAt := now.Add(-time.Hour)
+	version := func(price float64, from time.Time) StationFuelProduct {
+		return StationFuelProduct{ID: uuid.New(), StationID: stationID, FuelProductID: productID, UnitPrice: price, EffectiveFrom: from}
+	}
+	superseded := version(100, now.AddDate(0, 0, -10))
+	active := version(110, now.AddDate(0, 0, -2))
+	scheduled := version(120, now.AddDate(0, 0, 3))
+	cancelled := version(130, now.AddDate(0, 0, 1))
+	cancelled.CancelledAt = &cancelledAt
+	if err := conn.Create(&[]StationFuelProduct{superseded, active, scheduled, cancelled}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := GetFuelPriceHistory(stationID, &productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[uuid.UUID]StationFuelProduct{}
+	for _, p := range history {
+		got[p.ID] = p
+	}
+	tests := []struct {
+		name   string
+		id     uuid.UUID
+		status string
+		to     *time.Time // nil when the version has no end
+	}{
+		{"superseded", superseded.ID, PriceSuperseded, &active.EffectiveFrom},
+		{"active", active.ID, PriceActive, &scheduled.EffectiveFrom},
+		{"scheduled", scheduled.ID, PriceScheduled, nil},
+		{"cancelled", cancelled.ID, PriceCancelled, nil},
+	}
+	for _, tt := range tests {
+		p, ok := got[tt.id]
+		if !ok {
+			t.Fatalf("%s: version missing from history", tt.name)
+		}
+		if p.Status != tt.status {
+			t.Errorf("%s: status = %q, want %q", tt.name, p.Status, tt.status)
+		}
+		switch {
+		case tt.to == nil && p.EffectiveTo != nil:
+			t.Errorf("%s: effective_to = %v, want none", tt.name, *p.EffectiveTo)
+		case tt.to != nil && (p.EffectiveTo == nil || !p.EffectiveTo.Equal(*tt.to)):
+			t.Errorf("%s: effective_to = %v, want %v", tt.name, p.EffectiveTo, *tt.to)
+		}
+	}
+
+	current, err := GetCurrentFuelPrices(stationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 2 {
+		t.Errorf("current prices = %d versions, want the active and the scheduled one", len(current))
+	}
+}
+
+func TestEffectiveFuelPriceSkipsCancelled(t *testing.T) {
+	conn := setupTestDB(t)
+	stationID, productID := uuid.New(), uuid.New()
+	now := time.Now()
+	cancelledAt := now.Add(-3 * time.Hour)
+	versions := []StationFuelProduct{
+		{ID: uuid.New(), StationID: stationID, FuelProductID: productID, UnitPrice: 100, EffectiveFrom: now.AddDate(0, 0, -5)},
+		{ID: uuid.New(), StationID: stationID, FuelProductID: productID, UnitPrice: 150, EffectiveFrom: now.Add(-time.Hour), CancelledAt: &cancelledAt},
+	}
+	if err := conn.Create(&versions).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		want    float64
+		wantErr bool
+	}{
+		{"cancelled change never applies", now, 100, false},
+		{"before the first version", now.AddDate(0, 0, -6), 0, true},
+	}
+	for _, tt := range tests {
+		price, err := EffectiveFuelPrice(conn, stationID, productID, tt.at)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if err == nil && price.UnitPrice != tt.want {
+			t.Errorf("%s: price = %v, want %v", tt.name, price.UnitPrice, tt.want)
+		}
+	}
+}
+
+func TestScheduleFuelPrice(t *testing.T) {
+	conn := setupTestDB(t)
+	station := Station{ID: uuid.New(), Name: "Main"}
+	product := FuelProduct{ID: uuid.New(), Name: "Diesel"}
+	if err := conn.Create(&station).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	c := testutil.Ctx(t, uuid.New())
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	input := func(price float64, from time.Time) FuelPriceInput {
+		return FuelPriceInput{StationID: station.ID, FuelProductID: product.ID, UnitPrice: price, EffectiveFrom: from}
+	}
+
+	// run in order, later cases build on the versions earlier ones created
+	tests := []struct {
+		name       string
+		input      FuelPriceInput
+		wantErr    bool
+		wantStatus string
+	}{
+		{"takes effect now by default", input(180, time.Time{}), false, PriceActive},
+		{"within the backdating grace", input(181, time.Now().Add(-30*time.Second)), false, PriceActive},
+		{"backdated", input(182, time.Now().Add(-time.Hour)), true, ""},
+		{"scheduled", input(190, tomorrow), false, PriceScheduled},
+		{"clashes with a scheduled change", input(195, tomorrow), true, ""},
+		{"free price", input(0, tomorrow.Add(time.Hour)), true, ""},
+		{"unknown product", FuelPriceInput{StationID: station.ID, FuelProductID: uuid.New(), UnitPrice: 100}, true, ""},
+	}
+	for _, tt := range tests {
+		price, err := ScheduleFuelPrice(c, conn, tt.input, nil)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if err == nil && price.Status != tt.wantStatus {
+			t.Errorf("%s: status = %q, want %q", tt.name, price.Status, tt.wantStatus)
+		}
+	}
+
+	// once the scheduled change is withdrawn its slot is free again
+	var scheduled StationFuelProduct
+	conn.Where("unit_price = ?", 190).First(&scheduled)
+	if _, err := CancelScheduledFuelPrice(c, scheduled.ID); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if _, err := ScheduleFuelPrice(c, conn, input(195, tomorrow), nil); err != nil {
+		t.Errorf("rescheduling after a cancellation: %v", err)
+	}
+	var active StationFuelProduct
+	conn.Where("unit_price = ?", 181).First(&active)
+	if _, err := CancelScheduledFuelPrice(c, active.ID); err == nil {
+		t.Error("a price already in effect was cancelled")
+	}
+}
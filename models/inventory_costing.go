@@ -0,0 +1,364 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/dancankarani/safa/services"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const InventorySourcePumpReading = "pump_reading"
+
+// StationCostingMethod returns the costing method a station values its stock with
+func StationCostingMethod(tx *gorm.DB, stationID uuid.UUID) string {
+	var station Station
+	if err := tx.Select("id", "costing_method").First(&station, "id = ?", stationID).Error; err != nil || !services.IsValidCostingMethod(station.CostingMethod) {
+		return services.CostingFIFO
+	}
+	return station.CostingMethod
+}
+
+// AddInventoryLayer opens a cost layer for a delivery into a tank
+func AddInventoryLayer(tx *gorm.DB, supply Supply) error {
+	if supply.Quantity <= 0 {
+		return nil
+	}
+	layer := InventoryLayer{
+		ID:                uuid.New(),
+		TankID:            supply.TankID,
+		StationID:         supply.StationID,
+		FuelProductID:     supply.FuelProductID,
+		SupplyID:          &supply.ID,
+		ReceivedAt:        supply.DeliveryDate,
+		OriginalQuantity:  supply.Quantity,
+		RemainingQuantity: supply.Quantity,
+		UnitCost:          supply.UnitPrice,
+	}
+	if layer.ReceivedAt.IsZero() {
+		layer.ReceivedAt = time.Now()
+	}
+	return tx.Create(&layer).Error
+}
+
+// ConsumeInventory drains the tank's cost layers for a sale using the station's costing method
+// and returns the cost of the litres sold. Litres beyond the recorded layers are costed at the
+// tank's last known unit cost.
+func ConsumeInventory(tx *gorm.DB, tank Tank, quantity, revenue float64, sourceType string, sourceID uuid.UUID, date time.Time) (float64, error) {
+	if quantity <= 0 {
+		return 0, nil
+	}
+	method := StationCostingMethod(tx, tank.StationID)
+
+	var layers []InventoryLayer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("tank_id = ? AND remaining_quantity > 0", tank.ID).
+		Order("received_at, created_at").
+		Find(&layers).Error; err != nil {
+		return 0, err
+	}
+
+	costLayers := make([]services.CostLayer, len(layers))
+	for i, l := range layers {
+		costLayers[i] = services.CostLayer{Quantity: l.RemainingQuantity, UnitCost: l.UnitCost, Date: l.ReceivedAt}
+	}
+	takes, cost, shortfall := services.AllocateConsumption(method, costLayers, quantity)
+
+	consumption := func(layerID *uuid.UUID, qty, unitCost float64) InventoryConsumption {
+		return InventoryConsumption{
+			ID:            uuid.New(),
+			LayerID:       layerID,
+			TankID:        tank.ID,
+			StationID:     tank.StationID,
+			FuelProductID: tank.FuelProductID,
+			SourceType:    sourceType,
+			SourceID:      sourceID,
+			Method:        method,
+			Quantity:      qty,
+			UnitCost:      unitCost,
+			Cost:          ledger.Round2(qty * unitCost),
+			Revenue:       ledger.Round2(revenue * qty / quantity),
+			Date:          date,
+		}
+	}
+
+	var rows []InventoryConsumption
+	for i, take := range takes {
+		if take <= 0 {
+			continue
+		}
+		layers[i].RemainingQuantity -= take
+		if layers[i].RemainingQuantity < 1e-6 {
+			layers[i].RemainingQuantity = 0
+		}
+		if err := tx.Model(&layers[i]).Update("remaining_quantity", layers[i].RemainingQuantity).Error; err != nil {
+			return 0, err
+		}
+		rows = append(rows, consumption(&layers[i].ID, take, layers[i].UnitCost))
+	}
+
+	if shortfall > 0 {
+		var last InventoryLayer
+		lastCost := 0.0
+		if err := tx.Where("tank_id = ?", tank.ID).Order("received_at DESC, created_at DESC").First(&last).Error; err == nil {
+			lastCost = last.UnitCost
+		}
+		log.Printf("tank %s sold %.2f litres beyond recorded stock, costed at %.2f", tank.ID, shortfall, lastCost)
+		cost += shortfall * lastCost
+		rows = append(rows, consumption(nil, shortfall, lastCost))
+	}
+
+	if len(rows) > 0 {
+		if err := tx.Create(&rows).Error; err != nil {
+			return 0, err
+		}
+	}
+	return ledger.Round2(cost), nil
+}
+
+type InventoryValue struct {
+	TankID        uuid.UUID `json:"tank_id,omitempty"`
+	TankName      string    `json:"tank_name,omitempty"`
+	FuelProductID uuid.UUID `json:"fuel_product_id,omitempty"`
+	FuelProduct   string    `json:"fuel_product,omitempty"`
+	StationID     uuid.UUID `json:"station_id,omitempty"`
+	StationName   string    `json:"station_name,omitempty"`
+	Quantity      float64   `json:"quantity"`
+	Value         float64   `json:"value"`
+	UnitCost      float64   `json:"unit_cost"`
+}
+
+type InventoryValuation struct {
+	Tanks    []InventoryValue `json:"tanks"`
+	Products []InventoryValue `json:"products"`
+	Stations []InventoryValue `json:"stations"`
+	Total    float64          `json:"total"`
+}
+
+// GetInventoryValuation values the remaining cost layers per tank, product and station
+func GetInventoryValuation(stationID *uuid.UUID) (*InventoryValuation, error) {
+	query := db.Table("inventory_layers").
+		Select(`inventory_layers.tank_id, tanks.name AS tank_name,
+			inventory_layers.fuel_product_id, fuel_products.name AS fuel_product,
+			inventory_layers.station_id, stations.name AS station_name,
+			SUM(inventory_layers.remaining_quantity) AS quantity,
+			SUM(inventory_layers.remaining_quantity * inventory_layers.unit_cost) AS value`).
+		Joins("LEFT JOIN tanks ON tanks.id = inventory_layers.tank_id").
+		Joins("LEFT JOIN fuel_products ON fuel_products.id = inventory_layers.fuel_product_id").
+		Joins("LEFT JOIN stations ON stations.id = inventory_layers.station_id").
+		Where("inventory_layers.remaining_quantity > 0")
+	if stationID != nil {
+		query = query.Where("inventory_layers.station_id = ?", *stationID)
+	}
+	var tanks []InventoryValue
+	if err := query.
+		Group("inventory_layers.tank_id, tanks.name, inventory_layers.fuel_product_id, fuel_products.name, inventory_layers.station_id, stations.name").
+		Order("stations.name, tanks.name").
+		Scan(&tanks).Error; err != nil {
+		log.Println(err.Error())
+		return nil, errors.New("failed to value inventory")
+	}
+
+	valuation := InventoryValuation{Tanks: tanks}
+	products := map[uuid.UUID]*InventoryValue{}
+	stations := map[uuid.UUID]*InventoryValue{}
+	for i := range tanks {
+		t := &tanks[i]
+		t.Value = ledger.Round2(t.Value)
+		if t.Quantity > 0 {
+			t.UnitCost = ledger.Round2(t.Value / t.Quantity)
+		}
+		if products[t.FuelProductID] == nil {
+			products[t.FuelProductID] = &InventoryValue{FuelProductID: t.FuelProductID, FuelProduct: t.FuelProduct}
+		}
+		if stations[t.StationID] == nil {
+			stations[t.StationID] = &InventoryValue{StationID: t.StationID, StationName: t.StationName}
+		}
+		for _, agg := range []*InventoryValue{products[t.FuelProductID], stations[t.StationID]} {
+			agg.Quantity += t.Quantity
+			agg.Value += t.Value
+		}
+		valuation.Total += t.Value
+	}
+	for _, agg := range products {
+		agg.Value = ledger.Round2(agg.Value)
+		if agg.Quantity > 0 {
+			agg.UnitCost = ledger.Round2(agg.Value / agg.Quantity)
+		}
+		valuation.Products = append(valuation.Products, *agg)
+	}
+	for _, agg := range stations {
+		agg.Value = ledger.Round2(agg.Value)
+		if agg.Quantity > 0 {
+			agg.UnitCost = ledger.Round2(agg.Value / agg.Quantity)
+		}
+		valuation.Stations = append(valuation.Stations, *agg)
+	}
+	valuation.Total = ledger.Round2(valuation.Total)
+	return &valuation, nil
+}
+
+type CostOfSalesRow struct {
+	TankID        uuid.UUID `json:"tank_id"`
+	TankName      string    `json:"tank_name"`
+	FuelProductID uuid.UUID `json:"fuel_product_id"`
+	FuelProduct   string    `json:"fuel_product"`
+	StationID     uuid.UUID `json:"station_id"`
+	StationName   string    `json:"station_name"`
+	Quantity      float64   `json:"quantity"`
+	Cost          float64   `json:"cost"`
+	Revenue       float64   `json:"revenue"`
+	GrossMargin   float64   `json:"gross_margin"`
+}
+
+// GetCostOfSales sums the recorded cost of sales per tank between from and to
+func GetCostOfSales(stationID *uuid.UUID, from, to time.Time) ([]CostOfSalesRow, error) {
+	query := db.Table("inventory_consumptions").
+		Select(`inventory_consumptions.tank_id, tanks.name AS tank_name,
+			inventory_consumptions.fuel_product_id, fuel_products.name AS fuel_product,
+			inventory_consumptions.station_id, stations.name AS station_name,
+			SUM(inventory_consumptions.quantity) AS quantity, SUM(inventory_consumptions.cost) AS cost,
+			SUM(inventory_consumptions.revenue) AS revenue`).
+		Joins("LEFT JOIN tanks ON tanks.id = inventory_consumptions.tank_id").
+		Joins("LEFT JOIN fuel_products ON fuel_products.id = inventory_consumptions.fuel_product_id").
+		Joins("LEFT JOIN stations ON stations.id = inventory_consumptions.station_id").
+		Where("inventory_consumptions.date >= ? AND inventory_consumptions.date < ?", from, to)
+	if stationID != nil {
+		query = query.Where("inventory_consumptions.station_id = ?", *stationID)
+	}
+	var rows []CostOfSalesRow
+	if err := query.
+		Group("inventory_consumptions.tank_id, tanks.name, inventory_consumptions.fuel_product_id, fuel_products.name, inventory_consumptions.station_id, stations.name").
+		Order("stations.name, tanks.name").
+		Scan(&rows).Error; err != nil {
+		log.Println(err.Error())
+		return nil, errors.New("failed to get cost of sales")
+	}
+	for i := range rows {
+		rows[i].Cost = ledger.Round2(rows[i].Cost)
+		rows[i].Revenue = ledger.Round2(rows[i].Revenue)
+		rows[i].GrossMargin = ledger.Round2(rows[i].Revenue - rows[i].Cost)
+	}
+	return rows, nil
+}
+
+// SupplyRealisedProfit is what the litres of a delivery sold for against what they cost
+type SupplyRealisedProfit struct {
+	SoldQuantity float64
+	Revenue      float64
+	Cost         float64
+}
+
+// GetSupplyRealisedProfit sums the consumptions of a supply's cost layer
+func GetSupplyRealisedProfit(tx *gorm.DB, supplyID uuid.UUID) (SupplyRealisedProfit, error) {
+	var p SupplyRealisedProfit
+	err := tx.Table("inventory_consumptions").
+		Select("COALESCE(SUM(inventory_consumptions.quantity), 0) AS sold_quantity, COALESCE(SUM(inventory_consumptions.revenue), 0) AS revenue, COALESCE(SUM(inventory_consumptions.cost), 0) AS cost").
+		Joins("JOIN inventory_layers ON inventory_layers.id = inventory_consumptions.layer_id").
+		Where("inventory_layers.supply_id = ?", supplyID).
+		Scan(&p).Error
+	return p, err
+}
+
+// AdjustSupplyLayer corrects the cost layer a supply opened by delta litres once the litres actually received
+// are known. Litres already sold out of the layer cannot be taken back, so the remaining quantity stops at zero.
+func AdjustSupplyLayer(tx *gorm.DB, supplyID uuid.UUID, delta float64) error {
+	if delta == 0 {
+		return nil
+	}
+	var layer InventoryLayer
+	if err := tx.Where("supply_id = ?", supplyID).First(&layer).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return tx.Model(&layer).Updates(map[string]interface{}{
+		"original_quantity":  math.Max(layer.OriginalQuantity+delta, 0),
+		"remaining_quantity": math.Max(layer.RemainingQuantity+delta, 0),
+	}).Error
+}
+
+// soldFromLayer returns the litres already costed out of a layer
+func soldFromLayer(layer InventoryLayer) float64 {
+	return math.Max(layer.OriginalQuantity-layer.RemainingQuantity, 0)
+}
+
+// ReplaceSupplyLayer brings the cost layer of an edited supply in line with its new quantity, price and date.
+// Litres already sold out of the layer stay sold, so the new quantity cannot fall below them and a layer that
+// has been drawn on cannot move to another tank.
+func ReplaceSupplyLayer(tx *gorm.DB, supply Supply) error {
+	var layer InventoryLayer
+	err := tx.Where("supply_id = ?", supply.ID).First(&layer).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return AddInventoryLayer(tx, supply)
+	} else if err != nil {
+		return err
+	}
+
+	sold := soldFromLayer(layer)
+	if sold > 0.005 {
+		if layer.TankID != supply.TankID || layer.FuelProductID != supply.FuelProductID {
+			return fmt.Errorf("%.2f litres of this supply have already been sold, its tank and product cannot change", sold)
+		}
+		if supply.Quantity < sold-0.005 {
+			return fmt.Errorf("%.2f litres of this supply have already been sold, the quantity cannot go below that", sold)
+		}
+	}
+	return tx.Model(&layer).Updates(map[string]interface{}{
+		"tank_id":            supply.TankID,
+		"station_id":         supply.StationID,
+		"fuel_product_id":    supply.FuelProductID,
+		"received_at":        supply.DeliveryDate,
+		"original_quantity":  supply.Quantity,
+		"remaining_quantity": math.Max(supply.Quantity-sold, 0),
+		"unit_cost":          supply.UnitPrice,
+	}).Error
+}
+
+// RemoveSupplyLayer drops the cost layer of a deleted supply, refusing when some of it has already been sold
+func RemoveSupplyLayer(tx *gorm.DB, supplyID uuid.UUID) error {
+	var layer InventoryLayer
+	err := tx.Where("supply_id = ?", supplyID).First(&layer).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if sold := soldFromLayer(layer); sold > 0.005 {
+		return fmt.Errorf("%.2f litres of this supply have already been sold, correct its quantity instead of deleting it", sold)
+	}
+	return tx.Delete(&layer).Error
+}
+
+// ReverseInventoryConsumption puts the litres a source drew back into the layers they came from and deletes its
+// consumption rows, returning the cost that had been booked so it can be reversed in the ledger
+func ReverseInventoryConsumption(tx *gorm.DB, sourceType string, sourceID uuid.UUID) (float64, error) {
+	var rows []InventoryConsumption
+	if err := tx.Where("source_type = ? AND source_id = ?", sourceType, sourceID).Find(&rows).Error; err != nil {
+		return 0, err
+	}
+	var cost float64
+	for _, row := range rows {
+		cost += row.Cost
+		if row.LayerID == nil {
+			continue
+		}
+		if err := tx.Model(&InventoryLayer{}).Where("id = ?", *row.LayerID).
+			Update("remaining_quantity", gorm.Expr("remaining_quantity + ?", row.Quantity)).Error; err != nil {
+			return 0, err
+		}
+	}
+	if len(rows) > 0 {
+		if err := tx.Where("source_type = ? AND source_id = ?", sourceType, sourceID).Delete(&InventoryConsumption{}).Error; err != nil {
+			return 0, err
+		}
+	}
+	return ledger.Round2(cost), nil
+}
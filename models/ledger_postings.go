@@ -0,0 +1,305 @@
+package models
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PostSupplyJournal books a delivery: fuel inventory up, owed to the supplier
+func PostSupplyJournal(tx *gorm.DB, supply Supply) error {
+	var supplier Supplier
+	if err := tx.Select("id", "name").First(&supplier, "id = ?", supply.SupplierID).Error; err != nil {
+		return err
+	}
+	inventory, err := ledger.AccountByCode(tx, ledger.InventoryAccount)
+	if err != nil {
+		return err
+	}
+	payable, err := ledger.SupplierAccount(tx, supplier.ID, supplier.Name)
+	if err != nil {
+		return err
+	}
+	amount := supply.Quantity * supply.UnitPrice
+	return ledger.Post(tx, &ledger.JournalEntry{
+		Date:        supply.DeliveryDate,
+		Description: "Fuel supply " + supply.ReferenceNo,
+		SourceType:  ledger.SourceSupply,
+		SourceID:    &supply.ID,
+		StationID:   &supply.StationID,
+		CreatedBy:   &supply.EmployeeID,
+		Lines: []ledger.JournalLine{
+			ledger.Debit(inventory, amount, ""),
+			ledger.Credit(payable, amount, ""),
+		},
+	})
+}
+
+// PostSupplierPaymentJournal books a payment to a supplier out of cash, M-Pesa or bank
+func PostSupplierPaymentJournal(tx *gorm.DB, payment SupplierPayment) error {
+	var supplier Supplier
+	if err := tx.Select("id", "name").First(&supplier, "id = ?", payment.SupplierID).Error; err != nil {
+		return err
+	}
+	payable, err := ledger.SupplierAccount(tx, supplier.ID, supplier.Name)
+	if err != nil {
+		return err
+	}
+	tender, err := ledger.AccountByCode(tx, ledger.TenderAccount(payment.Method))
+	if err != nil {
+		return err
+	}
+	return ledger.Post(tx, &ledger.JournalEntry{
+		Date:        payment.PaymentDate,
+		Description: "Payment to " + supplier.Name + " " + payment.Reference,
+		SourceType:  ledger.SourceSupplierPayment,
+		SourceID:    &payment.ID,
+		Lines: []ledger.JournalLine{
+			ledger.Debit(payable, payment.Amount, ""),
+			ledger.Credit(tender, payment.Amount, ""),
+		},
+	})
+}
+
+// PostSupplierNoteJournal books a credit or debit note that lowers what is owed to a supplier. Litres sent
+// back leave inventory at inventoryValue, their cost; the rest of the note adjusts cost of sales, since the
+// fuel it concerns has usually been sold by the time it arrives.
+func PostSupplierNoteJournal(tx *gorm.DB, note SupplierDebt, date time.Time, createdBy *uuid.UUID, inventoryValue float64) error {
+	var supplier Supplier
+	if err := tx.Select("id", "name").First(&supplier, "id = ?", note.SupplierID).Error; err != nil {
+		return err
+	}
+	payable, err := ledger.SupplierAccount(tx, supplier.ID, supplier.Name)
+	if err != nil {
+		return err
+	}
+	cogs, err := ledger.AccountByCode(tx, ledger.CostOfSalesAccount)
+	if err != nil {
+		return err
+	}
+	inventory, err := ledger.AccountByCode(tx, ledger.InventoryAccount)
+	if err != nil {
+		return err
+	}
+	lines := []ledger.JournalLine{
+		ledger.Debit(payable, note.Amount, note.Notes),
+		ledger.Credit(inventory, inventoryValue, "returned fuel"),
+	}
+	if rest := ledger.Round2(note.Amount - inventoryValue); rest > 0 {
+		lines = append(lines, ledger.Credit(cogs, rest, note.TransactionType))
+	} else if rest < 0 {
+		lines = append(lines, ledger.Debit(cogs, -rest, "loss on returned fuel"))
+	}
+	return ledger.Post(tx, &ledger.JournalEntry{
+		Date:        date,
+		Description: strings.ReplaceAll(note.TransactionType, "_", " ") + " from " + supplier.Name,
+		SourceType:  ledger.SourceSupplierNote,
+		SourceID:    &note.ID,
+		CreatedBy:   createdBy,
+		Lines:       lines,
+	})
+}
+
+// PostPumpReadingJournal books the sales of a reading as cash takings of the station
+func PostPumpReadingJournal(tx *gorm.DB, reading PumpReadings, stationID uuid.UUID) error {
+	cash, err := ledger.AccountByCode(tx, ledger.CashAccount)
+	if err != nil {
+		return err
+	}
+	sales, err := ledger.AccountByCode(tx, ledger.FuelSalesAccount)
+	if err != nil {
+		return err
+	}
+	return ledger.Post(tx, &ledger.JournalEntry{
+		Date:        reading.BusinessDay,
+		Description: "Fuel sales " + reading.Shift + " shift",
+		SourceType:  ledger.SourcePumpReading,
+		SourceID:    &reading.ID,
+		StationID:   &stationID,
+		CreatedBy:   &reading.RecordedBy,
+		Lines: []ledger.JournalLine{
+			ledger.Debit(cash, reading.TotalSalesAmount, ""),
+			ledger.Credit(sales, reading.TotalSalesAmount, ""),
+		},
+	})
+}
+
+// PostCostOfSalesJournal moves the cost of litres sold out of inventory
+func PostCostOfSalesJournal(tx *gorm.DB, reading PumpReadings, stationID uuid.UUID, cost float64) error {
+	cogs, err := ledger.AccountByCode(tx, ledger.CostOfSalesAccount)
+	if err != nil {
+		return err
+	}
+	inventory, err := ledger.AccountByCode(tx, ledger.InventoryAccount)
+	if err != nil {
+		return err
+	}
+	return ledger.Post(tx, &ledger.JournalEntry{
+		Date:        reading.BusinessDay,
+		Description: "Cost of fuel sold " + reading.Shift + " shift",
+		SourceType:  ledger.SourcePumpReading,
+		SourceID:    &reading.ID,
+		StationID:   &stationID,
+		CreatedBy:   &reading.RecordedBy,
+		Lines: []ledger.JournalLine{
+			ledger.Debit(cogs, cost, ""),
+			ledger.Credit(inventory, cost, ""),
+		},
+	})
+}
+
+// PostExpenseJournal books a station expense paid in cash
+func PostExpenseJournal(tx *gorm.DB, expense Expenses) error {
+	expenses, err := ledger.AccountByCode(tx, ledger.ExpensesAccount)
+	if err != nil {
+		return err
+	}
+	cash, err := ledger.AccountByCode(tx, ledger.CashAccount)
+	if err != nil {
+		return err
+	}
+	return ledger.Post(tx, &ledger.JournalEntry{
+		Date:        expense.ExpenseDate,
+		Description: expense.ExpenseType + ": " + expense.Description,
+		SourceType:  ledger.SourceExpense,
+		SourceID:    &expense.ID,
+		StationID:   &expense.StationID,
+		Lines: []ledger.JournalLine{
+			ledger.Debit(expenses, expense.Amount, expense.ExpenseType),
+			ledger.Credit(cash, expense.Amount, ""),
+		},
+	})
+}
+
+// PostEmployeePaymentJournal books a salary payment
+func PostEmployeePaymentJournal(tx *gorm.DB, payment Payment, stationID *uuid.UUID) error {
+	salaries, err := ledger.AccountByCode(tx, ledger.SalariesAccount)
+	if err != nil {
+		return err
+	}
+	cash, err := ledger.AccountByCode(tx, ledger.CashAccount)
+	if err != nil {
+		return err
+	}
+	return ledger.Post(tx, &ledger.JournalEntry{
+		Date:        payment.PaymentDate,
+		Description: "Salary " + payment.PaidMonth,
+		SourceType:  ledger.SourceEmployeePayment,
+		SourceID:    &payment.ID,
+		StationID:   stationID,
+		Lines: []ledger.JournalLine{
+			ledger.Debit(salaries, payment.Amount, ""),
+			ledger.Credit(cash, payment.Amount, ""),
+		},
+	})
+}
+
+// PostDeliveryVarianceJournal books the value of litres short or over on a verified delivery. A shortage comes
+// out of inventory and is charged back to the supplier up to the debit note, the rest is a delivery loss in
+// cost of sales. An over delivery adds to inventory as a gain against cost of sales.
+func PostDeliveryVarianceJournal(tx *gorm.DB, verification DeliveryVerification, supply Supply) error {
+	value := ledger.Round2(-verification.Variance * supply.UnitPrice)
+	if value == 0 {
+		return nil
+	}
+	inventory, err := ledger.AccountByCode(tx, ledger.InventoryAccount)
+	if err != nil {
+		return err
+	}
+	cogs, err := ledger.AccountByCode(tx, ledger.CostOfSalesAccount)
+	if err != nil {
+		return err
+	}
+
+	entry := &ledger.JournalEntry{
+		Date:        supply.DeliveryDate,
+		Description: "Delivery variance " + supply.ReferenceNo,
+		SourceType:  ledger.SourceDeliveryVerification,
+		SourceID:    &verification.ID,
+		StationID:   &supply.StationID,
+		CreatedBy:   verification.VerifiedBy,
+	}
+	if value < 0 {
+		entry.Lines = []ledger.JournalLine{
+			ledger.Debit(inventory, -value, ""),
+			ledger.Credit(cogs, -value, "delivery gain"),
+		}
+		return ledger.Post(tx, entry)
+	}
+
+	claimed := math.Min(verification.DebitNoteAmount, value)
+	entry.Lines = []ledger.JournalLine{
+		ledger.Debit(cogs, value-claimed, "delivery loss"),
+		ledger.Credit(inventory, value, ""),
+	}
+	if claimed > 0 {
+		var supplier Supplier
+		if err := tx.Select("id", "name").First(&supplier, "id = ?", supply.SupplierID).Error; err != nil {
+			return err
+		}
+		payable, err := ledger.SupplierAccount(tx, supplier.ID, supplier.Name)
+		if err != nil {
+			return err
+		}
+		entry.Lines = append(entry.Lines, ledger.Debit(payable, claimed, "debit note"))
+	}
+	return ledger.Post(tx, entry)
+}
+
+// PostCustomerCreditJournal books fuel sold on account. Litres dispensed in a linked pump reading are already
+// in that reading's cash takings, so the credit moves their value out of cash into what the customer owes. A
+// credit without a reading is a sale of its own.
+func PostCustomerCreditJournal(tx *gorm.DB, credit CustomerCredit, customer Customer) error {
+	receivable, err := ledger.CustomerAccount(tx, customer.ID, customer.Name)
+	if err != nil {
+		return err
+	}
+	code := ledger.CashAccount
+	if credit.PumpReadingID == nil {
+		code = ledger.FuelSalesAccount
+	}
+	contra, err := ledger.AccountByCode(tx, code)
+	if err != nil {
+		return err
+	}
+	return ledger.Post(tx, &ledger.JournalEntry{
+		Date:        credit.Date,
+		Description: "Credit sale to " + customer.Name + " " + credit.VehicleRegistration,
+		SourceType:  ledger.SourceCustomerCredit,
+		SourceID:    &credit.ID,
+		StationID:   credit.StationID,
+		CreatedBy:   credit.RecordedBy,
+		Lines: []ledger.JournalLine{
+			ledger.Debit(receivable, credit.Amount, credit.Reference),
+			ledger.Credit(contra, credit.Amount, ""),
+		},
+	})
+}
+
+// PostCustomerPaymentJournal books a customer settling their account in cash, M-Pesa or bank
+func PostCustomerPaymentJournal(tx *gorm.DB, payment CustomerCreditPayment, customer Customer) error {
+	receivable, err := ledger.CustomerAccount(tx, customer.ID, customer.Name)
+	if err != nil {
+		return err
+	}
+	tender, err := ledger.AccountByCode(tx, ledger.TenderAccount(payment.Method))
+	if err != nil {
+		return err
+	}
+	return ledger.Post(tx, &ledger.JournalEntry{
+		Date:        payment.PaymentDate,
+		Description: "Payment from " + customer.Name + " " + payment.Reference,
+		SourceType:  ledger.SourceCustomerPayment,
+		SourceID:    &payment.ID,
+		StationID:   payment.StationID,
+		CreatedBy:   payment.RecordedBy,
+		Lines: []ledger.JournalLine{
+			ledger.Debit(tender, payment.Amount, ""),
+			ledger.Credit(receivable, payment.Amount, ""),
+		},
+	})
+}
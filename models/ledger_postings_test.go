@@ -0,0 +1,41 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/dancankarani/safa/internal/testutil"
+	"github.com/dancankarani/safa/ledger"
+	"github.com/google/uuid"
+)
+
+func TestPostCustomerCreditJournal(t *testing.T) {
+	readingID := uuid.New()
+	tests := []struct {
+		name      string
+		readingID *uuid.UUID
+		cash      float64
+		sales     float64
+	}{
+		{"linked to a reading moves cash takings to the account", &readingID, -1500, 0},
+		{"without a reading books the sale", nil, 0, -1500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := setupTestDB(t)
+			customer := Customer{ID: uuid.New(), Name: "Transporter"}
+			credit := CustomerCredit{ID: uuid.New(), CustomerID: customer.ID, PumpReadingID: tt.readingID, Amount: 1500}
+			if err := PostCustomerCreditJournal(conn, credit, customer); err != nil {
+				t.Fatal(err)
+			}
+			if got := testutil.AccountBalance(t, conn, ledger.ReceivablesAccount); got != 1500 {
+				t.Errorf("receivables = %v, want 1500", got)
+			}
+			if got := testutil.AccountBalance(t, conn, ledger.CashAccount); got != tt.cash {
+				t.Errorf("cash = %v, want %v", got, tt.cash)
+			}
+			if got := testutil.AccountBalance(t, conn, ledger.FuelSalesAccount); got != tt.sales {
+				t.Errorf("sales = %v, want %v", got, tt.sales)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/dancankarani/safa/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MeterResetBetween returns the latest reset of a pump recorded after from and no later than to, or nil
+func MeterResetBetween(tx *gorm.DB, pumpID uuid.UUID, from, to time.Time) (*PumpMeterReset, error) {
+	var reset PumpMeterReset
+	query := tx.Where("pump_id = ? AND reset_at <= ?", pumpID, to)
+	if !from.IsZero() {
+		query = query.Where("reset_at > ?", from)
+	}
+	err := query.Order("reset_at DESC").First(&reset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
+
+// MeterChainStart returns where a reading of a pump recorded at `at` should open: the closing meter of the
+// pump's previous reading, or the new meter of a reset recorded since. ok is false when there is nothing to
+// continue from. Readings listed in exclude are skipped, for checks made while a reading is edited or removed.
+func MeterChainStart(tx *gorm.DB, pumpID uuid.UUID, at time.Time, exclude ...uuid.UUID) (expected float64, ok bool, err error) {
+	var previous PumpReadings
+	query := tx.Where("pump_id = ? AND created_at <= ?", pumpID, at)
+	if len(exclude) > 0 {
+		query = query.Where("id NOT IN ?", exclude)
+	}
+	err = query.Order("created_at DESC").First(&previous).Error
+	hasPrevious := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, err
+	}
+
+	var since time.Time
+	if hasPrevious {
+		since = previous.CreatedAt
+	}
+	reset, err := MeterResetBetween(tx, pumpID, since, at)
+	if err != nil {
+		return 0, false, err
+	}
+	if reset != nil {
+		return services.ExpectedOpening(previous.ClosingMeter, &services.MeterResetEvent{NewOpeningMeter: reset.NewOpeningMeter}), true, nil
+	}
+	if !hasPrevious {
+		return 0, false, nil
+	}
+	return previous.ClosingMeter, true, nil
+}
+
+// CheckMeterOpening rejects a reading whose opening meter does not continue the pump's chain
+func CheckMeterOpening(tx *gorm.DB, pumpID uuid.UUID, at time.Time, opening float64, exclude ...uuid.UUID) error {
+	expected, ok, err := MeterChainStart(tx, pumpID, at, exclude...)
+	if err != nil {
+		return err
+	}
+	if ok && (opening-expected > services.MeterTolerance || expected-opening > services.MeterTolerance) {
+		return fmt.Errorf("opening meter %.2f does not continue from the pump's last meter %.2f, record a meter reset if the totalizer was reset or replaced", opening, expected)
+	}
+	return nil
+}
+
+type MeterResetInput struct {
+	Reason          string    `json:"reason"`
+	ResetAt         time.Time `json:"reset_at"`
+	OldClosingMeter float64   `json:"old_closing_meter"`
+	NewOpeningMeter float64   `json:"new_opening_meter"`
+	Notes           string    `json:"notes"`
+}
+
+// RecordMeterReset records a pump's totalizer being reset or replaced so the next reading may open from the new meter
+func RecordMeterReset(c *fiber.Ctx, pumpID uuid.UUID, input MeterResetInput, recordedBy *uuid.UUID) (*PumpMeterReset, error) {
+	if input.Reason != MeterResetReasonReset && input.Reason != MeterResetReasonReplacement {
+		return nil, fmt.Errorf("reason must be %s or %s", MeterResetReasonReset, MeterResetReasonReplacement)
+	}
+	if input.OldClosingMeter < 0 || input.NewOpeningMeter < 0 {
+		return nil, errors.New("meter readings cannot be negative")
+	}
+	now := time.Now()
+	if input.ResetAt.IsZero() {
+		input.ResetAt = now
+	}
+	if input.ResetAt.After(now) {
+		return nil, errors.New("reset_at cannot be in the future")
+	}
+
+	reset := PumpMeterReset{
+		ID:              uuid.New(),
+		PumpID:          pumpID,
+		Reason:          input.Reason,
+		ResetAt:         input.ResetAt,
+		OldClosingMeter: input.OldClosingMeter,
+		NewOpeningMeter: input.NewOpeningMeter,
+		Notes:           input.Notes,
+		RecordedBy:      recordedBy,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var pump Pump
+		if err := tx.First(&pump, "id = ?", pumpID).Error; err != nil {
+			return errors.New("pump not found")
+		}
+		if err := EnsurePeriodOpen(tx, pump.StationID, input.ResetAt); err != nil {
+			return err
+		}
+		if err := tx.Create(&reset).Error; err != nil {
+			log.Println("failed to record meter reset:", err.Error())
+			return errors.New("failed to record meter reset")
+		}
+		return RecordAudit(c, tx, AuditEntityMeterReset, reset.ID, AuditCreate, nil, reset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
+
+func GetMeterResets(pumpID uuid.UUID) ([]PumpMeterReset, error) {
+	resets := []PumpMeterReset{}
+	if err := db.Where("pump_id = ?", pumpID).Order("reset_at DESC").Find(&resets).Error; err != nil {
+		return nil, errors.New("failed to get meter resets")
+	}
+	return resets, nil
+}
+
+// MeterContinuityReport lists the gaps, overlaps and resets in a pump's reading chain over a period
+type MeterContinuityReport struct {
+	PumpID           uuid.UUID             `json:"pump_id"`
+	PumpName         string                `json:"pump_name"`
+	StationID        uuid.UUID             `json:"station_id"`
+	From             time.Time             `json:"from"`
+	To               time.Time             `json:"to"`
+	Readings         int                   `json:"readings"`
+	Issues           []services.MeterIssue `json:"issues"`
+	UnrecordedLiters float64               `json:"unrecorded_liters"`
+	OverlapLiters    float64               `json:"overlap_liters"`
+}
+
+// GetMeterContinuity checks the chain of a pump's readings recorded in [from, to), continuing from the last
+// reading before from
+func GetMeterContinuity(pumpID uuid.UUID, from, to time.Time) (*MeterContinuityReport, error) {
+	var pump Pump
+	if err := db.First(&pump, "id = ?", pumpID).Error; err != nil {
+		return nil, errors.New("pump not found")
+	}
+
+	var readings []PumpReadings
+	if err := db.Where("pump_id = ? AND created_at >= ? AND created_at < ?", pumpID, from, to).
+		Order("created_at").Find(&readings).Error; err != nil {
+		return nil, errors.New("failed to get pump readings")
+	}
+	var anchor PumpReadings
+	if err := db.Where("pump_id = ? AND created_at < ?", pumpID, from).Order("created_at DESC").First(&anchor).Error; err == nil {
+		readings = append([]PumpReadings{anchor}, readings...)
+	}
+
+	var resets []PumpMeterReset
+	if err := db.Where("pump_id = ? AND reset_at < ?", pumpID, to).Order("reset_at").Find(&resets).Error; err != nil {
+		return nil, errors.New("failed to get meter resets")
+	}
+
+	chain := make([]services.MeterReading, len(readings))
+	for i, r := range readings {
+		chain[i] = services.MeterReading{ID: r.ID.String(), RecordedAt: r.CreatedAt, OpeningMeter: r.OpeningMeter, ClosingMeter: r.ClosingMeter}
+	}
+	events := make([]services.MeterResetEvent, len(resets))
+	for i, r := range resets {
+		events[i] = services.MeterResetEvent{ID: r.ID.String(), ResetAt: r.ResetAt, OldClosingMeter: r.OldClosingMeter, NewOpeningMeter: r.NewOpeningMeter}
+	}
+
+	report := &MeterContinuityReport{
+		PumpID:    pump.ID,
+		PumpName:  pump.Name,
+		StationID: pump.StationID,
+		From:      from,
+		To:        to,
+		Readings:  len(readings),
+		Issues:    []services.MeterIssue{},
+	}
+	for _, issue := range services.CheckMeterContinuity(chain, events, pump.MeterRolloverLimit) {
+		if issue.At.Before(from) {
+			continue
+		}
+		report.Issues = append(report.Issues, issue)
+		switch issue.Type {
+		case services.MeterGap, services.MeterReset:
+			report.UnrecordedLiters = ledger.Round2(report.UnrecordedLiters + issue.Liters)
+		case services.MeterOverlap:
+			report.OverlapLiters = ledger.Round2(report.OverlapLiters + issue.Liters)
+		}
+	}
+	return report, nil
+}
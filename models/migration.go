@@ -1,9 +1,20 @@
 package models
 
+import (
+	"log"
+
+	"github.com/dancankarani/safa/ledger"
+	"gorm.io/gorm"
+)
+
 func MigrateDb(){
+	Migrate(db)
+}
 
+// Migrate creates or updates every table of the application and the ledger on conn
+func Migrate(conn *gorm.DB) {
 	// Perform database migration tasks here
-	db.AutoMigrate(
+	conn.AutoMigrate(
 		&StationFuelProduct{},
 		&Employee{},
 		&Payment{},
@@ -14,6 +25,11 @@ func MigrateDb(){
 		&Customer{},
 		&CustomerCredit{},
 		&CustomerCreditPayment{},
+		&CustomerPaymentAllocation{},
+		&CustomerInvoice{},
+		&CustomerInvoiceLine{},
+		&DocumentSequence{},
+		&SupplierPaymentAllocation{},
 		&DailyAccounts{},
 
 
@@ -31,5 +47,24 @@ func MigrateDb(){
 		&Pump{},
 		
 		&Tank{},
+		&RefreshToken{},
+		&TokenRevocation{},
+		&PasswordResetToken{},
+		&LoginLockout{},
+		&LoginAttempt{},
+		&AuditLog{},
+		&Shift{},
+		&CashUp{},
+		&PeriodClose{},
+		&InventoryLayer{},
+		&InventoryConsumption{},
+		&TankCalibration{},
+		&StockAlert{},
+		&PurchaseOrder{},
+		&DeliveryVerification{},
+		&PumpMeterReset{},
 	)
+	if err := ledger.Migrate(conn); err != nil {
+		log.Println("failed to migrate ledger:", err.Error())
+	}
 }
\ No newline at end of file
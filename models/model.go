@@ -20,6 +20,7 @@ type Employee struct {
 	CanLogin  bool 		`json:"can_login" gorm:"default:false"`
 	Password  string	`json:"password" gorm:"size:255"`
 	Role	  string	`json:"role" gorm:"size:50;default:'employee'"`
+	MustChangePassword bool `json:"must_change_password" gorm:"default:false"`
 	Salary	  float64	`json:"salary" gorm:"type:decimal(10,2);default:0"`
 	DateJoined 	time.Time 		`json:"date_joined" `
 	CreatedAt   time.Time      `json:"created_at" gorm:"autoCreateTime"`
@@ -48,6 +49,7 @@ type Station struct{
 	ID         uuid.UUID `json:"id" gorm:"type:varchar(36);"`
 	Name      string      `json:"name"`
 	Address   string      `json:"address"`
+	CostingMethod string  `json:"costing_method" gorm:"size:20;not null;default:'fifo'"` // "fifo", "weighted_average"
 	CreatedAt time.Time   `json:"created_at"`
 	UpdatedAt time.Time   `json:"updated_at"`
 	DeletedAt *gorm.DeletedAt `json:"deleted_at" gorm:"index"`
@@ -64,6 +66,8 @@ type Tank struct {
 	ID          uuid.UUID `json:"id" gorm:"type:varchar(36);"`
 	Name       string  `json:"name" gorm:"size:100"`
 	Capacity   float64 `json:"capacity" gorm:"type:decimal(10,2);not null"`
+	ReorderLevel float64 `json:"reorder_level" gorm:"type:decimal(10,2);default:0"` // litres at or below which a low stock alert is raised, 0 disables it
+	HighLevel    float64 `json:"high_level" gorm:"type:decimal(10,2);default:0"`    // litres at or above which an overfill alert is raised, 0 means 95% of capacity
 	FuelProductID uuid.UUID `json:"fuel_product_id" gorm:"type:varchar(36);not null"`
 	FuelProduct   FuelProduct   `json:"fuel_product" gorm:"foreignKey:FuelProductID"` // ✅ Added this line
 	StationID    uuid.UUID `json:"station_id" gorm:"type:varchar(36);not null"`
@@ -80,6 +84,7 @@ type Pump struct {
 	ID         uuid.UUID `json:"id" gorm:"type:varchar(36);"`
 	Name       string   `json:"name" gorm:"size:100"`
 	StationID  uuid.UUID `json:"station_id" gorm:"type:varchar(36);not null"`
+	MeterRolloverLimit float64 `json:"meter_rollover_limit" gorm:"type:decimal(12,2);default:0"` // totalizer value that wraps to zero, 0 if it never rolls over
 	Tanks      []Tank   `gorm:"many2many:tank_pumps;" json:"tanks"`
 	CreatedAt   time.Time      `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
@@ -119,9 +124,16 @@ type StationFuelProduct struct {
 	FuelProductID uuid.UUID   `json:"fuel_product_id"`
 	UnitPrice     float64     `json:"unit_price" gorm:"type:decimal(10,2);not null"`
 	EffectiveFrom time.Time   `json:"effective_from" gorm:"not null"`
+	Reason        string      `json:"reason" gorm:"size:255"`
+	CreatedBy     *uuid.UUID  `json:"created_by" gorm:"type:varchar(36)"`
+	CancelledAt   *time.Time  `json:"cancelled_at"` // a scheduled price withdrawn before it took effect
 	CreatedAt     time.Time   `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt     time.Time   `json:"updated_at" gorm:"autoUpdateTime"`
 
+	// worked out from the other versions of the station's product price, not stored
+	Status      string     `json:"status" gorm:"-"`
+	EffectiveTo *time.Time `json:"effective_to" gorm:"-"`
+
 	// Associations
 	Station     Station     `json:"station" gorm:"foreignKey:StationID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 	FuelProduct FuelProduct `json:"fuel_product" gorm:"foreignKey:FuelProductID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
@@ -172,6 +184,7 @@ type Supply struct {
 	TankID          uuid.UUID  `json:"tank_id" gorm:"type:varchar(36);not null;"`
 	EmployeeID    uuid.UUID `json:"employee_id" gorm:"type:char(36);not null"`         // Recorded by which employee
 	ReferenceNo   string    `json:"reference_no" gorm:"size:50"`                       // Invoice or PO number
+	PurchaseOrderID *uuid.UUID `json:"purchase_order_id" gorm:"type:varchar(36);index"`   // Order the delivery is received against
 	FuelProductID uuid.UUID `json:"fuel_product_id" gorm:"type:char(36);not null"`     // FK to FuelProduct
 	FuelProduct   FuelProduct   `json:"fuel_product" gorm:"foreignKey:FuelProductID;references:ID"`
 
@@ -180,6 +193,7 @@ type Supply struct {
 	TotalAmount   float64   `json:"total_amount" gorm:"type:decimal(10,2);not null"`   // Quantity × UnitPrice
 	DeliveryDate  time.Time `json:"delivery_date" gorm:"not null"`                     // Date delivered
 	IsPaid        bool      `json:"is_paid" gorm:"default:false"`                      // Settled or not
+	AmountPaid    float64   `json:"amount_paid" gorm:"type:decimal(12,2);default:0"`   // Payments and debit notes allocated to it
 	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`                  // Auto timestamp
 	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt	*gorm.DeletedAt `json:"deleted_at" gorm:"index"`
@@ -192,6 +206,7 @@ type SupplierDebt struct {
 	SupplierID      uuid.UUID `json:"supplier_id" gorm:"type:char(36);not null"`
 	SupplyID        *uuid.UUID `json:"supply_id" gorm:"type:char(36)"` // Optional if transaction type is "payment"
 	Supply          *Supply        `json:"supply,omitempty" gorm:"foreignKey:SupplyID;references:ID"`
+	PaymentID       *uuid.UUID `json:"payment_id" gorm:"type:varchar(36);index"` // SupplierPayment behind a "payment" entry
 
 	TransactionType string    `json:"transaction_type" gorm:"size:20;not null"` // "supply", "payment", etc.
 	Amount          float64   `json:"amount" gorm:"type:decimal(10,2);not null"` 
@@ -202,6 +217,17 @@ type SupplierDebt struct {
 	DeletedAt	*gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
 
+// SupplierPaymentAllocation is the part of a payment or debit note entry in the supplier's debt ledger that
+// settles one supply
+type SupplierPaymentAllocation struct {
+	ID           uuid.UUID `json:"id" gorm:"type:varchar(36);primaryKey"`
+	SupplierID   uuid.UUID `json:"supplier_id" gorm:"type:varchar(36);not null;index"`
+	SettlementID uuid.UUID `json:"settlement_id" gorm:"type:varchar(36);not null;index"` // the SupplierDebt payment or debit note
+	SupplyID     uuid.UUID `json:"supply_id" gorm:"type:varchar(36);not null;index"`
+	Amount       float64   `json:"amount" gorm:"type:decimal(12,2);not null"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
 //supplier payments
 type SupplierPayment struct {
     ID          uuid.UUID `json:"id" gorm:"primaryKey"`
@@ -210,6 +236,9 @@ type SupplierPayment struct {
     PaymentDate time.Time `json:"payment_date"`
     Method      string    `json:"method" gorm:"size:20"` // "cash", "transfer", etc.
     Reference   string    `json:"reference" gorm:"size:100"` // Payment reference
+	ReversedAt     *time.Time `json:"reversed_at"` // set when the payment was reversed as a mistake
+	ReversedBy     *uuid.UUID `json:"reversed_by" gorm:"type:varchar(36)"`
+	ReversalReason string     `json:"reversal_reason" gorm:"size:255"`
 	CreatedAt   time.Time      `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt	*gorm.DeletedAt `json:"deleted_at" gorm:"index"`
@@ -220,6 +249,7 @@ type Sales struct {
 	ID          uuid.UUID `json:"id" gorm:"type:varchar(36)"`
 	EmployeeID  uuid.UUID `json:"employee_id" gorm:"type:varchar(36);"`
 	PumpID     uuid.UUID `json:"pump_id" gorm:"type:varchar(36);not null"`
+	PumpReadingID *uuid.UUID `json:"pump_reading_id" gorm:"type:varchar(36);index"` // reading the sale was generated from
 	LitersSold    float64       `json:"liters_sold" gorm:"type:decimal(10,2);not null"`
 	PricePerLiter float64       `json:"price_per_liter" gorm:"type:decimal(10,2);not null"`
 	TotalAmount   float64       `json:"total_amount" gorm:"type:decimal(10,2);not null"`
@@ -240,6 +270,11 @@ type Dippings struct {
 	LitersDispensed float64    `json:"liters_dispensed" gorm:"type:decimal(10,2);not null"`
 	AmountSupplied float64    `json:"amount_supplied" gorm:"type:decimal(10,2);not null"`
 	Deviation	  float64    `json:"deviation" gorm:"type:decimal(10,2);not null"` // Difference dip and sales
+	OpeningDipCm    *float64   `json:"opening_dip_cm" gorm:"type:decimal(8,2)"` // dip height, converted to litres with the tank's calibration chart
+	ClosingDipCm    *float64   `json:"closing_dip_cm" gorm:"type:decimal(8,2)"`
+	Temperature     *float64   `json:"temperature" gorm:"type:decimal(5,2)"` // degrees celsius
+	WaterLevelCm    *float64   `json:"water_level_cm" gorm:"type:decimal(8,2)"`
+	WaterLiters     *float64   `json:"water_liters" gorm:"type:decimal(10,2)"`
 	CreatedAt   time.Time      `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt	*gorm.DeletedAt `json:"deleted_at" gorm:"index"`
@@ -278,8 +313,10 @@ type PumpReadings struct {
 	ReadingDate  time.Time `json:"reading_date" gorm:"autoCreateTime"`
 	BusinessDay  time.Time `json:"business_day" gorm:"type:date;index"`
 	Shift       string    `json:"shift" gorm:"size:50;not null"`
+	ShiftID     *uuid.UUID `json:"shift_id" gorm:"type:varchar(36);index"`
 	OpeningMeter float64    `json:"opening_meter" gorm:"type:decimal(10,2);not null"`
 	ClosingMeter float64    `json:"closing_meter" gorm:"type:decimal(10,2);not null"`
+	MeterRolloverAt float64  `json:"meter_rollover_at" gorm:"type:decimal(12,2);default:0"` // set when the totalizer wrapped during the reading
 	LitersDispensed float64    `json:"liters_dispensed" gorm:"type:decimal(10,2);not null"`
 	OpeningSalesAmount float64   `json:"opening_sales_amount" gorm:"type:decimal(10,2);not null"`
 	ClosingSalesAmount float64   `json:"closing_sales_amount" gorm:"type:decimal(10,2);not null"`
@@ -313,6 +350,10 @@ type Customer struct{
 	ID          uuid.UUID `json:"id" gorm:"type:varchar(36);primaryKey"`
 	Name        string    `json:"name" gorm:"size:100;not null"`
 	PhoneNumber string    `json:"phone_number" gorm:"size:15;not null"`
+	Email       string    `json:"email" gorm:"size:100"`
+	CreditLimit float64   `json:"credit_limit" gorm:"type:decimal(12,2);default:0"` // most the customer may owe, 0 for no limit
+	PaymentTermsDays int  `json:"payment_terms_days"` // days after the invoice date payment is due, 0 for cash on delivery
+	IsActive    bool      `json:"is_active" gorm:"default:true"`
 	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt	*gorm.DeletedAt `json:"deleted_at" gorm:"index"`
@@ -320,21 +361,48 @@ type Customer struct{
 type CustomerCredit struct {
 	ID          uuid.UUID `json:"id" gorm:"type:varchar(36);primaryKey"`
 	CustomerID  uuid.UUID `json:"customer_id" gorm:"type:varchar(36);not null"`
+	StationID   *uuid.UUID `json:"station_id" gorm:"type:varchar(36);index"`
+	PumpReadingID *uuid.UUID `json:"pump_reading_id" gorm:"type:varchar(36);index"` // reading the fuel was dispensed in
+	FuelProductID *uuid.UUID `json:"fuel_product_id" gorm:"type:varchar(36)"`
+	VehicleRegistration string `json:"vehicle_registration" gorm:"size:20"`
+	Reference   string    `json:"reference" gorm:"size:50"` // delivery note or LPO number
+	Liters      float64   `json:"liters" gorm:"type:decimal(10,2);default:0"`
+	UnitPrice   float64   `json:"unit_price" gorm:"type:decimal(10,2);default:0"`
 	Date		time.Time `json:"date" gorm:"autoCreateTime"`
 	Amount      float64   `json:"amount" gorm:"type:decimal(10,2);not null"`
+	AmountPaid  float64   `json:"amount_paid" gorm:"type:decimal(10,2);default:0"`
+	IsPaid      bool      `json:"is_paid" gorm:"default:false"`
+	RecordedBy  *uuid.UUID `json:"recorded_by" gorm:"type:varchar(36)"`
+	InvoiceID   *uuid.UUID `json:"invoice_id" gorm:"type:varchar(36);index"` // invoice the credit was billed on
 	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt	*gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+	Customer    *Customer `json:"customer,omitempty" gorm:"foreignKey:CustomerID;references:ID"`
+	FuelProduct *FuelProduct `json:"fuel_product,omitempty" gorm:"foreignKey:FuelProductID;references:ID"`
 }
 //customer credits payments
 type CustomerCreditPayment struct {
 	ID          uuid.UUID `json:"id" gorm:"type:varchar(36);primaryKey"`
 	CustomerID  uuid.UUID `json:"customer_id" gorm:"type:varchar(36);not null"`
+	StationID   *uuid.UUID `json:"station_id" gorm:"type:varchar(36);index"`
 	Amount      float64   `json:"amount" gorm:"type:decimal(10,2);not null"`
+	Method      string    `json:"method" gorm:"size:20"` // cash, mpesa or bank
+	Reference   string    `json:"reference" gorm:"size:50"`
 	PaymentDate time.Time `json:"payment_date" gorm:"autoCreateTime"`
+	RecordedBy  *uuid.UUID `json:"recorded_by" gorm:"type:varchar(36)"`
 	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt	*gorm.DeletedAt `json:"deleted_at" gorm:"index"`	
+	Allocations []CustomerPaymentAllocation `json:"allocations" gorm:"foreignKey:PaymentID;references:ID"`
+}
+
+// CustomerPaymentAllocation is the part of a customer payment applied to one credit
+type CustomerPaymentAllocation struct {
+	ID        uuid.UUID `json:"id" gorm:"type:varchar(36);primaryKey"`
+	PaymentID uuid.UUID `json:"payment_id" gorm:"type:varchar(36);not null;index"`
+	CreditID  uuid.UUID `json:"credit_id" gorm:"type:varchar(36);not null;index"`
+	Amount    float64   `json:"amount" gorm:"type:decimal(10,2);not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
 }
 
 //accounts
@@ -349,11 +417,334 @@ type DailyAccounts struct {
 	DebtPaid float64 `json:"debt_paid" gorm:"type:decimal(10,2);not null"`
 	Mpesa float64 `json:"mpesa" gorm:"type:decimal(10,2);not null"`
 	Bank float64 `json:"bank" gorm:"type:decimal(10,2);not null"`
+	// figures derived from the source tables by GenerateDailyAccounts
+	ComputedSalesAmount float64 `json:"computed_sales_amount" gorm:"type:decimal(10,2);not null;default:0"`
+	ComputedExpenses    float64 `json:"computed_expenses" gorm:"type:decimal(10,2);not null;default:0"`
+	ComputedDebtTaken   float64 `json:"computed_debt_taken" gorm:"type:decimal(10,2);not null;default:0"`
+	ComputedDebtPaid    float64 `json:"computed_debt_paid" gorm:"type:decimal(10,2);not null;default:0"`
+	ComputedMpesa       float64 `json:"computed_mpesa" gorm:"type:decimal(10,2);not null;default:0"`
+	ComputedBank        float64 `json:"computed_bank" gorm:"type:decimal(10,2);not null;default:0"`
+	GeneratedAt *time.Time `json:"generated_at"`
+	Status      string     `json:"status" gorm:"size:20;not null;default:'draft'"` // "draft", "approved"
+	ApprovedBy  *uuid.UUID `json:"approved_by" gorm:"type:varchar(36)"`
+	ApprovedAt  *time.Time `json:"approved_at"`
 	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt	*gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
 
+// RefreshToken is a long lived token used to obtain new access tokens. Only the hash is stored.
+type RefreshToken struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	EmployeeID   uuid.UUID  `json:"employee_id" gorm:"type:varchar(36);not null;index"`
+	TokenHash    string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	ReplacedByID *uuid.UUID `json:"replaced_by_id" gorm:"type:varchar(36)"` // set when the token is rotated
+	IPAddress    string     `json:"ip_address" gorm:"size:45"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TokenRevocation blocks access tokens before they expire.
+// Either a single token (TokenID) or every token of an employee issued before RevokedBefore.
+type TokenRevocation struct {
+	ID            uuid.UUID `json:"id" gorm:"type:varchar(36);primaryKey"`
+	TokenID       string    `json:"token_id" gorm:"size:36;index"`
+	EmployeeID    uuid.UUID `json:"employee_id" gorm:"type:varchar(36);index"`
+	RevokedBefore time.Time `json:"revoked_before"`
+	Reason        string    `json:"reason" gorm:"size:100"`
+	ExpiresAt     time.Time `json:"expires_at"` // safe to purge after this
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// PasswordResetToken is a single use token emailed on forgot password. Only the hash is stored.
+type PasswordResetToken struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	EmployeeID uuid.UUID  `json:"employee_id" gorm:"type:varchar(36);not null;index"`
+	TokenHash  string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt     *time.Time `json:"used_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// LoginLockout stores failed login counters per account or IP
+type LoginLockout struct {
+	Key         string    `json:"key" gorm:"size:150;primaryKey"` // "account:<email>" or "ip:<address>"
+	Failures    int       `json:"failures" gorm:"not null;default:0"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// LoginAttempt is an audit record of every login attempt
+type LoginAttempt struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	Email      string     `json:"email" gorm:"size:100;index"`
+	EmployeeID *uuid.UUID `json:"employee_id" gorm:"type:varchar(36);index"`
+	IPAddress  string     `json:"ip_address" gorm:"size:45;index"`
+	UserAgent  string     `json:"user_agent" gorm:"size:255"`
+	Success    bool       `json:"success"`
+	Reason     string     `json:"reason" gorm:"size:100"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// AuditLog records who changed a financial record, from where and what it looked like before and after
+type AuditLog struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	EntityType string     `json:"entity_type" gorm:"size:50;not null;index"`
+	EntityID   uuid.UUID  `json:"entity_id" gorm:"type:varchar(36);not null;index"`
+	Action     string     `json:"action" gorm:"size:20;not null"` // "create", "update", "delete"
+	ActorID    *uuid.UUID `json:"actor_id" gorm:"type:varchar(36);index"`
+	IPAddress  string     `json:"ip_address" gorm:"size:45"`
+	Before     string     `json:"before" gorm:"type:text"`
+	After      string     `json:"after" gorm:"type:text"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// Shift is a working shift at a station. Pump readings can only be posted while it is open.
+type Shift struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	StationID   uuid.UUID  `json:"station_id" gorm:"type:varchar(36);not null;index"`
+	Name        string     `json:"name" gorm:"size:50;not null"` // e.g. "day", "night"
+	BusinessDay time.Time  `json:"business_day" gorm:"type:date;index"`
+	Status      string     `json:"status" gorm:"size:20;not null;default:'open'"` // "open", "closed"
+	StartTime   time.Time  `json:"start_time" gorm:"not null"`
+	EndTime     *time.Time `json:"end_time"`
+	OpenedBy    uuid.UUID  `json:"opened_by" gorm:"type:varchar(36);not null"`
+	ClosedBy    *uuid.UUID `json:"closed_by" gorm:"type:varchar(36)"`
+	Notes       string     `json:"notes" gorm:"size:255"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt   *gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+
+	Station    Station        `json:"station" gorm:"foreignKey:StationID;references:ID"`
+	Attendants []Employee     `json:"attendants" gorm:"many2many:shift_attendants;"`
+	Readings   []PumpReadings `json:"readings" gorm:"foreignKey:ShiftID;references:ID"`
+}
+
+// CashUp is what an attendant hands over at the end of a shift, split by tender
+type CashUp struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	ShiftID        uuid.UUID  `json:"shift_id" gorm:"type:varchar(36);not null;uniqueIndex:idx_cash_up_shift_employee"`
+	EmployeeID     uuid.UUID  `json:"employee_id" gorm:"type:varchar(36);not null;uniqueIndex:idx_cash_up_shift_employee"`
+	StationID      uuid.UUID  `json:"station_id" gorm:"type:varchar(36);not null;index"`
+	BusinessDay    time.Time  `json:"business_day" gorm:"type:date;index"`
+	Cash           float64    `json:"cash" gorm:"type:decimal(10,2);not null;default:0"`
+	Mpesa          float64    `json:"mpesa" gorm:"type:decimal(10,2);not null;default:0"`
+	Bank           float64    `json:"bank" gorm:"type:decimal(10,2);not null;default:0"`
+	TotalCollected float64    `json:"total_collected" gorm:"type:decimal(10,2);not null"`
+	ExpectedAmount float64    `json:"expected_amount" gorm:"type:decimal(10,2);not null"` // sum of TotalSalesAmount of readings recorded by the employee on the shift
+	Variance       float64    `json:"variance" gorm:"type:decimal(10,2);not null"`        // collected - expected, negative is a shortage
+	Shortage       float64    `json:"shortage" gorm:"type:decimal(10,2);not null;default:0"`
+	Excess         float64    `json:"excess" gorm:"type:decimal(10,2);not null;default:0"`
+	Notes          string     `json:"notes" gorm:"size:255"`
+	RecordedBy     *uuid.UUID `json:"recorded_by" gorm:"type:varchar(36)"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt      *gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+
+	Shift    Shift    `json:"-" gorm:"foreignKey:ShiftID;references:ID"`
+	Employee Employee `json:"employee" gorm:"foreignKey:EmployeeID;references:ID"`
+}
+
+// PeriodClose locks a business day or month of a station against edits
+type PeriodClose struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	StationID    uuid.UUID  `json:"station_id" gorm:"type:varchar(36);not null;index"`
+	PeriodType   string     `json:"period_type" gorm:"size:10;not null"` // "day", "month"
+	PeriodStart  time.Time  `json:"period_start" gorm:"type:date;not null;index"`
+	PeriodEnd    time.Time  `json:"period_end" gorm:"type:date;not null;index"` // inclusive
+	Status       string     `json:"status" gorm:"size:20;not null;default:'closed'"` // "closed", "reopened"
+	ClosedBy     *uuid.UUID `json:"closed_by" gorm:"type:varchar(36)"`
+	ClosedAt     time.Time  `json:"closed_at"`
+	ReopenedBy   *uuid.UUID `json:"reopened_by" gorm:"type:varchar(36)"`
+	ReopenedAt   *time.Time `json:"reopened_at"`
+	ReopenReason string     `json:"reopen_reason" gorm:"size:255"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// InventoryLayer is fuel received into a tank at one unit cost, drained by sales
+type InventoryLayer struct {
+	ID                uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	TankID            uuid.UUID  `json:"tank_id" gorm:"type:varchar(36);not null;index"`
+	StationID         uuid.UUID  `json:"station_id" gorm:"type:varchar(36);not null;index"`
+	FuelProductID     uuid.UUID  `json:"fuel_product_id" gorm:"type:varchar(36);not null;index"`
+	SupplyID          *uuid.UUID `json:"supply_id" gorm:"type:varchar(36);index"`
+	ReceivedAt        time.Time  `json:"received_at" gorm:"not null;index"`
+	OriginalQuantity  float64    `json:"original_quantity" gorm:"type:decimal(12,3);not null"`
+	RemainingQuantity float64    `json:"remaining_quantity" gorm:"type:decimal(12,3);not null"`
+	UnitCost          float64    `json:"unit_cost" gorm:"type:decimal(10,4);not null"`
+	CreatedAt         time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt         time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// InventoryConsumption is the cost of fuel taken out of a layer by a sale.
+// LayerID is nil for litres sold beyond the recorded stock.
+type InventoryConsumption struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	LayerID       *uuid.UUID `json:"layer_id" gorm:"type:varchar(36);index"`
+	TankID        uuid.UUID  `json:"tank_id" gorm:"type:varchar(36);not null;index"`
+	StationID     uuid.UUID  `json:"station_id" gorm:"type:varchar(36);not null;index"`
+	FuelProductID uuid.UUID  `json:"fuel_product_id" gorm:"type:varchar(36);not null;index"`
+	SourceType    string     `json:"source_type" gorm:"size:30;not null;index:idx_consumption_source"`
+	SourceID      uuid.UUID  `json:"source_id" gorm:"type:varchar(36);not null;index:idx_consumption_source"`
+	Method        string     `json:"method" gorm:"size:20;not null"`
+	Quantity      float64    `json:"quantity" gorm:"type:decimal(12,3);not null"`
+	UnitCost      float64    `json:"unit_cost" gorm:"type:decimal(10,4);not null"`
+	Cost          float64    `json:"cost" gorm:"type:decimal(14,2);not null"`
+	Revenue       float64    `json:"revenue" gorm:"type:decimal(14,2);not null"`
+	Date          time.Time  `json:"date" gorm:"not null;index"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TankCalibration is one row of a tank's strapping chart
+type TankCalibration struct {
+	ID        uuid.UUID `json:"id" gorm:"type:varchar(36);primaryKey"`
+	TankID    uuid.UUID `json:"tank_id" gorm:"type:varchar(36);not null;uniqueIndex:idx_tank_calibration_height"`
+	HeightCm  float64   `json:"height_cm" gorm:"type:decimal(8,2);not null;uniqueIndex:idx_tank_calibration_height"`
+	Liters    float64   `json:"liters" gorm:"type:decimal(10,2);not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// StockAlert is a low stock or overfill event raised on a tank when its volume crosses a threshold.
+// An alert stays open or acknowledged until the level recovers, when it is resolved.
+type StockAlert struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	TankID         uuid.UUID  `json:"tank_id" gorm:"type:varchar(36);not null;index"`
+	StationID      uuid.UUID  `json:"station_id" gorm:"type:varchar(36);not null;index"`
+	FuelProductID  uuid.UUID  `json:"fuel_product_id" gorm:"type:varchar(36)"`
+	Type           string     `json:"type" gorm:"size:20;not null;index"`
+	Volume         float64    `json:"volume" gorm:"type:decimal(10,2)"`
+	Threshold      float64    `json:"threshold" gorm:"type:decimal(10,2)"`
+	Capacity       float64    `json:"capacity" gorm:"type:decimal(10,2)"`
+	Message        string     `json:"message" gorm:"size:255"`
+	Status         string     `json:"status" gorm:"size:20;default:'open';index"`
+	EmailedAt      *time.Time `json:"emailed_at"`
+	AcknowledgedBy *uuid.UUID `json:"acknowledged_by" gorm:"type:varchar(36)"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime;index"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+	Tank           Tank       `json:"tank" gorm:"foreignKey:TankID;references:ID"`
+}
+
+// PurchaseOrder is fuel ordered from a supplier for a station. Supplies received against it
+// keep its received, outstanding and variance figures up to date.
+type PurchaseOrder struct {
+	ID                  uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	OrderNo             string     `json:"order_no" gorm:"size:30;uniqueIndex"`
+	SupplierID          uuid.UUID  `json:"supplier_id" gorm:"type:varchar(36);not null;index"`
+	StationID           uuid.UUID  `json:"station_id" gorm:"type:varchar(36);not null;index"`
+	FuelProductID       uuid.UUID  `json:"fuel_product_id" gorm:"type:varchar(36);not null"`
+	TankID              *uuid.UUID `json:"tank_id" gorm:"type:varchar(36)"`
+	OrderedQuantity     float64    `json:"ordered_quantity" gorm:"type:decimal(10,2);not null"`
+	AgreedUnitPrice     float64    `json:"agreed_unit_price" gorm:"type:decimal(10,2);not null"`
+	TotalAmount         float64    `json:"total_amount" gorm:"type:decimal(12,2);not null"`
+	ExpectedDate        time.Time  `json:"expected_date" gorm:"type:date"`
+	Status              string     `json:"status" gorm:"size:20;default:'open';index"`
+	ReceivedQuantity    float64    `json:"received_quantity" gorm:"type:decimal(10,2);default:0"`
+	ReceivedAmount      float64    `json:"received_amount" gorm:"type:decimal(12,2);default:0"`
+	OutstandingQuantity float64    `json:"outstanding_quantity" gorm:"type:decimal(10,2);default:0"`
+	QuantityVariance    float64    `json:"quantity_variance" gorm:"type:decimal(10,2);default:0"` // received - ordered, negative is under delivery
+	PriceVariance       float64    `json:"price_variance" gorm:"type:decimal(12,2);default:0"`    // invoiced - received at the agreed price
+	Notes               string     `json:"notes" gorm:"size:255"`
+	CreatedBy           *uuid.UUID `json:"created_by" gorm:"type:varchar(36)"`
+	CreatedAt           time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt           time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+	Supplier            Supplier    `json:"supplier" gorm:"foreignKey:SupplierID;references:ID"`
+	FuelProduct         FuelProduct `json:"fuel_product" gorm:"foreignKey:FuelProductID;references:ID"`
+	Supplies            []Supply    `json:"supplies" gorm:"foreignKey:PurchaseOrderID;references:ID"`
+}
+
+// DocumentSequence is the last number handed out for a numbered document such as customer invoices
+type DocumentSequence struct {
+	Name       string `json:"name" gorm:"size:50;primaryKey"`
+	LastNumber int64  `json:"last_number" gorm:"not null;default:0"`
+}
+
+// CustomerInvoice bills a customer for the credits taken over a period
+type CustomerInvoice struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	InvoiceNo   string     `json:"invoice_no" gorm:"size:30;uniqueIndex"`
+	CustomerID  uuid.UUID  `json:"customer_id" gorm:"type:varchar(36);not null;index"`
+	PeriodStart time.Time  `json:"period_start" gorm:"type:date"`
+	PeriodEnd   time.Time  `json:"period_end" gorm:"type:date"`
+	InvoiceDate time.Time  `json:"invoice_date" gorm:"type:date;not null"`
+	DueDate     time.Time  `json:"due_date" gorm:"type:date;not null;index"`
+	TotalAmount float64    `json:"total_amount" gorm:"type:decimal(12,2);not null"`
+	AmountPaid  float64    `json:"amount_paid" gorm:"type:decimal(12,2);default:0"`
+	Status      string     `json:"status" gorm:"size:20;default:'issued';index"`
+	CreatedBy   *uuid.UUID `json:"created_by" gorm:"type:varchar(36)"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+	Customer    *Customer             `json:"customer,omitempty" gorm:"foreignKey:CustomerID;references:ID"`
+	Lines       []CustomerInvoiceLine `json:"lines" gorm:"foreignKey:InvoiceID;references:ID"`
+}
+
+// CustomerInvoiceLine is one credit sale billed on an invoice
+type CustomerInvoiceLine struct {
+	ID                  uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	InvoiceID           uuid.UUID  `json:"invoice_id" gorm:"type:varchar(36);not null;index"`
+	CreditID            uuid.UUID  `json:"credit_id" gorm:"type:varchar(36);not null;uniqueIndex"`
+	StationID           *uuid.UUID `json:"station_id" gorm:"type:varchar(36)"`
+	Date                time.Time  `json:"date"`
+	Description         string     `json:"description" gorm:"size:150"`
+	VehicleRegistration string     `json:"vehicle_registration" gorm:"size:20"`
+	Reference           string     `json:"reference" gorm:"size:50"`
+	Liters              float64    `json:"liters" gorm:"type:decimal(10,2)"`
+	UnitPrice           float64    `json:"unit_price" gorm:"type:decimal(10,2)"`
+	Amount              float64    `json:"amount" gorm:"type:decimal(12,2);not null"`
+}
+
+// DeliveryVerification checks a supply against the tank dips taken immediately before and after the offload
+type DeliveryVerification struct {
+	ID               uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	SupplyID         uuid.UUID  `json:"supply_id" gorm:"type:varchar(36);not null;uniqueIndex"`
+	TankID           uuid.UUID  `json:"tank_id" gorm:"type:varchar(36);not null"`
+	StationID        uuid.UUID  `json:"station_id" gorm:"type:varchar(36);not null;index"`
+	SupplierID       uuid.UUID  `json:"supplier_id" gorm:"type:varchar(36);not null;index"`
+	DipBeforeCm      *float64   `json:"dip_before_cm" gorm:"type:decimal(10,2)"`
+	DipAfterCm       *float64   `json:"dip_after_cm" gorm:"type:decimal(10,2)"`
+	VolumeBefore     float64    `json:"volume_before" gorm:"type:decimal(10,2);not null"`
+	VolumeAfter      float64    `json:"volume_after" gorm:"type:decimal(10,2);not null"`
+	DispensedDuring  float64    `json:"dispensed_during" gorm:"type:decimal(10,2);default:0"` // litres sold from the tank during the offload
+	InvoicedQuantity float64    `json:"invoiced_quantity" gorm:"type:decimal(10,2);not null"`
+	ReceivedQuantity float64    `json:"received_quantity" gorm:"type:decimal(10,2);not null"`
+	Variance         float64    `json:"variance" gorm:"type:decimal(10,2)"` // received - invoiced
+	VariancePercent  float64    `json:"variance_percent" gorm:"type:decimal(6,2)"`
+	TolerancePercent float64    `json:"tolerance_percent" gorm:"type:decimal(6,2)"`
+	ShortDelivery    bool       `json:"short_delivery" gorm:"index"`
+	ClaimQuantity    float64    `json:"claim_quantity" gorm:"type:decimal(10,2);default:0"`
+	DebitNoteID      *uuid.UUID `json:"debit_note_id" gorm:"type:char(36)"`
+	DebitNoteAmount  float64    `json:"debit_note_amount" gorm:"type:decimal(10,2);default:0"`
+	Notes            string     `json:"notes" gorm:"size:255"`
+	VerifiedBy       *uuid.UUID `json:"verified_by" gorm:"type:varchar(36)"`
+	CreatedAt        time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	Supply           Supply     `json:"supply" gorm:"foreignKey:SupplyID;references:ID"`
+}
+
+// meter reset reasons
+const (
+	MeterResetReasonReset       = "reset"
+	MeterResetReasonReplacement = "replacement"
+)
+
+// PumpMeterReset records a pump totalizer being reset or replaced. Readings after it continue from
+// NewOpeningMeter instead of the previous reading's closing meter.
+type PumpMeterReset struct {
+	ID              uuid.UUID  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	PumpID          uuid.UUID  `json:"pump_id" gorm:"type:varchar(36);not null;index"`
+	Reason          string     `json:"reason" gorm:"size:20;not null"`
+	ResetAt         time.Time  `json:"reset_at" gorm:"not null;index"`
+	OldClosingMeter float64    `json:"old_closing_meter" gorm:"type:decimal(12,2)"`
+	NewOpeningMeter float64    `json:"new_opening_meter" gorm:"type:decimal(12,2)"`
+	Notes           string     `json:"notes" gorm:"size:255"`
+	RecordedBy      *uuid.UUID `json:"recorded_by" gorm:"type:varchar(36)"`
+	CreatedAt       time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
 //before save supply hook
 func (s *Supply) BeforeSave(tx *gorm.DB) (err error) {
 	s.TotalAmount = s.Quantity * s.UnitPrice
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+
+	PeriodClosed   = "closed"
+	PeriodReopened = "reopened"
+)
+
+// ErrPeriodClosed is wrapped by every rejection of a change dated in a closed period
+var ErrPeriodClosed = errors.New("period is closed")
+
+// businessLocation is the timezone business days are counted in
+func businessLocation() *time.Location {
+	loc, err := time.LoadLocation("Africa/Nairobi")
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// PeriodBounds returns the first and last day of the day or month containing date
+func PeriodBounds(periodType string, date time.Time) (time.Time, time.Time, error) {
+	date = date.In(businessLocation())
+	switch periodType {
+	case PeriodDay:
+		start := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+		return start, start, nil
+	case PeriodMonth:
+		start := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+		return start, start.AddDate(0, 1, -1), nil
+	}
+	return time.Time{}, time.Time{}, errors.New("period_type must be day or month")
+}
+
+// EnsurePeriodOpen rejects changes to records of a station dated in a closed period
+func EnsurePeriodOpen(tx *gorm.DB, stationID uuid.UUID, date time.Time) error {
+	if date.IsZero() {
+		date = time.Now()
+	}
+	day := date.In(businessLocation()).Format("2006-01-02")
+
+	var closed PeriodClose
+	err := tx.Where("station_id = ? AND status = ? AND period_start <= ? AND period_end >= ?", stationID, PeriodClosed, day, day).
+		First(&closed).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s %s to %s is closed for this station", ErrPeriodClosed, closed.PeriodType,
+		closed.PeriodStart.Format("2006-01-02"), closed.PeriodEnd.Format("2006-01-02"))
+}
+
+// EnsurePumpPeriodOpen checks the period of the station the pump belongs to
+func EnsurePumpPeriodOpen(tx *gorm.DB, pumpID uuid.UUID, date time.Time) error {
+	var pump Pump
+	if err := tx.Select("id", "station_id").First(&pump, "id = ?", pumpID).Error; err != nil {
+		return errors.New("pump not found")
+	}
+	return EnsurePeriodOpen(tx, pump.StationID, date)
+}
+
+// EnsureTankPeriodOpen checks the period of the station the tank belongs to
+func EnsureTankPeriodOpen(tx *gorm.DB, tankID uuid.UUID, date time.Time) error {
+	var tank Tank
+	if err := tx.Select("id", "station_id").First(&tank, "id = ?", tankID).Error; err != nil {
+		return errors.New("tank not found")
+	}
+	return EnsurePeriodOpen(tx, tank.StationID, date)
+}
+
+// ClosePeriod closes the day or month containing date for a station
+func ClosePeriod(c *fiber.Ctx, stationID uuid.UUID, periodType string, date time.Time) (*PeriodClose, error) {
+	if stationID == uuid.Nil {
+		return nil, errors.New("station_id is required")
+	}
+	start, end, err := PeriodBounds(periodType, date)
+	if err != nil {
+		return nil, err
+	}
+	today, _, _ := PeriodBounds(PeriodDay, time.Now())
+	if end.After(today) {
+		return nil, errors.New("cannot close a period that has not ended")
+	}
+
+	period := PeriodClose{
+		ID:          uuid.New(),
+		StationID:   stationID,
+		PeriodType:  periodType,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Status:      PeriodClosed,
+		ClosedAt:    time.Now(),
+	}
+	if userID, ok := c.Locals("user_id").(*uuid.UUID); ok {
+		period.ClosedBy = userID
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&PeriodClose{}).
+			Where("station_id = ? AND period_type = ? AND period_start = ? AND status = ?", stationID, periodType, start.Format("2006-01-02"), PeriodClosed).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("period is already closed")
+		}
+		if err := tx.Create(&period).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityPeriodClose, period.ID, AuditCreate, nil, period)
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return &period, nil
+}
+
+// ReopenPeriod reopens a closed period. The reason is kept and the change is audited.
+func ReopenPeriod(c *fiber.Ctx, id uuid.UUID, reason string) (*PeriodClose, error) {
+	if reason == "" {
+		return nil, errors.New("a reason is required to reopen a period")
+	}
+
+	var period PeriodClose
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&period, "id = ?", id).Error; err != nil {
+			return errors.New("period not found")
+		}
+		if period.Status != PeriodClosed {
+			return errors.New("period is not closed")
+		}
+		before := period
+
+		now := time.Now()
+		period.Status = PeriodReopened
+		period.ReopenedAt = &now
+		period.ReopenReason = reason
+		if userID, ok := c.Locals("user_id").(*uuid.UUID); ok {
+			period.ReopenedBy = userID
+		}
+		if err := tx.Save(&period).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntityPeriodClose, period.ID, AuditUpdate, before, period)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &period, nil
+}
+
+// GetPeriodCloses lists the closes of a station, latest period first
+func GetPeriodCloses(c *fiber.Ctx, stationID uuid.UUID) ([]PeriodClose, error) {
+	var periods []PeriodClose
+	if err := db.Where("station_id = ?", stationID).Order("period_start DESC").Find(&periods).Error; err != nil {
+		return nil, errors.New("failed to get closed periods")
+	}
+	return periods, nil
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type ProductMargin struct {
+	FuelProductID  uuid.UUID `json:"fuel_product_id"`
+	FuelProduct    string    `json:"fuel_product"`
+	Liters         float64   `json:"liters"`
+	Revenue        float64   `json:"revenue"`
+	CostOfSales    float64   `json:"cost_of_sales"`
+	GrossMargin    float64   `json:"gross_margin"`
+	MarginPercent  float64   `json:"margin_percent"`
+	UncostedLiters float64   `json:"uncosted_liters"` // sold without stock on record, costed at the last known price
+}
+
+type ExpenseTypeTotal struct {
+	ExpenseType string  `json:"expense_type"`
+	Amount      float64 `json:"amount"`
+}
+
+type ProfitAndLoss struct {
+	StationID         uuid.UUID          `json:"station_id"`
+	StationName       string             `json:"station_name"`
+	From              time.Time          `json:"from"`
+	To                time.Time          `json:"to"`
+	CostingMethod     string             `json:"costing_method"`
+	Products          []ProductMargin    `json:"products"`
+	Revenue           float64            `json:"revenue"`
+	CostOfSales       float64            `json:"cost_of_sales"`
+	GrossMargin       float64            `json:"gross_margin"`
+	OperatingExpenses []ExpenseTypeTotal `json:"operating_expenses"`
+	TotalExpenses     float64            `json:"total_expenses"`
+	Payroll           float64            `json:"payroll"`
+	NetProfit         float64            `json:"net_profit"`
+}
+
+// GetProfitAndLoss builds the P&L of a station for business days in [from, to).
+// Revenue and cost of sales are the consumptions booked as the litres were sold, so the
+// P&L agrees with the ledger's cost of sales and uses the station's own costing method.
+func GetProfitAndLoss(c *fiber.Ctx, stationID uuid.UUID, from, to time.Time) (*ProfitAndLoss, error) {
+	var station Station
+	if err := db.First(&station, "id = ?", stationID).Error; err != nil {
+		return nil, errors.New("station not found")
+	}
+
+	pl := ProfitAndLoss{StationID: stationID, StationName: station.Name, From: from, To: to, CostingMethod: StationCostingMethod(db, stationID)}
+	var margins []ProductMargin
+	if err := db.Table("inventory_consumptions").
+		Select(`inventory_consumptions.fuel_product_id, fuel_products.name AS fuel_product,
+			SUM(inventory_consumptions.quantity) AS liters, SUM(inventory_consumptions.revenue) AS revenue,
+			SUM(inventory_consumptions.cost) AS cost_of_sales,
+			SUM(CASE WHEN inventory_consumptions.layer_id IS NULL THEN inventory_consumptions.quantity ELSE 0 END) AS uncosted_liters`).
+		Joins("LEFT JOIN fuel_products ON fuel_products.id = inventory_consumptions.fuel_product_id").
+		Where("inventory_consumptions.station_id = ? AND inventory_consumptions.date >= ? AND inventory_consumptions.date < ?", stationID, from, to).
+		Group("inventory_consumptions.fuel_product_id, fuel_products.name").
+		Scan(&margins).Error; err != nil {
+		log.Println(err.Error())
+		return nil, errors.New("failed to get cost of sales")
+	}
+	for _, margin := range margins {
+		margin.Liters = ledger.Round2(margin.Liters)
+		margin.Revenue = ledger.Round2(margin.Revenue)
+		margin.CostOfSales = ledger.Round2(margin.CostOfSales)
+		margin.UncostedLiters = ledger.Round2(margin.UncostedLiters)
+		margin.GrossMargin = ledger.Round2(margin.Revenue - margin.CostOfSales)
+		if margin.Revenue != 0 {
+			margin.MarginPercent = ledger.Round2(margin.GrossMargin / margin.Revenue * 100)
+		}
+		pl.Revenue += margin.Revenue
+		pl.CostOfSales += margin.CostOfSales
+		pl.Products = append(pl.Products, margin)
+	}
+	sort.Slice(pl.Products, func(i, j int) bool { return pl.Products[i].FuelProduct < pl.Products[j].FuelProduct })
+
+	if err := db.Model(&Expenses{}).
+		Select("expense_type, COALESCE(SUM(amount), 0) AS amount").
+		Where("station_id = ? AND expense_date >= ? AND expense_date < ?", stationID, from, to).
+		Group("expense_type").
+		Order("expense_type").
+		Scan(&pl.OperatingExpenses).Error; err != nil {
+		log.Println(err.Error())
+		return nil, errors.New("failed to get expenses")
+	}
+	for _, e := range pl.OperatingExpenses {
+		pl.TotalExpenses += e.Amount
+	}
+
+	if err := db.Model(&Payment{}).
+		Joins("JOIN employees ON employees.id = payments.employee_id").
+		Where("employees.station_id = ? AND payments.payment_date >= ? AND payments.payment_date < ?", stationID, from, to).
+		Select("COALESCE(SUM(payments.amount), 0)").
+		Scan(&pl.Payroll).Error; err != nil {
+		log.Println(err.Error())
+		return nil, errors.New("failed to get payroll")
+	}
+
+	pl.Revenue = ledger.Round2(pl.Revenue)
+	pl.CostOfSales = ledger.Round2(pl.CostOfSales)
+	pl.GrossMargin = ledger.Round2(pl.Revenue - pl.CostOfSales)
+	pl.TotalExpenses = ledger.Round2(pl.TotalExpenses)
+	pl.Payroll = ledger.Round2(pl.Payroll)
+	pl.NetProfit = ledger.Round2(pl.GrossMargin - pl.TotalExpenses - pl.Payroll)
+	return &pl, nil
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -13,58 +13,16 @@ import (
 
 func (p *PumpReadings) BeforeSave(tx *gorm.DB) (err error) { 
 	p.LitersDispensed = p.ClosingMeter - p.OpeningMeter
+	if p.MeterRolloverAt > 0 && p.ClosingMeter < p.OpeningMeter {
+		// the totalizer wrapped to zero during the reading
+		p.LitersDispensed = p.MeterRolloverAt - p.OpeningMeter + p.ClosingMeter
+	}
 	p.TotalSalesAmount =   p.LitersDispensed * p.UnitPrice
 	return nil
 }
 
 
 
-func UpdatePumpReadings(c *fiber.Ctx,id uuid.UUID, updatedReadings PumpReadings)(*PumpReadings, error) {
-	pumpReadings := PumpReadings{}
-	err := db.First(&pumpReadings, "id = ?", id).Error
-	if err != nil {
-		log.Println(err.Error())
-		return nil, errors.New("pump readings not found")
-	}
-	
-	if !updatedReadings.BusinessDay.IsZero() {
-		pumpReadings.BusinessDay = updatedReadings.BusinessDay
-		// Optional: disallow future business dates
-		if pumpReadings.BusinessDay.After(time.Now()) {
-			return nil, fmt.Errorf("business_day cannot be in the future")
-		}
-
-		pumpReadings.BusinessDay = updatedReadings.BusinessDay
-	}
-
-	if updatedReadings.OpeningSalesAmount != 0 {
-		pumpReadings.OpeningSalesAmount = updatedReadings.OpeningSalesAmount
-	}
-	if updatedReadings.ClosingSalesAmount != 0 {
-		pumpReadings.ClosingSalesAmount = updatedReadings.ClosingSalesAmount
-	}
-	if updatedReadings.OpeningMeter != 0 {
-		pumpReadings.OpeningMeter = updatedReadings.OpeningMeter
-	}
-	if updatedReadings.ClosingMeter != 0 {
-		pumpReadings.ClosingMeter = updatedReadings.ClosingMeter
-	}
-	
-	if !updatedReadings.ReadingDate.IsZero() {
-		pumpReadings.ReadingDate = updatedReadings.ReadingDate
-	}
-	if updatedReadings.Shift != ""{
-		pumpReadings.ReadingDate = updatedReadings.ReadingDate
-	}
-	
-	err = db.Save(&pumpReadings).Error
-	if err != nil {
-		log.Println(err.Error())
-		return nil, errors.New("failed to update pump readings")
-	}
-	return &pumpReadings, nil
-}
-
 //get latest pump readings BY STATION ID
 func GetLatestPumpReadingsByStationID(c *fiber.Ctx, stationID uuid.UUID) ([]PumpReadings, error) {
 	var readings []PumpReadings
@@ -175,25 +133,13 @@ func GetPaginatedPumpReadings(c *fiber.Ctx, page, pageSize int) ([]PumpReadingRe
 }
 
 
-func DeletePumpReadings(c *fiber.Ctx, id uuid.UUID) error {
-	var pumpReadings PumpReadings
-	if err := db.First(&pumpReadings, "id = ?", id).Error; err != nil {
-		log.Println(err.Error())
-		return errors.New("pump readings not found")
-	}
-	if err := db.Delete(&pumpReadings).Error; err != nil {
-		log.Println(err.Error())
-		return errors.New("failed to delete pump readings")
-	}
-	return nil
-}
 // get total sales for a date range
 type ResSales struct {
 	TotalSales  float64 `json:"total_sales"`
 	TotalLiters float64	`json:"total_liters"`
 }
 
-func GetTotalSalesByDate(c *fiber.Ctx) (*ResSales, error) {
+func GetTotalSalesByDate(c *fiber.Ctx, stationID *uuid.UUID) (*ResSales, error) {
 	// Parse date query params
 	startDateStr := c.Query("start_date")
 	endDateStr := c.Query("end_date")
@@ -229,6 +175,7 @@ func GetTotalSalesByDate(c *fiber.Ctx) (*ResSales, error) {
 
 	var res ResSales
 	if err := db.Model(&PumpReadings{}).
+		Scopes(ForStation(stationID, "station_id = ?")).
 		Where("reading_date BETWEEN ? AND ?", startDate, endDate).
 		Select(`
 			COALESCE(SUM(total_sales_amount), 0) as total_sales, 
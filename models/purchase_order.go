@@ -0,0 +1,334 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// purchase order statuses
+const (
+	PurchaseOrderOpen              = "open"
+	PurchaseOrderPartiallyReceived = "partially_received"
+	PurchaseOrderReceived          = "received"
+	PurchaseOrderClosed            = "closed" // short closed, no more deliveries expected
+	PurchaseOrderCancelled         = "cancelled"
+)
+
+type PurchaseOrderInput struct {
+	SupplierID      uuid.UUID  `json:"supplier_id"`
+	StationID       uuid.UUID  `json:"station_id"`
+	FuelProductID   uuid.UUID  `json:"fuel_product_id"`
+	TankID          *uuid.UUID `json:"tank_id"`
+	OrderedQuantity float64    `json:"ordered_quantity"`
+	AgreedUnitPrice float64    `json:"agreed_unit_price"`
+	ExpectedDate    time.Time  `json:"expected_date"`
+	Notes           string     `json:"notes"`
+}
+
+func (input PurchaseOrderInput) validate() error {
+	if input.SupplierID == uuid.Nil || input.StationID == uuid.Nil || input.FuelProductID == uuid.Nil {
+		return errors.New("supplier_id, station_id and fuel_product_id are required")
+	}
+	if input.OrderedQuantity <= 0 {
+		return errors.New("ordered_quantity must be greater than zero")
+	}
+	if input.AgreedUnitPrice <= 0 {
+		return errors.New("agreed_unit_price must be greater than zero")
+	}
+	if input.ExpectedDate.IsZero() {
+		return errors.New("expected_date is required")
+	}
+	return nil
+}
+
+// validateTank checks the tank belongs to the station and holds the ordered product
+func (input PurchaseOrderInput) validateTank(tx *gorm.DB) error {
+	if input.TankID == nil {
+		return nil
+	}
+	var tank Tank
+	if err := tx.First(&tank, "id = ?", *input.TankID).Error; err != nil {
+		return errors.New("tank not found")
+	}
+	if tank.StationID != input.StationID || tank.FuelProductID != input.FuelProductID {
+		return errors.New("tank does not hold the ordered product at this station")
+	}
+	return nil
+}
+
+// CreatePurchaseOrder raises a new open order
+func CreatePurchaseOrder(c *fiber.Ctx, input PurchaseOrderInput, createdBy *uuid.UUID) (*PurchaseOrder, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+	id := uuid.New()
+	order := PurchaseOrder{
+		ID:                  id,
+		OrderNo:             fmt.Sprintf("PO-%s-%s", time.Now().In(businessLocation()).Format("20060102"), strings.ToUpper(id.String()[:6])),
+		SupplierID:          input.SupplierID,
+		StationID:           input.StationID,
+		FuelProductID:       input.FuelProductID,
+		TankID:              input.TankID,
+		OrderedQuantity:     input.OrderedQuantity,
+		AgreedUnitPrice:     input.AgreedUnitPrice,
+		TotalAmount:         ledger.Round2(input.OrderedQuantity * input.AgreedUnitPrice),
+		ExpectedDate:        input.ExpectedDate,
+		Status:              PurchaseOrderOpen,
+		OutstandingQuantity: input.OrderedQuantity,
+		QuantityVariance:    -input.OrderedQuantity,
+		Notes:               input.Notes,
+		CreatedBy:           createdBy,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var supplier Supplier
+		if err := tx.First(&supplier, "id = ?", input.SupplierID).Error; err != nil {
+			return errors.New("supplier not found")
+		}
+		if err := input.validateTank(tx); err != nil {
+			return err
+		}
+		if err := tx.Create(&order).Error; err != nil {
+			log.Println("failed to create purchase order:", err.Error())
+			return errors.New("failed to create purchase order")
+		}
+		return RecordAudit(c, tx, AuditEntityPurchaseOrder, order.ID, AuditCreate, nil, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// UpdatePurchaseOrder amends the quantity, price, date, tank or notes of an order nothing has been received against
+func UpdatePurchaseOrder(c *fiber.Ctx, id uuid.UUID, input PurchaseOrderInput) (*PurchaseOrder, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var order PurchaseOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "id = ?", id).Error; err != nil {
+			return errors.New("purchase order not found")
+		}
+		if order.Status != PurchaseOrderOpen || order.ReceivedQuantity > 0 {
+			return errors.New("only open orders with nothing received can be amended")
+		}
+		before := order
+
+		input.SupplierID, input.StationID, input.FuelProductID = order.SupplierID, order.StationID, order.FuelProductID
+		if input.OrderedQuantity == 0 {
+			input.OrderedQuantity = order.OrderedQuantity
+		}
+		if input.AgreedUnitPrice == 0 {
+			input.AgreedUnitPrice = order.AgreedUnitPrice
+		}
+		if input.ExpectedDate.IsZero() {
+			input.ExpectedDate = order.ExpectedDate
+		}
+		if input.TankID == nil {
+			input.TankID = order.TankID
+		}
+		if err := input.validate(); err != nil {
+			return err
+		}
+		if err := input.validateTank(tx); err != nil {
+			return err
+		}
+
+		order.OrderedQuantity = input.OrderedQuantity
+		order.AgreedUnitPrice = input.AgreedUnitPrice
+		order.TotalAmount = ledger.Round2(input.OrderedQuantity * input.AgreedUnitPrice)
+		order.ExpectedDate = input.ExpectedDate
+		order.TankID = input.TankID
+		if input.Notes != "" {
+			order.Notes = input.Notes
+		}
+		order.OutstandingQuantity = order.OrderedQuantity
+		order.QuantityVariance = -order.OrderedQuantity
+		if err := tx.Omit(clause.Associations).Save(&order).Error; err != nil {
+			return errors.New("failed to update purchase order")
+		}
+		return RecordAudit(c, tx, AuditEntityPurchaseOrder, order.ID, AuditUpdate, before, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetPurchaseOrderByID(id)
+}
+
+// setPurchaseOrderStatus cancels or short closes an order
+func setPurchaseOrderStatus(c *fiber.Ctx, id uuid.UUID, status string) (*PurchaseOrder, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var order PurchaseOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "id = ?", id).Error; err != nil {
+			return errors.New("purchase order not found")
+		}
+		switch {
+		case order.Status == PurchaseOrderCancelled || order.Status == PurchaseOrderClosed || order.Status == PurchaseOrderReceived:
+			return fmt.Errorf("purchase order is already %s", order.Status)
+		case status == PurchaseOrderCancelled && order.ReceivedQuantity > 0:
+			return errors.New("an order with deliveries received cannot be cancelled, close it instead")
+		}
+		before := order
+		if err := tx.Model(&order).Update("status", status).Error; err != nil {
+			return errors.New("failed to update purchase order")
+		}
+		return RecordAudit(c, tx, AuditEntityPurchaseOrder, order.ID, AuditUpdate, before, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetPurchaseOrderByID(id)
+}
+
+func CancelPurchaseOrder(c *fiber.Ctx, id uuid.UUID) (*PurchaseOrder, error) {
+	return setPurchaseOrderStatus(c, id, PurchaseOrderCancelled)
+}
+
+// ClosePurchaseOrder short closes a partially received order so no further deliveries are expected
+func ClosePurchaseOrder(c *fiber.Ctx, id uuid.UUID) (*PurchaseOrder, error) {
+	return setPurchaseOrderStatus(c, id, PurchaseOrderClosed)
+}
+
+// ReceiveAgainstPurchaseOrder checks a supply matches its purchase order and can still be received,
+// then refreshes the order's received figures. It runs inside the supply's transaction.
+func ReceiveAgainstPurchaseOrder(tx *gorm.DB, supply Supply) error {
+	if supply.PurchaseOrderID == nil {
+		return nil
+	}
+	var order PurchaseOrder
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "id = ?", *supply.PurchaseOrderID).Error; err != nil {
+		return errors.New("purchase order not found")
+	}
+	if order.Status == PurchaseOrderCancelled || order.Status == PurchaseOrderClosed {
+		return fmt.Errorf("purchase order %s is %s", order.OrderNo, order.Status)
+	}
+	if order.SupplierID != supply.SupplierID || order.StationID != supply.StationID || order.FuelProductID != supply.FuelProductID {
+		return fmt.Errorf("supply does not match the supplier, station or product of purchase order %s", order.OrderNo)
+	}
+	return SyncPurchaseOrderReceipts(tx, order.ID)
+}
+
+// SyncPurchaseOrderReceipts recomputes what has been received against an order from its supplies
+// and moves it between open, partially received and received. Cancelled and closed orders keep their status.
+func SyncPurchaseOrderReceipts(tx *gorm.DB, id uuid.UUID) error {
+	var order PurchaseOrder
+	if err := tx.First(&order, "id = ?", id).Error; err != nil {
+		return errors.New("purchase order not found")
+	}
+	var received struct {
+		Quantity float64
+		Amount   float64
+	}
+	if err := tx.Model(&Supply{}).
+		Select("COALESCE(SUM(quantity), 0) AS quantity, COALESCE(SUM(total_amount), 0) AS amount").
+		Where("purchase_order_id = ?", id).
+		Scan(&received).Error; err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"received_quantity":    ledger.Round2(received.Quantity),
+		"received_amount":      ledger.Round2(received.Amount),
+		"outstanding_quantity": ledger.Round2(math.Max(order.OrderedQuantity-received.Quantity, 0)),
+		"quantity_variance":    ledger.Round2(received.Quantity - order.OrderedQuantity),
+		"price_variance":       ledger.Round2(received.Amount - received.Quantity*order.AgreedUnitPrice),
+	}
+	if order.Status != PurchaseOrderCancelled && order.Status != PurchaseOrderClosed {
+		switch {
+		case received.Quantity <= 0:
+			updates["status"] = PurchaseOrderOpen
+		case received.Quantity < order.OrderedQuantity:
+			updates["status"] = PurchaseOrderPartiallyReceived
+		default:
+			updates["status"] = PurchaseOrderReceived
+		}
+	}
+	return tx.Model(&PurchaseOrder{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func GetPurchaseOrderByID(id uuid.UUID) (*PurchaseOrder, error) {
+	var order PurchaseOrder
+	if err := db.Preload("Supplier").Preload("FuelProduct").Preload("Supplies").First(&order, "id = ?", id).Error; err != nil {
+		return nil, errors.New("purchase order not found")
+	}
+	return &order, nil
+}
+
+type PurchaseOrderFilter struct {
+	SupplierID *uuid.UUID
+	StationID  *uuid.UUID
+	Status     string
+}
+
+func GetPurchaseOrders(filter PurchaseOrderFilter) ([]PurchaseOrder, error) {
+	orders := []PurchaseOrder{}
+	query := db.Preload("Supplier").Preload("FuelProduct")
+	if filter.SupplierID != nil {
+		query = query.Where("supplier_id = ?", *filter.SupplierID)
+	}
+	if filter.StationID != nil {
+		query = query.Where("station_id = ?", *filter.StationID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if err := query.Order("expected_date DESC, created_at DESC").Find(&orders).Error; err != nil {
+		return nil, errors.New("failed to get purchase orders")
+	}
+	return orders, nil
+}
+
+// SupplierOutstandingOrders are the orders of one supplier still awaiting delivery
+type SupplierOutstandingOrders struct {
+	SupplierID          uuid.UUID       `json:"supplier_id"`
+	SupplierName        string          `json:"supplier_name"`
+	OutstandingQuantity float64         `json:"outstanding_quantity"`
+	OutstandingValue    float64         `json:"outstanding_value"`
+	Overdue             int             `json:"overdue"`
+	Orders              []PurchaseOrder `json:"orders"`
+}
+
+// GetOutstandingOrders groups open and partially received orders by supplier, optionally for one supplier or station
+func GetOutstandingOrders(supplierID, stationID *uuid.UUID) ([]SupplierOutstandingOrders, error) {
+	orders := []PurchaseOrder{}
+	query := db.Preload("Supplier").Preload("FuelProduct").
+		Where("status IN ?", []string{PurchaseOrderOpen, PurchaseOrderPartiallyReceived})
+	if supplierID != nil {
+		query = query.Where("supplier_id = ?", *supplierID)
+	}
+	if stationID != nil {
+		query = query.Where("station_id = ?", *stationID)
+	}
+	if err := query.Order("expected_date").Find(&orders).Error; err != nil {
+		return nil, errors.New("failed to get outstanding orders")
+	}
+
+	now := time.Now().In(businessLocation())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	result := []SupplierOutstandingOrders{}
+	index := map[uuid.UUID]int{}
+	for _, order := range orders {
+		i, ok := index[order.SupplierID]
+		if !ok {
+			i = len(result)
+			index[order.SupplierID] = i
+			result = append(result, SupplierOutstandingOrders{SupplierID: order.SupplierID, SupplierName: order.Supplier.Name})
+		}
+		group := &result[i]
+		group.OutstandingQuantity = ledger.Round2(group.OutstandingQuantity + order.OutstandingQuantity)
+		group.OutstandingValue = ledger.Round2(group.OutstandingValue + order.OutstandingQuantity*order.AgreedUnitPrice)
+		if truncateDay(order.ExpectedDate).Before(today) {
+			group.Overdue++
+		}
+		group.Orders = append(group.Orders, order)
+	}
+	return result, nil
+}
@@ -29,8 +29,24 @@ func AddNewSales(c *fiber.Ctx)(*Sales, error){
 	if err := c.BodyParser(&sales); err != nil {
 		return nil, err
 	}
-	if err := db.Create(&sales).Error; err != nil {
+	// a sale is dated when it was made, which may be an earlier day than when it is entered
+	if sales.CreatedAt.IsZero() {
+		sales.CreatedAt = time.Now()
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := EnsurePumpPeriodOpen(tx, sales.PumpID, sales.CreatedAt); err != nil {
+			return err
+		}
+		if err := tx.Create(&sales).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntitySales, sales.ID, AuditCreate, nil, sales)
+	})
+	if err != nil {
 		log.Println(err.Error())
+		if errors.Is(err, ErrPeriodClosed) {
+			return nil, err
+		}
 		return nil,errors.New("failed to add sales")
 	}
 	return sales, nil
@@ -43,6 +59,7 @@ func UpdateSales(c *fiber.Ctx, id uuid.UUID, updatedData *Sales) (*Sales, error)
 		log.Println(err.Error())
 		return nil, errors.New("Sales not found")
 	}
+	before := sales
 
 	if updatedData.LitersSold != 0 {
 		sales.LitersSold = updatedData.LitersSold
@@ -52,8 +69,20 @@ func UpdateSales(c *fiber.Ctx, id uuid.UUID, updatedData *Sales) (*Sales, error)
 		sales.PricePerLiter = updatedData.PricePerLiter
 	}
 
-	if err := db.Save(&sales).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := EnsurePumpPeriodOpen(tx, sales.PumpID, sales.CreatedAt); err != nil {
+			return err
+		}
+		if err := tx.Save(&sales).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntitySales, sales.ID, AuditUpdate, before, sales)
+	})
+	if err != nil {
 		log.Println(err.Error())
+		if errors.Is(err, ErrPeriodClosed) {
+			return nil, err
+		}
 		return nil, errors.New("failed to update sales")
 	}
 	return &sales, nil
@@ -67,14 +96,26 @@ func DeleteSales(c *fiber.Ctx, id uuid.UUID) error {
 		log.Println(err.Error())
 		return errors.New("Sales not found")
 	}
-	if err := db.Delete(&sales).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := EnsurePumpPeriodOpen(tx, sales.PumpID, sales.CreatedAt); err != nil {
+			return err
+		}
+		if err := tx.Delete(&sales).Error; err != nil {
+			return err
+		}
+		return RecordAudit(c, tx, AuditEntitySales, sales.ID, AuditDelete, sales, nil)
+	})
+	if err != nil {
 		log.Println(err.Error())
+		if errors.Is(err, ErrPeriodClosed) {
+			return err
+		}
 		return errors.New("failed to delete sales")
 	}
 	return nil
 }
 // get paginated sales, order by created_at desc (latest first)
-func GetSales(c *fiber.Ctx) ([]Sales, error) {
+func GetSales(c *fiber.Ctx, stationID *uuid.UUID) ([]Sales, error) {
 	var sales []Sales
 
 	// Get pagination params from query, with defaults
@@ -88,7 +129,7 @@ func GetSales(c *fiber.Ctx) ([]Sales, error) {
 	}
 	offset := (page - 1) * limit
 
-	if err := db.Order("created_at desc").Limit(limit).Offset(offset).Find(&sales).Error; err != nil {
+	if err := db.Scopes(ForStation(stationID, "pump_id IN (SELECT id FROM pumps WHERE station_id = ?)")).Order("created_at desc").Limit(limit).Offset(offset).Find(&sales).Error; err != nil {
 		log.Println(err.Error())
 		return nil, errors.New("failed to get sales")
 	}
@@ -96,9 +137,9 @@ func GetSales(c *fiber.Ctx) ([]Sales, error) {
 }
 
 //get sales by dates
-func GetSalesByDate(c *fiber.Ctx, startDate, endDate time.Time) ([]Sales, error) {
+func GetSalesByDate(c *fiber.Ctx, stationID *uuid.UUID, startDate, endDate time.Time) ([]Sales, error) {
 	var sales []Sales
-	if err := db.Where("created_at >= ? AND created_at <= ?", startDate, endDate).Find(&sales).Error; err != nil {
+	if err := db.Scopes(ForStation(stationID, "pump_id IN (SELECT id FROM pumps WHERE station_id = ?)")).Where("created_at >= ? AND created_at <= ?", startDate, endDate).Find(&sales).Error; err != nil {
 		log.Println(err.Error())
 		return nil, errors.New("failed to get sales by date")
 	}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ShiftOpen   = "open"
+	ShiftClosed = "closed"
+)
+
+type OpenShiftInput struct {
+	StationID    uuid.UUID   `json:"station_id"`
+	Name         string      `json:"name"`
+	BusinessDay  time.Time   `json:"business_day"`
+	AttendantIDs []uuid.UUID `json:"attendant_ids"`
+	Notes        string      `json:"notes"`
+}
+
+// OpenShift starts a new shift at a station. A station can only have one open shift at a time.
+func OpenShift(c *fiber.Ctx, input OpenShiftInput, openedBy uuid.UUID) (*Shift, error) {
+	if input.StationID == uuid.Nil || input.Name == "" {
+		return nil, errors.New("station_id and name are required")
+	}
+	now := time.Now()
+	if input.BusinessDay.IsZero() {
+		input.BusinessDay = now
+	}
+	if input.BusinessDay.After(now) {
+		return nil, errors.New("business_day cannot be in the future")
+	}
+
+	shift := Shift{
+		ID:          uuid.New(),
+		StationID:   input.StationID,
+		Name:        input.Name,
+		BusinessDay: time.Date(input.BusinessDay.Year(), input.BusinessDay.Month(), input.BusinessDay.Day(), 0, 0, 0, 0, input.BusinessDay.Location()),
+		Status:      ShiftOpen,
+		StartTime:   now,
+		OpenedBy:    openedBy,
+		Notes:       input.Notes,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// lock the station so two requests cannot both find no open shift and open one each
+		var station Station
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&station, "id = ?", input.StationID).Error; err != nil {
+			return errors.New("station not found")
+		}
+		var open int64
+		if err := tx.Model(&Shift{}).Where("station_id = ? AND status = ?", input.StationID, ShiftOpen).Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			return errors.New("station already has an open shift")
+		}
+
+		if len(input.AttendantIDs) > 0 {
+			var attendants []Employee
+			if err := tx.Where("id IN ? AND station_id = ?", input.AttendantIDs, input.StationID).Find(&attendants).Error; err != nil {
+				return err
+			}
+			if len(attendants) != len(input.AttendantIDs) {
+				return errors.New("all attendants must be employees of the station")
+			}
+			shift.Attendants = attendants
+		}
+
+		return tx.Omit("Attendants.*").Create(&shift).Error
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return &shift, nil
+}
+
+// CloseShift closes an open shift once every pump at the station has a closing reading on it
+func CloseShift(c *fiber.Ctx, id uuid.UUID, closedBy uuid.UUID) (*Shift, error) {
+	var shift Shift
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// lock the shift so no reading can be posted to it between the missing pump check and the close
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&shift, "id = ?", id).Error; err != nil {
+			return errors.New("shift not found")
+		}
+		if shift.Status != ShiftOpen {
+			return errors.New("shift is already closed")
+		}
+
+		var pumps []Pump
+		if err := tx.Where("station_id = ?", shift.StationID).Find(&pumps).Error; err != nil {
+			return err
+		}
+		var readPumpIDs []uuid.UUID
+		if err := tx.Model(&PumpReadings{}).Where("shift_id = ?", shift.ID).Distinct().Pluck("pump_id", &readPumpIDs).Error; err != nil {
+			return err
+		}
+		read := map[uuid.UUID]bool{}
+		for _, pumpID := range readPumpIDs {
+			read[pumpID] = true
+		}
+		var missing []string
+		for _, pump := range pumps {
+			if !read[pump.ID] {
+				missing = append(missing, pump.Name)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("closing meter readings missing for pumps: %s", strings.Join(missing, ", "))
+		}
+
+		now := time.Now()
+		shift.Status = ShiftClosed
+		shift.EndTime = &now
+		shift.ClosedBy = &closedBy
+		return tx.Save(&shift).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &shift, nil
+}
+
+func GetShiftByID(c *fiber.Ctx, id uuid.UUID) (*Shift, error) {
+	var shift Shift
+	if err := db.Preload("Attendants").Preload("Readings").First(&shift, "id = ?", id).Error; err != nil {
+		return nil, errors.New("shift not found")
+	}
+	return &shift, nil
+}
+
+// GetOpenShift returns the currently open shift of a station
+func GetOpenShift(c *fiber.Ctx, stationID uuid.UUID) (*Shift, error) {
+	var shift Shift
+	if err := db.Preload("Attendants").Where("station_id = ? AND status = ?", stationID, ShiftOpen).First(&shift).Error; err != nil {
+		return nil, errors.New("no open shift for this station")
+	}
+	return &shift, nil
+}
+
+// get paginated shifts of a station, latest first
+func GetShiftsByStation(c *fiber.Ctx, stationID uuid.UUID, page, pageSize int) ([]Shift, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	var shifts []Shift
+	if err := db.Preload("Attendants").
+		Where("station_id = ?", stationID).
+		Order("start_time DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&shifts).Error; err != nil {
+		return nil, errors.New("failed to get shifts")
+	}
+	return shifts, nil
+}
@@ -5,12 +5,30 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/dancankarani/safa/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+// ForStation narrows a query to one station when stationID is set, cond is the where clause taking the station id.
+func ForStation(stationID *uuid.UUID, cond string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if stationID == nil {
+			return tx
+		}
+		return tx.Where(cond, *stationID)
+	}
+}
+
 func AddNewStation (c *fiber.Ctx, station Station) (*Station,error) {
 	station.ID = uuid.New()
+	if station.CostingMethod == "" {
+		station.CostingMethod = services.CostingFIFO
+	}
+	if !services.IsValidCostingMethod(station.CostingMethod) {
+		return nil, errors.New("costing_method must be fifo or weighted_average")
+	}
 	db.AutoMigrate(&Station{})
 	if err := db.Create(&station).Error; err != nil {
 		return nil, errors.New("failed to add new station")
@@ -18,6 +36,21 @@ func AddNewStation (c *fiber.Ctx, station Station) (*Station,error) {
 	return &station, nil	
 }
 
+// SetStationCostingMethod switches how a station's stock and cost of sales are valued from now on
+func SetStationCostingMethod(c *fiber.Ctx, id uuid.UUID, method string) (*Station, error) {
+	if !services.IsValidCostingMethod(method) {
+		return nil, errors.New("costing_method must be fifo or weighted_average")
+	}
+	var station Station
+	if err := db.First(&station, "id = ?", id).Error; err != nil {
+		return nil, errors.New("station not found")
+	}
+	if err := db.Model(&station).Update("costing_method", method).Error; err != nil {
+		return nil, errors.New("failed to update costing method")
+	}
+	return &station, nil
+}
+
 func GetStationByID(c* fiber.Ctx, id uuid.UUID) (*Station, error) {
 	var station Station
 	if err := db.Preload("Expenses").Preload("Tanks.Pumps.Sales").Where("id = ?", id).First(&station).Error; err != nil {
@@ -52,7 +85,7 @@ type ResStationSales struct {
 	BankDeposit float64   `json:"bank_deposit"`
 }
 
-func GetSummationOfSalesAndLiters(c *fiber.Ctx) (*[]ResStationSales, error) {
+func GetSummationOfSalesAndLiters(c *fiber.Ctx, stationID *uuid.UUID) (*[]ResStationSales, error) {
 	// Parse optional `date` query param (format: YYYY-MM-DD)
 	dateParam := c.Query("date")
 	var targetDate time.Time
@@ -73,6 +106,7 @@ func GetSummationOfSalesAndLiters(c *fiber.Ctx) (*[]ResStationSales, error) {
 	var stations []Station
 	if err := db.
 		Preload("Tanks.Pumps.Readings").
+		Scopes(ForStation(stationID, "id = ?")).
 		Find(&stations).Error; err != nil {
 		return nil, errors.New("failed to get all stations")
 	}
@@ -121,7 +155,7 @@ type ResSationExpenses struct{
 	StationExpenses []StationExpenses `json:"station_expenses"`
 	TotalExpenses float64 `json:"total_expenses"`
 }
-func GetMonthlySummationOfExpenses(c *fiber.Ctx) (*ResSationExpenses, error) {
+func GetMonthlySummationOfExpenses(c *fiber.Ctx, stationID *uuid.UUID) (*ResSationExpenses, error) {
 	monthParam := c.Query("month")
 	var startOfMonth time.Time
 	var err error
@@ -140,7 +174,7 @@ func GetMonthlySummationOfExpenses(c *fiber.Ctx) (*ResSationExpenses, error) {
 	endOfMonth := startOfMonth.AddDate(0, 1, 0)
 
 	var stations []Station
-	if err := db.Preload("Expenses").Find(&stations).Error; err != nil {
+	if err := db.Preload("Expenses").Scopes(ForStation(stationID, "id = ?")).Find(&stations).Error; err != nil {
 		return nil, errors.New("failed to get all stations")
 	}
 
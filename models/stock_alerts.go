@@ -0,0 +1,182 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/dancankarani/safa/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// stock alert statuses
+const (
+	StockAlertOpen         = "open"
+	StockAlertAcknowledged = "acknowledged"
+	StockAlertResolved     = "resolved"
+)
+
+// EvaluateStockAlerts raises a low stock or overfill alert when the tank's new volume breaches a threshold
+// and no alert of that type is already active, and resolves active alerts whose threshold is no longer breached.
+// It runs inside the stock movement's transaction so alerts roll back with it.
+func EvaluateStockAlerts(tx *gorm.DB, tank Tank, volume float64) error {
+	level := services.EvaluateTankLevel(tank.Capacity, tank.ReorderLevel, tank.HighLevel, volume)
+	breached := map[string]bool{}
+	for _, alertType := range level.Alerts() {
+		breached[alertType] = true
+	}
+
+	var active []StockAlert
+	if err := tx.Where("tank_id = ? AND status IN ?", tank.ID, []string{StockAlertOpen, StockAlertAcknowledged}).
+		Find(&active).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	raised := map[string]bool{}
+	for _, alert := range active {
+		if breached[alert.Type] {
+			raised[alert.Type] = true
+			continue
+		}
+		if err := tx.Model(&StockAlert{}).Where("id = ?", alert.ID).
+			Updates(map[string]interface{}{"status": StockAlertResolved, "resolved_at": now}).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, alertType := range level.Alerts() {
+		if raised[alertType] {
+			continue
+		}
+		alert := StockAlert{
+			ID:            uuid.New(),
+			TankID:        tank.ID,
+			StationID:     tank.StationID,
+			FuelProductID: tank.FuelProductID,
+			Type:          alertType,
+			Volume:        ledger.Round2(volume),
+			Capacity:      tank.Capacity,
+			Status:        StockAlertOpen,
+		}
+		if alertType == services.AlertLowStock {
+			alert.Threshold = level.ReorderLevel
+			alert.Message = fmt.Sprintf("Tank %s is low: %.2f litres left, reorder level is %.2f litres", tank.Name, volume, level.ReorderLevel)
+		} else {
+			alert.Threshold = ledger.Round2(level.HighLevel)
+			alert.Message = fmt.Sprintf("Tank %s is nearly full: %.2f litres held, %.2f litres of ullage left", tank.Name, volume, level.Ullage)
+		}
+		if err := tx.Create(&alert).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StockAlertFilter narrows the alerts returned by GetStockAlerts
+type StockAlertFilter struct {
+	StationID *uuid.UUID
+	Status    string
+	Since     time.Time
+}
+
+// GetStockAlerts lists alerts newest first. Clients poll with Since set to the created_at of the last alert they saw.
+func GetStockAlerts(filter StockAlertFilter) ([]StockAlert, error) {
+	alerts := []StockAlert{}
+	query := db.Preload("Tank")
+	if filter.StationID != nil {
+		query = query.Where("station_id = ?", *filter.StationID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at > ?", filter.Since)
+	}
+	if err := query.Order("created_at DESC").Limit(200).Find(&alerts).Error; err != nil {
+		log.Println("failed to get stock alerts:", err.Error())
+		return nil, errors.New("failed to get stock alerts")
+	}
+	return alerts, nil
+}
+
+func GetStockAlertByID(id uuid.UUID) (*StockAlert, error) {
+	var alert StockAlert
+	if err := db.First(&alert, "id = ?", id).Error; err != nil {
+		return nil, errors.New("stock alert not found")
+	}
+	return &alert, nil
+}
+
+// AcknowledgeStockAlert marks an open alert as seen; it is resolved automatically once the level recovers
+func AcknowledgeStockAlert(c *fiber.Ctx, id uuid.UUID) (*StockAlert, error) {
+	alert, err := GetStockAlertByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Status != StockAlertOpen {
+		return nil, fmt.Errorf("stock alert is already %s", alert.Status)
+	}
+	now := time.Now()
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	if err := db.Model(alert).Updates(map[string]interface{}{
+		"status":          StockAlertAcknowledged,
+		"acknowledged_by": userID,
+		"acknowledged_at": now,
+	}).Error; err != nil {
+		return nil, errors.New("failed to acknowledge stock alert")
+	}
+	return GetStockAlertByID(id)
+}
+
+// stockAlertRecipients returns the emails of admins and of the managers of the station
+func stockAlertRecipients(stationID uuid.UUID) ([]string, error) {
+	var emails []string
+	err := db.Model(&Employee{}).
+		Where("email <> '' AND (role = ? OR (role = ? AND station_id = ?))", services.RoleAdmin, services.RoleManager, stationID).
+		Distinct().Pluck("email", &emails).Error
+	return emails, err
+}
+
+// DispatchStockAlertEmails emails every open alert that has not been emailed yet.
+// Alerts are marked as emailed after one attempt so a failing mail server does not resend them on every run.
+func DispatchStockAlertEmails() {
+	var alerts []StockAlert
+	if err := db.Preload("Tank.Station").Where("status = ? AND emailed_at IS NULL", StockAlertOpen).
+		Order("created_at").Find(&alerts).Error; err != nil {
+		log.Println("failed to load stock alerts:", err.Error())
+		return
+	}
+	for _, alert := range alerts {
+		recipients, err := stockAlertRecipients(alert.StationID)
+		if err != nil {
+			log.Println("failed to load stock alert recipients:", err.Error())
+			continue
+		}
+		subject := fmt.Sprintf("[%s] %s alert", alert.Tank.Station.Name, alert.Type)
+		body := fmt.Sprintf("<p>%s</p><p>Station: %s<br>Capacity: %.2f litres<br>Threshold: %.2f litres<br>Raised at: %s</p>",
+			alert.Message, alert.Tank.Station.Name, alert.Capacity, alert.Threshold,
+			alert.CreatedAt.In(businessLocation()).Format("2006-01-02 15:04"))
+		for _, to := range recipients {
+			if err := services.SendEmail(to, subject, body); err != nil {
+				log.Println("failed to email stock alert:", err.Error())
+			}
+		}
+		if err := db.Model(&StockAlert{}).Where("id = ?", alert.ID).Update("emailed_at", time.Now()).Error; err != nil {
+			log.Println("failed to mark stock alert as emailed:", err.Error())
+		}
+	}
+}
+
+// RunStockAlertDispatcher emails new stock alerts every interval, it is meant to run in its own goroutine
+func RunStockAlertDispatcher(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		DispatchStockAlertEmails()
+	}
+}
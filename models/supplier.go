@@ -3,9 +3,12 @@ package models
 import (
 	"errors"
 	"log"
+	"math"
 
+	"github.com/dancankarani/safa/ledger"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 func AddSupplier(c *fiber.Ctx, s *Supplier) (*Supplier, error) {
@@ -65,3 +68,129 @@ func DeleteSupplier(c *fiber.Ctx, id uuid.UUID) error {
 	return nil
 }
 
+
+// supplier debt transaction types
+const (
+	SupplierDebtSupply    = "supply"
+	SupplierDebtPayment   = "payment"
+	SupplierDebtDebitNote  = "debit_note"  // claimed back from the supplier, reduces what we owe
+	SupplierDebtCreditNote = "credit_note" // issued by the supplier for returns or price corrections, reduces what we owe
+)
+
+// SupplierDebtBalanceSQL sums a supplier's debt entries into the amount owed to them
+const SupplierDebtBalanceSQL = `COALESCE(SUM(CASE
+	WHEN transaction_type = 'supply' THEN amount
+	WHEN transaction_type IN ('payment', 'debit_note', 'credit_note') THEN -amount
+	ELSE 0 END), 0)`
+
+// SupplierDebtBalance returns the amount owed to a supplier from its debt entries
+func SupplierDebtBalance(tx *gorm.DB, supplierID uuid.UUID) (float64, error) {
+	var balance float64
+	err := tx.Model(&SupplierDebt{}).
+		Select(SupplierDebtBalanceSQL).
+		Where("supplier_id = ?", supplierID).
+		Scan(&balance).Error
+	return balance, err
+}
+
+// RecordSupplierDebitNote records amount claimed back from a supplier against a supply. A note larger than
+// the outstanding debt becomes credit held with the supplier.
+func RecordSupplierDebitNote(tx *gorm.DB, supplierID uuid.UUID, supplyID *uuid.UUID, amount float64, notes string) (*SupplierDebt, error) {
+	return recordSupplierNote(tx, SupplierDebtDebitNote, supplierID, supplyID, amount, notes)
+}
+
+// recordSupplierNote adds a debit or credit note to a supplier's debt entries and settles supplies with it
+func recordSupplierNote(tx *gorm.DB, noteType string, supplierID uuid.UUID, supplyID *uuid.UUID, amount float64, notes string) (*SupplierDebt, error) {
+	if amount <= 0 {
+		return nil, errors.New("note amount must be greater than zero")
+	}
+	var supplier Supplier
+	if err := tx.First(&supplier, "id = ?", supplierID).Error; err != nil {
+		return nil, errors.New("Supplier not found")
+	}
+	balance, err := SupplierDebtBalance(tx, supplierID)
+	if err != nil {
+		return nil, err
+	}
+
+	newBalance := balance - amount
+	if newBalance < 0 {
+		supplier.CreditBalance += -newBalance
+		newBalance = 0
+		if err := tx.Model(&supplier).Update("credit_balance", supplier.CreditBalance).Error; err != nil {
+			return nil, err
+		}
+	}
+	note := SupplierDebt{
+		ID:              uuid.New(),
+		SupplierID:      supplierID,
+		SupplyID:        supplyID,
+		TransactionType: noteType,
+		Amount:          ledger.Round2(amount),
+		RunningBalance:  ledger.Round2(newBalance),
+		Notes:           notes,
+	}
+	if err := tx.Create(&note).Error; err != nil {
+		return nil, err
+	}
+	if err := AllocateSupplierSettlements(tx, supplierID); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// RemoveSupplierDebtEntry deletes a supplier debt entry and carries its effect through the entries recorded
+// after it: their running balances move by the change the entry made, balances that would drop below zero
+// become credit held with the supplier, and credit the entry consumed or created is given back or taken away.
+func RemoveSupplierDebtEntry(tx *gorm.DB, entry SupplierDebt) error {
+	var previous SupplierDebt
+	var before float64
+	err := tx.Where("supplier_id = ? AND (created_at < ? OR (created_at = ? AND id < ?))", entry.SupplierID, entry.CreatedAt, entry.CreatedAt, entry.ID).
+		Order("created_at DESC, id DESC").First(&previous).Error
+	if err == nil {
+		before = previous.RunningBalance
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	// credit handed back to the supplier account once the entry is gone
+	shift := entry.RunningBalance - before
+	var creditRestored float64
+	if entry.TransactionType == SupplierDebtSupply {
+		creditRestored = entry.Amount - shift // credit the supply used up comes back
+	} else {
+		creditRestored = -(entry.Amount + shift) // overpayment that became credit is taken away
+	}
+
+	var later []SupplierDebt
+	if err := tx.Where("supplier_id = ? AND (created_at > ? OR (created_at = ? AND id > ?))", entry.SupplierID, entry.CreatedAt, entry.CreatedAt, entry.ID).
+		Order("created_at, id").Find(&later).Error; err != nil {
+		return err
+	}
+	for _, row := range later {
+		balance := row.RunningBalance - shift
+		if balance < 0 {
+			creditRestored -= balance
+			balance = 0
+		}
+		shift = row.RunningBalance - balance
+		if err := tx.Model(&SupplierDebt{}).Where("id = ?", row.ID).Update("running_balance", ledger.Round2(balance)).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Delete(&SupplierDebt{}, "id = ?", entry.ID).Error; err != nil {
+		return err
+	}
+	if err := releaseSettlementAllocations(tx, entry.ID); err != nil {
+		return err
+	}
+	if math.Abs(creditRestored) < 0.005 {
+		return nil
+	}
+	var supplier Supplier
+	if err := tx.First(&supplier, "id = ?", entry.SupplierID).Error; err != nil {
+		return errors.New("Supplier not found")
+	}
+	return tx.Model(&supplier).Update("credit_balance", ledger.Round2(math.Max(supplier.CreditBalance+creditRestored, 0))).Error
+}
@@ -0,0 +1,414 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/dancankarani/safa/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// supplier debt entries that settle supplies
+var supplierSettlementTypes = []string{SupplierDebtPayment, SupplierDebtDebitNote, SupplierDebtCreditNote}
+
+// syncSupplyPaid recomputes what has been settled on a supply from its allocations
+func syncSupplyPaid(tx *gorm.DB, supplyID uuid.UUID) error {
+	var supply Supply
+	if err := tx.Select("id", "total_amount").First(&supply, "id = ?", supplyID).Error; err != nil {
+		return err
+	}
+	var paid float64
+	if err := tx.Model(&SupplierPaymentAllocation{}).Select("COALESCE(SUM(amount), 0)").
+		Where("supply_id = ?", supplyID).Scan(&paid).Error; err != nil {
+		return err
+	}
+	paid = ledger.Round2(paid)
+	return tx.Model(&Supply{}).Where("id = ?", supplyID).Updates(map[string]interface{}{
+		"amount_paid": paid,
+		"is_paid":     paid >= supply.TotalAmount-0.005,
+	}).Error
+}
+
+// AllocateSupplierPayment applies a settlement entry to the supplies the payer chose. Anything not allocated
+// here is left for AllocateSupplierSettlements to spread oldest first.
+func AllocateSupplierPayment(tx *gorm.DB, supplierID, settlementID uuid.UUID, amount float64, requested []services.Allocation) error {
+	var total float64
+	for _, a := range requested {
+		supplyID, err := uuid.Parse(a.ID)
+		if err != nil {
+			return fmt.Errorf("invalid supply id %s", a.ID)
+		}
+		if a.Amount <= 0 {
+			return errors.New("allocation amounts must be greater than zero")
+		}
+		total = ledger.Round2(total + a.Amount)
+		if total > amount+0.005 {
+			return errors.New("allocations exceed the payment amount")
+		}
+
+		var supply Supply
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&supply, "id = ?", supplyID).Error; err != nil {
+			return fmt.Errorf("supply %s not found", a.ID)
+		}
+		if supply.SupplierID != supplierID {
+			return fmt.Errorf("supply %s was not delivered by this supplier", a.ID)
+		}
+		if a.Amount > supply.TotalAmount-supply.AmountPaid+0.005 {
+			return fmt.Errorf("allocation to supply %s exceeds its outstanding %.2f", supply.ReferenceNo, supply.TotalAmount-supply.AmountPaid)
+		}
+		if err := tx.Create(&SupplierPaymentAllocation{
+			ID:           uuid.New(),
+			SupplierID:   supplierID,
+			SettlementID: settlementID,
+			SupplyID:     supplyID,
+			Amount:       ledger.Round2(a.Amount),
+		}).Error; err != nil {
+			return err
+		}
+		if err := syncSupplyPaid(tx, supplyID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AllocateSupplierSettlements applies whatever part of a supplier's payments and debit notes is not yet
+// allocated to the supplier's unpaid supplies, oldest delivery first. A debit note raised against a supply
+// settles that supply before any other. Money left over stays unallocated until the next supply arrives.
+func AllocateSupplierSettlements(tx *gorm.DB, supplierID uuid.UUID) error {
+	var settlements []struct {
+		ID        uuid.UUID
+		SupplyID  *uuid.UUID
+		Amount    float64
+		Allocated float64
+	}
+	if err := tx.Model(&SupplierDebt{}).
+		Select(`supplier_debts.id, supplier_debts.supply_id, supplier_debts.amount,
+			COALESCE((SELECT SUM(a.amount) FROM supplier_payment_allocations a WHERE a.settlement_id = supplier_debts.id), 0) AS allocated`).
+		Where("supplier_debts.supplier_id = ? AND supplier_debts.transaction_type IN ?", supplierID, supplierSettlementTypes).
+		Order("supplier_debts.created_at, supplier_debts.id").Scan(&settlements).Error; err != nil {
+		return err
+	}
+
+	var supplies []Supply
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("supplier_id = ? AND total_amount - amount_paid > 0.005", supplierID).
+		Order("delivery_date, created_at").Find(&supplies).Error; err != nil {
+		return err
+	}
+	if len(supplies) == 0 {
+		return nil
+	}
+	items := make([]services.OpenItem, len(supplies))
+	for i, supply := range supplies {
+		items[i] = services.OpenItem{ID: supply.ID.String(), Date: supply.DeliveryDate, Outstanding: ledger.Round2(supply.TotalAmount - supply.AmountPaid)}
+	}
+
+	touched := map[uuid.UUID]bool{}
+	for _, settlement := range settlements {
+		remaining := ledger.Round2(settlement.Amount - settlement.Allocated)
+		if remaining <= 0.005 {
+			continue
+		}
+		// a debit note is claimed against its own supply first
+		ordered := items
+		if settlement.SupplyID != nil {
+			ordered = make([]services.OpenItem, 0, len(items))
+			for _, item := range items {
+				if item.ID == settlement.SupplyID.String() {
+					item.Date = time.Time{}
+				}
+				ordered = append(ordered, item)
+			}
+		}
+		allocations, _ := services.AllocateOldestFirst(remaining, ordered)
+		for _, a := range allocations {
+			supplyID := uuid.MustParse(a.ID)
+			if err := tx.Create(&SupplierPaymentAllocation{
+				ID:           uuid.New(),
+				SupplierID:   supplierID,
+				SettlementID: settlement.ID,
+				SupplyID:     supplyID,
+				Amount:       a.Amount,
+			}).Error; err != nil {
+				return err
+			}
+			for i := range items {
+				if items[i].ID == a.ID {
+					items[i].Outstanding = ledger.Round2(items[i].Outstanding - a.Amount)
+				}
+			}
+			touched[supplyID] = true
+		}
+	}
+
+	for supplyID := range touched {
+		if err := syncSupplyPaid(tx, supplyID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReleaseSupplyAllocations takes back the payments allocated to a supply that is being reversed, leaving them
+// free to settle other supplies
+func ReleaseSupplyAllocations(tx *gorm.DB, supplyID uuid.UUID) error {
+	if err := tx.Where("supply_id = ?", supplyID).Delete(&SupplierPaymentAllocation{}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Supply{}).Where("id = ?", supplyID).
+		Updates(map[string]interface{}{"amount_paid": 0, "is_paid": false}).Error
+}
+
+type SupplierNoteInput struct {
+	Type             string     `json:"type"` // credit_note or debit_note
+	SupplyID         *uuid.UUID `json:"supply_id"`
+	Amount           float64    `json:"amount"`
+	ReturnedQuantity float64    `json:"returned_quantity"` // litres of the named supply sent back to the supplier
+	Reference        string     `json:"reference"`
+	Reason           string     `json:"reason"`
+	Date             time.Time  `json:"date"`
+}
+
+// RecordSupplierNote records a credit note received from, or a debit note raised on, a supplier. Either lowers
+// what is owed, settling the supply it names first. A note for returned litres takes them out of the supply's
+// cost layer and inventory, the caller moves them out of the tank in the same transaction.
+func RecordSupplierNote(c *fiber.Ctx, tx *gorm.DB, supplierID uuid.UUID, input SupplierNoteInput, createdBy *uuid.UUID) (*SupplierDebt, error) {
+	if input.Type != SupplierDebtCreditNote && input.Type != SupplierDebtDebitNote {
+		return nil, fmt.Errorf("type must be %s or %s", SupplierDebtCreditNote, SupplierDebtDebitNote)
+	}
+	if strings.TrimSpace(input.Reason) == "" {
+		return nil, errors.New("a reason is required")
+	}
+	if input.ReturnedQuantity < 0 {
+		return nil, errors.New("returned_quantity cannot be negative")
+	}
+	if input.ReturnedQuantity > 0 && input.SupplyID == nil {
+		return nil, errors.New("supply_id is required to return litres")
+	}
+	if input.Date.IsZero() {
+		input.Date = time.Now()
+	}
+
+	var inventoryValue float64
+	if input.SupplyID != nil {
+		var supply Supply
+		if err := tx.First(&supply, "id = ?", *input.SupplyID).Error; err != nil {
+			return nil, errors.New("supply not found")
+		}
+		if supply.SupplierID != supplierID {
+			return nil, errors.New("supply was not delivered by this supplier")
+		}
+		if input.ReturnedQuantity > 0 {
+			var layer InventoryLayer
+			if err := tx.Where("supply_id = ?", supply.ID).First(&layer).Error; err != nil {
+				return nil, errors.New("supply has no stock left to return")
+			}
+			if layer.RemainingQuantity < input.ReturnedQuantity-0.005 {
+				return nil, fmt.Errorf("only %.2f litres of this supply are unsold and can be returned", layer.RemainingQuantity)
+			}
+			if err := AdjustSupplyLayer(tx, supply.ID, -input.ReturnedQuantity); err != nil {
+				return nil, err
+			}
+			inventoryValue = ledger.Round2(input.ReturnedQuantity * layer.UnitCost)
+		}
+	}
+	notes := strings.TrimSpace(input.Reference + " " + input.Reason)
+	note, err := recordSupplierNote(tx, input.Type, supplierID, input.SupplyID, input.Amount, notes)
+	if err != nil {
+		return nil, err
+	}
+	if err := PostSupplierNoteJournal(tx, *note, input.Date, createdBy, inventoryValue); err != nil {
+		return nil, err
+	}
+	if err := RecordAudit(c, tx, AuditEntitySupplierNote, note.ID, AuditCreate, nil, note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// releaseSettlementAllocations takes back what a removed payment or debit note had settled
+func releaseSettlementAllocations(tx *gorm.DB, settlementID uuid.UUID) error {
+	var supplyIDs []uuid.UUID
+	if err := tx.Model(&SupplierPaymentAllocation{}).Where("settlement_id = ?", settlementID).
+		Distinct().Pluck("supply_id", &supplyIDs).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("settlement_id = ?", settlementID).Delete(&SupplierPaymentAllocation{}).Error; err != nil {
+		return err
+	}
+	for _, supplyID := range supplyIDs {
+		if err := syncSupplyPaid(tx, supplyID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SupplierStatementLine is one entry of a supplier's account: supplies raise the balance owed, payments and
+// debit notes lower it
+type SupplierStatementLine struct {
+	Date         time.Time  `json:"date"`
+	Type         string     `json:"type"`
+	EntryID      uuid.UUID  `json:"entry_id"`
+	SupplyID     *uuid.UUID `json:"supply_id,omitempty"`
+	Reference    string     `json:"reference"`
+	DeliveryDate *time.Time `json:"delivery_date,omitempty"`
+	Quantity     float64    `json:"quantity,omitempty"`
+	UnitPrice    float64    `json:"unit_price,omitempty"`
+	Notes        string     `json:"notes"`
+	Supplies     float64    `json:"supplies"`
+	Payments     float64    `json:"payments"`
+	Balance      float64    `json:"balance"`
+}
+
+type SupplierStatement struct {
+	Supplier       Supplier                `json:"supplier"`
+	From           time.Time               `json:"from"`
+	To             time.Time               `json:"to"`
+	OpeningBalance float64                 `json:"opening_balance"`
+	Lines          []SupplierStatementLine `json:"lines"`
+	TotalSupplies  float64                 `json:"total_supplies"`
+	TotalPayments  float64                 `json:"total_payments"` // payments and debit notes
+	ClosingBalance float64                 `json:"closing_balance"`
+}
+
+// GetSupplierStatement lists a supplier's debt entries recorded in [from, to) with a running balance. A
+// negative balance is money held on account with the supplier.
+func GetSupplierStatement(supplierID uuid.UUID, from, to time.Time) (*SupplierStatement, error) {
+	var supplier Supplier
+	if err := db.First(&supplier, "id = ?", supplierID).Error; err != nil {
+		return nil, errors.New("supplier not found")
+	}
+
+	var opening float64
+	if err := db.Model(&SupplierDebt{}).Select(SupplierDebtBalanceSQL).
+		Where("supplier_id = ? AND created_at < ?", supplierID, from).Scan(&opening).Error; err != nil {
+		return nil, errors.New("failed to get opening balance")
+	}
+
+	var entries []SupplierDebt
+	if err := db.Preload("Supply").
+		Where("supplier_id = ? AND created_at >= ? AND created_at < ?", supplierID, from, to).
+		Order("created_at, id").Find(&entries).Error; err != nil {
+		return nil, errors.New("failed to get supplier transactions")
+	}
+
+	statement := SupplierStatement{
+		Supplier:       supplier,
+		From:           from,
+		To:             to,
+		OpeningBalance: ledger.Round2(opening),
+		Lines:          []SupplierStatementLine{},
+	}
+	balance := statement.OpeningBalance
+	for _, entry := range entries {
+		line := SupplierStatementLine{
+			Date:     entry.CreatedAt,
+			Type:     entry.TransactionType,
+			EntryID:  entry.ID,
+			SupplyID: entry.SupplyID,
+			Notes:    entry.Notes,
+		}
+		if entry.Supply != nil {
+			line.Reference = entry.Supply.ReferenceNo
+			line.DeliveryDate = &entry.Supply.DeliveryDate
+			line.Quantity = entry.Supply.Quantity
+			line.UnitPrice = entry.Supply.UnitPrice
+		}
+		switch entry.TransactionType {
+		case SupplierDebtSupply:
+			line.Supplies = entry.Amount
+			statement.TotalSupplies = ledger.Round2(statement.TotalSupplies + entry.Amount)
+		case SupplierDebtPayment, SupplierDebtDebitNote, SupplierDebtCreditNote:
+			line.Payments = entry.Amount
+			statement.TotalPayments = ledger.Round2(statement.TotalPayments + entry.Amount)
+		}
+		balance = ledger.Round2(balance + line.Supplies - line.Payments)
+		line.Balance = balance
+		statement.Lines = append(statement.Lines, line)
+	}
+	statement.ClosingBalance = balance
+	return &statement, nil
+}
+
+// SupplyAging is an unpaid supply on the aged payables report
+type SupplyAging struct {
+	SupplyID     uuid.UUID `json:"supply_id"`
+	StationID    uuid.UUID `json:"station_id"`
+	ReferenceNo  string    `json:"reference_no"`
+	DeliveryDate time.Time `json:"delivery_date"`
+	TotalAmount  float64   `json:"total_amount"`
+	Outstanding  float64   `json:"outstanding"`
+	AgeDays      int       `json:"age_days"`
+}
+
+// SupplierAging is what is owed to one supplier, by age
+type SupplierAging struct {
+	SupplierID   uuid.UUID     `json:"supplier_id"`
+	SupplierName string        `json:"supplier_name"`
+	Supplies     []SupplyAging `json:"supplies"`
+	services.AgingBuckets
+}
+
+type AgedPayables struct {
+	AsOf      time.Time             `json:"as_of"`
+	Suppliers []SupplierAging       `json:"suppliers"`
+	Total     services.AgingBuckets `json:"total"`
+}
+
+// GetAgedPayables buckets the supplies still unpaid at the end of asOf by delivery date, optionally for one
+// supplier or station
+func GetAgedPayables(asOf time.Time, supplierID, stationID *uuid.UUID) (*AgedPayables, error) {
+	end := asOf.AddDate(0, 0, 1)
+	var rows []struct {
+		SupplyAging
+		SupplierID   uuid.UUID
+		SupplierName string
+	}
+	query := db.Table("supplies").
+		Select(`supplies.id AS supply_id, supplies.station_id, supplies.reference_no, supplies.delivery_date,
+			supplies.total_amount, supplies.supplier_id, suppliers.name AS supplier_name,
+			supplies.total_amount - COALESCE((SELECT SUM(a.amount) FROM supplier_payment_allocations a
+				JOIN supplier_debts d ON d.id = a.settlement_id
+				WHERE a.supply_id = supplies.id AND d.created_at < ? AND d.deleted_at IS NULL), 0) AS outstanding`, end).
+		Joins("JOIN suppliers ON suppliers.id = supplies.supplier_id").
+		Where("supplies.deleted_at IS NULL AND supplies.delivery_date < ?", end)
+	if supplierID != nil {
+		query = query.Where("supplies.supplier_id = ?", *supplierID)
+	}
+	if stationID != nil {
+		query = query.Where("supplies.station_id = ?", *stationID)
+	}
+	if err := query.Order("supplier_name, supplies.delivery_date").Scan(&rows).Error; err != nil {
+		return nil, errors.New("failed to get payables")
+	}
+
+	report := &AgedPayables{AsOf: asOf, Suppliers: []SupplierAging{}}
+	index := map[uuid.UUID]int{}
+	for _, row := range rows {
+		if row.Outstanding <= 0.005 {
+			continue
+		}
+		row.Outstanding = ledger.Round2(row.Outstanding)
+		row.AgeDays = services.AgeInDays(row.DeliveryDate, asOf)
+
+		i, ok := index[row.SupplierID]
+		if !ok {
+			i = len(report.Suppliers)
+			index[row.SupplierID] = i
+			report.Suppliers = append(report.Suppliers, SupplierAging{SupplierID: row.SupplierID, SupplierName: row.SupplierName, Supplies: []SupplyAging{}})
+		}
+		supplier := &report.Suppliers[i]
+		supplier.Supplies = append(supplier.Supplies, row.SupplyAging)
+		supplier.Add(row.Outstanding, row.AgeDays)
+		report.Total.Add(row.Outstanding, row.AgeDays)
+	}
+	return report, nil
+}
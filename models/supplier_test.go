@@ -0,0 +1,58 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRemoveSupplierDebtEntry(t *testing.T) {
+	tests := []struct {
+		name     string
+		remove   int
+		balances []float64 // running balances of the entries left, oldest first
+		credit   float64
+	}{
+		// supply 1000 -> 1000, payment 400 -> 600, supply 500 -> 1100
+		{"payment raises later balances", 1, []float64{1000, 1500}, 0},
+		{"supply lowers later balances into credit", 0, []float64{0, 500}, 400},
+		{"last entry leaves earlier balances alone", 2, []float64{1000, 600}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := setupTestDB(t)
+			supplier := Supplier{ID: uuid.New(), Name: "Depot"}
+			if err := conn.Create(&supplier).Error; err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now().Add(-time.Hour)
+			entries := []SupplierDebt{
+				{ID: uuid.New(), SupplierID: supplier.ID, TransactionType: SupplierDebtSupply, Amount: 1000, RunningBalance: 1000, CreatedAt: start},
+				{ID: uuid.New(), SupplierID: supplier.ID, TransactionType: SupplierDebtPayment, Amount: 400, RunningBalance: 600, CreatedAt: start.Add(time.Minute)},
+				{ID: uuid.New(), SupplierID: supplier.ID, TransactionType: SupplierDebtSupply, Amount: 500, RunningBalance: 1100, CreatedAt: start.Add(2 * time.Minute)},
+			}
+			if err := conn.Create(&entries).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			if err := RemoveSupplierDebtEntry(conn, entries[tt.remove]); err != nil {
+				t.Fatal(err)
+			}
+			var left []SupplierDebt
+			conn.Where("supplier_id = ?", supplier.ID).Order("created_at").Find(&left)
+			if len(left) != len(tt.balances) {
+				t.Fatalf("%d entries left, want %d", len(left), len(tt.balances))
+			}
+			for i, want := range tt.balances {
+				if left[i].RunningBalance != want {
+					t.Errorf("entry %d running balance = %v, want %v", i, left[i].RunningBalance, want)
+				}
+			}
+			conn.First(&supplier, "id = ?", supplier.ID)
+			if supplier.CreditBalance != tt.credit {
+				t.Errorf("supplier credit = %v, want %v", supplier.CreditBalance, tt.credit)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 //create tank
@@ -76,4 +77,50 @@ func GetTankByID(c *fiber.Ctx, id uuid.UUID) (*Tank, error) {
 		return nil, errors.New("tank not found")
 	}
 	return &tank, nil
-}
\ No newline at end of file
+}
+// TankThresholds are the alert levels of a tank in litres
+type TankThresholds struct {
+	ReorderLevel float64 `json:"reorder_level"`
+	HighLevel    float64 `json:"high_level"`
+}
+
+// SetTankThresholds updates the reorder and high levels of a tank and re-evaluates its alerts against current stock
+func SetTankThresholds(c *fiber.Ctx, id uuid.UUID, input TankThresholds) (*Tank, error) {
+	var tank Tank
+	if err := db.First(&tank, "id = ?", id).Error; err != nil {
+		return nil, errors.New("tank not found")
+	}
+	if input.ReorderLevel < 0 || input.HighLevel < 0 {
+		return nil, errors.New("thresholds cannot be negative")
+	}
+	if tank.Capacity > 0 && (input.ReorderLevel >= tank.Capacity || input.HighLevel > tank.Capacity) {
+		return nil, errors.New("thresholds must be within the tank capacity")
+	}
+	if input.HighLevel > 0 && input.ReorderLevel >= input.HighLevel {
+		return nil, errors.New("reorder level must be below the high level")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&tank).Updates(map[string]interface{}{
+			"reorder_level": input.ReorderLevel,
+			"high_level":    input.HighLevel,
+		}).Error; err != nil {
+			return errors.New("failed to update tank thresholds")
+		}
+		tank.ReorderLevel = input.ReorderLevel
+		tank.HighLevel = input.HighLevel
+
+		var stock FuelStock
+		if err := tx.Where("tank_id = ?", tank.ID).First(&stock).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		return EvaluateStockAlerts(tx, tank, stock.CurrentVolume)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tank, nil
+}
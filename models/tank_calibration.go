@@ -0,0 +1,101 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/dancankarani/safa/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SaveTankCalibration replaces the strapping chart of a tank
+func SaveTankCalibration(c *fiber.Ctx, tankID uuid.UUID, points []services.CalibrationPoint) ([]TankCalibration, error) {
+	if err := services.ValidateCalibration(points); err != nil {
+		return nil, err
+	}
+	var tank Tank
+	if err := db.First(&tank, "id = ?", tankID).Error; err != nil {
+		return nil, errors.New("tank not found")
+	}
+	if max := points[len(points)-1].Liters; tank.Capacity > 0 && max > tank.Capacity*1.05 {
+		return nil, fmt.Errorf("chart goes up to %.2f liters but the tank holds %.2f", max, tank.Capacity)
+	}
+
+	rows := make([]TankCalibration, len(points))
+	for i, p := range points {
+		rows[i] = TankCalibration{ID: uuid.New(), TankID: tankID, HeightCm: p.HeightCm, Liters: p.Liters}
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tank_id = ?", tankID).Delete(&TankCalibration{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, errors.New("failed to save calibration chart")
+	}
+	return rows, nil
+}
+
+// GetTankCalibration returns the strapping chart of a tank sorted by height
+func GetTankCalibration(tx *gorm.DB, tankID uuid.UUID) ([]services.CalibrationPoint, error) {
+	var rows []TankCalibration
+	if err := tx.Where("tank_id = ?", tankID).Order("height_cm").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	points := make([]services.CalibrationPoint, len(rows))
+	for i, r := range rows {
+		points[i] = services.CalibrationPoint{HeightCm: r.HeightCm, Liters: r.Liters}
+	}
+	return points, nil
+}
+
+// ApplyDipCalibration fills in litres for dips taken in centimetres and centimetres for dips
+// entered in litres, using the tank's chart. Dips in centimetres need a chart.
+func ApplyDipCalibration(tx *gorm.DB, d *Dippings) error {
+	points, err := GetTankCalibration(tx, d.TankID)
+	if err != nil {
+		return err
+	}
+	hasChart := len(points) >= 2
+
+	convert := func(cm **float64, liters *float64, name string) error {
+		if *cm != nil {
+			if !hasChart {
+				return fmt.Errorf("%s given in cm but the tank has no calibration chart", name)
+			}
+			v, err := services.VolumeAtHeight(points, **cm)
+			if err != nil {
+				return err
+			}
+			*liters = ledger.Round2(v)
+			return nil
+		}
+		if hasChart {
+			if h, err := services.HeightAtVolume(points, *liters); err == nil {
+				h = ledger.Round2(h)
+				*cm = &h
+			}
+		}
+		return nil
+	}
+	if err := convert(&d.OpeningDipCm, &d.OpeningDip, "opening_dip"); err != nil {
+		return err
+	}
+	if err := convert(&d.ClosingDipCm, &d.ClosingDip, "closing_dip"); err != nil {
+		return err
+	}
+
+	if d.WaterLevelCm != nil && hasChart {
+		v, err := services.VolumeAtHeight(points, *d.WaterLevelCm)
+		if err != nil {
+			return fmt.Errorf("water level: %v", err)
+		}
+		v = ledger.Round2(v)
+		d.WaterLiters = &v
+	}
+	return nil
+}
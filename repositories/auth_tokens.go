@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/services"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	RefreshToken     string    `json:"refresh_token"`
+	AccessExpiresAt  time.Time `json:"token_expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
+
+// IssueTokenPair creates a short lived access token and a persisted refresh token for the employee
+func IssueTokenPair(tx *gorm.DB, employee models.Employee, ip string) (*TokenPair, *models.RefreshToken, error) {
+	accessToken, err := services.GenerateToken(services.Claims{
+		UserID:    &employee.ID,
+		FullName:  employee.FirstName + " " + employee.LastName,
+		Role:      employee.Role,
+		StationID: employee.StationID,
+		MustChangePassword: employee.MustChangePassword,
+	}, AccessTokenTTL)
+	if err != nil {
+		return nil, nil, errors.New("failed to generate token")
+	}
+
+	refreshToken, hash, err := services.GenerateRefreshToken()
+	if err != nil {
+		return nil, nil, errors.New("failed to generate refresh token")
+	}
+
+	record := models.RefreshToken{
+		ID:         uuid.New(),
+		EmployeeID: employee.ID,
+		TokenHash:  hash,
+		ExpiresAt:  time.Now().Add(RefreshTokenTTL),
+		IPAddress:  ip,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, nil, errors.New("failed to store refresh token")
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		AccessExpiresAt:  time.Now().Add(AccessTokenTTL),
+		RefreshExpiresAt: record.ExpiresAt,
+	}, &record, nil
+}
+
+// RotateRefreshToken exchanges a valid refresh token for a new pair and revokes the old one.
+// Presenting an already revoked token is treated as theft and kills every session of the employee.
+func RotateRefreshToken(refreshToken, ip string) (*TokenPair, error) {
+	var pair *TokenPair
+	reused := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var existing models.RefreshToken
+		// lock the row so two concurrent refreshes with the same token cannot both rotate it
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", services.HashToken(refreshToken)).First(&existing).Error; err != nil {
+			return errors.New("invalid refresh token")
+		}
+		if existing.RevokedAt != nil {
+			reused = true
+			return RevokeEmployeeSessions(tx, existing.EmployeeID, "refresh token reuse")
+		}
+		if time.Now().After(existing.ExpiresAt) {
+			return errors.New("refresh token expired")
+		}
+
+		var employee models.Employee
+		if err := tx.First(&employee, "id = ?", existing.EmployeeID).Error; err != nil {
+			return errors.New("employee not found")
+		}
+
+		newPair, record, err := IssueTokenPair(tx, employee, ip)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&existing).Updates(map[string]interface{}{
+			"revoked_at":     now,
+			"replaced_by_id": record.ID,
+		}).Error; err != nil {
+			return errors.New("failed to rotate refresh token")
+		}
+		pair = newPair
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, errors.New("refresh token has already been used, all sessions revoked")
+	}
+	return pair, nil
+}
+
+// RevokeRefreshToken revokes a single refresh token, used on logout
+func RevokeRefreshToken(refreshToken string) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("token_hash = ? AND revoked_at IS NULL", services.HashToken(refreshToken)).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAccessToken adds a single access token to the revocation list until it expires
+func RevokeAccessToken(tokenID string, employeeID uuid.UUID, expiresAt time.Time, reason string) error {
+	revocation := models.TokenRevocation{
+		ID:         uuid.New(),
+		TokenID:    tokenID,
+		EmployeeID: employeeID,
+		Reason:     reason,
+		ExpiresAt:  expiresAt,
+	}
+	return db.Create(&revocation).Error
+}
+
+// RevokeEmployeeSessions revokes every refresh token of the employee and
+// rejects every access token issued to them before now
+func RevokeEmployeeSessions(tx *gorm.DB, employeeID uuid.UUID, reason string) error {
+	now := time.Now()
+	if err := RevokeRefreshTokens(tx, employeeID); err != nil {
+		return err
+	}
+	revocation := models.TokenRevocation{
+		ID:            uuid.New(),
+		EmployeeID:    employeeID,
+		RevokedBefore: now,
+		Reason:        reason,
+		ExpiresAt:     now.Add(AccessTokenTTL),
+	}
+	return tx.Create(&revocation).Error
+}
+
+// RevokeRefreshTokens revokes every refresh token of the employee so no session can be renewed
+func RevokeRefreshTokens(tx *gorm.DB, employeeID uuid.UUID) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("employee_id = ? AND revoked_at IS NULL", employeeID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// PurgeExpiredRevocations deletes revocations whose tokens have expired anyway, keeping the
+// table IsTokenRevoked reads on every request small
+func PurgeExpiredRevocations() error {
+	return db.Where("expires_at < ?", time.Now()).Delete(&models.TokenRevocation{}).Error
+}
+
+// IsTokenRevoked is consulted by JWTMiddleware on every request
+func IsTokenRevoked(tokenID string, employeeID uuid.UUID, issuedAt time.Time) (bool, error) {
+	var count int64
+	err := db.Model(&models.TokenRevocation{}).
+		Where("(token_id = ? AND token_id <> '') OR (employee_id = ? AND revoked_before >= ?)", tokenID, employeeID, issuedAt).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,34 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dancankarani/safa/models"
+	"github.com/google/uuid"
+)
+
+func TestPurgeExpiredRevocations(t *testing.T) {
+	conn := setupTestDB(t)
+	employeeID := uuid.New()
+	if err := RevokeAccessToken("expired", employeeID, time.Now().Add(-time.Minute), "logout"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeAccessToken("live", employeeID, time.Now().Add(time.Minute), "logout"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PurgeExpiredRevocations(); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	var left []models.TokenRevocation
+	if err := conn.Find(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].TokenID != "live" {
+		t.Errorf("revocations left = %+v, want only the live one", left)
+	}
+	if revoked, _ := IsTokenRevoked("live", employeeID, time.Now()); !revoked {
+		t.Error("live token no longer revoked after purge")
+	}
+}
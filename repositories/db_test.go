@@ -0,0 +1,31 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/dancankarani/safa/internal/testutil"
+	"github.com/dancankarani/safa/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// setupTestDB points the package at a fresh in-memory database with the full schema for the length of a test
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	conn := testutil.OpenDB(t)
+	previous := db
+	db = conn
+	t.Cleanup(func() { db = previous })
+	models.Migrate(conn)
+	return conn
+}
+
+// tankVolume is the stock a tank currently holds
+func tankVolume(t *testing.T, conn *gorm.DB, tankID uuid.UUID) float64 {
+	t.Helper()
+	var stock models.FuelStock
+	if err := conn.Where("tank_id = ?", tankID).First(&stock).Error; err != nil {
+		t.Fatalf("stock of tank: %v", err)
+	}
+	return stock.CurrentVolume
+}
@@ -0,0 +1,182 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DeliveryVerificationInput carries the dips taken around an offload, either as heights in cm
+// converted through the tank's calibration chart or directly as volumes in litres
+type DeliveryVerificationInput struct {
+	DipBeforeCm      *float64 `json:"dip_before_cm"`
+	DipAfterCm       *float64 `json:"dip_after_cm"`
+	VolumeBefore     *float64 `json:"volume_before"`
+	VolumeAfter      *float64 `json:"volume_after"`
+	DispensedDuring  float64  `json:"dispensed_during"`
+	TolerancePercent *float64 `json:"tolerance_percent"`
+	RaiseDebitNote   bool     `json:"raise_debit_note"`
+	Notes            string   `json:"notes"`
+}
+
+// dipVolume resolves one side of the offload to litres
+func dipVolume(points []services.CalibrationPoint, heightCm, volume *float64, side string) (float64, error) {
+	if volume != nil {
+		return *volume, nil
+	}
+	if heightCm == nil {
+		return 0, fmt.Errorf("dip_%s_cm or volume_%s is required", side, side)
+	}
+	if len(points) == 0 {
+		return 0, errors.New("tank has no calibration chart, send volumes in litres instead")
+	}
+	return services.VolumeAtHeight(points, *heightCm)
+}
+
+// VerifyDelivery compares a supply's invoiced litres with what the tank actually gained during the offload.
+// Stock, the supply's cost layer and fuel transactions are corrected to the litres received, the value of the
+// variance is posted to the ledger, and a short delivery can raise a debit note against the supplier for the
+// litres short beyond the tolerance.
+func VerifyDelivery(c *fiber.Ctx, supplyID uuid.UUID, input DeliveryVerificationInput, verifiedBy *uuid.UUID) (*models.DeliveryVerification, error) {
+	var verification models.DeliveryVerification
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var supply models.Supply
+		if err := tx.First(&supply, "id = ?", supplyID).Error; err != nil {
+			return errors.New("supply not found")
+		}
+		if err := models.EnsurePeriodOpen(tx, supply.StationID, supply.DeliveryDate); err != nil {
+			return err
+		}
+		var existing int64
+		if err := tx.Model(&models.DeliveryVerification{}).Where("supply_id = ?", supply.ID).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return errors.New("supply has already been verified")
+		}
+		if input.DispensedDuring < 0 {
+			return errors.New("dispensed_during cannot be negative")
+		}
+
+		points, err := models.GetTankCalibration(tx, supply.TankID)
+		if err != nil {
+			return err
+		}
+		before, err := dipVolume(points, input.DipBeforeCm, input.VolumeBefore, "before")
+		if err != nil {
+			return err
+		}
+		after, err := dipVolume(points, input.DipAfterCm, input.VolumeAfter, "after")
+		if err != nil {
+			return err
+		}
+		if after < before {
+			return errors.New("tank volume after the offload is below the volume before it")
+		}
+
+		tolerance := services.DefaultDeliveryTolerancePercent
+		if input.TolerancePercent != nil {
+			tolerance = *input.TolerancePercent
+			if tolerance < 0 || tolerance > services.MaxDeliveryTolerancePercent {
+				return fmt.Errorf("tolerance_percent must be between 0 and %.0f", services.MaxDeliveryTolerancePercent)
+			}
+		}
+		check := services.CheckDelivery(supply.Quantity, before, after, input.DispensedDuring, tolerance)
+
+		verification = models.DeliveryVerification{
+			ID:               uuid.New(),
+			SupplyID:         supply.ID,
+			TankID:           supply.TankID,
+			StationID:        supply.StationID,
+			SupplierID:       supply.SupplierID,
+			DipBeforeCm:      input.DipBeforeCm,
+			DipAfterCm:       input.DipAfterCm,
+			VolumeBefore:     before,
+			VolumeAfter:      after,
+			DispensedDuring:  input.DispensedDuring,
+			InvoicedQuantity: supply.Quantity,
+			ReceivedQuantity: check.Received,
+			Variance:         check.Variance,
+			VariancePercent:  check.VariancePercent,
+			TolerancePercent: check.TolerancePercent,
+			ShortDelivery:    check.Short,
+			ClaimQuantity:    check.ClaimQuantity,
+			Notes:            input.Notes,
+			VerifiedBy:       verifiedBy,
+		}
+
+		if input.RaiseDebitNote && check.Short {
+			amount := check.ClaimQuantity * supply.UnitPrice
+			note, err := models.RecordSupplierDebitNote(tx, supply.SupplierID, &supply.ID, amount,
+				fmt.Sprintf("Short delivery %s: %.2f litres claimed of %.2f short", supply.ReferenceNo, check.ClaimQuantity, -check.Variance))
+			if err != nil {
+				return err
+			}
+			verification.DebitNoteID = &note.ID
+			verification.DebitNoteAmount = note.Amount
+		}
+		if err := tx.Create(&verification).Error; err != nil {
+			return err
+		}
+
+		// bring book stock in line with the litres actually received
+		if check.Variance < 0 {
+			if err := UpdateFuelStock(tx, supply.TankID, supply.StationID, supply.FuelProductID, -check.Variance, "out"); err != nil {
+				return err
+			}
+			if err := AddFuelTransaction(tx, "delivery_shortage", supply.FuelProductID, supply.StationID, -check.Variance, verification.ID, supply.EmployeeID); err != nil {
+				return err
+			}
+		} else if check.Variance > 0 {
+			if err := UpdateFuelStock(tx, supply.TankID, supply.StationID, supply.FuelProductID, check.Variance, "in"); err != nil {
+				return err
+			}
+			if err := AddFuelTransaction(tx, "supply", supply.FuelProductID, supply.StationID, check.Variance, verification.ID, supply.EmployeeID); err != nil {
+				return err
+			}
+		}
+		if err := models.AdjustSupplyLayer(tx, supply.ID, check.Variance); err != nil {
+			return err
+		}
+		if err := models.PostDeliveryVarianceJournal(tx, verification, supply); err != nil {
+			return err
+		}
+		return models.RecordAudit(c, tx, models.AuditEntityDeliveryVerification, verification.ID, models.AuditCreate, nil, verification)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &verification, nil
+}
+
+func GetDeliveryVerification(supplyID uuid.UUID) (*models.DeliveryVerification, error) {
+	var verification models.DeliveryVerification
+	if err := db.Preload("Supply").First(&verification, "supply_id = ?", supplyID).Error; err != nil {
+		return nil, errors.New("supply has not been verified")
+	}
+	return &verification, nil
+}
+
+// GetDeliveryVerifications lists verified deliveries newest first, optionally by station, supplier or only short ones
+func GetDeliveryVerifications(stationID, supplierID *uuid.UUID, shortOnly bool) ([]models.DeliveryVerification, error) {
+	verifications := []models.DeliveryVerification{}
+	query := db.Preload("Supply")
+	if stationID != nil {
+		query = query.Where("station_id = ?", *stationID)
+	}
+	if supplierID != nil {
+		query = query.Where("supplier_id = ?", *supplierID)
+	}
+	if shortOnly {
+		query = query.Where("short_delivery = ?", true)
+	}
+	if err := query.Order("created_at DESC").Find(&verifications).Error; err != nil {
+		return nil, errors.New("failed to get delivery verifications")
+	}
+	return verifications, nil
+}
@@ -2,9 +2,11 @@ package repositories
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/services"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -12,7 +14,7 @@ import (
 func GetCurrentStock(db *gorm.DB, productID, stationID uuid.UUID) (float64, error) {
 	var stock float64
 	err := db.Model(&models.FuelTransaction{}).
-		Select("COALESCE(SUM(CASE WHEN type = 'supply' THEN quantity ELSE -quantity END), 0)").
+		Select("COALESCE(SUM(CASE WHEN type IN ('supply', 'sale_reversal') THEN quantity ELSE -quantity END), 0)").
 		Where("fuel_product_id = ? AND station_id = ?", productID, stationID).
 		Scan(&stock).Error
 	return stock, err
@@ -20,8 +22,15 @@ func GetCurrentStock(db *gorm.DB, productID, stationID uuid.UUID) (float64, erro
 
 
 
-// direction: "in" for supply, "out" for sale or usage
+// direction: "in" for supply, "out" for sale or usage.
+// Supplies that would push the tank past its capacity are rejected, and every movement
+// re-evaluates the tank's low stock and overfill alerts.
 func UpdateFuelStock(tx *gorm.DB, tankID, stationID, fuelProductID uuid.UUID, quantity float64, direction string) error {
+	var tank models.Tank
+	if err := tx.First(&tank, "id = ?", tankID).Error; err != nil {
+		return errors.New("tank not found")
+	}
+
 	var stock models.FuelStock
 	err := tx.Where("tank_id = ?", tankID).First(&stock).Error
 
@@ -29,6 +38,9 @@ func UpdateFuelStock(tx *gorm.DB, tankID, stationID, fuelProductID uuid.UUID, qu
 		if direction == "out" {
 			return errors.New("cannot reduce stock: no existing stock record")
 		}
+		if err := checkTankCapacity(tank, 0, quantity); err != nil {
+			return err
+		}
 
 		// Create new stock record
 		stock = models.FuelStock{
@@ -38,13 +50,19 @@ func UpdateFuelStock(tx *gorm.DB, tankID, stationID, fuelProductID uuid.UUID, qu
 			StationID:     stationID,
 			CurrentVolume: quantity,
 		}
-		return tx.Create(&stock).Error
+		if err := tx.Create(&stock).Error; err != nil {
+			return err
+		}
+		return models.EvaluateStockAlerts(tx, tank, stock.CurrentVolume)
 	} else if err != nil {
 		return err
 	}
 
 	// Update existing stock
 	if direction == "in" {
+		if err := checkTankCapacity(tank, stock.CurrentVolume, quantity); err != nil {
+			return err
+		}
 		stock.CurrentVolume += quantity
 	} else if direction == "out" {
 		if stock.CurrentVolume < quantity {
@@ -55,7 +73,22 @@ func UpdateFuelStock(tx *gorm.DB, tankID, stationID, fuelProductID uuid.UUID, qu
 		return errors.New("invalid stock direction")
 	}
 
-	return tx.Save(&stock).Error
+	if err := tx.Save(&stock).Error; err != nil {
+		return err
+	}
+	return models.EvaluateStockAlerts(tx, tank, stock.CurrentVolume)
+}
+
+// checkTankCapacity rejects a delivery of quantity litres that does not fit in the tank's ullage
+func checkTankCapacity(tank models.Tank, current, quantity float64) error {
+	if tank.Capacity <= 0 {
+		return nil
+	}
+	level := services.EvaluateTankLevel(tank.Capacity, tank.ReorderLevel, tank.HighLevel, current)
+	if quantity > level.Ullage+0.005 {
+		return fmt.Errorf("supply of %.2f litres exceeds the ullage of tank %s: %.2f of %.2f litres free", quantity, tank.Name, level.Ullage, tank.Capacity)
+	}
+	return nil
 }
 
 type FuelStockWithDetails struct {
@@ -67,20 +100,38 @@ type FuelStockWithDetails struct {
     StationName     string    `json:"station_name"`
     TankName        string    `json:"tank_name"`
     CurrentVolume   float64   `json:"current_volume"`
+    Capacity        float64   `json:"capacity"`
+    Ullage          float64   `json:"ullage"`
+    FillPercent     float64   `json:"fill_percent"`
+    ReorderLevel    float64   `json:"reorder_level"`
+    HighLevel       float64   `json:"high_level"`
+    BelowReorder    bool      `json:"below_reorder"`
     LastUpdated     time.Time `json:"last_updated"`
 }
 
-func GetFuelStocksWithDetails() ([]FuelStockWithDetails, error) {
+func GetFuelStocksWithDetails(stationID *uuid.UUID) ([]FuelStockWithDetails, error) {
     var stocks []FuelStockWithDetails
     err := db.Table("fuel_stocks").
     Select("fuel_stocks.id, fuel_stocks.fuel_product_id, fuel_stocks.station_id, fuel_stocks.tank_id, fuel_stocks.current_volume, fuel_stocks.last_updated, "+
-           "fuel_products.name as fuel_product_name, stations.name as station_name, tanks.name as tank_name").
+           "fuel_products.name as fuel_product_name, stations.name as station_name, tanks.name as tank_name, "+
+           "tanks.capacity, tanks.reorder_level, tanks.high_level").
     Joins("LEFT JOIN fuel_products ON fuel_products.id = fuel_stocks.fuel_product_id").
     Joins("LEFT JOIN stations ON stations.id = fuel_stocks.station_id").
     Joins("LEFT JOIN tanks ON tanks.id = fuel_stocks.tank_id").
+    Scopes(models.ForStation(stationID, "fuel_stocks.station_id = ?")).
     Scan(&stocks).Error
+    if err != nil {
+        return nil, err
+    }
 
-    return stocks, err
+    for i := range stocks {
+        level := services.EvaluateTankLevel(stocks[i].Capacity, stocks[i].ReorderLevel, stocks[i].HighLevel, stocks[i].CurrentVolume)
+        stocks[i].Ullage = level.Ullage
+        stocks[i].FillPercent = level.FillPercent
+        stocks[i].HighLevel = level.HighLevel
+        stocks[i].BelowReorder = level.BelowReorder
+    }
+    return stocks, nil
 }
 
 
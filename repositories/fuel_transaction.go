@@ -17,9 +17,9 @@ func AddFuelTransaction(db *gorm.DB, txType string, productID, stationID uuid.UU
     // Calculate new level
     var newLevel float64
     switch txType {
-    case "supply":
+    case "supply", "sale_reversal":
         newLevel = previousLevel + quantity
-    case "sale", "dipping":
+    case "sale", "dipping", "delivery_shortage", "supply_reversal", "sale_adjustment", "supplier_return":
         newLevel = previousLevel - quantity
         if newLevel < 0 {
             return fmt.Errorf("insufficient stock: only %.2f available", previousLevel)
@@ -0,0 +1,20 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dancankarani/safa/ledger"
+	"github.com/google/uuid"
+)
+
+func GetTrialBalance(asOf time.Time, stationID *uuid.UUID) (*ledger.TrialBalance, error) {
+	return ledger.GetTrialBalance(db, asOf, stationID)
+}
+
+func GetAccountStatement(code string, from, to time.Time) (*ledger.AccountStatement, error) {
+	return ledger.GetAccountStatement(db, code, from, to)
+}
+
+func GetLedgerAccounts() ([]ledger.Account, error) {
+	return ledger.GetAccounts(db)
+}
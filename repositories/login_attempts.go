@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/services"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBAttemptStore keeps login attempt counters in the login_lockouts table
+type DBAttemptStore struct {
+	db *gorm.DB
+}
+
+func NewDBAttemptStore(db *gorm.DB) *DBAttemptStore {
+	return &DBAttemptStore{db: db}
+}
+
+func (s *DBAttemptStore) Get(key string) (*services.LoginAttemptState, error) {
+	var lockout models.LoginLockout
+	err := s.db.First(&lockout, "key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &services.LoginAttemptState{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &services.LoginAttemptState{
+		Failures:    lockout.Failures,
+		LastFailure: lockout.LastFailure,
+		LockedUntil: lockout.LockedUntil,
+	}, nil
+}
+
+func (s *DBAttemptStore) Save(key string, state *services.LoginAttemptState) error {
+	lockout := models.LoginLockout{
+		Key:         key,
+		Failures:    state.Failures,
+		LastFailure: state.LastFailure,
+		LockedUntil: state.LockedUntil,
+	}
+	return s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&lockout).Error
+}
+
+func (s *DBAttemptStore) Reset(key string) error {
+	return s.db.Delete(&models.LoginLockout{}, "key = ?", key).Error
+}
+
+// RecordLoginAttempt writes the login audit trail. Failures here never block a login.
+func RecordLoginAttempt(email string, employeeID *uuid.UUID, ip, userAgent string, success bool, reason string) {
+	attempt := models.LoginAttempt{
+		ID:         uuid.New(),
+		Email:      email,
+		EmployeeID: employeeID,
+		IPAddress:  ip,
+		UserAgent:  userAgent,
+		Success:    success,
+		Reason:     reason,
+	}
+	if err := db.Create(&attempt).Error; err != nil {
+		log.Println("failed to record login attempt:", err.Error())
+	}
+}
+
+// GetLoginAttempts returns the latest login attempts, optionally for one email
+func GetLoginAttempts(email string, since time.Time, limit int) ([]models.LoginAttempt, error) {
+	var attempts []models.LoginAttempt
+	query := db.Where("created_at >= ?", since)
+	if email != "" {
+		query = query.Where("email = ?", email)
+	}
+	if err := query.Order("created_at DESC").Limit(limit).Find(&attempts).Error; err != nil {
+		return nil, errors.New("failed to get login attempts")
+	}
+	return attempts, nil
+}
@@ -0,0 +1,175 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/services"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const PasswordResetTTL = 30 * time.Minute
+
+// ChangePassword verifies the old password and stores the new one.
+// Refresh tokens of every other session are revoked and a fresh token pair is returned.
+func ChangePassword(employeeID uuid.UUID, oldPassword, newPassword, ip string) (*TokenPair, error) {
+	if !services.ValidatePassword(newPassword) {
+		return nil, errors.New("password must be at least 8 characters and contain letters and digits")
+	}
+	if oldPassword == newPassword {
+		return nil, errors.New("new password must be different from the old password")
+	}
+
+	var tokens *TokenPair
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var employee models.Employee
+		if err := tx.First(&employee, "id = ?", employeeID).Error; err != nil {
+			return errors.New("employee not found")
+		}
+		if err := services.CompareHashAndPassword(employee.Password, oldPassword); err != nil {
+			return errors.New("old password is incorrect")
+		}
+
+		if err := setPassword(tx, &employee, newPassword); err != nil {
+			return err
+		}
+		if err := RevokeRefreshTokens(tx, employee.ID); err != nil {
+			return err
+		}
+
+		pair, _, err := IssueTokenPair(tx, employee, ip)
+		if err != nil {
+			return err
+		}
+		tokens = pair
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RequestPasswordReset emails a single use reset token.
+// It never reveals whether the email belongs to an employee.
+func RequestPasswordReset(email string) error {
+	employee, err := GetEmployeeByEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	token, hash, err := services.GenerateRefreshToken()
+	if err != nil {
+		return errors.New("failed to generate reset token")
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// only the latest reset link is valid
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("employee_id = ? AND used_at IS NULL", employee.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		reset := models.PasswordResetToken{
+			ID:         uuid.New(),
+			EmployeeID: employee.ID,
+			TokenHash:  hash,
+			ExpiresAt:  time.Now().Add(PasswordResetTTL),
+		}
+		return tx.Create(&reset).Error
+	})
+	if err != nil {
+		log.Println("failed to store reset token:", err.Error())
+		return errors.New("failed to create reset token")
+	}
+
+	go services.SendEmail(employee.Email, "Password Reset", passwordResetEmail(employee.FirstName, token))
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token and kills every existing session
+func ResetPassword(token, newPassword string) error {
+	if !services.ValidatePassword(newPassword) {
+		return errors.New("password must be at least 8 characters and contain letters and digits")
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordResetToken
+		if err := tx.Where("token_hash = ?", services.HashToken(token)).First(&reset).Error; err != nil {
+			return errors.New("invalid reset token")
+		}
+		if reset.UsedAt != nil {
+			return errors.New("reset token has already been used")
+		}
+		if time.Now().After(reset.ExpiresAt) {
+			return errors.New("reset token expired")
+		}
+
+		var employee models.Employee
+		if err := tx.First(&employee, "id = ?", reset.EmployeeID).Error; err != nil {
+			return errors.New("employee not found")
+		}
+		if err := setPassword(tx, &employee, newPassword); err != nil {
+			return err
+		}
+		if err := tx.Model(&reset).Update("used_at", time.Now()).Error; err != nil {
+			return errors.New("failed to consume reset token")
+		}
+		return RevokeEmployeeSessions(tx, employee.ID, "password reset")
+	})
+}
+
+//hashes and saves the password and clears the forced change flag
+func setPassword(tx *gorm.DB, employee *models.Employee, password string) error {
+	hashed, err := services.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	employee.Password = hashed
+	employee.MustChangePassword = false
+	if err := tx.Model(employee).Updates(map[string]interface{}{
+		"password":             hashed,
+		"must_change_password": false,
+	}).Error; err != nil {
+		return errors.New("failed to update password")
+	}
+	return nil
+}
+
+func passwordResetEmail(name, token string) string {
+	link := token
+	if frontend := os.Getenv("FRONTEND_URL"); frontend != "" {
+		link = fmt.Sprintf(`<a href="%s/reset-password?token=%s">Reset your password</a>`, frontend, token)
+	}
+	return fmt.Sprintf(`
+	<html>
+	<body style="background-color: #f0f0f0; margin: 0; padding: 0;">
+		<div style="max-width: 600px; margin: 40px auto; background-color: #ffffff; padding: 30px; border-radius: 10px; font-family: Arial, sans-serif; color: #333;">
+		<h1 style="font-size: 26px; font-weight: bold; color: #2c3e50; margin-top: 0; margin-bottom: 20px;">
+			SAFA Password Reset
+		</h1>
+		<p style="font-size: 16px; margin-bottom: 20px;">
+			Dear <strong>%s</strong>,
+		</p>
+		<p style="font-size: 16px; margin-bottom: 10px;">
+			We received a request to reset your password. Use the link below within %d minutes:
+		</p>
+		<p style="font-size: 16px; margin-bottom: 10px;">
+			<span style="background-color: #eef; padding: 4px 8px; border-radius: 4px;">%s</span>
+		</p>
+		<p style="font-size: 14px; color: #777; margin-top: 30px;">
+			If you did not request this, you can ignore this email.
+		</p>
+		<p style="font-size: 14px; color: #aaa; margin-top: 40px;">
+			&copy; 2025 SAFA Systems
+		</p>
+		</div>
+	</body>
+	</html>
+	`, name, int(PasswordResetTTL.Minutes()), link)
+}
@@ -1,13 +1,18 @@
 package repositories
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"time"
 
+	"github.com/dancankarani/safa/ledger"
 	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func AddPumpReadings(c *fiber.Ctx, pumpReadings models.PumpReadings) (*models.PumpReadings, error) {
@@ -46,6 +51,7 @@ func AddPumpReadings(c *fiber.Ctx, pumpReadings models.PumpReadings) (*models.Pu
 		if tank.ID == uuid.Nil || tank.StationID == uuid.Nil || tank.FuelProductID == uuid.Nil {
 			return fmt.Errorf("incomplete tank configuration")
 		}
+
 		if pumpReadings.BusinessDay.IsZero() {
 			return fmt.Errorf("business_day is required and must be a valid date")
 		}
@@ -55,21 +61,62 @@ func AddPumpReadings(c *fiber.Ctx, pumpReadings models.PumpReadings) (*models.Pu
 			return fmt.Errorf("business_day cannot be in the future")
 		}
 
+		if err := models.EnsurePeriodOpen(tx, pump.StationID, pumpReadings.BusinessDay); err != nil {
+			return err
+		}
+
+		// litres sell at the station's price in effect when they were read, whatever price the client sent
+		price, err := readingPrice(tx, tank, pumpReadings)
+		if err != nil {
+			return err
+		}
+		pumpReadings.UnitPrice = price
+
+		// readings can only be recorded against an open shift of the pump's station
+		if pumpReadings.ShiftID == nil {
+			return fmt.Errorf("shift_id is required")
+		}
+		var shift models.Shift
+		// share lock, so the reading waits for a close in progress and then sees the shift closed
+		if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).First(&shift, "id = ?", *pumpReadings.ShiftID).Error; err != nil {
+			return fmt.Errorf("shift not found")
+		}
+		if shift.Status != models.ShiftOpen {
+			return fmt.Errorf("shift %s is closed", shift.Name)
+		}
+		if shift.StationID != pump.StationID {
+			return fmt.Errorf("shift does not belong to the pump's station")
+		}
+		pumpReadings.Shift = shift.Name
+
+		// the reading must continue the pump's meter chain, wrapping only at the pump's rollover limit
+		if err := models.CheckMeterOpening(tx, pump.ID, time.Now(), pumpReadings.OpeningMeter); err != nil {
+			return err
+		}
+		if err := setMeterRollover(&pumpReadings, pump); err != nil {
+			return err
+		}
+
 		// 1. Save pump readings
-		fmt.Println(pumpReadings.LitersDispensed)
-		
 		if pumpReadings.LitersDispensed < 0 {
 			return fmt.Errorf("liters dispensed cannot be negative")
 		}
 		if err := tx.Create(&pumpReadings).Error; err != nil {
 			return err
 		}
+		if err := models.RecordAudit(c, tx, models.AuditEntityPumpReading, pumpReadings.ID, models.AuditCreate, nil, pumpReadings); err != nil {
+			return err
+		}
+		if err := models.PostPumpReadingJournal(tx, pumpReadings, pump.StationID); err != nil {
+			return err
+		}
 
 		// 2. Create sales record
 		sale := models.Sales{
 			ID:            uuid.New(),
 			EmployeeID:    pumpReadings.RecordedBy,
 			PumpID:        pumpReadings.PumpID,
+			PumpReadingID: &pumpReadings.ID,
 			LitersSold:    pumpReadings.LitersDispensed,
 			PricePerLiter: pumpReadings.UnitPrice,
 			TotalAmount:   pumpReadings.TotalSalesAmount,
@@ -83,8 +130,21 @@ func AddPumpReadings(c *fiber.Ctx, pumpReadings models.PumpReadings) (*models.Pu
 		if err := UpdateFuelStock(tx, tank.ID, tank.StationID, tank.FuelProductID, pumpReadings.LitersDispensed, "out"); err != nil {
 			return err
 		}
+		if err := AddFuelTransaction(tx, "sale", tank.FuelProductID, tank.StationID, pumpReadings.LitersDispensed, pumpReadings.ID, pumpReadings.RecordedBy); err != nil {
+			return err
+		}
+
+		// 4. Cost the litres sold out of the tank's cost layers
+		cost, err := models.ConsumeInventory(tx, tank, pumpReadings.LitersDispensed, pumpReadings.TotalSalesAmount,
+			models.InventorySourcePumpReading, pumpReadings.ID, pumpReadings.BusinessDay)
+		if err != nil {
+			return err
+		}
+		if err := models.PostCostOfSalesJournal(tx, pumpReadings, pump.StationID, cost); err != nil {
+			return err
+		}
 
-		return nil
+		return models.RefreshShiftCashUps(tx, pumpReadings.ShiftID)
 	})
 
 	if err != nil {
@@ -93,3 +153,319 @@ func AddPumpReadings(c *fiber.Ctx, pumpReadings models.PumpReadings) (*models.Pu
 
 	return returnVal, nil
 }
+
+// neighbourReadings returns the readings of the same pump recorded just before and just after a reading
+func neighbourReadings(tx *gorm.DB, reading models.PumpReadings) (previous, next *models.PumpReadings, err error) {
+	var prev models.PumpReadings
+	err = tx.Where("pump_id = ? AND id <> ? AND created_at <= ?", reading.PumpID, reading.ID, reading.CreatedAt).
+		Order("created_at DESC").First(&prev).Error
+	if err == nil {
+		previous = &prev
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+
+	var nxt models.PumpReadings
+	err = tx.Where("pump_id = ? AND id <> ? AND created_at > ?", reading.PumpID, reading.ID, reading.CreatedAt).
+		Order("created_at").First(&nxt).Error
+	if err == nil {
+		next = &nxt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+	return previous, next, nil
+}
+
+// setMeterRollover records the pump's rollover limit on a reading whose totalizer wrapped to zero
+func setMeterRollover(reading *models.PumpReadings, pump models.Pump) error {
+	_, rolledOver, err := services.MeterDispensed(reading.OpeningMeter, reading.ClosingMeter, pump.MeterRolloverLimit)
+	if err != nil {
+		return err
+	}
+	reading.MeterRolloverAt = 0
+	if rolledOver {
+		reading.MeterRolloverAt = pump.MeterRolloverLimit
+	}
+	return nil
+}
+
+// readingPrice is the station's price of a tank's product at the time of a reading: when it was read, or by
+// the end of its business day when no reading time was given
+func readingPrice(tx *gorm.DB, tank models.Tank, reading models.PumpReadings) (float64, error) {
+	at := reading.ReadingDate
+	if at.IsZero() {
+		at = reading.BusinessDay.AddDate(0, 0, 1).Add(-time.Second)
+		if at.After(time.Now()) {
+			at = time.Now()
+		}
+	}
+	price, err := models.EffectiveFuelPrice(tx, tank.StationID, tank.FuelProductID, at)
+	if err != nil {
+		return 0, fmt.Errorf("no fuel price was in effect for this pump's product at the station on %s", at.Format("2006-01-02 15:04"))
+	}
+	return price.UnitPrice, nil
+}
+
+// checkMeterChain makes sure a corrected reading still opens where the previous reading of the pump closed
+// and closes where the next one opens. A meter reset between two readings breaks the chain legitimately.
+func checkMeterChain(tx *gorm.DB, reading models.PumpReadings) error {
+	if err := models.CheckMeterOpening(tx, reading.PumpID, reading.CreatedAt, reading.OpeningMeter, reading.ID); err != nil {
+		return err
+	}
+	_, next, err := neighbourReadings(tx, reading)
+	if err != nil || next == nil {
+		return err
+	}
+	reset, err := models.MeterResetBetween(tx, reading.PumpID, reading.CreatedAt, next.CreatedAt)
+	if err != nil || reset != nil {
+		return err
+	}
+	if math.Abs(next.OpeningMeter-reading.ClosingMeter) > services.MeterTolerance {
+		return fmt.Errorf("closing meter %.2f does not match the next reading's opening meter %.2f", reading.ClosingMeter, next.OpeningMeter)
+	}
+	return nil
+}
+
+// readingSale finds the sale generated from a reading. Sales recorded before readings were linked are matched
+// on pump, litres and amount.
+func readingSale(tx *gorm.DB, reading models.PumpReadings) (*models.Sales, error) {
+	var sale models.Sales
+	err := tx.Where("pump_reading_id = ?", reading.ID).First(&sale).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = tx.Where("pump_reading_id IS NULL AND pump_id = ? AND liters_sold = ? AND total_amount = ?",
+			reading.PumpID, reading.LitersDispensed, reading.TotalSalesAmount).
+			Order("created_at").First(&sale).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &sale, nil
+}
+
+// readingTank returns the tank a reading drew from: the tank its litres were costed out of, or the pump's first tank
+func readingTank(tx *gorm.DB, reading models.PumpReadings) (*models.Tank, error) {
+	var tank models.Tank
+	var consumption models.InventoryConsumption
+	if err := tx.Where("source_type = ? AND source_id = ?", models.InventorySourcePumpReading, reading.ID).First(&consumption).Error; err == nil {
+		if err := tx.First(&tank, "id = ?", consumption.TankID).Error; err == nil {
+			return &tank, nil
+		}
+	}
+	var pump models.Pump
+	if err := tx.Preload("Tanks").First(&pump, "id = ?", reading.PumpID).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch pump: %v", err)
+	}
+	if len(pump.Tanks) == 0 {
+		return nil, fmt.Errorf("no tanks associated with this pump")
+	}
+	return &pump.Tanks[0], nil
+}
+
+// adjustReadingStock moves delta litres (positive for more sold) out of or back into the reading's tank
+func adjustReadingStock(tx *gorm.DB, tank models.Tank, reading models.PumpReadings, delta float64) error {
+	switch {
+	case delta > 0:
+		if err := UpdateFuelStock(tx, tank.ID, tank.StationID, tank.FuelProductID, delta, "out"); err != nil {
+			return err
+		}
+		return AddFuelTransaction(tx, "sale_adjustment", tank.FuelProductID, tank.StationID, delta, reading.ID, reading.RecordedBy)
+	case delta < 0:
+		if err := UpdateFuelStock(tx, tank.ID, tank.StationID, tank.FuelProductID, -delta, "in"); err != nil {
+			return err
+		}
+		return AddFuelTransaction(tx, "sale_reversal", tank.FuelProductID, tank.StationID, -delta, reading.ID, reading.RecordedBy)
+	}
+	return nil
+}
+
+// reverseReadingBooks takes a reading's cost layers consumption and journals back out
+func reverseReadingBooks(tx *gorm.DB, reading models.PumpReadings, reversedBy *uuid.UUID) error {
+	if _, err := models.ReverseInventoryConsumption(tx, models.InventorySourcePumpReading, reading.ID); err != nil {
+		return err
+	}
+	return ledger.Reverse(tx, ledger.SourcePumpReading, reading.ID, reading.BusinessDay, reversedBy)
+}
+
+// UpdatePumpReadings corrects a reading and carries the change through in one transaction: the linked sale,
+// tank stock and a fuel transaction for the litres difference, the cost layers and the ledger. The corrected
+// meters must still chain with the pump's previous and next readings.
+func UpdatePumpReadings(c *fiber.Ctx, id uuid.UUID, updatedReadings models.PumpReadings) (*models.PumpReadings, error) {
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	var pumpReadings models.PumpReadings
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pumpReadings, "id = ?", id).Error; err != nil {
+			return errors.New("pump readings not found")
+		}
+		before := pumpReadings
+
+		if !updatedReadings.BusinessDay.IsZero() {
+			if updatedReadings.BusinessDay.After(time.Now()) {
+				return fmt.Errorf("business_day cannot be in the future")
+			}
+			pumpReadings.BusinessDay = updatedReadings.BusinessDay
+		}
+		if updatedReadings.OpeningSalesAmount != 0 {
+			pumpReadings.OpeningSalesAmount = updatedReadings.OpeningSalesAmount
+		}
+		if updatedReadings.ClosingSalesAmount != 0 {
+			pumpReadings.ClosingSalesAmount = updatedReadings.ClosingSalesAmount
+		}
+		if updatedReadings.OpeningMeter != 0 {
+			pumpReadings.OpeningMeter = updatedReadings.OpeningMeter
+		}
+		if updatedReadings.ClosingMeter != 0 {
+			pumpReadings.ClosingMeter = updatedReadings.ClosingMeter
+		}
+		if !updatedReadings.ReadingDate.IsZero() {
+			pumpReadings.ReadingDate = updatedReadings.ReadingDate
+		}
+		var pump models.Pump
+		if err := tx.First(&pump, "id = ?", pumpReadings.PumpID).Error; err != nil {
+			return errors.New("pump not found")
+		}
+		if err := setMeterRollover(&pumpReadings, pump); err != nil {
+			return err
+		}
+
+		if err := models.EnsurePumpPeriodOpen(tx, before.PumpID, before.BusinessDay); err != nil {
+			return err
+		}
+		if err := models.EnsurePumpPeriodOpen(tx, pumpReadings.PumpID, pumpReadings.BusinessDay); err != nil {
+			return err
+		}
+		if err := checkMeterChain(tx, pumpReadings); err != nil {
+			return err
+		}
+		tank, err := readingTank(tx, before)
+		if err != nil {
+			return err
+		}
+		// a reading moved to another time sells at the price in effect then
+		if !pumpReadings.ReadingDate.Equal(before.ReadingDate) || !pumpReadings.BusinessDay.Equal(before.BusinessDay) {
+			price, err := readingPrice(tx, *tank, pumpReadings)
+			if err != nil {
+				return err
+			}
+			pumpReadings.UnitPrice = price
+		}
+		sale, err := readingSale(tx, before)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Omit(clause.Associations).Save(&pumpReadings).Error; err != nil {
+			return err
+		}
+		// litres are worked out on save, the corrected reading must still cover what was sold on credit from it
+		credited, err := models.ReadingCreditedLiters(tx, pumpReadings.ID)
+		if err != nil {
+			return err
+		}
+		if pumpReadings.LitersDispensed+services.MeterTolerance < credited {
+			return fmt.Errorf("%.2f litres of this reading were sold on credit, it cannot dispense only %.2f", credited, pumpReadings.LitersDispensed)
+		}
+
+		// 1. Linked sale
+		if sale != nil {
+			if err := tx.Model(sale).Updates(map[string]interface{}{
+				"pump_reading_id": pumpReadings.ID,
+				"liters_sold":     pumpReadings.LitersDispensed,
+				"price_per_liter": pumpReadings.UnitPrice,
+				"total_amount":    pumpReadings.TotalSalesAmount,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		// 2. Stock and fuel transaction for the litres difference
+		if err := adjustReadingStock(tx, *tank, pumpReadings, pumpReadings.LitersDispensed-before.LitersDispensed); err != nil {
+			return err
+		}
+
+		// 3. Cost layers and ledger are reversed and booked again
+		if err := reverseReadingBooks(tx, before, userID); err != nil {
+			return err
+		}
+		stationID := tank.StationID
+		if err := models.PostPumpReadingJournal(tx, pumpReadings, stationID); err != nil {
+			return err
+		}
+		cost, err := models.ConsumeInventory(tx, *tank, pumpReadings.LitersDispensed, pumpReadings.TotalSalesAmount,
+			models.InventorySourcePumpReading, pumpReadings.ID, pumpReadings.BusinessDay)
+		if err != nil {
+			return err
+		}
+		if err := models.PostCostOfSalesJournal(tx, pumpReadings, stationID, cost); err != nil {
+			return err
+		}
+		if err := models.RefreshShiftCashUps(tx, pumpReadings.ShiftID); err != nil {
+			return err
+		}
+
+		return models.RecordAudit(c, tx, models.AuditEntityPumpReading, pumpReadings.ID, models.AuditUpdate, before, pumpReadings)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pumpReadings, nil
+}
+
+// DeletePumpReadings removes a reading together with its sale, returning its litres to the tank and reversing
+// its cost layers consumption and journals. A reading between two others cannot be removed unless the next
+// reading opens where the previous one closed.
+func DeletePumpReadings(c *fiber.Ctx, id uuid.UUID) error {
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	return db.Transaction(func(tx *gorm.DB) error {
+		var pumpReadings models.PumpReadings
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pumpReadings, "id = ?", id).Error; err != nil {
+			return errors.New("pump readings not found")
+		}
+		if err := models.EnsurePumpPeriodOpen(tx, pumpReadings.PumpID, pumpReadings.BusinessDay); err != nil {
+			return err
+		}
+
+		_, next, err := neighbourReadings(tx, pumpReadings)
+		if err != nil {
+			return err
+		}
+		if next != nil {
+			if err := models.CheckMeterOpening(tx, next.PumpID, next.CreatedAt, next.OpeningMeter, pumpReadings.ID, next.ID); err != nil {
+				return fmt.Errorf("deleting this reading would break the meter chain: %w", err)
+			}
+		}
+
+		tank, err := readingTank(tx, pumpReadings)
+		if err != nil {
+			return err
+		}
+		sale, err := readingSale(tx, pumpReadings)
+		if err != nil {
+			return err
+		}
+		if sale != nil {
+			if err := tx.Delete(sale).Error; err != nil {
+				return err
+			}
+		}
+		if err := adjustReadingStock(tx, *tank, pumpReadings, -pumpReadings.LitersDispensed); err != nil {
+			return err
+		}
+		if err := reverseReadingBooks(tx, pumpReadings, userID); err != nil {
+			return err
+		}
+		// credits dispensed in the reading stay owed but no longer ride on its cash takings
+		if err := models.UnlinkReadingCredits(c, tx, pumpReadings.ID, userID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&pumpReadings).Error; err != nil {
+			return err
+		}
+		if err := models.RefreshShiftCashUps(tx, pumpReadings.ShiftID); err != nil {
+			return err
+		}
+		return models.RecordAudit(c, tx, models.AuditEntityPumpReading, pumpReadings.ID, models.AuditDelete, pumpReadings, nil)
+	})
+}
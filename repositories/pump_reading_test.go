@@ -0,0 +1,184 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dancankarani/safa/internal/testutil"
+	"github.com/dancankarani/safa/ledger"
+	"github.com/dancankarani/safa/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestReadingPrice(t *testing.T) {
+	conn := setupTestDB(t)
+	tank := models.Tank{ID: uuid.New(), StationID: uuid.New(), FuelProductID: uuid.New()}
+	now := time.Now()
+	prices := []models.StationFuelProduct{
+		{ID: uuid.New(), StationID: tank.StationID, FuelProductID: tank.FuelProductID, UnitPrice: 100, EffectiveFrom: now.AddDate(0, 0, -10)},
+		{ID: uuid.New(), StationID: tank.StationID, FuelProductID: tank.FuelProductID, UnitPrice: 120, EffectiveFrom: now.AddDate(0, 0, -2)},
+	}
+	if err := conn.Create(&prices).Error; err != nil {
+		t.Fatal(err)
+	}
+	day := func(d int) time.Time {
+		t := now.AddDate(0, 0, d)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+
+	tests := []struct {
+		name    string
+		reading models.PumpReadings
+		want    float64
+		wantErr bool
+	}{
+		{"read before the change", models.PumpReadings{ReadingDate: now.AddDate(0, 0, -5), BusinessDay: day(-5)}, 100, false},
+		{"entered late for an earlier day", models.PumpReadings{BusinessDay: day(-5)}, 100, false},
+		{"read after the change", models.PumpReadings{BusinessDay: day(-1)}, 120, false},
+		{"before any price", models.PumpReadings{BusinessDay: day(-20)}, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := readingPrice(conn, tank, tt.reading)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: readingPrice() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("%s: readingPrice() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckMeterChain(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		opening float64
+		closing float64
+		reset   bool // a meter reset is recorded between the reading and the next one
+		wantErr bool
+	}{
+		{"unchanged", 100, 200, false, false},
+		{"within tolerance", 100.005, 199.995, false, false},
+		{"opening off the previous closing", 90, 200, false, true},
+		{"closing off the next opening", 100, 210, false, true},
+		{"closing off the next opening after a reset", 100, 210, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := setupTestDB(t)
+			pumpID := uuid.New()
+			readings := []models.PumpReadings{
+				{ID: uuid.New(), PumpID: pumpID, OpeningMeter: 0, ClosingMeter: 100, CreatedAt: now.Add(-3 * time.Hour)},
+				{ID: uuid.New(), PumpID: pumpID, OpeningMeter: 100, ClosingMeter: 200, CreatedAt: now.Add(-2 * time.Hour)},
+				{ID: uuid.New(), PumpID: pumpID, OpeningMeter: 200, ClosingMeter: 300, CreatedAt: now.Add(-1 * time.Hour)},
+			}
+			if err := conn.Create(&readings).Error; err != nil {
+				t.Fatal(err)
+			}
+			if tt.reset {
+				reset := models.PumpMeterReset{ID: uuid.New(), PumpID: pumpID, Reason: models.MeterResetReasonReset, ResetAt: now.Add(-90 * time.Minute), OldClosingMeter: 210, NewOpeningMeter: 200}
+				if err := conn.Create(&reset).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			corrected := readings[1]
+			corrected.OpeningMeter, corrected.ClosingMeter = tt.opening, tt.closing
+			if err := checkMeterChain(conn, corrected); (err != nil) != tt.wantErr {
+				t.Errorf("checkMeterChain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// readingFixture is a pump on a tank holding 1000 litres bought at 150, selling at 200 on an open shift
+func readingFixture(t *testing.T, conn *gorm.DB) (models.Tank, models.PumpReadings) {
+	t.Helper()
+	station := models.Station{ID: uuid.New(), Name: "Main", CostingMethod: "fifo"}
+	supplier := models.Supplier{ID: uuid.New(), Name: "Depot"}
+	tank := models.Tank{ID: uuid.New(), Name: "T1", Capacity: 10000, FuelProductID: uuid.New(), StationID: station.ID}
+	pump := models.Pump{ID: uuid.New(), Name: "P1", StationID: station.ID}
+	shift := models.Shift{ID: uuid.New(), StationID: station.ID, Name: "day", Status: models.ShiftOpen, StartTime: time.Now(), OpenedBy: uuid.New()}
+	price := models.StationFuelProduct{ID: uuid.New(), StationID: station.ID, FuelProductID: tank.FuelProductID, UnitPrice: 200, EffectiveFrom: time.Now().AddDate(0, 0, -10)}
+	for _, row := range []interface{}{&station, &supplier, &tank, &pump, &shift, &price} {
+		if err := conn.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := conn.Model(&pump).Association("Tanks").Append(&tank); err != nil {
+		t.Fatal(err)
+	}
+	supply := models.Supply{
+		ID: uuid.New(), SupplierID: supplier.ID, StationID: station.ID, TankID: tank.ID, EmployeeID: uuid.New(),
+		FuelProductID: tank.FuelProductID, Quantity: 1000, UnitPrice: 150, DeliveryDate: time.Now().AddDate(0, 0, -5),
+	}
+	if err := RecordSupply(conn, supply); err != nil {
+		t.Fatalf("record supply: %v", err)
+	}
+	today := time.Now()
+	reading := models.PumpReadings{
+		PumpID: pump.ID, ShiftID: &shift.ID, RecordedBy: uuid.New(), OpeningMeter: 0, ClosingMeter: 100,
+		BusinessDay: time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location()),
+	}
+	return tank, reading
+}
+
+func TestPumpReadingCascade(t *testing.T) {
+	conn := setupTestDB(t)
+	tank, input := readingFixture(t, conn)
+	c := testutil.Ctx(t, uuid.New())
+
+	type books struct {
+		stock, sold, sales, cost, inventory float64
+	}
+	check := func(step string, want books) {
+		t.Helper()
+		if got := tankVolume(t, conn, tank.ID); got != want.stock {
+			t.Errorf("%s: stock = %v, want %v", step, got, want.stock)
+		}
+		if got, _ := GetCurrentStock(conn, tank.FuelProductID, tank.StationID); got != want.stock {
+			t.Errorf("%s: stock by transactions = %v, want %v", step, got, want.stock)
+		}
+		var sold float64
+		conn.Model(&models.Sales{}).Select("COALESCE(SUM(liters_sold), 0)").Scan(&sold)
+		if sold != want.sold {
+			t.Errorf("%s: litres on sales = %v, want %v", step, sold, want.sold)
+		}
+		var consumed float64
+		conn.Model(&models.InventoryConsumption{}).Select("COALESCE(SUM(quantity), 0)").Scan(&consumed)
+		if consumed != want.sold {
+			t.Errorf("%s: litres consumed = %v, want %v", step, consumed, want.sold)
+		}
+		if got := testutil.AccountBalance(t, conn, ledger.FuelSalesAccount); got != want.sales {
+			t.Errorf("%s: sales account = %v, want %v", step, got, want.sales)
+		}
+		if got := testutil.AccountBalance(t, conn, ledger.CostOfSalesAccount); got != want.cost {
+			t.Errorf("%s: cost of sales = %v, want %v", step, got, want.cost)
+		}
+		if got := testutil.AccountBalance(t, conn, ledger.InventoryAccount); got != want.inventory {
+			t.Errorf("%s: inventory = %v, want %v", step, got, want.inventory)
+		}
+	}
+
+	reading, err := AddPumpReadings(c, input)
+	if err != nil {
+		t.Fatalf("add reading: %v", err)
+	}
+	check("added", books{stock: 900, sold: 100, sales: -20000, cost: 15000, inventory: 135000})
+
+	if _, err := UpdatePumpReadings(c, reading.ID, models.PumpReadings{ClosingMeter: 150}); err != nil {
+		t.Fatalf("update reading: %v", err)
+	}
+	check("corrected up", books{stock: 850, sold: 150, sales: -30000, cost: 22500, inventory: 127500})
+
+	if _, err := UpdatePumpReadings(c, reading.ID, models.PumpReadings{ClosingMeter: 40}); err != nil {
+		t.Fatalf("update reading: %v", err)
+	}
+	check("corrected down", books{stock: 960, sold: 40, sales: -8000, cost: 6000, inventory: 144000})
+
+	if err := DeletePumpReadings(c, reading.ID); err != nil {
+		t.Fatalf("delete reading: %v", err)
+	}
+	check("deleted", books{stock: 1000, sold: 0, sales: 0, cost: 0, inventory: 150000})
+}
@@ -0,0 +1,171 @@
+package repositories
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dancankarani/safa/internal/testutil"
+	"github.com/dancankarani/safa/ledger"
+	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/services"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// supplierFixture delivers an older supply of 100,000 and a newer one of 50,000 from one supplier
+func supplierFixture(t *testing.T, conn *gorm.DB) (supplierID uuid.UUID, older, newer models.Supply) {
+	t.Helper()
+	station := models.Station{ID: uuid.New(), Name: "Main", CostingMethod: "fifo"}
+	supplier := models.Supplier{ID: uuid.New(), Name: "Depot"}
+	tank := models.Tank{ID: uuid.New(), Name: "T1", Capacity: 10000, FuelProductID: uuid.New(), StationID: station.ID}
+	for _, row := range []interface{}{&station, &supplier, &tank} {
+		if err := conn.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	supply := func(litres float64, daysAgo int) models.Supply {
+		s := models.Supply{
+			ID: uuid.New(), SupplierID: supplier.ID, StationID: station.ID, TankID: tank.ID, EmployeeID: uuid.New(),
+			FuelProductID: tank.FuelProductID, Quantity: litres, UnitPrice: 100, DeliveryDate: time.Now().AddDate(0, 0, -daysAgo),
+		}
+		if err := RecordSupply(conn, s); err != nil {
+			t.Fatalf("record supply: %v", err)
+		}
+		return s
+	}
+	older = supply(1000, 10)
+	newer = supply(500, 5)
+	return supplier.ID, older, newer
+}
+
+// amountPaid is what has been allocated to a supply
+func amountPaid(t *testing.T, conn *gorm.DB, supplyID uuid.UUID) float64 {
+	t.Helper()
+	var supply models.Supply
+	if err := conn.First(&supply, "id = ?", supplyID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return supply.AmountPaid
+}
+
+func TestAllocateSupplierPayment(t *testing.T) {
+	tests := []struct {
+		name      string
+		amount    float64
+		allocate  func(older, newer, foreign models.Supply) []services.Allocation
+		wantErr   bool
+		olderPaid float64
+		newerPaid float64
+	}{
+		{"chosen supply first, rest oldest first", 40000, func(_, newer, _ models.Supply) []services.Allocation {
+			return []services.Allocation{{ID: newer.ID.String(), Amount: 30000}}
+		}, false, 10000, 30000},
+		{"no choice settles oldest first", 40000, func(_, _, _ models.Supply) []services.Allocation {
+			return nil
+		}, false, 40000, 0},
+		{"allocations above the payment", 40000, func(older, newer, _ models.Supply) []services.Allocation {
+			return []services.Allocation{{ID: newer.ID.String(), Amount: 30000}, {ID: older.ID.String(), Amount: 20000}}
+		}, true, 0, 0},
+		{"allocation above the supply's outstanding", 70000, func(_, newer, _ models.Supply) []services.Allocation {
+			return []services.Allocation{{ID: newer.ID.String(), Amount: 60000}}
+		}, true, 0, 0},
+		{"another supplier's supply", 40000, func(_, _, foreign models.Supply) []services.Allocation {
+			return []services.Allocation{{ID: foreign.ID.String(), Amount: 10000}}
+		}, true, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := setupTestDB(t)
+			supplierID, older, newer := supplierFixture(t, conn)
+			_, foreign, _ := supplierFixture(t, conn)
+
+			payment := models.SupplierPayment{ID: uuid.New(), SupplierID: supplierID, Amount: tt.amount, PaymentDate: time.Now(), Method: "bank"}
+			err := RecordSupplierPayment(conn, payment, tt.allocate(older, newer, foreign))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RecordSupplierPayment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := amountPaid(t, conn, older.ID); got != tt.olderPaid {
+				t.Errorf("older supply paid = %v, want %v", got, tt.olderPaid)
+			}
+			if got := amountPaid(t, conn, newer.ID); got != tt.newerPaid {
+				t.Errorf("newer supply paid = %v, want %v", got, tt.newerPaid)
+			}
+		})
+	}
+}
+
+func TestSupplierNoteSettlesItsSupplyFirst(t *testing.T) {
+	conn := setupTestDB(t)
+	supplierID, older, newer := supplierFixture(t, conn)
+
+	note := models.SupplierNoteInput{Type: models.SupplierDebtDebitNote, SupplyID: &newer.ID, Amount: 20000, Reason: "short delivery"}
+	if _, err := RecordSupplierNote(testutil.Ctx(t, uuid.New()), supplierID, note, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := amountPaid(t, conn, newer.ID); got != 20000 {
+		t.Errorf("named supply paid = %v, want 20000", got)
+	}
+	if got := amountPaid(t, conn, older.ID); got != 0 {
+		t.Errorf("older supply paid = %v, want 0", got)
+	}
+}
+
+func TestReverseSupplierPayment(t *testing.T) {
+	conn := setupTestDB(t)
+	supplierID, older, newer := supplierFixture(t, conn)
+	first := models.SupplierPayment{ID: uuid.New(), SupplierID: supplierID, Amount: 100000, PaymentDate: time.Now(), Method: "bank"}
+	if err := RecordSupplierPayment(conn, first, nil); err != nil {
+		t.Fatal(err)
+	}
+	// settles the newer supply and leaves 30,000 unallocated
+	second := models.SupplierPayment{ID: uuid.New(), SupplierID: supplierID, Amount: 80000, PaymentDate: time.Now(), Method: "bank"}
+	if err := RecordSupplierPayment(conn, second, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	reversed, err := ReverseSupplierPayment(testutil.Ctx(t, uuid.New()), first.ID, "paid twice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reversed.ReversedAt == nil || reversed.ReversalReason != "paid twice" {
+		t.Errorf("payment not marked reversed: %+v", reversed)
+	}
+	// the older supply is freed and picks up what the second payment had left over
+	if got := amountPaid(t, conn, older.ID); got != 30000 {
+		t.Errorf("older supply paid = %v, want 30000", got)
+	}
+	if got := amountPaid(t, conn, newer.ID); got != 50000 {
+		t.Errorf("newer supply paid = %v, want 50000", got)
+	}
+	if got := testutil.AccountBalance(t, conn, ledger.PayablesAccount); got != -70000 {
+		t.Errorf("payables = %v, want -70000", got)
+	}
+	var entry ledger.JournalEntry
+	conn.Where("source_id = ? AND reversal_of IS NOT NULL", first.ID).First(&entry)
+	if !strings.Contains(entry.Description, "paid twice") {
+		t.Errorf("reversal entry %q does not carry the reason", entry.Description)
+	}
+	if _, err := ReverseSupplierPayment(testutil.Ctx(t, uuid.New()), first.ID, "again", nil); err == nil {
+		t.Error("a payment was reversed twice")
+	}
+}
+
+func TestReverseSupplierPaymentAmbiguousLegacyEntry(t *testing.T) {
+	conn := setupTestDB(t)
+	supplierID, _, _ := supplierFixture(t, conn)
+	payment := models.SupplierPayment{ID: uuid.New(), SupplierID: supplierID, Amount: 5000, PaymentDate: time.Now(), CreatedAt: time.Now()}
+	if err := conn.Create(&payment).Error; err != nil {
+		t.Fatal(err)
+	}
+	// two unlinked entries recorded before payments were linked, either could be this payment's
+	for i := 0; i < 2; i++ {
+		entry := models.SupplierDebt{ID: uuid.New(), SupplierID: supplierID, TransactionType: models.SupplierDebtPayment, Amount: 5000, CreatedAt: payment.CreatedAt.Add(time.Duration(i) * time.Second)}
+		if err := conn.Create(&entry).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ReverseSupplierPayment(testutil.Ctx(t, uuid.New()), payment.ID, "mistake", nil); err == nil || !strings.Contains(err.Error(), "cannot be reversed safely") {
+		t.Errorf("ReverseSupplierPayment() error = %v, want an ambiguous match refusal", err)
+	}
+}
@@ -4,97 +4,175 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"strings"
 	"time"
 
+	"github.com/dancankarani/safa/ledger"
 	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/services"
+	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func RecordSupply(db *gorm.DB, supply models.Supply) error {
 	return db.Transaction(func(tx *gorm.DB) error {
-		// 1. Save the supply record
+		// Save the supply record
 		if err := tx.Create(&supply).Error; err != nil {
 			return err
 		}
 
-		// 2. Load the supplier
-		var supplier models.Supplier
-		if err := tx.First(&supplier, "id = ?", supply.SupplierID).Error; err != nil {
+		// Open a cost layer for the tank
+		if err := models.AddInventoryLayer(tx, supply); err != nil {
 			return err
 		}
-
-		// 3. Get current running balance
-		var currentDebt struct {
-			Balance float64
-		}
-		err := tx.Model(&models.SupplierDebt{}).
-			Select(`COALESCE(SUM(CASE 
-				WHEN transaction_type = 'supply' THEN amount 
-				WHEN transaction_type = 'payment' THEN -amount 
-				ELSE 0 END), 0) as balance`).
-			Where("supplier_id = ?", supply.SupplierID).
-			Scan(&currentDebt).Error
-		if err != nil {
+		if err := moveSupplyStock(tx, supply, supply.Quantity); err != nil {
 			return err
 		}
+		return postSupply(tx, supply)
+	})
+}
 
-		// 4. Apply credit
-		amountDue := supply.TotalAmount
-		creditToApply := math.Min(supplier.CreditBalance, amountDue)
-		remainingDebt := amountDue - creditToApply
-		newRunningBalance := currentDebt.Balance + remainingDebt
-
-		// 5. Create supplier debt record
-		notes := ""
-		if creditToApply > 0 {
-			notes = fmt.Sprintf("Applied credit: %.2f, remaining debt: %.2f", creditToApply, remainingDebt)
-		} else {
-			notes = "No credit applied"
-		}
+// postSupply books a saved supply: supplier debt, ledger and purchase order. Its litres reach the tank through
+// moveSupplyStock.
+func postSupply(tx *gorm.DB, supply models.Supply) error {
+	// 2. Load the supplier
+	var supplier models.Supplier
+	if err := tx.First(&supplier, "id = ?", supply.SupplierID).Error; err != nil {
+		return err
+	}
 
-		debtRecord := models.SupplierDebt{
-			ID:              uuid.New(),
-			SupplierID:      supply.SupplierID,
-			SupplyID:        &supply.ID,
-			TransactionType: "supply",
-			Amount:          amountDue,
-			RunningBalance:  newRunningBalance,
-			Notes:           notes,
-		}
+	// 3. Get current running balance
+	var currentDebt struct {
+		Balance float64
+	}
+	err := tx.Model(&models.SupplierDebt{}).
+		Select(models.SupplierDebtBalanceSQL + " as balance").
+		Where("supplier_id = ?", supply.SupplierID).
+		Scan(&currentDebt).Error
+	if err != nil {
+		return err
+	}
 
-		// 6. Update supplier's credit balance
-		supplier.CreditBalance -= creditToApply
-		if supplier.CreditBalance < 0 {
-			supplier.CreditBalance = 0
-		}
-		if err := tx.Model(&supplier).Update("credit_balance", supplier.CreditBalance).Error; err != nil {
+	// 4. Apply credit
+	amountDue := supply.TotalAmount
+	creditToApply := math.Min(supplier.CreditBalance, amountDue)
+	remainingDebt := amountDue - creditToApply
+	newRunningBalance := currentDebt.Balance + remainingDebt
+
+	// 5. Create supplier debt record
+	notes := ""
+	if creditToApply > 0 {
+		notes = fmt.Sprintf("Applied credit: %.2f, remaining debt: %.2f", creditToApply, remainingDebt)
+	} else {
+		notes = "No credit applied"
+	}
+
+	debtRecord := models.SupplierDebt{
+		ID:              uuid.New(),
+		SupplierID:      supply.SupplierID,
+		SupplyID:        &supply.ID,
+		TransactionType: "supply",
+		Amount:          amountDue,
+		RunningBalance:  newRunningBalance,
+		Notes:           notes,
+	}
+
+	// 6. Update supplier's credit balance
+	supplier.CreditBalance -= creditToApply
+	if supplier.CreditBalance < 0 {
+		supplier.CreditBalance = 0
+	}
+	if err := tx.Model(&supplier).Update("credit_balance", supplier.CreditBalance).Error; err != nil {
+		return err
+	}
+
+	// 7. Record the debt entry
+	if err := tx.Create(&debtRecord).Error; err != nil {
+		return err
+	}
+
+	// 8. Post to the ledger
+	if err := models.PostSupplyJournal(tx, supply); err != nil {
+		return err
+	}
+
+	// 9. Receive against the purchase order
+	if err := models.ReceiveAgainstPurchaseOrder(tx, supply); err != nil {
+		return err
+	}
+
+	// 10. Settle it out of any payments not yet allocated
+	return models.AllocateSupplierSettlements(tx, supply.SupplierID)
+}
+
+// reverseSupply undoes what postSupply booked for a supply: its debt entry is removed and later running
+// balances recomputed, what was settled on it freed and the journal reversed. It refuses once the delivery
+// has been verified against dips. The tank stock is left to moveSupplyStock.
+func reverseSupply(tx *gorm.DB, supply models.Supply, reversedBy *uuid.UUID) error {
+	var verified int64
+	if err := tx.Model(&models.DeliveryVerification{}).Where("supply_id = ?", supply.ID).Count(&verified).Error; err != nil {
+		return err
+	}
+	if verified > 0 {
+		return errors.New("supply has been verified against tank dips and can no longer be changed")
+	}
+
+	var debts []models.SupplierDebt
+	if err := tx.Where("supply_id = ? AND transaction_type = ?", supply.ID, models.SupplierDebtSupply).
+		Order("created_at DESC").Find(&debts).Error; err != nil {
+		return err
+	}
+	for _, debt := range debts {
+		if err := models.RemoveSupplierDebtEntry(tx, debt); err != nil {
 			return err
 		}
+	}
+	if err := models.ReleaseSupplyAllocations(tx, supply.ID); err != nil {
+		return err
+	}
+
+	return ledger.Reverse(tx, ledger.SourceSupply, supply.ID, supply.DeliveryDate, reversedBy)
+}
 
-		// 7. Record the debt entry
-		if err := tx.Create(&debtRecord).Error; err != nil {
+// moveSupplyStock puts litres of a supply into its tank, or takes them back out when litres is negative, with
+// a fuel transaction for the movement. Taking litres out is refused when the tank no longer holds them.
+func moveSupplyStock(tx *gorm.DB, supply models.Supply, litres float64) error {
+	switch {
+	case litres > 0:
+		if err := UpdateFuelStock(tx, supply.TankID, supply.StationID, supply.FuelProductID, litres, "in"); err != nil {
 			return err
 		}
-
-		// 8. Update fuel stock
-		if err := UpdateFuelStock(tx, supply.TankID, supply.StationID, supply.FuelProductID, supply.Quantity, "in"); err != nil {
+		return AddFuelTransaction(tx, "supply", supply.FuelProductID, supply.StationID, litres, supply.ID, supply.EmployeeID)
+	case litres < 0:
+		var stock models.FuelStock
+		if err := tx.Where("tank_id = ?", supply.TankID).First(&stock).Error; err != nil {
+			return errors.New("no stock record for the supply's tank")
+		}
+		if stock.CurrentVolume < -litres-0.005 {
+			return fmt.Errorf("tank holds %.2f litres, taking %.2f litres of this supply back out would make stock negative", stock.CurrentVolume, -litres)
+		}
+		if err := UpdateFuelStock(tx, supply.TankID, supply.StationID, supply.FuelProductID, math.Min(-litres, stock.CurrentVolume), "out"); err != nil {
 			return err
 		}
-
-		// 9. Add fuel transaction
-		return AddFuelTransaction(tx, "supply", supply.FuelProductID, supply.StationID, supply.Quantity, supply.ID, supply.EmployeeID)
-	})
+		return AddFuelTransaction(tx, "supply_reversal", supply.FuelProductID, supply.StationID, -litres, supply.ID, supply.EmployeeID)
+	}
+	return nil
 }
 
 
-func RecordSupplierPayment(db *gorm.DB, payment models.SupplierPayment) error {
+// RecordSupplierPayment records a payment to a supplier. It settles the supplies named in allocations first
+// and the oldest unpaid supplies with the rest; an overpayment is held as credit with the supplier.
+func RecordSupplierPayment(db *gorm.DB, payment models.SupplierPayment, allocations []services.Allocation) error {
     return db.Transaction(func(tx *gorm.DB) error {
         if payment.Amount <= 0 {
             return fmt.Errorf("invalid payment amount")
         }
 
-        payment.ID = uuid.New()
+        if payment.ID == uuid.Nil {
+            payment.ID = uuid.New()
+        }
         if err := tx.Create(&payment).Error; err != nil {
             return err
         }
@@ -110,10 +188,7 @@ func RecordSupplierPayment(db *gorm.DB, payment models.SupplierPayment) error {
 
         // Get net debt (supplies - payments)
         err := tx.Model(&models.SupplierDebt{}).
-            Select(`COALESCE(SUM(CASE 
-                WHEN transaction_type = 'supply' THEN amount 
-                WHEN transaction_type = 'payment' THEN -amount 
-                ELSE 0 END), 0) as balance`).
+            Select(models.SupplierDebtBalanceSQL + " as balance").
             Where("supplier_id = ?", payment.SupplierID).
             Scan(&currentDebt).Error
         if err != nil {
@@ -135,6 +210,7 @@ func RecordSupplierPayment(db *gorm.DB, payment models.SupplierPayment) error {
         debtRecord := models.SupplierDebt{
             ID:              uuid.New(),
             SupplierID:      payment.SupplierID,
+            PaymentID:       &payment.ID,
             TransactionType: "payment",
             Amount:          payment.Amount,
             RunningBalance:  newBalance,
@@ -145,11 +221,134 @@ func RecordSupplierPayment(db *gorm.DB, payment models.SupplierPayment) error {
             return err
         }
 
-        return tx.Create(&debtRecord).Error
+        if err := tx.Create(&debtRecord).Error; err != nil {
+            return err
+        }
+        if err := models.AllocateSupplierPayment(tx, payment.SupplierID, debtRecord.ID, payment.Amount, allocations); err != nil {
+            return err
+        }
+        if err := models.AllocateSupplierSettlements(tx, payment.SupplierID); err != nil {
+            return err
+        }
+
+        return models.PostSupplierPaymentJournal(tx, payment)
     })
 }
 
 
+// ReverseSupplierPayment undoes a payment recorded by mistake: its debt entry is removed with later running
+// balances and supplier credit recomputed, what it settled is freed and the journal reversed. The payment
+// itself is kept, marked reversed.
+func ReverseSupplierPayment(c *fiber.Ctx, id uuid.UUID, reason string, reversedBy *uuid.UUID) (*models.SupplierPayment, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("a reason is required to reverse a payment")
+	}
+	var payment models.SupplierPayment
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, "id = ?", id).Error; err != nil {
+			return errors.New("payment not found")
+		}
+		if payment.ReversedAt != nil {
+			return errors.New("payment has already been reversed")
+		}
+		before := payment
+
+		// payments recorded before entries were linked are matched on supplier, amount and time, which is only
+		// safe when a single entry matches
+		var entry models.SupplierDebt
+		err := tx.Where("payment_id = ?", payment.ID).First(&entry).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			var candidates []models.SupplierDebt
+			if err := tx.Where("payment_id IS NULL AND supplier_id = ? AND transaction_type = ? AND amount = ? AND created_at BETWEEN ? AND ?",
+				payment.SupplierID, models.SupplierDebtPayment, payment.Amount,
+				payment.CreatedAt.Add(-time.Minute), payment.CreatedAt.Add(time.Minute)).
+				Order("created_at").Find(&candidates).Error; err != nil {
+				return err
+			}
+			if len(candidates) > 1 {
+				return fmt.Errorf("%d unlinked supplier debt entries match this payment, it cannot be reversed safely", len(candidates))
+			}
+			if len(candidates) == 1 {
+				entry, err = candidates[0], nil
+			}
+		}
+		if err != nil {
+			return errors.New("the payment's supplier debt entry could not be found")
+		}
+
+		if err := models.RemoveSupplierDebtEntry(tx, entry); err != nil {
+			return err
+		}
+		if err := models.AllocateSupplierSettlements(tx, payment.SupplierID); err != nil {
+			return err
+		}
+		if err := ledger.ReverseWithReason(tx, ledger.SourceSupplierPayment, payment.ID, payment.PaymentDate, reversedBy, reason); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		payment.ReversedAt = &now
+		payment.ReversedBy = reversedBy
+		payment.ReversalReason = reason
+		if err := tx.Model(&payment).Updates(map[string]interface{}{
+			"reversed_at":     payment.ReversedAt,
+			"reversed_by":     payment.ReversedBy,
+			"reversal_reason": payment.ReversalReason,
+		}).Error; err != nil {
+			return err
+		}
+		return models.RecordAudit(c, tx, models.AuditEntitySupplierPayment, payment.ID, models.AuditUpdate, before, payment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// RecordSupplierNote records a credit or debit note against a supplier, taking litres returned with it out of
+// the supply's tank
+func RecordSupplierNote(c *fiber.Ctx, supplierID uuid.UUID, input models.SupplierNoteInput, createdBy *uuid.UUID) (*models.SupplierDebt, error) {
+	var note *models.SupplierDebt
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if note, err = models.RecordSupplierNote(c, tx, supplierID, input, createdBy); err != nil {
+			return err
+		}
+		if input.ReturnedQuantity <= 0 {
+			return nil
+		}
+		var supply models.Supply
+		if err := tx.First(&supply, "id = ?", *input.SupplyID).Error; err != nil {
+			return errors.New("supply not found")
+		}
+		if err := UpdateFuelStock(tx, supply.TankID, supply.StationID, supply.FuelProductID, input.ReturnedQuantity, "out"); err != nil {
+			return err
+		}
+		recordedBy := supply.EmployeeID
+		if createdBy != nil {
+			recordedBy = *createdBy
+		}
+		return AddFuelTransaction(tx, "supplier_return", supply.FuelProductID, supply.StationID, input.ReturnedQuantity, note.ID, recordedBy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// GetSupplierPayments lists payments newest first, for one supplier when supplierID is given
+func GetSupplierPayments(supplierID *uuid.UUID) ([]models.SupplierPayment, error) {
+	payments := []models.SupplierPayment{}
+	query := db.Order("payment_date DESC, created_at DESC")
+	if supplierID != nil {
+		query = query.Where("supplier_id = ?", *supplierID)
+	}
+	if err := query.Find(&payments).Error; err != nil {
+		return nil, errors.New("failed to get supplier payments")
+	}
+	return payments, nil
+}
+
 //get balances
 func GetSupplierBalance(db *gorm.DB, supplierID uuid.UUID) (debtYouOwe float64, creditTheyOwe float64, netBalance float64, err error) {
     // Get supplier's credit balance
@@ -181,6 +380,8 @@ func GetSupplierBalance(db *gorm.DB, supplierID uuid.UUID) (debtYouOwe float64,
 
 
 type SupplierDebtDTO struct {
+	SupplierID         uuid.UUID  `json:"supplier_id"`
+	SupplyID           *uuid.UUID `json:"supply_id"`
 	TransactionType    string 	`json:"transaction_type"`
 	FuelType           string	`json:"fuel_type"`
 	Quantity           float64	`json:"quantity"`
@@ -188,15 +389,24 @@ type SupplierDebtDTO struct {
 	CarNumber          string	`json:"car_number"`
 	Amount             float64	`json:"amount"`
 	RunningBalance     float64	`json:"running_balance"`
-	SellingPrice       float64	`json:"selling_price"`
+	SoldQuantity       float64	`json:"sold_quantity"`
+	SellingPrice       float64	`json:"selling_price"` // average realised price of the litres sold
 	Profit             float64	`json:"profit"`
+	AmountPaid         float64	`json:"amount_paid"` // settled on the supply so far
+	IsPaid             bool	`json:"is_paid"`
 	Notes              string	`json:"notes"`
 	Date               time.Time `json:"date"`
 }
 
-func GetSupplierDebts(db *gorm.DB) ([]SupplierDebtDTO, error) {
+// GetSupplierDebts lists supplier debt entries newest first, for one supplier when supplierID is given
+// and only those for deliveries to one station when stationID is given
+func GetSupplierDebts(db *gorm.DB, supplierID, stationID *uuid.UUID) ([]SupplierDebtDTO, error) {
 	var debts []models.SupplierDebt
-	err := db.
+	query := db.Scopes(models.ForStation(stationID, "supply_id IN (SELECT id FROM supplies WHERE station_id = ?)"))
+	if supplierID != nil {
+		query = query.Where("supplier_id = ?", *supplierID)
+	}
+	err := query.
 		Preload("Supply").
 		Preload("Supply.FuelProduct").
 		Order("created_at DESC").
@@ -208,6 +418,8 @@ func GetSupplierDebts(db *gorm.DB) ([]SupplierDebtDTO, error) {
 	var result []SupplierDebtDTO
 	for _, debt := range debts {
 		dto := SupplierDebtDTO{
+			SupplierID:      debt.SupplierID,
+			SupplyID:        debt.SupplyID,
 			TransactionType: debt.TransactionType,
 			Amount:          debt.Amount,
 			RunningBalance:  debt.RunningBalance,
@@ -221,20 +433,16 @@ func GetSupplierDebts(db *gorm.DB) ([]SupplierDebtDTO, error) {
 			dto.Quantity = supply.Quantity
 			dto.UnitCost = supply.UnitPrice
 			dto.FuelType = supply.FuelProduct.Name
-
-			// Get latest selling price from StationFuelProduct
-			var sellingPrice float64
-			var stationFuelProduct models.StationFuelProduct
-			err := db.
-				Where("fuel_product_id = ? AND station_id = ?", supply.FuelProductID, supply.StationID).
-				Order("effective_from DESC").
-				First(&stationFuelProduct).Error
-			if err == nil {
-				sellingPrice = stationFuelProduct.UnitPrice
+			dto.AmountPaid = supply.AmountPaid
+			dto.IsPaid = supply.IsPaid
+
+			// profit is realised on the litres of this delivery actually sold, at the price they sold for
+			realised, err := models.GetSupplyRealisedProfit(db, supply.ID)
+			if err == nil && realised.SoldQuantity > 0 {
+				dto.SoldQuantity = realised.SoldQuantity
+				dto.SellingPrice = realised.Revenue / realised.SoldQuantity
+				dto.Profit = realised.Revenue - realised.Cost
 			}
-
-			dto.SellingPrice = sellingPrice
-			dto.Profit = (sellingPrice - supply.UnitPrice) * supply.Quantity
 		}
 
 		result = append(result, dto)
@@ -249,10 +457,7 @@ func GetSupplierRunningBalance(tx *gorm.DB, supplierID uuid.UUID) (float64, erro
         Balance float64
     }
     err := tx.Model(&models.SupplierDebt{}).
-        Select(`COALESCE(SUM(CASE 
-            WHEN transaction_type = 'supply' THEN amount 
-            WHEN transaction_type = 'payment' THEN -amount 
-            ELSE 0 END), 0) as balance`).
+        Select(models.SupplierDebtBalanceSQL + " as balance").
         Where("supplier_id = ?", supplierID).
         Scan(&result).Error
     return result.Balance, err
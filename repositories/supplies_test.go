@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/dancankarani/safa/internal/testutil"
+	"github.com/dancankarani/safa/ledger"
+	"github.com/dancankarani/safa/models"
+	"github.com/google/uuid"
+)
+
+
+func TestSupplierNoteReturningFuel(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     models.SupplierNoteInput
+		wantErr   bool
+		stock     float64
+		layer     float64
+		inventory float64 // change in the inventory account
+		cogs      float64 // change in cost of sales
+	}{
+		{"return of unsold litres", models.SupplierNoteInput{Type: models.SupplierDebtCreditNote, Amount: 30000, ReturnedQuantity: 200, Reason: "contaminated"}, false, 200, 200, -30000, 0},
+		{"return credited above cost", models.SupplierNoteInput{Type: models.SupplierDebtCreditNote, Amount: 31000, ReturnedQuantity: 200, Reason: "contaminated"}, false, 200, 200, -30000, -1000},
+		{"price credit without a return", models.SupplierNoteInput{Type: models.SupplierDebtCreditNote, Amount: 5000, Reason: "price correction"}, false, 400, 400, 0, -5000},
+		{"more than is unsold", models.SupplierNoteInput{Type: models.SupplierDebtDebitNote, Amount: 75000, ReturnedQuantity: 500, Reason: "wrong grade"}, true, 400, 400, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := setupTestDB(t)
+			supply := supplyFixture(t, conn)
+			inventoryBefore := testutil.AccountBalance(t, conn, ledger.InventoryAccount)
+			cogsBefore := testutil.AccountBalance(t, conn, ledger.CostOfSalesAccount)
+
+			input := tt.input
+			input.SupplyID = &supply.ID
+			_, err := RecordSupplierNote(testutil.Ctx(t, uuid.New()), supply.SupplierID, input, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RecordSupplierNote() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := tankVolume(t, conn, supply.TankID); got != tt.stock {
+				t.Errorf("tank stock = %v, want %v", got, tt.stock)
+			}
+			var layer models.InventoryLayer
+			conn.Where("supply_id = ?", supply.ID).First(&layer)
+			if layer.RemainingQuantity != tt.layer {
+				t.Errorf("layer remaining = %v, want %v", layer.RemainingQuantity, tt.layer)
+			}
+			if got := testutil.AccountBalance(t, conn, ledger.InventoryAccount) - inventoryBefore; got != tt.inventory {
+				t.Errorf("inventory moved by %v, want %v", got, tt.inventory)
+			}
+			if got := testutil.AccountBalance(t, conn, ledger.CostOfSalesAccount) - cogsBefore; got != tt.cogs {
+				t.Errorf("cost of sales moved by %v, want %v", got, tt.cogs)
+			}
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package repositories
 
 import (
-	"log"
+	"errors"
 
 	"github.com/dancankarani/safa/models"
+	"github.com/dancankarani/safa/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 
@@ -17,12 +20,25 @@ func AddNewSupply(c *fiber.Ctx)(*models.Supply, error){
 		return nil, err
 	}
 	supply.ID = uuid.New()
-	
-	
-	//update the supplier debts
-	err := RecordSupply(db, *supply)
+	if supply.PurchaseOrderID != nil && supply.UnitPrice == 0 {
+		// deliveries against an order are priced at the agreed price unless invoiced otherwise
+		order, err := models.GetPurchaseOrderByID(*supply.PurchaseOrderID)
+		if err != nil {
+			return nil, err
+		}
+		supply.UnitPrice = order.AgreedUnitPrice
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := models.EnsurePeriodOpen(tx, supply.StationID, supply.DeliveryDate); err != nil {
+			return err
+		}
+		//update the supplier debts
+		if err := RecordSupply(tx, *supply); err != nil {
+			return err
+		}
+		return models.RecordAudit(c, tx, models.AuditEntitySupply, supply.ID, models.AuditCreate, nil, supply)
+	})
 	if err != nil {
-		//rollback
 		return nil, err
 	}
 
@@ -30,52 +46,127 @@ func AddNewSupply(c *fiber.Ctx)(*models.Supply, error){
 }
 
 //update supply
+// The edit is a compensating transaction: what the old supply booked is reversed and the edited supply
+// is booked again, all or nothing.
 func UpdateSupply(c *fiber.Ctx, id uuid.UUID, supply *models.Supply)(*models.Supply, error){
 	var updatedSupply models.Supply
-	
-	if err := db.First(&updatedSupply, "id = ?", id).Error; err != nil {
-		return nil, err
-	}	
-	updatedSupply.TotalAmount = (updatedSupply.Quantity * updatedSupply.UnitPrice)
-
-	log.Println(updatedSupply)
-
-	
-	updatedSupply.SupplierID = supply.SupplierID
-	updatedSupply.StationID = supply.StationID
-	updatedSupply.EmployeeID = supply.EmployeeID
-	updatedSupply.ReferenceNo = supply.ReferenceNo
-	updatedSupply.FuelProductID = supply.FuelProductID
-	updatedSupply.Quantity = supply.Quantity
-	updatedSupply.UnitPrice = supply.UnitPrice
-	updatedSupply.DeliveryDate = supply.DeliveryDate
-	updatedSupply.IsPaid = supply.IsPaid
-	log.Println(updatedSupply.TotalAmount)
-	
-	if err := db.Updates(&updatedSupply).Scan(&updatedSupply).Error; err != nil {
-		return nil, err
-	}
-	//record debts
-	updatedSupply.ID = uuid.New()
-	updatedSupply.TotalAmount = (updatedSupply.Quantity * updatedSupply.UnitPrice)
-	err := RecordSupply(db, updatedSupply)
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&updatedSupply, "id = ?", id).Error; err != nil {
+			return err
+		}
+		before := updatedSupply
+		if err := models.EnsurePeriodOpen(tx, before.StationID, before.DeliveryDate); err != nil {
+			return err
+		}
+		if err := models.EnsurePeriodOpen(tx, supply.StationID, supply.DeliveryDate); err != nil {
+			return err
+		}
+		if supply.Quantity <= 0 {
+			return errors.New("quantity must be greater than zero")
+		}
+
+		if err := reverseSupply(tx, before, userID); err != nil {
+			return err
+		}
+
+		updatedSupply.SupplierID = supply.SupplierID
+		updatedSupply.StationID = supply.StationID
+		updatedSupply.EmployeeID = supply.EmployeeID
+		updatedSupply.ReferenceNo = supply.ReferenceNo
+		updatedSupply.FuelProductID = supply.FuelProductID
+		updatedSupply.Quantity = supply.Quantity
+		updatedSupply.UnitPrice = supply.UnitPrice
+		updatedSupply.DeliveryDate = supply.DeliveryDate
+		// what was settled on it is reallocated once it is booked again
+		updatedSupply.AmountPaid = 0
+		updatedSupply.IsPaid = false
+		if supply.TankID != uuid.Nil {
+			updatedSupply.TankID = supply.TankID
+		}
+		if supply.CarNumber != "" {
+			updatedSupply.CarNumber = supply.CarNumber
+		}
+		if supply.PurchaseOrderID != nil {
+			updatedSupply.PurchaseOrderID = supply.PurchaseOrderID
+		}
+		if err := tx.Omit(clause.Associations).Save(&updatedSupply).Error; err != nil {
+			return err
+		}
+
+		if err := models.ReplaceSupplyLayer(tx, updatedSupply); err != nil {
+			return err
+		}
+		// only the change in litres moves through the tank, what was already sold out of the supply stays sold
+		if before.TankID != updatedSupply.TankID {
+			if err := moveSupplyStock(tx, before, -before.Quantity); err != nil {
+				return err
+			}
+			if err := moveSupplyStock(tx, updatedSupply, updatedSupply.Quantity); err != nil {
+				return err
+			}
+		} else if err := moveSupplyStock(tx, updatedSupply, updatedSupply.Quantity-before.Quantity); err != nil {
+			return err
+		}
+		if err := postSupply(tx, updatedSupply); err != nil {
+			return err
+		}
+		if before.SupplierID != updatedSupply.SupplierID {
+			if err := models.AllocateSupplierSettlements(tx, before.SupplierID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Select("amount_paid", "is_paid").First(&updatedSupply, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if before.PurchaseOrderID != nil && (updatedSupply.PurchaseOrderID == nil || *before.PurchaseOrderID != *updatedSupply.PurchaseOrderID) {
+			if err := models.SyncPurchaseOrderReceipts(tx, *before.PurchaseOrderID); err != nil {
+				return err
+			}
+		}
+		return models.RecordAudit(c, tx, models.AuditEntitySupply, id, models.AuditUpdate, before, updatedSupply)
+	})
 	if err != nil {
-		//rollback
 		return nil, err
 	}
 	return &updatedSupply, nil
 }
 
 //delete supply
+// Deleting reverses the supply's stock, debt and ledger effects in the same transaction.
 func DeleteSupply(c *fiber.Ctx, id uuid.UUID) error {
-	var supply models.Supply
-	if err := db.First(&supply, "id = ?", id).Error; err != nil {
-		return err
-	}
-	if err := db.Delete(&supply).Error; err != nil {
-		return err
-	}
-	return nil
+	userID, _ := c.Locals("user_id").(*uuid.UUID)
+	return db.Transaction(func(tx *gorm.DB) error {
+		var supply models.Supply
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&supply, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := models.EnsurePeriodOpen(tx, supply.StationID, supply.DeliveryDate); err != nil {
+			return err
+		}
+		if err := reverseSupply(tx, supply, userID); err != nil {
+			return err
+		}
+		if err := moveSupplyStock(tx, supply, -supply.Quantity); err != nil {
+			return err
+		}
+		if err := models.RemoveSupplyLayer(tx, supply.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&supply).Error; err != nil {
+			return err
+		}
+		if err := models.AllocateSupplierSettlements(tx, supply.SupplierID); err != nil {
+			return err
+		}
+		if supply.PurchaseOrderID != nil {
+			if err := models.SyncPurchaseOrderReceipts(tx, *supply.PurchaseOrderID); err != nil {
+				return err
+			}
+		}
+		return models.RecordAudit(c, tx, models.AuditEntitySupply, supply.ID, models.AuditDelete, supply, nil)
+	})
 }
 
 //Get supply by id
@@ -88,7 +179,7 @@ func GetSupplyByID(c *fiber.Ctx, id uuid.UUID)(*models.Supply, error){
 }
 
 //get all supplies
-func GetAllSupplies(c *fiber.Ctx) (*[]models.Supply, error) {
+func GetAllSupplies(c *fiber.Ctx, stationID *uuid.UUID) (*[]models.Supply, error) {
 	var supplies []models.Supply
 
 	// Get pagination query params
@@ -102,7 +193,7 @@ func GetAllSupplies(c *fiber.Ctx) (*[]models.Supply, error) {
 	}
 	offset := (page - 1) * limit
 
-	if err := db.Limit(limit).Offset(offset).Find(&supplies).Error; err != nil {
+	if err := db.Scopes(models.ForStation(stationID, "station_id = ?")).Limit(limit).Offset(offset).Find(&supplies).Error; err != nil {
 		return nil, err
 	}
 	return &supplies, nil
@@ -110,19 +201,29 @@ func GetAllSupplies(c *fiber.Ctx) (*[]models.Supply, error) {
 
 
 //supplier payments
+// The body may list "allocations" of the payment to specific supplies, the rest settles the oldest first.
 func AddSupplierPayments(c *fiber.Ctx)(*models.SupplierPayment, error){
-	var payment models.SupplierPayment
+	var input struct {
+		models.SupplierPayment
+		Allocations []services.Allocation `json:"allocations"`
+	}
 	
-	if err := c.BodyParser(&payment); err != nil {
+	if err := c.BodyParser(&input); err != nil {
 		return nil, err
 	}
+	payment := input.SupplierPayment
 	payment.ID = uuid.New()
+	payment.ReversedAt, payment.ReversedBy, payment.ReversalReason = nil, nil, ""
 	
 	
-	//update the supplier debts
-	err := RecordSupplierPayment(db, payment)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		//update the supplier debts
+		if err := RecordSupplierPayment(tx, payment, input.Allocations); err != nil {
+			return err
+		}
+		return models.RecordAudit(c, tx, models.AuditEntitySupplierPayment, payment.ID, models.AuditCreate, nil, payment)
+	})
 	if err != nil {
-		//rollback
 		return nil, err
 	}
 
@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dancankarani/safa/internal/testutil"
+	"github.com/dancankarani/safa/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// supplyFixture delivers 1000 litres into a tank and sells 600 of them
+func supplyFixture(t *testing.T, conn *gorm.DB) models.Supply {
+	t.Helper()
+	station := models.Station{ID: uuid.New(), Name: "Main", CostingMethod: "fifo"}
+	supplier := models.Supplier{ID: uuid.New(), Name: "Depot"}
+	tank := models.Tank{ID: uuid.New(), Name: "T1", Capacity: 10000, FuelProductID: uuid.New(), StationID: station.ID}
+	for _, row := range []interface{}{&station, &supplier, &tank} {
+		if err := conn.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	supply := models.Supply{
+		ID: uuid.New(), SupplierID: supplier.ID, StationID: station.ID, TankID: tank.ID, EmployeeID: uuid.New(),
+		FuelProductID: tank.FuelProductID, Quantity: 1000, UnitPrice: 150, DeliveryDate: time.Now().Add(-48 * time.Hour),
+	}
+	if err := RecordSupply(conn, supply); err != nil {
+		t.Fatalf("record supply: %v", err)
+	}
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if _, err := models.ConsumeInventory(tx, tank, 600, 600*180, models.InventorySourcePumpReading, uuid.New(), time.Now().Add(-24*time.Hour)); err != nil {
+			return err
+		}
+		return UpdateFuelStock(tx, tank.ID, station.ID, tank.FuelProductID, 600, "out")
+	})
+	if err != nil {
+		t.Fatalf("sell litres: %v", err)
+	}
+	return supply
+}
+
+func TestUpdatePartlySoldSupply(t *testing.T) {
+	tests := []struct {
+		name      string
+		quantity  float64
+		price     float64
+		wantErr   bool
+		wantStock float64
+		wantLayer float64 // litres left in the supply's cost layer
+	}{
+		{"price only correction", 1000, 160, false, 400, 400},
+		{"smaller delivery", 900, 150, false, 300, 300},
+		{"larger delivery", 1200, 150, false, 600, 600},
+		{"below litres already sold", 500, 150, true, 400, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := setupTestDB(t)
+			supply := supplyFixture(t, conn)
+
+			edit := supply
+			edit.Quantity, edit.UnitPrice = tt.quantity, tt.price
+			_, err := UpdateSupply(testutil.Ctx(t, uuid.New()), supply.ID, &edit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateSupply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := tankVolume(t, conn, supply.TankID); got != tt.wantStock {
+				t.Errorf("tank stock = %v, want %v", got, tt.wantStock)
+			}
+			var layer models.InventoryLayer
+			conn.Where("supply_id = ?", supply.ID).First(&layer)
+			if layer.RemainingQuantity != tt.wantLayer {
+				t.Errorf("layer remaining = %v, want %v", layer.RemainingQuantity, tt.wantLayer)
+			}
+			if !tt.wantErr && layer.UnitCost != tt.price {
+				t.Errorf("layer unit cost = %v, want %v", layer.UnitCost, tt.price)
+			}
+		})
+	}
+}
@@ -10,19 +10,23 @@ import (
 func SetAdminRoutes(app *fiber.App) {
 	g := app.Group("/api/v1", middleware.JWTMiddleware)
 	//stations
-	stations := g.Group("/admin/stations")
+	stations := g.Group("/admin/stations", middleware.AuthorizeResource("stations"))
 	stations.Get("/", controllers.ReadAllStationsController)
 	stations.Get("/sales", controllers.GetAllSalesInStationHandler)
 	stations.Get("/expenses", controllers.GetStationExpensesHandler)
-	stations.Get("/:id", controllers.ReadStationByIDController)
-	stations.Patch("/:id", controllers.ReadStationByIDController)
+	stations.Get("/:id", middleware.RequireStationAccess("id"), controllers.ReadStationByIDController)
+	stations.Patch("/:id", middleware.RequireStationAccess("id"), controllers.ReadStationByIDController)
 	stations.Post("/", controllers.NewStationHandler)
+	stations.Patch("/:id/costing-method", controllers.SetStationCostingMethodHandler)
 
 	// suppliers
-	suppliers := g.Group("/admin/suppliers")
+	suppliers := g.Group("/admin/suppliers", middleware.AuthorizeResource("suppliers"))
 	suppliers.Get("/", controllers.GetSuppliersHandler)
 	suppliers.Get("/balance/:id", controllers.GetSupplierBalanceHandler)
 	suppliers.Get("/balances", controllers.GetAllSupplierBalancesHandler)
+	suppliers.Get("/payables/aging", controllers.GetAgedPayablesHandler)
+	suppliers.Get("/:id/statement", controllers.GetSupplierStatementHandler)
+	suppliers.Post("/:id/notes", controllers.RecordSupplierNoteHandler)
 	suppliers.Get("/:id", controllers.GetSupplierHandler)
 	suppliers.Post("/", controllers.AddSupplierHandler)
 	suppliers.Patch("/:id", controllers.UpdateSupplierHandler)
@@ -30,7 +34,7 @@ func SetAdminRoutes(app *fiber.App) {
 
 
 	// fuel products
-	fuelProducts := g.Group("/admin/fuel-products")
+	fuelProducts := g.Group("/admin/fuel-products", middleware.AuthorizeResource("fuel_products"))
 	fuelProducts.Get("/", controllers.GetAllFuelProductsHandler)
 	fuelProducts.Get("/:id", controllers.GetFuelProductByIDHandler)
 	fuelProducts.Post("/", controllers.CreateFuelProductHandler)
@@ -38,38 +42,51 @@ func SetAdminRoutes(app *fiber.App) {
 	fuelProducts.Delete("/:id", controllers.DeleteFuelProductHandler)
 
 	// supplies
-	supplies := g.Group("/admin/supplies")
+	supplies := g.Group("/admin/supplies", middleware.AuthorizeResource("supplies"))
 	supplies.Get("/", controllers.GetSuppliesHandler)
+	supplies.Get("/verifications", controllers.GetDeliveryVerificationsHandler)
 	supplies.Get("/:id", controllers.GetSupplyByIDHandler)
+	supplies.Get("/:id/verification", controllers.GetDeliveryVerificationHandler)
+	supplies.Post("/:id/verify", controllers.VerifyDeliveryHandler)
 	supplies.Post("/", controllers.AddSupplyHandler)
 	supplies.Patch("/:id", controllers.UpdateSupplyHandler)
 	supplies.Delete("/:id", controllers.DeleteSupplyHandler)
+
+	// purchase orders
+	orders := g.Group("/admin/purchase-orders", middleware.AuthorizeResource("purchase_orders"))
+	orders.Get("/", controllers.GetPurchaseOrdersHandler)
+	orders.Get("/outstanding", controllers.GetOutstandingOrdersHandler)
+	orders.Get("/:id", controllers.GetPurchaseOrderHandler)
+	orders.Post("/", controllers.CreatePurchaseOrderHandler)
+	orders.Patch("/:id", controllers.UpdatePurchaseOrderHandler)
+	orders.Post("/:id/cancel", controllers.CancelPurchaseOrderHandler)
+	orders.Post("/:id/close", controllers.ClosePurchaseOrderHandler)
 	
 	//debts
-	debts := g.Group("/admin/supplier/debts")
+	debts := g.Group("/admin/supplier/debts", middleware.AuthorizeResource("supplier_debts"))
 	debts.Get("/", controllers.GetSupplierDebtsHandler)
 	
 
 	// dippings
-	dippings := g.Group("/admin/dippings")
+	dippings := g.Group("/admin/dippings", middleware.AuthorizeResource("dippings"))
 	dippings.Get("/opening/:tank_id", controllers.GetOpeningDipHandler)
 	dippings.Get("/closing/:tank_id", controllers.GetClosingSalesHandler)
 	dippings.Get("/", controllers.GetAllDippingsHandler)
 	dippings.Get("/:id", controllers.GetDippingByIDHandler)
-	dippings.Get("/station/:id", controllers.GetDippingsByStationHandler)
+	dippings.Get("/station/:id", middleware.RequireStationAccess("id"), controllers.GetDippingsByStationHandler)
 	dippings.Get("/product/:id", controllers.GetDippingByFuelProductHandler)
 	dippings.Get("/date/:date", controllers.GetDippingByDippingDateHandler)
 	dippings.Post("/", controllers.CreateDippingHandler)
 	dippings.Patch("/:id", controllers.UpdateDippingHandler)
 
 	//
-	d := g.Group("/admin/dippings-sales")
+	d := g.Group("/admin/dippings-sales", middleware.AuthorizeResource("dippings"))
 	d.Get("/", controllers.CompareDippingsAndSales)
 
 	
 
 	//sales
-	sales := g.Group("/admin/sales")
+	sales := g.Group("/admin/sales", middleware.AuthorizeResource("sales"))
 	sales.Post("/", controllers.AddNewSalesHandler)
 	sales.Patch("/:id", controllers.UpdateSalesHandler)
 	sales.Delete("/:id", controllers.DeleteSalesHandler)
@@ -77,16 +94,23 @@ func SetAdminRoutes(app *fiber.App) {
 	sales.Get("/date/:start_date/:end_date", controllers.GetSalesByDateHandler)
 
 	//tanks
-	tanks := g.Group("/admin/tanks")
-	tanks.Get("/:station/:id", controllers.GetAllTanksHandler)
+	tanks := g.Group("/admin/tanks", middleware.AuthorizeResource("tanks"))
+	tanks.Post("/:id/calibration", controllers.UploadTankCalibrationHandler)
+	tanks.Get("/:id/calibration", controllers.GetTankCalibrationHandler)
+	tanks.Get("/:id/calibration/convert", controllers.ConvertDipHandler)
+	tanks.Patch("/:id/thresholds", controllers.SetTankThresholdsHandler)
+	tanks.Get("/:station/:id", middleware.RequireStationAccess("id"), controllers.GetAllTanksHandler)
 	tanks.Get("/:id", controllers.GetTankByIDHandler)
 	tanks.Post("/", controllers.AddNewTankHandler)
 	tanks.Patch("/:id", controllers.UpdateTankHandler)
 	tanks.Delete("/:id", controllers.DeleteTankHandler)
 
 	//pump
-	pumps := g.Group("/admin/pumps")
-	pumps.Get("/station/:id", controllers.GetPumpsByStationHandler)
+	pumps := g.Group("/admin/pumps", middleware.AuthorizeResource("pumps"))
+	pumps.Get("/station/:id", middleware.RequireStationAccess("id"), controllers.GetPumpsByStationHandler)
+	pumps.Get("/:id/meter-resets", controllers.GetMeterResetsHandler)
+	pumps.Post("/:id/meter-resets", controllers.RecordMeterResetHandler)
+	pumps.Get("/:id/meter-continuity", controllers.GetMeterContinuityHandler)
 	pumps.Get("/:id", controllers.GetPumpByIDHandler)
 	pumps.Post("/:tank_id", controllers.AddNewPumpHandler)
 	pumps.Patch("/:id", controllers.UpdatePumpHandler)
@@ -95,11 +119,11 @@ func SetAdminRoutes(app *fiber.App) {
 	pumps.Delete("/:tank_id/:pump_id", controllers.ReassignPumpToTankHandler)
 
 	//create tank with pumps
-	tanksWithPumps := g.Group("/admin/tanks-with-pumps")
+	tanksWithPumps := g.Group("/admin/tanks-with-pumps", middleware.AuthorizeResource("tanks"))
 	tanksWithPumps.Post("/", models.CreateTankWithPumps)
 
 	//nozzles
-	nozzles := g.Group("/admin/nozzles")
+	nozzles := g.Group("/admin/nozzles", middleware.AuthorizeResource("nozzles"))
 	nozzles.Get("/:id", controllers.GetNozzleByIDHandler)
 	nozzles.Get("/", controllers.GetAllNozzlesHandler)
 	nozzles.Post("/", controllers.CreateNozzleHandler)
@@ -107,18 +131,67 @@ func SetAdminRoutes(app *fiber.App) {
 	nozzles.Delete("/:id", controllers.DeleteNozzleHandler)
 
 	//payments
-	payments := g.Group("/admin/payments")
+	payments := g.Group("/admin/payments", middleware.AuthorizeResource("payments"))
 	
 	payments.Post("/", controllers.AddNewEmployeePayment)
 	payments.Get("/report", controllers.GetPayrollReportHandler)
 
 
 	//fuel stock
-	stock := g.Group("/admin/stock")
+	stock := g.Group("/admin/stock", middleware.AuthorizeResource("stock"))
 	stock.Get("/", controllers.GetFuelStockHandler)
 
+	//stock alerts
+	alerts := g.Group("/admin/alerts", middleware.AuthorizeResource("alerts"))
+	alerts.Get("/", controllers.GetStockAlertsHandler)
+	alerts.Post("/:id/acknowledge", controllers.AcknowledgeStockAlertHandler)
+
+	//sessions
+	sessions := g.Group("/admin/employees", middleware.RequirePermission("employees:write"))
+	sessions.Post("/:id/revoke-sessions", controllers.RevokeEmployeeSessionsHandler)
+	sessions.Post("/:id/unlock", controllers.UnlockEmployeeHandler)
+
+	//login audit
+	logins := g.Group("/admin/login-attempts", middleware.RequirePermission("employees:write"))
+	logins.Get("/", controllers.GetLoginAttemptsHandler)
+
+	//audit trail
+	audit := g.Group("/admin/audit", middleware.AuthorizeResource("audit"))
+	audit.Get("/", controllers.GetAuditLogsHandler)
+
+	//inventory valuation
+	inventory := g.Group("/admin/inventory", middleware.AuthorizeResource("stock"))
+	inventory.Get("/valuation", controllers.GetInventoryValuationHandler)
+	inventory.Get("/cost-of-sales", controllers.GetCostOfSalesHandler)
+	inventory.Get("/forecast/:id", middleware.RequireStationAccess("id"), controllers.GetFuelForecastHandler)
+
+	//general ledger
+	gl := g.Group("/admin/ledger", middleware.AuthorizeResource("ledger"))
+	gl.Get("/accounts", controllers.GetLedgerAccountsHandler)
+	gl.Get("/trial-balance", controllers.GetTrialBalanceHandler)
+	gl.Get("/accounts/:code/statement", controllers.GetAccountStatementHandler)
+
+	//credit customers
+	customers := g.Group("/admin/customers", middleware.AuthorizeResource("customers"))
+	customers.Get("/", controllers.GetCustomersHandler)
+	customers.Post("/", controllers.AddCustomerHandler)
+	customers.Post("/credits", controllers.AddCustomerCreditHandler)
+	customers.Post("/payments", controllers.AddCustomerPaymentHandler)
+	customers.Get("/invoices", controllers.GetInvoicesHandler)
+	customers.Post("/invoices/generate", controllers.GenerateInvoicesHandler)
+	customers.Get("/invoices/:id", controllers.GetInvoiceHandler)
+	customers.Post("/invoices/:id/void", controllers.VoidInvoiceHandler)
+	customers.Get("/receivables/aging", controllers.GetAgedReceivablesHandler)
+	customers.Get("/:id", controllers.GetCustomerHandler)
+	customers.Patch("/:id", controllers.UpdateCustomerHandler)
+	customers.Get("/:id/credits", controllers.GetCustomerCreditsHandler)
+	customers.Get("/:id/payments", controllers.GetCustomerPaymentsHandler)
+	customers.Get("/:id/statement", controllers.GetCustomerStatementHandler)
+
 	//supplier payments
-	payment := g.Group("/admin/supplier-payments")
-	payment.Post("/", controllers.AddSupplierPayments)	
+	payment := g.Group("/admin/supplier-payments", middleware.AuthorizeResource("supplier_payments"))
+	payment.Get("/", controllers.GetSupplierPaymentsHandler)
+	payment.Post("/", controllers.AddSupplierPayments)
+	payment.Post("/:id/reverse", controllers.ReverseSupplierPaymentHandler)	
 }
 
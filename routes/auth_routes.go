@@ -2,10 +2,16 @@ package routes
 
 import (
 	"github.com/dancankarani/safa/controllers"
+	"github.com/dancankarani/safa/middleware"
 	"github.com/gofiber/fiber/v2"
 )
 
 func SetAuthRoutes(app *fiber.App) {
 	auth := app.Group("/api/v1/auth")
 	auth.Post("/login", controllers.LoginUser)
+	auth.Post("/refresh", controllers.RefreshToken)
+	auth.Post("/logout", middleware.JWTMiddleware, controllers.LogoutUser)
+	auth.Post("/change-password", middleware.JWTMiddleware, controllers.ChangePasswordHandler)
+	auth.Post("/forgot-password", controllers.ForgotPasswordHandler)
+	auth.Post("/reset-password", controllers.ResetPasswordHandler)
 }
\ No newline at end of file
@@ -10,40 +10,64 @@ import (
 func SetEmployeeRoutes(app *fiber.App) {
 	// Define the routes for employee management
 	e := app.Group("/api/v1", middleware.JWTMiddleware)
-	e.Post("/employees", controllers.CreateEmployee)
-	e.Get("/employees/:id", controllers.GetEmployeeByID)
-	e.Get("/employees", controllers.GetAllEmployees)
-	e.Patch("/employees/:id", controllers.UpdateEmployee)
-	e.Delete("/employees/:id", controllers.DeleteEmployee)
+	e.Post("/employees", middleware.AuthorizeResource("employees"), controllers.CreateEmployee)
+	e.Get("/employees/:id", middleware.AuthorizeResource("employees"), controllers.GetEmployeeByID)
+	e.Get("/employees", middleware.AuthorizeResource("employees"), controllers.GetAllEmployees)
+	e.Patch("/employees/:id", middleware.AuthorizeResource("employees"), controllers.UpdateEmployee)
+	e.Delete("/employees/:id", middleware.AuthorizeResource("employees"), controllers.DeleteEmployee)
 
 	//expenses
-	e.Post("/expenses", controllers.CreateExpensesHandler)
-	e.Get("/expenses", controllers.GetExpensesHandler)
-	e.Get("/daily/expenses", controllers.GetExpensesByDateHandler)
-	e.Get("/station/expenses/:id", controllers.GetPaginatedExpensesByStation)
-	e.Get("/expenses/duration/:start_date/:end_date", controllers.GetExpensesByDurationHandler)
-	e.Patch("/expenses/:id", controllers.UpdateExpensesHandler)
-	e.Delete("/expenses/:id", controllers.DeleteExpensesHandler)
+	e.Post("/expenses", middleware.AuthorizeResource("expenses"), controllers.CreateExpensesHandler)
+	e.Get("/expenses", middleware.AuthorizeResource("expenses"), controllers.GetExpensesHandler)
+	e.Get("/daily/expenses", middleware.AuthorizeResource("expenses"), controllers.GetExpensesByDateHandler)
+	e.Get("/station/expenses/:id", middleware.AuthorizeResource("expenses"), middleware.RequireStationAccess("id"), controllers.GetPaginatedExpensesByStation)
+	e.Get("/expenses/duration/:start_date/:end_date", middleware.AuthorizeResource("expenses"), controllers.GetExpensesByDurationHandler)
+	e.Patch("/expenses/:id", middleware.AuthorizeResource("expenses"), controllers.UpdateExpensesHandler)
+	e.Delete("/expenses/:id", middleware.AuthorizeResource("expenses"), controllers.DeleteExpensesHandler)
 
 	//pump readings
-	e.Post("/pump-readings", controllers.AddNewPumpReadings)
-	e.Get("/pump-readings", controllers.GetOrderedPumpReadingsHandler)
-	e.Get("/pump-readings/:pump_id", controllers.GetOpeningReadingsHandler)
-	e.Get("/pump-readings/:id", controllers.GetPumpReadingsHandler)
-	e.Patch("/pump-readings/:id", controllers.UpdatePumpReadingsHandler)
-	e.Delete("/pump-readings/:id", controllers.DeletePumpReadingsHandler)
+	e.Post("/pump-readings", middleware.AuthorizeResource("pump_readings"), controllers.AddNewPumpReadings)
+	e.Get("/pump-readings", middleware.AuthorizeResource("pump_readings"), controllers.GetOrderedPumpReadingsHandler)
+	e.Get("/pump-readings/:pump_id", middleware.AuthorizeResource("pump_readings"), controllers.GetOpeningReadingsHandler)
+	e.Get("/pump-readings/:id", middleware.AuthorizeResource("pump_readings"), controllers.GetPumpReadingsHandler)
+	e.Patch("/pump-readings/:id", middleware.AuthorizeResource("pump_readings"), controllers.UpdatePumpReadingsHandler)
+	e.Delete("/pump-readings/:id", middleware.AuthorizeResource("pump_readings"), controllers.DeletePumpReadingsHandler)
 
-	e.Get("/sales/", controllers.GetAllSalesByDateHandler)
+	//shifts
+	e.Post("/shifts", middleware.AuthorizeResource("shifts"), controllers.OpenShiftHandler)
+	e.Post("/shifts/:id/close", middleware.AuthorizeResource("shifts"), controllers.CloseShiftHandler)
+	e.Get("/shifts/:id", middleware.AuthorizeResource("shifts"), controllers.GetShiftHandler)
+	e.Get("/station/shifts/:id", middleware.AuthorizeResource("shifts"), middleware.RequireStationAccess("id"), controllers.GetStationShiftsHandler)
+	e.Get("/station/shifts/:id/open", middleware.AuthorizeResource("shifts"), middleware.RequireStationAccess("id"), controllers.GetOpenShiftHandler)
+
+	//cash-ups
+	e.Post("/cash-ups", middleware.AuthorizeResource("cash_ups"), controllers.CreateCashUpHandler)
+	e.Patch("/cash-ups/:id", middleware.AuthorizeResource("cash_ups"), controllers.UpdateCashUpHandler)
+	e.Get("/shifts/:id/reconciliation", middleware.AuthorizeResource("cash_ups"), controllers.GetShiftReconciliationHandler)
+	e.Get("/reports/employee-shortages", middleware.AuthorizeResource("cash_ups"), controllers.GetEmployeeShortagesHandler)
+
+	//period close
+	e.Post("/periods/close", middleware.AuthorizeResource("periods"), controllers.ClosePeriodHandler)
+	e.Post("/periods/:id/reopen", middleware.RequirePermission("periods:reopen"), controllers.ReopenPeriodHandler)
+	e.Get("/station/periods/:id", middleware.AuthorizeResource("periods"), middleware.RequireStationAccess("id"), controllers.GetStationPeriodsHandler)
+
+	//reports
+	e.Get("/reports/profit-loss/:id", middleware.AuthorizeResource("reports"), middleware.RequireStationAccess("id"), controllers.GetProfitAndLossHandler)
+
+	e.Get("/sales/", middleware.AuthorizeResource("sales"), controllers.GetAllSalesByDateHandler)
 
 	//send email
 	em := app.Group("/api/v1")
 	em.Post("/send-email", controllers.SendEmail)
 
 	//daily accounts
-	e.Post("/daily-accounts", models.AddDailyAccounts)
-	e.Get("/daily-accounts", models.GetDailyAccounts)
-	e.Get("/daily-accounts/:id", models.GetDailyAccount)
-	e.Patch("/daily-accounts/:id", models.UpdateDailyAccount)
-	e.Get("/monthly-accounts", models.GetMonthlyDailyAccounts)
+	e.Post("/daily-accounts", middleware.AuthorizeResource("daily_accounts"), models.AddDailyAccounts)
+	e.Get("/daily-accounts", middleware.AuthorizeResource("daily_accounts"), controllers.GetDailyAccountsHandler)
+	e.Get("/daily-accounts/:id", middleware.AuthorizeResource("daily_accounts"), models.GetDailyAccount)
+	e.Patch("/daily-accounts/:id", middleware.AuthorizeResource("daily_accounts"), models.UpdateDailyAccount)
+	e.Post("/daily-accounts/generate", middleware.AuthorizeResource("daily_accounts"), controllers.GenerateDailyAccountsHandler)
+	e.Post("/daily-accounts/:id/approve", middleware.RequirePermission("daily_accounts:approve"), controllers.ApproveDailyAccountHandler)
+	e.Get("/daily-accounts/:id/variances", middleware.AuthorizeResource("daily_accounts"), controllers.GetDailyAccountVariancesHandler)
+	e.Get("/monthly-accounts", middleware.AuthorizeResource("daily_accounts"), controllers.GetMonthlyDailyAccountsHandler)
 
 }
\ No newline at end of file
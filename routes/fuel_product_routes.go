@@ -3,21 +3,21 @@ package routes
 import (
 	"github.com/dancankarani/safa/controllers"
 	"github.com/dancankarani/safa/middleware"
-	"github.com/dancankarani/safa/models"
 	"github.com/gofiber/fiber/v2"
 )
 
 func FuelProductRoutes(app *fiber.App) {
-	f := app.Group("/fuel-products", middleware.JWTMiddleware)
+	f := app.Group("/fuel-products", middleware.JWTMiddleware, middleware.AuthorizeResource("fuel_products"))
 	f.Get("/", controllers.GetAllFuelProductsHandler)
 	f.Get("/:id", controllers.GetFuelProductByIDHandler)
 	f.Post("/", controllers.CreateFuelProductHandler)
 	f.Put("/:id", controllers.UpdateFuelProductHandler)
 	f.Delete("/:id", controllers.DeleteFuelProductHandler)
 
-	fp:= app.Group("/api/v1/station/fuel-price", middleware.JWTMiddleware)
-	fp.Post("/", models.CreateStationFuelPrice)
-	fp.Get("/:station_id", models.GetStationFuelPrices)
-	fp.Patch("/:id", models.UpdateStationFuelPrice)
-	fp.Delete( "/:id", models.DeleteStationFuelPrice)
+	fp:= app.Group("/api/v1/station/fuel-price", middleware.JWTMiddleware, middleware.AuthorizeResource("fuel_prices"))
+	fp.Post("/", controllers.CreateStationFuelPriceHandler)
+	fp.Get("/:station_id/history", middleware.RequireStationAccess("station_id"), controllers.GetFuelPriceHistoryHandler)
+	fp.Get("/:station_id", middleware.RequireStationAccess("station_id"), controllers.GetStationFuelPricesHandler)
+	fp.Patch("/:id", controllers.UpdateStationFuelPriceHandler)
+	fp.Delete( "/:id", controllers.DeleteStationFuelPriceHandler)
 }
\ No newline at end of file
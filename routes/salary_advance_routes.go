@@ -7,7 +7,7 @@ import(
 
 func SetSalaryAdvanceRoutes(app *fiber.App) {
 	// Define the routes for salary advance management
-	e := app.Group("/api/v1/salary/advances",middleware.JWTMiddleware)
+	e := app.Group("/api/v1/salary/advances",middleware.JWTMiddleware, middleware.AuthorizeResource("salary_advances"))
 	//protected routes
 	e.Post("/", controllers.CreateSalaryAdvanceHandler)
 	e.Get("/:id", controllers.GetSalaryAdvanceByIDHandler)
@@ -0,0 +1,45 @@
+package services
+
+import "time"
+
+// AgingBuckets splits outstanding amounts by how many days old the document is
+type AgingBuckets struct {
+	Current    float64 `json:"current"` // up to 30 days
+	Days31To60 float64 `json:"days_31_60"`
+	Days61To90 float64 `json:"days_61_90"`
+	Over90     float64 `json:"over_90"`
+	Total      float64 `json:"total"`
+}
+
+// AgeInDays counts whole calendar days from date to asOf, never less than zero
+func AgeInDays(date, asOf time.Time) int {
+	days := int(dayOf(asOf).Sub(dayOf(date)).Hours() / 24)
+	if days < 0 {
+		return 0
+	}
+	return days
+}
+
+// Add puts an outstanding amount of the given age into its bucket
+func (b *AgingBuckets) Add(amount float64, ageDays int) {
+	switch {
+	case ageDays <= 30:
+		b.Current = round2(b.Current + amount)
+	case ageDays <= 60:
+		b.Days31To60 = round2(b.Days31To60 + amount)
+	case ageDays <= 90:
+		b.Days61To90 = round2(b.Days61To90 + amount)
+	default:
+		b.Over90 = round2(b.Over90 + amount)
+	}
+	b.Total = round2(b.Total + amount)
+}
+
+// Merge adds another set of buckets into b
+func (b *AgingBuckets) Merge(other AgingBuckets) {
+	b.Current = round2(b.Current + other.Current)
+	b.Days31To60 = round2(b.Days31To60 + other.Days31To60)
+	b.Days61To90 = round2(b.Days61To90 + other.Days61To90)
+	b.Over90 = round2(b.Over90 + other.Over90)
+	b.Total = round2(b.Total + other.Total)
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgingBuckets(t *testing.T) {
+	asOf := time.Date(2025, 6, 30, 15, 0, 0, 0, time.UTC)
+	var b AgingBuckets
+	for _, c := range []struct {
+		date   time.Time
+		amount float64
+	}{
+		{asOf, 100},
+		{asOf.AddDate(0, 0, -30), 50},
+		{asOf.AddDate(0, 0, -31), 200},
+		{asOf.AddDate(0, 0, -75), 300},
+		{asOf.AddDate(0, 0, -91), 400.25},
+		{asOf.AddDate(0, 0, 5), 10}, // dated ahead counts as current
+	} {
+		b.Add(c.amount, AgeInDays(c.date, asOf))
+	}
+	want := AgingBuckets{Current: 160, Days31To60: 200, Days61To90: 300, Over90: 400.25, Total: 1060.25}
+	if b != want {
+		t.Errorf("buckets = %+v, want %+v", b, want)
+	}
+
+	var total AgingBuckets
+	total.Merge(b)
+	total.Merge(b)
+	if total.Total != 2120.5 || total.Over90 != 800.5 {
+		t.Errorf("merged = %+v", total)
+	}
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"sort"
+	"time"
+)
+
+// OpenItem is a document with an amount still owing, a credit sale, an invoice or a supply
+type OpenItem struct {
+	ID          string    `json:"id"`
+	Date        time.Time `json:"date"`
+	Outstanding float64   `json:"outstanding"`
+}
+
+// Allocation is the part of a payment applied to one open item
+type Allocation struct {
+	ID     string  `json:"id"`
+	Amount float64 `json:"amount"`
+}
+
+// AllocateOldestFirst applies amount to the open items in date order until it runs out. It returns the
+// allocations made and whatever could not be allocated.
+func AllocateOldestFirst(amount float64, items []OpenItem) ([]Allocation, float64) {
+	sorted := append([]OpenItem(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	allocations := []Allocation{}
+	remaining := round2(amount)
+	for _, item := range sorted {
+		if remaining <= 0 {
+			break
+		}
+		if item.Outstanding <= 0 {
+			continue
+		}
+		applied := item.Outstanding
+		if applied > remaining {
+			applied = remaining
+		}
+		applied = round2(applied)
+		allocations = append(allocations, Allocation{ID: item.ID, Amount: applied})
+		remaining = round2(remaining - applied)
+	}
+	return allocations, remaining
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllocateOldestFirst(t *testing.T) {
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	items := []OpenItem{
+		{ID: "c", Date: day.AddDate(0, 0, 2), Outstanding: 300},
+		{ID: "a", Date: day, Outstanding: 100},
+		{ID: "settled", Date: day, Outstanding: 0},
+		{ID: "b", Date: day.AddDate(0, 0, 1), Outstanding: 250.5},
+	}
+
+	allocations, remaining := AllocateOldestFirst(400, items)
+	if remaining != 0 {
+		t.Fatalf("remaining = %v, want 0", remaining)
+	}
+	want := []Allocation{{ID: "a", Amount: 100}, {ID: "b", Amount: 250.5}, {ID: "c", Amount: 49.5}}
+	if len(allocations) != len(want) {
+		t.Fatalf("allocations = %+v, want %+v", allocations, want)
+	}
+	for i := range want {
+		if allocations[i] != want[i] {
+			t.Errorf("allocation %d = %+v, want %+v", i, allocations[i], want[i])
+		}
+	}
+
+	allocations, remaining = AllocateOldestFirst(1000, items)
+	if remaining != 349.5 || len(allocations) != 3 {
+		t.Errorf("overpayment: allocations = %+v, remaining = %v", allocations, remaining)
+	}
+}
@@ -2,7 +2,9 @@ package services
 
 
 import (
-
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"os"
 	"time"
@@ -17,6 +19,8 @@ type Claims struct {
 	UserID *uuid.UUID `json:"user_id"`
 	FullName	string `json:"full_name"`
 	Role string `json:"role"`
+	StationID uuid.UUID `json:"station_id"`
+	MustChangePassword bool `json:"must_change_password"`
 	jwt.StandardClaims
 }
 //the function loads .env and return the secretKey
@@ -39,8 +43,11 @@ Generates a JWT token
 */
 func GenerateToken(claims Claims,expiration_time time.Duration) (string, error) {
 	my_secret_key := LoadSecretKey()
+	now := time.Now()
 	claims.StandardClaims = jwt.StandardClaims{
-		ExpiresAt: time.Now().Add(expiration_time).Unix(),
+		Id:        uuid.New().String(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(expiration_time).Unix(),
 		Issuer:    "dancan",
 		
 	}
@@ -76,9 +83,26 @@ func ValidateToken(tokenString string)(*Claims,error){
 }
 
 /*
-Invalidates token when logged out
-@params tokenString
+Generates an opaque refresh token
+returns the token handed to the client and the hash that is stored
+*/
+func GenerateRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+/*
+Hashes a refresh token before it is stored or looked up
+@params token
 */
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
 /*
 gets the users id from the token
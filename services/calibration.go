@@ -0,0 +1,111 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CalibrationPoint is one row of a tank strapping chart
+type CalibrationPoint struct {
+	HeightCm float64 `json:"height_cm"`
+	Liters   float64 `json:"liters"`
+}
+
+// ParseCalibrationCSV reads "height_cm,liters" rows. A header row is optional.
+// Rows are sorted by height and must give a volume that never falls as the height rises.
+func ParseCalibrationCSV(r io.Reader) ([]CalibrationPoint, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	var points []CalibrationPoint
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv: %v", err)
+		}
+		line++
+		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected height_cm,liters", line)
+		}
+		height, herr := strconv.ParseFloat(strings.TrimSpace(record[0]), 64)
+		liters, lerr := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if herr != nil || lerr != nil {
+			if line == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("line %d: height and liters must be numbers", line)
+		}
+		if height < 0 || liters < 0 {
+			return nil, fmt.Errorf("line %d: height and liters cannot be negative", line)
+		}
+		points = append(points, CalibrationPoint{HeightCm: height, Liters: liters})
+	}
+	if err := ValidateCalibration(points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// ValidateCalibration sorts the chart by height and checks it can be interpolated
+func ValidateCalibration(points []CalibrationPoint) error {
+	if len(points) < 2 {
+		return errors.New("a calibration chart needs at least two rows")
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].HeightCm < points[j].HeightCm })
+	for i := 1; i < len(points); i++ {
+		if points[i].HeightCm == points[i-1].HeightCm {
+			return fmt.Errorf("height %.2f cm appears more than once", points[i].HeightCm)
+		}
+		if points[i].Liters < points[i-1].Liters {
+			return fmt.Errorf("volume drops from %.2f to %.2f liters at %.2f cm", points[i-1].Liters, points[i].Liters, points[i].HeightCm)
+		}
+	}
+	return nil
+}
+
+// VolumeAtHeight interpolates the volume at a dip height from a chart sorted by height
+func VolumeAtHeight(points []CalibrationPoint, heightCm float64) (float64, error) {
+	if len(points) < 2 {
+		return 0, errors.New("tank has no calibration chart")
+	}
+	first, last := points[0], points[len(points)-1]
+	if heightCm < first.HeightCm || heightCm > last.HeightCm {
+		return 0, fmt.Errorf("dip of %.2f cm is outside the calibration chart (%.2f to %.2f cm)", heightCm, first.HeightCm, last.HeightCm)
+	}
+	i := sort.Search(len(points), func(i int) bool { return points[i].HeightCm >= heightCm })
+	if points[i].HeightCm == heightCm {
+		return points[i].Liters, nil
+	}
+	lo, hi := points[i-1], points[i]
+	return lo.Liters + (hi.Liters-lo.Liters)*(heightCm-lo.HeightCm)/(hi.HeightCm-lo.HeightCm), nil
+}
+
+// HeightAtVolume is the inverse of VolumeAtHeight, used to store the height of dips entered in litres
+func HeightAtVolume(points []CalibrationPoint, liters float64) (float64, error) {
+	if len(points) < 2 {
+		return 0, errors.New("tank has no calibration chart")
+	}
+	first, last := points[0], points[len(points)-1]
+	if liters < first.Liters || liters > last.Liters {
+		return 0, fmt.Errorf("%.2f liters is outside the calibration chart (%.2f to %.2f liters)", liters, first.Liters, last.Liters)
+	}
+	i := sort.Search(len(points), func(i int) bool { return points[i].Liters >= liters })
+	if points[i].Liters == liters || i == 0 {
+		return points[i].HeightCm, nil
+	}
+	lo, hi := points[i-1], points[i]
+	return lo.HeightCm + (hi.HeightCm-lo.HeightCm)*(liters-lo.Liters)/(hi.Liters-lo.Liters), nil
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCalibrationCSV(t *testing.T) {
+	points, err := ParseCalibrationCSV(strings.NewReader("height_cm,liters\n10,500\n0,0\n20,1100\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(points) != 3 || points[0].HeightCm != 0 || points[2].Liters != 1100 {
+		t.Errorf("points = %v", points)
+	}
+
+	if _, err := ParseCalibrationCSV(strings.NewReader("0,0\n10,500\n20,400\n")); err == nil {
+		t.Error("expected error for a falling volume")
+	}
+	if _, err := ParseCalibrationCSV(strings.NewReader("0,0\nten,500\n")); err == nil {
+		t.Error("expected error for a non numeric row")
+	}
+}
+
+func TestVolumeAndHeightInterpolation(t *testing.T) {
+	points := []CalibrationPoint{{0, 0}, {10, 500}, {20, 1100}}
+
+	tests := []struct {
+		height, liters float64
+	}{
+		{0, 0}, {5, 250}, {10, 500}, {15, 800}, {20, 1100},
+	}
+	for _, tt := range tests {
+		got, err := VolumeAtHeight(points, tt.height)
+		if err != nil || !almostEqual(got, tt.liters) {
+			t.Errorf("VolumeAtHeight(%v) = %v, %v want %v", tt.height, got, err, tt.liters)
+		}
+		h, err := HeightAtVolume(points, tt.liters)
+		if err != nil || !almostEqual(h, tt.height) {
+			t.Errorf("HeightAtVolume(%v) = %v, %v want %v", tt.liters, h, err, tt.height)
+		}
+	}
+
+	if _, err := VolumeAtHeight(points, 25); err == nil {
+		t.Error("expected error above the chart")
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// inventory costing methods
+const (
+	CostingFIFO            = "fifo"
+	CostingWeightedAverage = "weighted_average"
+)
+
+// IsValidCostingMethod reports whether method is fifo or weighted_average
+func IsValidCostingMethod(method string) bool {
+	return method == CostingFIFO || method == CostingWeightedAverage
+}
+
+// CostLayer is a quantity still on hand at one unit cost
+type CostLayer struct {
+	Quantity float64   `json:"quantity"`
+	UnitCost float64   `json:"unit_cost"`
+	Date     time.Time `json:"date"`
+}
+
+// Inventory values stock on hand and the cost of what leaves it.
+// FIFO keeps one layer per receipt and consumes the oldest first,
+// weighted average keeps a single layer at the running average cost.
+type Inventory struct {
+	Method       string
+	Layers       []CostLayer
+	lastUnitCost float64
+}
+
+func NewInventory(method string) (*Inventory, error) {
+	if !IsValidCostingMethod(method) {
+		return nil, errors.New("costing method must be fifo or weighted_average")
+	}
+	return &Inventory{Method: method}, nil
+}
+
+// Receive adds quantity at unitCost
+func (inv *Inventory) Receive(quantity, unitCost float64, date time.Time) {
+	if quantity <= 0 {
+		return
+	}
+	inv.lastUnitCost = unitCost
+	if inv.Method == CostingWeightedAverage && len(inv.Layers) > 0 {
+		layer := &inv.Layers[0]
+		total := layer.Quantity*layer.UnitCost + quantity*unitCost
+		layer.Quantity += quantity
+		layer.UnitCost = total / layer.Quantity
+		layer.Date = date
+		return
+	}
+	inv.Layers = append(inv.Layers, CostLayer{Quantity: quantity, UnitCost: unitCost, Date: date})
+}
+
+// Consume removes quantity and returns its cost. Selling more than is on hand
+// is costed at the last known unit cost and reported as the shortfall.
+func (inv *Inventory) Consume(quantity float64) (cost float64, shortfall float64) {
+	remaining := quantity
+	for remaining > 1e-9 && len(inv.Layers) > 0 {
+		layer := &inv.Layers[0]
+		take := math.Min(layer.Quantity, remaining)
+		cost += take * layer.UnitCost
+		inv.lastUnitCost = layer.UnitCost
+		layer.Quantity -= take
+		remaining -= take
+		if layer.Quantity <= 1e-9 {
+			inv.Layers = inv.Layers[1:]
+		}
+	}
+	if remaining > 1e-9 {
+		shortfall = remaining
+		cost += remaining * inv.lastUnitCost
+	}
+	return cost, shortfall
+}
+
+// Quantity is the stock on hand
+func (inv *Inventory) Quantity() float64 {
+	var q float64
+	for _, l := range inv.Layers {
+		q += l.Quantity
+	}
+	return q
+}
+
+// Value is the cost of the stock on hand
+func (inv *Inventory) Value() float64 {
+	var v float64
+	for _, l := range inv.Layers {
+		v += l.Quantity * l.UnitCost
+	}
+	return v
+}
+
+// UnitCost is the average cost of the stock on hand, or the last cost when empty
+func (inv *Inventory) UnitCost() float64 {
+	if q := inv.Quantity(); q > 0 {
+		return inv.Value() / q
+	}
+	return inv.lastUnitCost
+}
+
+// AllocateConsumption decides how much of quantity comes out of each layer without changing them.
+// FIFO drains the oldest layers first, weighted average takes from every layer in proportion
+// so each is consumed at the average cost. Quantity beyond what the layers hold is the shortfall.
+func AllocateConsumption(method string, layers []CostLayer, quantity float64) (takes []float64, cost float64, shortfall float64) {
+	takes = make([]float64, len(layers))
+	var onHand, value float64
+	for _, l := range layers {
+		onHand += l.Quantity
+		value += l.Quantity * l.UnitCost
+	}
+	if quantity <= 0 {
+		return takes, 0, 0
+	}
+
+	if method == CostingWeightedAverage {
+		take := math.Min(quantity, onHand)
+		if onHand > 0 {
+			for i, l := range layers {
+				takes[i] = l.Quantity * take / onHand
+			}
+			cost = take * value / onHand
+		}
+		return takes, cost, quantity - take
+	}
+
+	remaining := quantity
+	for i, l := range layers {
+		if remaining <= 1e-9 {
+			break
+		}
+		take := math.Min(l.Quantity, remaining)
+		takes[i] = take
+		cost += take * l.UnitCost
+		remaining -= take
+	}
+	if remaining < 1e-9 {
+		remaining = 0
+	}
+	return takes, cost, remaining
+}
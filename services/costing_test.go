@@ -0,0 +1,77 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func almostEqual(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+
+func TestInventoryFIFO(t *testing.T) {
+	inv, _ := NewInventory(CostingFIFO)
+	day := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	inv.Receive(1000, 150, day)
+	inv.Receive(1000, 160, day.AddDate(0, 0, 1))
+
+	cost, shortfall := inv.Consume(1500)
+	if !almostEqual(cost, 1000*150+500*160) || shortfall != 0 {
+		t.Errorf("cost = %v shortfall = %v", cost, shortfall)
+	}
+	if !almostEqual(inv.Quantity(), 500) || !almostEqual(inv.Value(), 500*160) {
+		t.Errorf("on hand = %v value = %v", inv.Quantity(), inv.Value())
+	}
+}
+
+func TestInventoryWeightedAverage(t *testing.T) {
+	inv, _ := NewInventory(CostingWeightedAverage)
+	day := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	inv.Receive(1000, 150, day)
+	inv.Receive(1000, 160, day)
+
+	cost, _ := inv.Consume(1500)
+	if !almostEqual(cost, 1500*155) {
+		t.Errorf("cost = %v, want %v", cost, 1500*155.0)
+	}
+	if !almostEqual(inv.UnitCost(), 155) {
+		t.Errorf("unit cost = %v, want 155", inv.UnitCost())
+	}
+}
+
+func TestInventoryShortfall(t *testing.T) {
+	inv, _ := NewInventory(CostingFIFO)
+	inv.Receive(100, 150, time.Now())
+
+	cost, shortfall := inv.Consume(120)
+	if !almostEqual(shortfall, 20) || !almostEqual(cost, 120*150) {
+		t.Errorf("cost = %v shortfall = %v", cost, shortfall)
+	}
+	if inv.Quantity() != 0 {
+		t.Errorf("on hand = %v, want 0", inv.Quantity())
+	}
+}
+
+func TestNewInventoryRejectsUnknownMethod(t *testing.T) {
+	if _, err := NewInventory("lifo"); err == nil {
+		t.Error("expected error for unknown method")
+	}
+}
+
+func TestAllocateConsumption(t *testing.T) {
+	layers := []CostLayer{{Quantity: 1000, UnitCost: 150}, {Quantity: 1000, UnitCost: 160}}
+
+	takes, cost, shortfall := AllocateConsumption(CostingFIFO, layers, 1500)
+	if !almostEqual(takes[0], 1000) || !almostEqual(takes[1], 500) || !almostEqual(cost, 230000) || shortfall != 0 {
+		t.Errorf("fifo takes = %v cost = %v shortfall = %v", takes, cost, shortfall)
+	}
+
+	takes, cost, _ = AllocateConsumption(CostingWeightedAverage, layers, 1000)
+	if !almostEqual(takes[0], 500) || !almostEqual(takes[1], 500) || !almostEqual(cost, 155000) {
+		t.Errorf("weighted average takes = %v cost = %v", takes, cost)
+	}
+
+	_, _, shortfall = AllocateConsumption(CostingFIFO, layers, 2500)
+	if !almostEqual(shortfall, 500) {
+		t.Errorf("shortfall = %v, want 500", shortfall)
+	}
+}
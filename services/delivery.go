@@ -0,0 +1,45 @@
+package services
+
+import "math"
+
+// DefaultDeliveryTolerancePercent is the shortage, as a percentage of the invoiced litres, accepted as normal transit loss
+const DefaultDeliveryTolerancePercent = 0.5
+
+// MaxDeliveryTolerancePercent is the largest tolerance a verification may ask for
+const MaxDeliveryTolerancePercent = 10.0
+
+// DeliveryCheck compares the litres a tank actually gained during an offload with the invoiced quantity
+type DeliveryCheck struct {
+	Invoiced         float64 `json:"invoiced"`
+	Received         float64 `json:"received"`
+	Variance         float64 `json:"variance"` // received - invoiced, negative is a shortage
+	VariancePercent  float64 `json:"variance_percent"`
+	TolerancePercent float64 `json:"tolerance_percent"`
+	Tolerance        float64 `json:"tolerance"` // litres
+	Short            bool    `json:"short"`
+	ClaimQuantity    float64 `json:"claim_quantity"` // litres short beyond the tolerance
+}
+
+// CheckDelivery works out the litres received from the tank volume before and after the offload, adding back
+// litres dispensed from the tank while it was offloading. A delivery is short when the shortage exceeds
+// tolerancePercent of the invoiced quantity, and only the litres beyond the tolerance are claimable.
+func CheckDelivery(invoiced, volumeBefore, volumeAfter, dispensedDuring, tolerancePercent float64) DeliveryCheck {
+	if tolerancePercent < 0 {
+		tolerancePercent = 0
+	}
+	check := DeliveryCheck{
+		Invoiced:         invoiced,
+		Received:         round2(volumeAfter - volumeBefore + dispensedDuring),
+		TolerancePercent: tolerancePercent,
+		Tolerance:        round2(invoiced * tolerancePercent / 100),
+	}
+	check.Variance = round2(check.Received - invoiced)
+	if invoiced > 0 {
+		check.VariancePercent = round2(check.Variance / invoiced * 100)
+	}
+	if shortage := -check.Variance; shortage > check.Tolerance {
+		check.Short = true
+		check.ClaimQuantity = round2(math.Max(shortage-check.Tolerance, 0))
+	}
+	return check
+}
@@ -0,0 +1,24 @@
+package services
+
+import "testing"
+
+func TestCheckDelivery(t *testing.T) {
+	// 10000 invoiced, tank went from 2000 to 11850 while 50 litres were sold: 9900 received
+	check := CheckDelivery(10000, 2000, 11850, 50, 0.5)
+	if check.Received != 9900 || check.Variance != -100 || check.VariancePercent != -1 {
+		t.Fatalf("received/variance/percent = %v/%v/%v, want 9900/-100/-1", check.Received, check.Variance, check.VariancePercent)
+	}
+	if !check.Short || check.ClaimQuantity != 50 {
+		t.Fatalf("short/claim = %v/%v, want true/50", check.Short, check.ClaimQuantity)
+	}
+
+	check = CheckDelivery(10000, 2000, 11970, 0, 0.5)
+	if check.Short || check.ClaimQuantity != 0 {
+		t.Fatalf("30 litres short is within tolerance, got short=%v claim=%v", check.Short, check.ClaimQuantity)
+	}
+
+	check = CheckDelivery(10000, 2000, 12100, 0, 0.5)
+	if check.Short || check.Variance != 100 {
+		t.Fatalf("over delivery should not be short, got short=%v variance=%v", check.Short, check.Variance)
+	}
+}
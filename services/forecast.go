@@ -0,0 +1,181 @@
+package services
+
+import (
+	"math"
+	"time"
+)
+
+// forecast defaults
+const (
+	DefaultForecastWindow  = 28 // days of history averaged
+	DefaultForecastHorizon = 14 // days projected ahead
+	DefaultLeadTimeDays    = 1  // days between placing an order and delivery
+)
+
+// minimum samples of a weekday before its own seasonal factor is trusted
+const minWeekdaySamples = 2
+
+// DailyUsage is the litres drawn from a tank on one business day
+type DailyUsage struct {
+	Day    time.Time `json:"day"`
+	Liters float64   `json:"liters"`
+}
+
+// ForecastParams tunes ForecastTank, zero values fall back to the defaults
+type ForecastParams struct {
+	Window       int `json:"window"`
+	Horizon      int `json:"horizon"`
+	LeadTimeDays int `json:"lead_time_days"`
+}
+
+func (p ForecastParams) withDefaults() ForecastParams {
+	if p.Window <= 0 {
+		p.Window = DefaultForecastWindow
+	}
+	if p.Horizon <= 0 {
+		p.Horizon = DefaultForecastHorizon
+	}
+	if p.LeadTimeDays < 0 {
+		p.LeadTimeDays = 0
+	}
+	return p
+}
+
+// DayForecast is the expected consumption of one day and the stock left at its close without new deliveries
+type DayForecast struct {
+	Date         time.Time `json:"date"`
+	Liters       float64   `json:"liters"`
+	ClosingStock float64   `json:"closing_stock"`
+}
+
+// Forecast is the projected consumption of a tank and the order that keeps it supplied
+type Forecast struct {
+	HistoryDays    int           `json:"history_days"`
+	AverageDaily   float64       `json:"average_daily"`
+	WeekdayFactors [7]float64    `json:"weekday_factors"` // indexed by time.Weekday, Sunday first
+	Days           []DayForecast `json:"days"`
+
+	// DaysOfCover is nil when no consumption is expected
+	DaysOfCover  *float64   `json:"days_of_cover"`
+	StockoutDate *time.Time `json:"stockout_date"`
+
+	// the suggestion is empty when stock stays above the reorder level over the horizon
+	SuggestedOrderDate     *time.Time `json:"suggested_order_date"`
+	SuggestedDeliveryDate  *time.Time `json:"suggested_delivery_date"`
+	SuggestedOrderQuantity float64    `json:"suggested_order_quantity"`
+	Urgent                 bool       `json:"urgent"` // the order should already have been placed to arrive in time
+}
+
+// ForecastTank predicts daily consumption from today onwards as a moving average of the last
+// params.Window days before today, scaled by a day-of-week factor, and runs the tank's stock down
+// against it. Days inside the window after the first recorded day with no usage count as zero.
+//
+// An order is suggested to arrive on the first day the stock would otherwise close at or below the
+// reorder level (or run dry when none is set), sized to fill the tank up to its high level.
+func ForecastTank(history []DailyUsage, today time.Time, level TankLevel, params ForecastParams) Forecast {
+	params = params.withDefaults()
+	today = dayOf(today)
+
+	usage := map[time.Time]float64{}
+	var first time.Time
+	for _, h := range history {
+		day := dayOf(h.Day)
+		if !day.Before(today) {
+			continue
+		}
+		usage[day] += h.Liters
+		if first.IsZero() || day.Before(first) {
+			first = day
+		}
+	}
+
+	forecast := Forecast{}
+	for i := range forecast.WeekdayFactors {
+		forecast.WeekdayFactors[i] = 1
+	}
+
+	start := today.AddDate(0, 0, -params.Window)
+	if !first.IsZero() && first.After(start) {
+		start = first
+	}
+	var total float64
+	var weekdayTotal [7]float64
+	var weekdayCount [7]int
+	if !first.IsZero() {
+		for day := start; day.Before(today); day = day.AddDate(0, 0, 1) {
+			total += usage[day]
+			weekdayTotal[day.Weekday()] += usage[day]
+			weekdayCount[day.Weekday()]++
+			forecast.HistoryDays++
+		}
+	}
+	if forecast.HistoryDays > 0 {
+		forecast.AverageDaily = total / float64(forecast.HistoryDays)
+	}
+	if forecast.AverageDaily > 0 {
+		for i := range forecast.WeekdayFactors {
+			if weekdayCount[i] >= minWeekdaySamples {
+				forecast.WeekdayFactors[i] = weekdayTotal[i] / float64(weekdayCount[i]) / forecast.AverageDaily
+			}
+		}
+	}
+
+	// run the stock down over the horizon
+	stock := level.Volume
+	trigger := level.ReorderLevel
+	deliveryIndex := -1
+	for i := 0; i < params.Horizon; i++ {
+		date := today.AddDate(0, 0, i)
+		liters := forecast.AverageDaily * forecast.WeekdayFactors[date.Weekday()]
+		if forecast.DaysOfCover == nil && liters > 0 && stock-liters < 0 {
+			cover := float64(i) + math.Max(stock, 0)/liters
+			forecast.DaysOfCover = &cover
+		}
+		stock -= liters
+		if deliveryIndex < 0 && liters > 0 && stock <= trigger {
+			deliveryIndex = i
+		}
+		forecast.Days = append(forecast.Days, DayForecast{Date: date, Liters: round2(liters), ClosingStock: round2(stock)})
+	}
+	if forecast.DaysOfCover == nil && forecast.AverageDaily > 0 {
+		// still in stock at the end of the horizon, extrapolate at the average rate
+		cover := float64(params.Horizon) + math.Max(stock, 0)/forecast.AverageDaily
+		forecast.DaysOfCover = &cover
+	}
+	if forecast.DaysOfCover != nil {
+		rounded := round2(*forecast.DaysOfCover)
+		forecast.DaysOfCover = &rounded
+		stockout := today.AddDate(0, 0, int(rounded))
+		forecast.StockoutDate = &stockout
+	}
+
+	if deliveryIndex < 0 {
+		return forecast
+	}
+	delivery := today.AddDate(0, 0, deliveryIndex)
+	order := delivery.AddDate(0, 0, -params.LeadTimeDays)
+	if order.Before(today) {
+		order = today
+		forecast.Urgent = true
+	}
+	forecast.SuggestedOrderDate = &order
+	forecast.SuggestedDeliveryDate = &delivery
+
+	// fill up to the high level from the stock opening the delivery day
+	opening := level.Volume
+	if deliveryIndex > 0 {
+		opening = forecast.Days[deliveryIndex-1].ClosingStock
+	}
+	if level.Capacity > 0 {
+		forecast.SuggestedOrderQuantity = math.Max(math.Floor(level.HighLevel-math.Max(opening, 0)), 0)
+	}
+	return forecast
+}
+
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestForecastTankWeekdaySeasonality(t *testing.T) {
+	// four weeks of 1000 litres a day, 2000 on Saturdays
+	today := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC) // Monday
+	var history []DailyUsage
+	for i := 1; i <= 28; i++ {
+		day := today.AddDate(0, 0, -i)
+		liters := 1000.0
+		if day.Weekday() == time.Saturday {
+			liters = 2000
+		}
+		history = append(history, DailyUsage{Day: day, Liters: liters})
+	}
+
+	level := EvaluateTankLevel(20000, 3000, 19000, 9000)
+	forecast := ForecastTank(history, today, level, ForecastParams{Horizon: 7, LeadTimeDays: 2})
+
+	if forecast.HistoryDays != 28 {
+		t.Fatalf("history days = %d, want 28", forecast.HistoryDays)
+	}
+	if !almostEqual(forecast.AverageDaily, 8000.0/7) {
+		t.Fatalf("average = %v, want %v", forecast.AverageDaily, 8000.0/7)
+	}
+	if !almostEqual(forecast.Days[5].Liters, 2000) { // Saturday
+		t.Fatalf("saturday forecast = %v, want 2000", forecast.Days[5].Liters)
+	}
+	if !almostEqual(forecast.Days[0].Liters, 1000) {
+		t.Fatalf("monday forecast = %v, want 1000", forecast.Days[0].Liters)
+	}
+
+	// Mon-Fri draw 5000, Saturday 2000 leaves 2000 <= reorder level 3000 on Saturday
+	if forecast.SuggestedDeliveryDate == nil || !forecast.SuggestedDeliveryDate.Equal(today.AddDate(0, 0, 5)) {
+		t.Fatalf("delivery date = %v, want saturday", forecast.SuggestedDeliveryDate)
+	}
+	if !forecast.SuggestedOrderDate.Equal(today.AddDate(0, 0, 3)) || forecast.Urgent {
+		t.Fatalf("order date = %v urgent %v, want thursday", forecast.SuggestedOrderDate, forecast.Urgent)
+	}
+	if forecast.SuggestedOrderQuantity != 15000 { // fill 4000 on hand up to the 19000 high level
+		t.Fatalf("order quantity = %v, want 15000", forecast.SuggestedOrderQuantity)
+	}
+	if forecast.DaysOfCover == nil {
+		t.Fatal("expected days of cover")
+	}
+	if *forecast.DaysOfCover != 7.88 { // 1000 left after a week at 8000/7 a day
+		t.Fatalf("days of cover = %v, want 7.88", *forecast.DaysOfCover)
+	}
+}
+
+func TestForecastTankWithoutHistory(t *testing.T) {
+	level := EvaluateTankLevel(20000, 3000, 0, 9000)
+	forecast := ForecastTank(nil, time.Now(), level, ForecastParams{})
+	if forecast.DaysOfCover != nil || forecast.SuggestedOrderDate != nil {
+		t.Fatalf("expected no cover or order without history, got %+v", forecast)
+	}
+	if len(forecast.Days) != DefaultForecastHorizon {
+		t.Fatalf("days = %d, want %d", len(forecast.Days), DefaultForecastHorizon)
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LoginAttemptState is the failed attempt counter kept per account or per IP
+type LoginAttemptState struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// AttemptStore persists attempt counters. MemoryAttemptStore is used in tests,
+// production plugs in a database or cache backed store.
+type AttemptStore interface {
+	Get(key string) (*LoginAttemptState, error)
+	Save(key string, state *LoginAttemptState) error
+	Reset(key string) error
+}
+
+// MemoryAttemptStore keeps attempt counters in process memory
+type MemoryAttemptStore struct {
+	mu     sync.Mutex
+	states map[string]LoginAttemptState
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{states: map[string]LoginAttemptState{}}
+}
+
+func (m *MemoryAttemptStore) Get(key string) (*LoginAttemptState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state := m.states[key]
+	return &state, nil
+}
+
+func (m *MemoryAttemptStore) Save(key string, state *LoginAttemptState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[key] = *state
+	return nil
+}
+
+func (m *MemoryAttemptStore) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, key)
+	return nil
+}
+
+// LoginLimiter locks an account or IP after too many failed logins.
+// Every failure past the threshold doubles the lockout up to MaxLockout.
+type LoginLimiter struct {
+	Store          AttemptStore
+	MaxAccountFail int
+	MaxIPFail      int
+	BaseLockout    time.Duration
+	MaxLockout     time.Duration
+	Window         time.Duration // failures older than this are forgotten
+	Now            func() time.Time
+}
+
+func NewLoginLimiter(store AttemptStore) *LoginLimiter {
+	return &LoginLimiter{
+		Store:          store,
+		MaxAccountFail: 5,
+		MaxIPFail:      20,
+		BaseLockout:    time.Minute,
+		MaxLockout:     time.Hour,
+		Window:         15 * time.Minute,
+		Now:            time.Now,
+	}
+}
+
+func AccountKey(email string) string { return "account:" + email }
+func IPKey(ip string) string         { return "ip:" + ip }
+
+// LockedError is returned while an account or IP is locked out
+type LockedError struct {
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// Check returns a LockedError if either the account or the IP is locked
+func (l *LoginLimiter) Check(email, ip string) error {
+	for _, key := range []string{AccountKey(email), IPKey(ip)} {
+		state, err := l.Store.Get(key)
+		if err != nil {
+			return err
+		}
+		if remaining := state.LockedUntil.Sub(l.Now()); remaining > 0 {
+			return &LockedError{Key: key, RetryAfter: remaining}
+		}
+	}
+	return nil
+}
+
+// RegisterFailure counts a failed login for the account and IP and locks them when over the limit
+func (l *LoginLimiter) RegisterFailure(email, ip string) error {
+	if err := l.fail(AccountKey(email), l.MaxAccountFail); err != nil {
+		return err
+	}
+	return l.fail(IPKey(ip), l.MaxIPFail)
+}
+
+// RegisterSuccess clears the account counter. The IP counter is left to expire
+// so one valid login cannot hide a spray across many accounts.
+func (l *LoginLimiter) RegisterSuccess(email string) error {
+	return l.Store.Reset(AccountKey(email))
+}
+
+// Unlock clears the counter for a key, used by the admin unlock endpoint
+func (l *LoginLimiter) Unlock(key string) error {
+	return l.Store.Reset(key)
+}
+
+func (l *LoginLimiter) fail(key string, max int) error {
+	now := l.Now()
+	state, err := l.Store.Get(key)
+	if err != nil {
+		return err
+	}
+	if !state.LastFailure.IsZero() && now.Sub(state.LastFailure) > l.Window && now.After(state.LockedUntil) {
+		state.Failures = 0
+	}
+	state.Failures++
+	state.LastFailure = now
+	if state.Failures >= max {
+		state.LockedUntil = now.Add(l.lockoutFor(state.Failures - max))
+	}
+	return l.Store.Save(key, state)
+}
+
+// lockoutFor doubles the base lockout for every failure past the threshold
+func (l *LoginLimiter) lockoutFor(extraFailures int) time.Duration {
+	lockout := l.BaseLockout
+	for i := 0; i < extraFailures; i++ {
+		lockout *= 2
+		if lockout >= l.MaxLockout {
+			return l.MaxLockout
+		}
+	}
+	return lockout
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(now *time.Time) *LoginLimiter {
+	l := NewLoginLimiter(NewMemoryAttemptStore())
+	l.MaxAccountFail = 3
+	l.MaxIPFail = 5
+	l.Now = func() time.Time { return *now }
+	return l
+}
+
+func TestLoginLimiterLocksAccount(t *testing.T) {
+	now := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	l := newTestLimiter(&now)
+
+	for i := 0; i < 2; i++ {
+		l.RegisterFailure("a@safa.co", "10.0.0.1")
+	}
+	if err := l.Check("a@safa.co", "10.0.0.1"); err != nil {
+		t.Fatalf("expected no lock after 2 failures, got %v", err)
+	}
+
+	l.RegisterFailure("a@safa.co", "10.0.0.1")
+	var locked *LockedError
+	if err := l.Check("a@safa.co", "10.0.0.1"); !errors.As(err, &locked) {
+		t.Fatalf("expected account to be locked, got %v", err)
+	}
+	if locked.RetryAfter != time.Minute {
+		t.Errorf("RetryAfter = %v, want %v", locked.RetryAfter, time.Minute)
+	}
+
+	now = now.Add(time.Minute + time.Second)
+	if err := l.Check("a@safa.co", "10.0.0.1"); err != nil {
+		t.Errorf("expected lock to expire, got %v", err)
+	}
+}
+
+func TestLoginLimiterProgressiveLockout(t *testing.T) {
+	now := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	l := newTestLimiter(&now)
+
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute}
+	for i := 0; i < 2; i++ {
+		l.RegisterFailure("a@safa.co", "10.0.0.1")
+	}
+	for _, want := range expected {
+		l.RegisterFailure("a@safa.co", "10.0.0.2")
+		state, _ := l.Store.Get(AccountKey("a@safa.co"))
+		if got := state.LockedUntil.Sub(now); got != want {
+			t.Errorf("lockout = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestLoginLimiterLocksIPAcrossAccounts(t *testing.T) {
+	now := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	l := newTestLimiter(&now)
+
+	for _, email := range []string{"a@safa.co", "b@safa.co", "c@safa.co", "d@safa.co", "e@safa.co"} {
+		l.RegisterFailure(email, "10.0.0.9")
+	}
+	if err := l.Check("f@safa.co", "10.0.0.9"); err == nil {
+		t.Errorf("expected IP to be locked")
+	}
+	if err := l.Check("f@safa.co", "10.0.0.10"); err != nil {
+		t.Errorf("expected other IP to be allowed, got %v", err)
+	}
+}
+
+func TestLoginLimiterSuccessAndUnlock(t *testing.T) {
+	now := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	l := newTestLimiter(&now)
+
+	l.RegisterFailure("a@safa.co", "10.0.0.1")
+	l.RegisterFailure("a@safa.co", "10.0.0.1")
+	l.RegisterSuccess("a@safa.co")
+	l.RegisterFailure("a@safa.co", "10.0.0.1")
+	if err := l.Check("a@safa.co", "10.0.0.1"); err != nil {
+		t.Errorf("success should reset the account counter, got %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		l.RegisterFailure("b@safa.co", "10.0.0.3")
+	}
+	l.Unlock(AccountKey("b@safa.co"))
+	if err := l.Check("b@safa.co", "10.0.0.3"); err != nil {
+		t.Errorf("expected unlock to clear the lock, got %v", err)
+	}
+}
+
+func TestLoginLimiterForgetsOldFailures(t *testing.T) {
+	now := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	l := newTestLimiter(&now)
+
+	l.RegisterFailure("a@safa.co", "10.0.0.1")
+	l.RegisterFailure("a@safa.co", "10.0.0.1")
+	now = now.Add(l.Window + time.Minute)
+	l.RegisterFailure("a@safa.co", "10.0.0.1")
+	if err := l.Check("a@safa.co", "10.0.0.1"); err != nil {
+		t.Errorf("failures outside the window should not count, got %v", err)
+	}
+}
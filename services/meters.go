@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// MeterTolerance absorbs rounding when comparing totalizer readings
+const MeterTolerance = 0.01
+
+// meter continuity issue types
+const (
+	MeterGap     = "gap"     // the meter moved between readings without being recorded
+	MeterOverlap = "overlap" // a reading opened below where the previous one closed, litres counted twice
+	MeterReset   = "reset"   // the chain was legitimately broken by a reset or replacement
+)
+
+// MeterDispensed returns the litres between two totalizer readings. A closing reading below the opening is
+// only accepted as a rollover when the pump has a rollover limit, the value at which its totalizer wraps to zero.
+func MeterDispensed(opening, closing, rolloverLimit float64) (liters float64, rolledOver bool, err error) {
+	if opening < 0 || closing < 0 {
+		return 0, false, errors.New("meter readings cannot be negative")
+	}
+	if rolloverLimit > 0 && (opening > rolloverLimit || closing > rolloverLimit) {
+		return 0, false, fmt.Errorf("meter readings cannot exceed the pump's rollover limit of %.2f", rolloverLimit)
+	}
+	if closing >= opening {
+		return round2(closing - opening), false, nil
+	}
+	if rolloverLimit <= 0 {
+		return 0, false, fmt.Errorf("closing meter %.2f is below opening meter %.2f", closing, opening)
+	}
+	return round2(rolloverLimit - opening + closing), true, nil
+}
+
+// MeterReading is one reading in a pump's totalizer chain
+type MeterReading struct {
+	ID           string    `json:"id"`
+	RecordedAt   time.Time `json:"recorded_at"`
+	OpeningMeter float64   `json:"opening_meter"`
+	ClosingMeter float64   `json:"closing_meter"`
+}
+
+// MeterResetEvent breaks the chain: readings after it continue from NewOpeningMeter
+type MeterResetEvent struct {
+	ID              string    `json:"id"`
+	ResetAt         time.Time `json:"reset_at"`
+	OldClosingMeter float64   `json:"old_closing_meter"`
+	NewOpeningMeter float64   `json:"new_opening_meter"`
+}
+
+// MeterIssue is a break in a pump's reading chain
+type MeterIssue struct {
+	Type            string    `json:"type"`
+	At              time.Time `json:"at"`
+	ReadingID       string    `json:"reading_id,omitempty"`
+	PreviousID      string    `json:"previous_id,omitempty"`
+	ResetID         string    `json:"reset_id,omitempty"`
+	ExpectedOpening float64   `json:"expected_opening"`
+	ActualOpening   float64   `json:"actual_opening"`
+	Liters          float64   `json:"liters"` // unrecorded litres for a gap, double counted for an overlap
+}
+
+// ExpectedOpening is where the next reading should open: the previous closing meter, or the new meter
+// of a reset recorded after it
+func ExpectedOpening(previousClosing float64, reset *MeterResetEvent) float64 {
+	if reset != nil {
+		return reset.NewOpeningMeter
+	}
+	return previousClosing
+}
+
+// CheckMeterContinuity walks readings in the order they were recorded and reports every place an opening
+// meter does not continue from the previous closing meter, or from a reset in between. Litres a reset shows
+// were dispensed after the last reading but before the reset are reported as a gap on the reset.
+// rolloverLimit lets a chain wrap around, a gap is measured across the wrap.
+func CheckMeterContinuity(readings []MeterReading, resets []MeterResetEvent, rolloverLimit float64) []MeterIssue {
+	issues := []MeterIssue{}
+	r := 0
+	var previous *MeterReading
+	for i := range readings {
+		reading := readings[i]
+
+		var reset *MeterResetEvent
+		for r < len(resets) && !resets[r].ResetAt.After(reading.RecordedAt) {
+			reset = &resets[r]
+			if previous != nil && resets[r].ResetAt.After(previous.RecordedAt) {
+				issue := MeterIssue{Type: MeterReset, At: reset.ResetAt, ResetID: reset.ID, PreviousID: previous.ID,
+					ExpectedOpening: previous.ClosingMeter, ActualOpening: reset.NewOpeningMeter}
+				if unrecorded := reset.OldClosingMeter - previous.ClosingMeter; unrecorded > MeterTolerance {
+					issue.Liters = round2(unrecorded)
+				}
+				issues = append(issues, issue)
+			} else if previous != nil {
+				reset = nil // the reset predates the previous reading, which already continued from it
+			}
+			r++
+		}
+		if previous == nil {
+			previous = &readings[i]
+			continue
+		}
+
+		expected := ExpectedOpening(previous.ClosingMeter, reset)
+		diff := reading.OpeningMeter - expected
+		if math.Abs(diff) > MeterTolerance {
+			issue := MeterIssue{At: reading.RecordedAt, ReadingID: reading.ID, PreviousID: previous.ID,
+				ExpectedOpening: expected, ActualOpening: reading.OpeningMeter}
+			if diff > 0 {
+				issue.Type = MeterGap
+				issue.Liters = round2(diff)
+			} else if rolloverLimit > 0 && expected-reading.OpeningMeter > rolloverLimit/2 {
+				// the totalizer wrapped between the readings
+				issue.Type = MeterGap
+				issue.Liters = round2(rolloverLimit - expected + reading.OpeningMeter)
+			} else {
+				issue.Type = MeterOverlap
+				issue.Liters = round2(-diff)
+			}
+			issues = append(issues, issue)
+		}
+		previous = &readings[i]
+	}
+	return issues
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMeterDispensed(t *testing.T) {
+	if liters, rolled, err := MeterDispensed(100, 350.5, 0); err != nil || rolled || liters != 250.5 {
+		t.Fatalf("got %v %v %v, want 250.5 false nil", liters, rolled, err)
+	}
+	if liters, rolled, err := MeterDispensed(999900, 150, 1000000); err != nil || !rolled || liters != 250 {
+		t.Fatalf("rollover got %v %v %v, want 250 true nil", liters, rolled, err)
+	}
+	if _, _, err := MeterDispensed(500, 100, 0); err == nil {
+		t.Fatal("expected an error for a backwards meter without a rollover limit")
+	}
+}
+
+func TestCheckMeterContinuity(t *testing.T) {
+	day := time.Date(2026, 5, 1, 6, 0, 0, 0, time.UTC)
+	at := func(h int) time.Time { return day.Add(time.Duration(h) * time.Hour) }
+
+	readings := []MeterReading{
+		{ID: "a", RecordedAt: at(0), OpeningMeter: 1000, ClosingMeter: 1500},
+		{ID: "b", RecordedAt: at(8), OpeningMeter: 1520, ClosingMeter: 2000},  // 20 litre gap
+		{ID: "c", RecordedAt: at(16), OpeningMeter: 1990, ClosingMeter: 2400}, // 10 litre overlap
+		{ID: "d", RecordedAt: at(30), OpeningMeter: 0, ClosingMeter: 300},     // after a replacement
+	}
+	resets := []MeterResetEvent{{ID: "r", ResetAt: at(20), OldClosingMeter: 2450, NewOpeningMeter: 0}}
+
+	issues := CheckMeterContinuity(readings, resets, 0)
+	if len(issues) != 3 {
+		t.Fatalf("issues = %+v, want 3", issues)
+	}
+	if issues[0].Type != MeterGap || issues[0].Liters != 20 || issues[0].ReadingID != "b" {
+		t.Fatalf("first issue = %+v, want 20 litre gap on b", issues[0])
+	}
+	if issues[1].Type != MeterOverlap || issues[1].Liters != 10 {
+		t.Fatalf("second issue = %+v, want 10 litre overlap", issues[1])
+	}
+	if issues[2].Type != MeterReset || issues[2].Liters != 50 {
+		t.Fatalf("third issue = %+v, want reset with 50 unrecorded litres", issues[2])
+	}
+}
@@ -0,0 +1,103 @@
+package services
+
+import "strings"
+
+// roles an employee can hold
+const (
+	RoleAdmin            = "admin"
+	RoleManager          = "manager"
+	RoleStationAttendant = "station_attendant"
+	RoleAccountant       = "accountant"
+	RoleEmployee         = "employee" // legacy default role, treated like an attendant
+)
+
+// permission actions, a permission is written as "<resource>:<action>"
+const (
+	ActionRead  = "read"
+	ActionWrite = "write"
+)
+
+// wildcard permission that grants everything
+const AllPermissions = "*"
+
+// RolePermissions maps every named role to the permissions it holds.
+// A permission of "<resource>:*" grants every action on that resource.
+var RolePermissions = map[string][]string{
+	RoleAdmin: {AllPermissions},
+	RoleManager: {
+		"stations:read", "tanks:*", "pumps:*", "nozzles:*", "dippings:*",
+		"sales:*", "pump_readings:*", "expenses:*", "employees:*",
+		"salary_advances:*", "daily_accounts:*", "fuel_prices:*",
+		"fuel_products:read", "supplies:*", "suppliers:read",
+		"supplier_debts:read", "stock:read", "payments:read", "shifts:*",
+		"cash_ups:*", "periods:read", "periods:write", "reports:read",
+		"alerts:*", "purchase_orders:*", "customers:*",
+	},
+	RoleAccountant: {
+		"stations:read", "tanks:read", "pumps:read", "nozzles:read",
+		"dippings:read", "sales:read", "pump_readings:read", "employees:read",
+		"fuel_products:read", "fuel_prices:read", "stock:read",
+		"expenses:*", "payments:*", "salary_advances:*", "daily_accounts:*",
+		"suppliers:*", "supplies:*", "supplier_debts:*", "supplier_payments:*",
+		"audit:read", "shifts:read", "cash_ups:*",
+		"periods:read", "periods:write", "ledger:read", "reports:read",
+		"alerts:read", "purchase_orders:*", "customers:*",
+	},
+	RoleStationAttendant: {
+		"stations:read", "tanks:read", "pumps:read", "nozzles:read",
+		"fuel_products:read", "fuel_prices:read", "stock:read", "sales:read",
+		"pump_readings:*", "dippings:*", "shifts:read", "alerts:read",
+	},
+}
+
+func init() {
+	RolePermissions[RoleEmployee] = RolePermissions[RoleStationAttendant]
+}
+
+// HasPermission reports whether the role holds the given permission
+func HasPermission(role, permission string) bool {
+	resource, _, _ := strings.Cut(permission, ":")
+	for _, p := range RolePermissions[role] {
+		if p == AllPermissions || p == permission || p == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidRole reports whether the role is one of the named roles
+func IsValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// CanAssignRole reports whether a user holding actor may give an employee role, or act on an employee who
+// already holds it. Only admins hand out the admin and accountant roles.
+func CanAssignRole(actor, role string) bool {
+	if actor == RoleAdmin {
+		return true
+	}
+	switch role {
+	case RoleAdmin, RoleAccountant:
+		return false
+	}
+	return true
+}
+
+// IsStationScoped reports whether the role may only see data of its own station
+func IsStationScoped(role string) bool {
+	switch role {
+	case RoleAdmin, RoleAccountant:
+		return false
+	}
+	return true
+}
+
+// ActionForMethod maps an HTTP method to the action it performs
+func ActionForMethod(method string) string {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return ActionRead
+	}
+	return ActionWrite
+}
@@ -0,0 +1,58 @@
+package services
+
+import "testing"
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       string
+		permission string
+		expected   bool
+	}{
+		{"Admin has everything", RoleAdmin, "stations:write", true},
+		{"Manager reads stations", RoleManager, "stations:read", true},
+		{"Manager cannot create stations", RoleManager, "stations:write", false},
+		{"Manager wildcard resource", RoleManager, "expenses:write", true},
+		{"Accountant records supplier payments", RoleAccountant, "supplier_payments:write", true},
+		{"Attendant cannot delete suppliers", RoleStationAttendant, "suppliers:write", false},
+		{"Legacy employee role acts as attendant", RoleEmployee, "pump_readings:write", true},
+		{"Unknown role has nothing", "guest", "stations:read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasPermission(tt.role, tt.permission); got != tt.expected {
+				t.Errorf("HasPermission(%q, %q) = %v, want %v", tt.role, tt.permission, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsStationScoped(t *testing.T) {
+	if IsStationScoped(RoleAdmin) || IsStationScoped(RoleAccountant) {
+		t.Errorf("admin and accountant must not be station scoped")
+	}
+	if !IsStationScoped(RoleManager) || !IsStationScoped(RoleStationAttendant) {
+		t.Errorf("manager and attendant must be station scoped")
+	}
+}
+
+func TestCanAssignRole(t *testing.T) {
+	tests := []struct {
+		actor, role string
+		expected    bool
+	}{
+		{RoleAdmin, RoleAdmin, true},
+		{RoleAdmin, RoleAccountant, true},
+		{RoleManager, RoleStationAttendant, true},
+		{RoleManager, RoleManager, true},
+		{RoleManager, RoleAdmin, false},
+		{RoleManager, RoleAccountant, false},
+		{RoleAccountant, RoleAdmin, false},
+	}
+	for _, tt := range tests {
+		if got := CanAssignRole(tt.actor, tt.role); got != tt.expected {
+			t.Errorf("CanAssignRole(%q, %q) = %v, want %v", tt.actor, tt.role, got, tt.expected)
+		}
+	}
+}
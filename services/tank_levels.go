@@ -0,0 +1,61 @@
+package services
+
+// stock alert types
+const (
+	AlertLowStock = "low_stock"
+	AlertOverfill = "overfill"
+)
+
+// DefaultHighLevelPercent is the fill level that raises an overfill alert when a tank has no high level set
+const DefaultHighLevelPercent = 95.0
+
+// TankLevel describes how full a tank is against its capacity and thresholds
+type TankLevel struct {
+	Capacity     float64 `json:"capacity"`
+	Volume       float64 `json:"volume"`
+	Ullage       float64 `json:"ullage"`
+	FillPercent  float64 `json:"fill_percent"`
+	ReorderLevel float64 `json:"reorder_level"`
+	HighLevel    float64 `json:"high_level"`
+	BelowReorder bool    `json:"below_reorder"`
+	AboveHigh    bool    `json:"above_high"`
+}
+
+// EvaluateTankLevel works out ullage, fill percentage and threshold breaches for a tank holding volume litres.
+// A reorder level of zero disables the low stock check and a high level of zero falls back to
+// DefaultHighLevelPercent of capacity.
+func EvaluateTankLevel(capacity, reorderLevel, highLevel, volume float64) TankLevel {
+	level := TankLevel{
+		Capacity:     capacity,
+		Volume:       volume,
+		ReorderLevel: reorderLevel,
+		HighLevel:    highLevel,
+	}
+	if capacity <= 0 {
+		level.BelowReorder = reorderLevel > 0 && volume <= reorderLevel
+		return level
+	}
+	if level.HighLevel <= 0 || level.HighLevel > capacity {
+		level.HighLevel = capacity * DefaultHighLevelPercent / 100
+	}
+	level.Ullage = capacity - volume
+	if level.Ullage < 0 {
+		level.Ullage = 0
+	}
+	level.FillPercent = volume / capacity * 100
+	level.BelowReorder = reorderLevel > 0 && volume <= reorderLevel
+	level.AboveHigh = volume >= level.HighLevel
+	return level
+}
+
+// Alerts lists the alert types the level currently breaches
+func (l TankLevel) Alerts() []string {
+	var alerts []string
+	if l.BelowReorder {
+		alerts = append(alerts, AlertLowStock)
+	}
+	if l.AboveHigh {
+		alerts = append(alerts, AlertOverfill)
+	}
+	return alerts
+}
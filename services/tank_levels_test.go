@@ -0,0 +1,26 @@
+package services
+
+import "testing"
+
+func TestEvaluateTankLevel(t *testing.T) {
+	level := EvaluateTankLevel(10000, 2000, 0, 1500)
+	if level.Ullage != 8500 || level.FillPercent != 15 {
+		t.Fatalf("ullage/fill = %v/%v, want 8500/15", level.Ullage, level.FillPercent)
+	}
+	if level.HighLevel != 9500 {
+		t.Fatalf("default high level = %v, want 9500", level.HighLevel)
+	}
+	if alerts := level.Alerts(); len(alerts) != 1 || alerts[0] != AlertLowStock {
+		t.Fatalf("alerts = %v, want [low_stock]", alerts)
+	}
+
+	level = EvaluateTankLevel(10000, 2000, 9000, 9200)
+	if alerts := level.Alerts(); len(alerts) != 1 || alerts[0] != AlertOverfill {
+		t.Fatalf("alerts = %v, want [overfill]", alerts)
+	}
+
+	level = EvaluateTankLevel(10000, 0, 0, 0)
+	if len(level.Alerts()) != 0 {
+		t.Fatalf("empty tank without reorder level should not alert, got %v", level.Alerts())
+	}
+}
@@ -23,3 +23,20 @@ func ValidatePhoneNumber(phone string) bool {
 	}
 	return true
 }
+
+// ValidatePassword requires at least 8 characters with a letter and a digit
+func ValidatePassword(password string) bool {
+	if len(password) < 8 || len(password) > 72 {
+		return false
+	}
+	var hasLetter, hasDigit bool
+	for _, char := range password {
+		switch {
+		case char >= '0' && char <= '9':
+			hasDigit = true
+		case (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z'):
+			hasLetter = true
+		}
+	}
+	return hasLetter && hasDigit
+}